@@ -0,0 +1,168 @@
+package gocqlxmock
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// SchemaAgreementOptions configures the simulation of schema propagation of
+// a SessionxMock.
+type SchemaAgreementOptions struct {
+	// Polls is the number of polls of AwaitSchemaAgreement that find the
+	// schema in disagreement after a DDL statement.
+	Polls int
+	// Delay is how long the schema stays in disagreement after a DDL
+	// statement.
+	Delay time.Duration
+	// PollInterval is how long AwaitSchemaAgreement waits between polls.
+	// Without one, it polls again as soon as the schema may agree.
+	PollInterval time.Duration
+}
+
+// SchemaAgreementViolation is a statement issued after a DDL statement
+// without awaiting schema agreement in between.
+type SchemaAgreementViolation struct {
+	DDL  string
+	Stmt string
+}
+
+func (violation SchemaAgreementViolation) String() string {
+	return fmt.Sprintf("%q issued before awaiting schema agreement after %q", violation.Stmt, violation.DDL)
+}
+
+// schemaAgreement is the state of the simulated schema propagation.
+type schemaAgreement struct {
+	options    SchemaAgreementOptions
+	polls      int
+	until      time.Time
+	pending    string
+	violations []SchemaAgreementViolation
+}
+
+// WithSchemaAgreement simulates schema propagation: every DDL statement
+// executed through ExecStmt or a query leaves the schema in disagreement for
+// options.Polls polls and options.Delay, which AwaitSchemaAgreement waits for, or for its context
+// to be done, before calling the mock. Statements issued after a DDL
+// statement and before AwaitSchemaAgreement are kept for
+// SchemaAgreementViolations and AssertSchemaAgreementAwaited and, when the
+// session has a test set with Test, reported to it right away.
+func (mock *SessionxMock) WithSchemaAgreement(options SchemaAgreementOptions) *SessionxMock {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	mock.agreement = &schemaAgreement{options: options}
+
+	return mock
+}
+
+// SchemaAgreementViolations returns the statements issued so far without
+// awaiting schema agreement after a DDL statement.
+func (mock *SessionxMock) SchemaAgreementViolations() []SchemaAgreementViolation {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	if mock.agreement == nil {
+		return nil
+	}
+
+	return append([]SchemaAgreementViolation(nil), mock.agreement.violations...)
+}
+
+// AssertSchemaAgreementAwaited asserts that schema agreement was awaited
+// after every DDL statement before issuing other statements.
+func (mock *SessionxMock) AssertSchemaAgreementAwaited(t mock.TestingT) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	violations := mock.SchemaAgreementViolations()
+	for _, violation := range violations {
+		t.Errorf("gocqlxmock: schema agreement: %s", violation)
+	}
+
+	return len(violations) == 0
+}
+
+// changeSchema puts the schema in disagreement after the DDL statement
+// stmt.
+func (mock *SessionxMock) changeSchema(stmt string) {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	agreement := mock.agreement
+	if agreement == nil {
+		return
+	}
+
+	agreement.polls = agreement.options.Polls
+	agreement.until = time.Now().Add(agreement.options.Delay)
+	agreement.pending = stmt
+}
+
+// checkSchemaAgreement records stmt as a violation if it is issued while a
+// DDL statement was not awaited.
+func (mock *SessionxMock) checkSchemaAgreement(stmt string) {
+	if kind, _ := classify(stmt); kind == StatementSchema || kind == StatementOther {
+		return
+	}
+
+	mock.mu.Lock()
+	agreement := mock.agreement
+	if agreement == nil || agreement.pending == "" {
+		mock.mu.Unlock()
+		return
+	}
+	violation := SchemaAgreementViolation{DDL: agreement.pending, Stmt: stmt}
+	agreement.violations = append(agreement.violations, violation)
+	t := mock.test
+	mock.mu.Unlock()
+
+	if t != nil {
+		t.Errorf("gocqlxmock: schema agreement: %s", violation)
+	}
+}
+
+// awaitSchemaAgreement polls the simulated schema until it agrees or ctx is
+// done.
+func (mock *SessionxMock) awaitSchemaAgreement(ctx context.Context) error {
+	for {
+		mock.mu.Lock()
+		agreement := mock.agreement
+		if agreement == nil {
+			mock.mu.Unlock()
+			return nil
+		}
+		wait, agreed := agreement.poll(time.Now())
+		mock.mu.Unlock()
+
+		if agreed {
+			return nil
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// poll reports whether the schema agrees at now or, if not, how long to
+// wait before polling again.
+func (agreement *schemaAgreement) poll(now time.Time) (time.Duration, bool) {
+	interval := agreement.options.PollInterval
+	if agreement.polls > 0 {
+		agreement.polls--
+		return interval, false
+	}
+
+	if wait := agreement.until.Sub(now); wait > 0 {
+		if interval > 0 && interval < wait {
+			wait = interval
+		}
+		return wait, false
+	}
+	agreement.pending = ""
+
+	return 0, true
+}
@@ -0,0 +1,130 @@
+package gocqlxmock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const agreementDDL = "CREATE TABLE potato (id int PRIMARY KEY)"
+
+func makeAgreementSut(options SchemaAgreementOptions) sessionXSut {
+	sut := makeSessionxSut()
+	sut.sessionxmock.WithSchemaAgreement(options)
+	sut.sessionxmock.On("ExecStmt", mock.Anything).Return(nil)
+	sut.sessionxmock.On("AwaitSchemaAgreement", mock.Anything).Return(nil)
+
+	return sut
+}
+
+func Test_Sessionx_WithSchemaAgreement(t *testing.T) {
+	t.Run("Should poll until the schema agrees after DDL", func(t *testing.T) {
+		// arrange
+		sut := makeAgreementSut(SchemaAgreementOptions{Polls: 3, PollInterval: 5 * time.Millisecond})
+		_ = sut.sessionxmock.ExecStmt(agreementDDL)
+
+		// act
+		start := time.Now()
+		err := sut.sessionxmock.AwaitSchemaAgreement(sut.ctx)
+
+		// assert
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+		sut.sessionxmock.AssertNumberOfCalls(t, "AwaitSchemaAgreement", 1)
+	})
+
+	t.Run("Should wait for the delay of the disagreement", func(t *testing.T) {
+		// arrange
+		sut := makeAgreementSut(SchemaAgreementOptions{Delay: 20 * time.Millisecond})
+		_ = sut.sessionxmock.ExecStmt(agreementDDL)
+
+		// act
+		start := time.Now()
+		err := sut.sessionxmock.AwaitSchemaAgreement(sut.ctx)
+
+		// assert
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	})
+
+	t.Run("Should disagree after DDL executed through a query", func(t *testing.T) {
+		// arrange
+		sut := makeAgreementSut(SchemaAgreementOptions{Delay: 20 * time.Millisecond})
+		sut.sessionxmock.On("Query", agreementDDL, []string(nil)).Return(sut.querymock)
+		sut.querymock.On("ExecRelease").Return(nil)
+		_ = sut.sessionxmock.Query(agreementDDL, nil).ExecRelease()
+
+		// act
+		start := time.Now()
+		err := sut.sessionxmock.AwaitSchemaAgreement(sut.ctx)
+
+		// assert
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	})
+
+	t.Run("Should agree right away without DDL", func(t *testing.T) {
+		// arrange
+		sut := makeAgreementSut(SchemaAgreementOptions{Delay: time.Hour})
+
+		// act
+		err := sut.sessionxmock.AwaitSchemaAgreement(sut.ctx)
+
+		// assert
+		assert.NoError(t, err)
+	})
+
+	t.Run("Should give up when the context is done", func(t *testing.T) {
+		// arrange
+		sut := makeAgreementSut(SchemaAgreementOptions{Delay: time.Hour})
+		_ = sut.sessionxmock.ExecStmt(agreementDDL)
+		ctx, cancel := context.WithTimeout(sut.ctx, 10*time.Millisecond)
+		defer cancel()
+
+		// act
+		err := sut.sessionxmock.AwaitSchemaAgreement(ctx)
+
+		// assert
+		assert.Equal(t, context.DeadlineExceeded, err)
+		sut.sessionxmock.AssertNotCalled(t, "AwaitSchemaAgreement", mock.Anything)
+	})
+
+	t.Run("Should report statements issued before awaiting agreement", func(t *testing.T) {
+		// arrange
+		sut := makeAgreementSut(SchemaAgreementOptions{})
+		sut.sessionxmock.On("Query", mock.Anything, sut.names).Return(sut.querymock)
+
+		// act
+		_ = sut.sessionxmock.ExecStmt(agreementDDL)
+		sut.sessionxmock.Query("INSERT INTO potato (id) VALUES (?)", sut.names)
+		_ = sut.sessionxmock.AwaitSchemaAgreement(sut.ctx)
+		sut.sessionxmock.Query("SELECT * FROM potato", sut.names)
+
+		// assert
+		spy := &testingTSpy{}
+		assert.Equal(t, []SchemaAgreementViolation{
+			{DDL: agreementDDL, Stmt: "INSERT INTO potato (id) VALUES (?)"},
+		}, sut.sessionxmock.SchemaAgreementViolations())
+		assert.False(t, sut.sessionxmock.AssertSchemaAgreementAwaited(spy))
+		assert.Len(t, spy.errors, 1)
+	})
+
+	t.Run("Should report violations right away to the test of the session", func(t *testing.T) {
+		// arrange
+		sut := makeAgreementSut(SchemaAgreementOptions{})
+		spy := &testingTSpy{}
+		sut.sessionxmock.Test(spy)
+
+		// act
+		_ = sut.sessionxmock.ExecStmt(agreementDDL)
+		_ = sut.sessionxmock.ExecStmt("DELETE FROM potato WHERE id = 1")
+
+		// assert
+		assert.Len(t, spy.errors, 1)
+		assert.Contains(t, spy.errors[0], "before awaiting schema agreement")
+		assert.False(t, spy.failed)
+	})
+}
@@ -0,0 +1,561 @@
+package gocqlxmock
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Guilospanck/igocqlx"
+	"github.com/gocql/gocql"
+	"github.com/scylladb/gocqlx/v2"
+	"github.com/stretchr/testify/mock"
+)
+
+var (
+	_ IBatchSessionx = &SessionxMock{}
+	_ IBatchx        = &BatchxMock{}
+)
+
+// IBatchx is the batch API of gocqlx, which igocqlx lacks: the statements of
+// queries handed out by a session, bound like gocqlx.Batch binds them and run
+// at once by the session.
+type IBatchx interface {
+	BindStruct(qry igocqlx.IQueryx, arg interface{}) error
+	BindStructMap(qry igocqlx.IQueryx, arg0 interface{}, arg1 map[string]interface{}) error
+	BindMap(qry igocqlx.IQueryx, arg map[string]interface{}) error
+	Bind(qry igocqlx.IQueryx, args ...interface{}) error
+	Query(stmt string, args ...interface{})
+	Size() int
+	SetConsistency(c gocql.Consistency)
+	GetConsistency() gocql.Consistency
+	SerialConsistency(cons gocql.SerialConsistency) IBatchx
+	DefaultTimestamp(enable bool) IBatchx
+	WithTimestamp(timestamp int64) IBatchx
+	WithContext(ctx context.Context) IBatchx
+}
+
+// IBatchSessionx is an igocqlx.ISessionx that runs batches.
+type IBatchSessionx interface {
+	igocqlx.ISessionx
+	NewBatch(bt gocql.BatchType) IBatchx
+	ExecuteBatch(batch IBatchx) error
+	ExecuteBatchCAS(batch IBatchx, dest ...interface{}) (applied bool, iter igocqlx.IIterx, err error)
+}
+
+// BatchEntry is a statement added to a batch, with the values bound to it.
+type BatchEntry struct {
+	Stmt   string
+	Values []interface{}
+}
+
+// batchable is a query of this package, which batches take the statement and
+// the bind names of.
+type batchable interface {
+	statement() string
+	names() []string
+	transformer() gocqlx.Transformer
+}
+
+// batchEntry returns the entry qry adds to a batch, its values resolved by
+// bind from the names and transformer of qry.
+func batchEntry(qry igocqlx.IQueryx, bind func(names []string, tr gocqlx.Transformer) ([]interface{}, error)) (BatchEntry, error) {
+	query, ok := qry.(batchable)
+	if !ok {
+		return BatchEntry{}, fmt.Errorf("gocqlxmock: cannot add a %T to a batch", qry)
+	}
+
+	values, err := bind(query.names(), query.transformer())
+	if err != nil {
+		return BatchEntry{}, err
+	}
+
+	return BatchEntry{Stmt: query.statement(), Values: values}, nil
+}
+
+// batchStatement returns the CQL of a batch of type bt made of entries.
+func batchStatement(bt gocql.BatchType, entries []BatchEntry) string {
+	var b strings.Builder
+
+	b.WriteString("BEGIN ")
+	switch bt {
+	case gocql.UnloggedBatch:
+		b.WriteString("UNLOGGED ")
+	case gocql.CounterBatch:
+		b.WriteString("COUNTER ")
+	}
+	b.WriteString("BATCH ")
+	for _, entry := range entries {
+		b.WriteString(entry.Stmt)
+		b.WriteString("; ")
+	}
+	b.WriteString("APPLY BATCH")
+
+	return b.String()
+}
+
+// The batch size thresholds of Scylla, batch_size_warn_threshold_in_kb and
+// batch_size_fail_threshold_in_kb, in bytes.
+const (
+	DefaultBatchSizeWarnThreshold = 128 * 1024
+	DefaultBatchSizeFailThreshold = 1024 * 1024
+)
+
+// batchThresholds are the sizes past which a batch is warned about and
+// rejected, 0 meaning the default.
+type batchThresholds struct {
+	warn, fail int
+	warnings   []string
+}
+
+// check returns the error of a batch of size bytes made of n statements,
+// recording a warning when it is large but not too large.
+func (thresholds *batchThresholds) check(size, n int) error {
+	warn, fail := thresholds.warn, thresholds.fail
+	if warn == 0 {
+		warn = DefaultBatchSizeWarnThreshold
+	}
+	if fail == 0 {
+		fail = DefaultBatchSizeFailThreshold
+	}
+
+	switch {
+	case size > fail:
+		return invalidf("Batch too large")
+	case size > warn:
+		thresholds.warnings = append(thresholds.warnings, fmt.Sprintf(
+			"Batch of %d statements is of size %d, exceeding specified threshold of %d by %d.",
+			n, size, warn, size-warn))
+	}
+
+	return nil
+}
+
+// valueSize estimates the size of value once marshaled.
+func valueSize(value interface{}) int {
+	switch value := value.(type) {
+	case nil:
+		return 0
+	case []byte:
+		return len(value)
+	case string:
+		return len(value)
+	case gocql.UUID:
+		return 16
+	case time.Time, time.Duration:
+		return 8
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return valueSize(v.Elem().Interface())
+	case reflect.Bool, reflect.Int8, reflect.Uint8:
+		return 1
+	case reflect.Int16, reflect.Uint16:
+		return 2
+	case reflect.Int32, reflect.Uint32, reflect.Float32:
+		return 4
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Float64:
+		return 8
+	case reflect.String:
+		return v.Len()
+	case reflect.Slice, reflect.Array:
+		size := 4
+		for i := 0; i < v.Len(); i++ {
+			size += 4 + valueSize(v.Index(i).Interface())
+		}
+		return size
+	case reflect.Map:
+		size := 4
+		iter := v.MapRange()
+		for iter.Next() {
+			size += 8 + valueSize(iter.Key().Interface()) + valueSize(iter.Value().Interface())
+		}
+		return size
+	case reflect.Struct:
+		size := 0
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				size += 4 + valueSize(v.Field(i).Interface())
+			}
+		}
+		return size
+	default:
+		return len(fmt.Sprint(value))
+	}
+}
+
+type BatchxMock struct {
+	mock.Mock
+	Type gocql.BatchType
+
+	graph mockGraph
+	state batchState
+	log   callLog
+}
+
+// batchState is what a batch accumulates through its calls.
+type batchState struct {
+	mu                sync.Mutex
+	session           *SessionxMock
+	typ               gocql.BatchType
+	entries           []BatchEntry
+	ctx               context.Context
+	consistency       *gocql.Consistency
+	serialConsistency *gocql.SerialConsistency
+}
+
+// NewBatchxMock creates a BatchxMock of type bt bound to t: unexpected calls
+// fail the test and its expectations are asserted when the test finishes.
+func NewBatchxMock(t TestingT, bt gocql.BatchType) *BatchxMock {
+	mock := &BatchxMock{Type: bt}
+	bindTest(t, mock, mock)
+
+	return mock
+}
+
+func (mock *BatchxMock) mockGraph() *mockGraph {
+	return &mock.graph
+}
+
+func (mock *BatchxMock) setSession(session *SessionxMock, bt gocql.BatchType) {
+	mock.state.mu.Lock()
+	defer mock.state.mu.Unlock()
+
+	mock.state.session = session
+	mock.state.typ = bt
+}
+
+// BatchType returns the type of the batch: the one given to the session that
+// handed it out, falling back to Type.
+func (mock *BatchxMock) BatchType() gocql.BatchType {
+	mock.state.mu.Lock()
+	defer mock.state.mu.Unlock()
+
+	if mock.state.session != nil {
+		return mock.state.typ
+	}
+
+	return mock.Type
+}
+
+// Entries returns the statements added to the batch so far, with their
+// bound values.
+func (mock *BatchxMock) Entries() []BatchEntry {
+	mock.state.mu.Lock()
+	defer mock.state.mu.Unlock()
+
+	return append([]BatchEntry(nil), mock.state.entries...)
+}
+
+// Context returns the context the batch runs with.
+func (mock *BatchxMock) Context() context.Context {
+	mock.state.mu.Lock()
+	defer mock.state.mu.Unlock()
+
+	if mock.state.ctx != nil {
+		return mock.state.ctx
+	}
+
+	return context.Background()
+}
+
+func (mock *BatchxMock) add(entry BatchEntry) {
+	mock.state.mu.Lock()
+	defer mock.state.mu.Unlock()
+
+	mock.state.entries = append(mock.state.entries, entry)
+}
+
+func (mock *BatchxMock) batchx(args mock.Arguments) IBatchx {
+	result := args.Get(0).(IBatchx)
+	if result == IBatchx(mock) {
+		return mock
+	}
+	mock.graph.adopt(result)
+
+	return result
+}
+
+func (mock *BatchxMock) called(method string, arguments ...interface{}) mock.Arguments {
+	args := mock.MethodCalled(method, arguments...)
+	mock.log.record(method, arguments, args)
+
+	return args
+}
+
+// bind makes the call method, adding the statement of qry to the batch once
+// the call returned no error.
+func (mock *BatchxMock) bind(method string, arguments []interface{}, qry igocqlx.IQueryx, bind func(names []string, tr gocqlx.Transformer) ([]interface{}, error)) error {
+	err := mock.MethodCalled(method, arguments...).Error(0)
+	if err == nil {
+		var entry BatchEntry
+		if entry, err = batchEntry(qry, bind); err == nil {
+			mock.add(entry)
+		}
+	}
+	mock.log.record(method, arguments, []interface{}{err})
+
+	return err
+}
+
+func (mock *BatchxMock) BindStruct(qry igocqlx.IQueryx, arg interface{}) error {
+	return mock.bind("BindStruct", []interface{}{qry, arg}, qry, func(names []string, tr gocqlx.Transformer) ([]interface{}, error) {
+		return bindStructValues(names, tr, arg, nil)
+	})
+}
+
+func (mock *BatchxMock) BindStructMap(qry igocqlx.IQueryx, arg0 interface{}, arg1 map[string]interface{}) error {
+	return mock.bind("BindStructMap", []interface{}{qry, arg0, arg1}, qry, func(names []string, tr gocqlx.Transformer) ([]interface{}, error) {
+		return bindStructValues(names, tr, arg0, arg1)
+	})
+}
+
+func (mock *BatchxMock) BindMap(qry igocqlx.IQueryx, arg map[string]interface{}) error {
+	return mock.bind("BindMap", []interface{}{qry, arg}, qry, func(names []string, tr gocqlx.Transformer) ([]interface{}, error) {
+		return bindMapValues(names, tr, arg)
+	})
+}
+
+func (mock *BatchxMock) Bind(qry igocqlx.IQueryx, v ...interface{}) error {
+	return mock.bind("Bind", []interface{}{qry, v}, qry, func([]string, gocqlx.Transformer) ([]interface{}, error) {
+		return v, nil
+	})
+}
+
+func (mock *BatchxMock) Query(stmt string, v ...interface{}) {
+	mock.called("Query", stmt, v)
+	mock.add(BatchEntry{Stmt: stmt, Values: v})
+}
+
+// Size returns the number of statements of the batch, without being
+// recorded as a call.
+func (mock *BatchxMock) Size() int {
+	mock.state.mu.Lock()
+	defer mock.state.mu.Unlock()
+
+	return len(mock.state.entries)
+}
+
+func (mock *BatchxMock) SetConsistency(c gocql.Consistency) {
+	mock.called("SetConsistency", c)
+
+	mock.state.mu.Lock()
+	mock.state.consistency = &c
+	mock.state.mu.Unlock()
+}
+
+// GetConsistency returns the consistency the batch runs with: the one given
+// to SetConsistency, falling back to the default of its session and
+// gocql.Quorum.
+func (mock *BatchxMock) GetConsistency() gocql.Consistency {
+	mock.state.mu.Lock()
+	consistency, session := mock.state.consistency, mock.state.session
+	mock.state.mu.Unlock()
+
+	switch {
+	case consistency != nil:
+		return *consistency
+	case session != nil:
+		return session.defaultConsistency()
+	default:
+		return gocql.Quorum
+	}
+}
+
+// GetSerialConsistency returns the serial consistency the batch runs with:
+// the one given to SerialConsistency, falling back to the default of its
+// session and gocql.Serial.
+func (mock *BatchxMock) GetSerialConsistency() gocql.SerialConsistency {
+	mock.state.mu.Lock()
+	serialConsistency, session := mock.state.serialConsistency, mock.state.session
+	mock.state.mu.Unlock()
+
+	switch {
+	case serialConsistency != nil:
+		return *serialConsistency
+	case session != nil:
+		return session.defaultSerialConsistency()
+	default:
+		return gocql.Serial
+	}
+}
+
+func (mock *BatchxMock) SerialConsistency(cons gocql.SerialConsistency) IBatchx {
+	args := mock.called("SerialConsistency", cons)
+
+	mock.state.mu.Lock()
+	mock.state.serialConsistency = &cons
+	mock.state.mu.Unlock()
+
+	return mock.batchx(args)
+}
+
+func (mock *BatchxMock) DefaultTimestamp(enable bool) IBatchx {
+	args := mock.called("DefaultTimestamp", enable)
+
+	return mock.batchx(args)
+}
+
+func (mock *BatchxMock) WithTimestamp(timestamp int64) IBatchx {
+	args := mock.called("WithTimestamp", timestamp)
+
+	return mock.batchx(args)
+}
+
+func (mock *BatchxMock) WithContext(ctx context.Context) IBatchx {
+	args := mock.called("WithContext", ctx)
+
+	mock.state.mu.Lock()
+	mock.state.ctx = ctx
+	mock.state.mu.Unlock()
+
+	return mock.batchx(args)
+}
+
+// AssertType asserts that the batch is of type bt.
+func (mock *BatchxMock) AssertType(t mock.TestingT, bt gocql.BatchType) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	if actual := mock.BatchType(); actual != bt {
+		t.Errorf("gocqlxmock: batch is of type %s, expected %s", batchTypeName(actual), batchTypeName(bt))
+		return false
+	}
+
+	return true
+}
+
+// AssertConsistency asserts that the batch runs with consistency c.
+func (mock *BatchxMock) AssertConsistency(t mock.TestingT, c gocql.Consistency) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	if actual := mock.GetConsistency(); actual != c {
+		t.Errorf("gocqlxmock: batch runs with consistency %s, expected %s", actual, c)
+		return false
+	}
+
+	return true
+}
+
+func batchTypeName(bt gocql.BatchType) string {
+	switch bt {
+	case gocql.LoggedBatch:
+		return "LOGGED"
+	case gocql.UnloggedBatch:
+		return "UNLOGGED"
+	case gocql.CounterBatch:
+		return "COUNTER"
+	default:
+		return fmt.Sprintf("BatchType(%d)", bt)
+	}
+}
+
+// WithBatchSizeThresholds sets the sizes, in bytes, past which batches run
+// by the session are warned about and rejected with "Batch too large". Sizes
+// are estimated from the values bound to the batches.
+func (mock *SessionxMock) WithBatchSizeThresholds(warn, fail int) *SessionxMock {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	mock.batchThresholds.warn, mock.batchThresholds.fail = warn, fail
+
+	return mock
+}
+
+// BatchWarnings returns the warnings about the size of the batches run by
+// the session so far.
+func (mock *SessionxMock) BatchWarnings() []string {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	return append([]string(nil), mock.batchThresholds.warnings...)
+}
+
+func (mock *SessionxMock) NewBatch(bt gocql.BatchType) IBatchx {
+	args := mock.Called(bt)
+
+	result := args.Get(0).(IBatchx)
+	mock.graph.adopt(result)
+	if batch, ok := result.(*BatchxMock); ok {
+		batch.setSession(mock, bt)
+	}
+	mock.log.recordHandout("NewBatch", []interface{}{bt}, args, result)
+
+	return result
+}
+
+func (mock *SessionxMock) ExecuteBatch(batch IBatchx) error {
+	if err := mock.executeBatch(batch, "ExecuteBatch"); err != nil {
+		mock.log.record("ExecuteBatch", []interface{}{batch}, []interface{}{err})
+		return err
+	}
+	args := mock.Called(batch)
+	mock.log.record("ExecuteBatch", []interface{}{batch}, args)
+
+	return args.Error(0)
+}
+
+func (mock *SessionxMock) ExecuteBatchCAS(batch IBatchx, dest ...interface{}) (applied bool, iter igocqlx.IIterx, err error) {
+	if err := mock.executeBatch(batch, "ExecuteBatchCAS"); err != nil {
+		mock.log.record("ExecuteBatchCAS", []interface{}{batch, dest}, []interface{}{false, errIterx{err}, err})
+		return false, errIterx{err}, err
+	}
+	args := mock.Called(batch, dest)
+	mock.log.record("ExecuteBatchCAS", []interface{}{batch, dest}, args)
+
+	iter, _ = args.Get(1).(igocqlx.IIterx)
+	mock.graph.adopt(iter)
+
+	return args.Bool(0), iter, args.Error(2)
+}
+
+// executeBatch checks a BatchxMock about to run against the consistency
+// policy and the batch size thresholds of the session.
+func (mock *SessionxMock) executeBatch(batch IBatchx, method string) error {
+	b, ok := batch.(*BatchxMock)
+	if !ok {
+		return nil
+	}
+
+	entries := b.Entries()
+	execution := Execution{
+		Stmt:              batchStatement(b.BatchType(), entries),
+		Method:            method,
+		Kind:              StatementBatch,
+		LWT:               method == "ExecuteBatchCAS",
+		Consistency:       b.GetConsistency(),
+		SerialConsistency: b.GetSerialConsistency(),
+	}
+	size := 0
+	for _, entry := range entries {
+		if _, lwt := classify(entry.Stmt); lwt {
+			execution.LWT = true
+		}
+		for _, value := range entry.Values {
+			size += valueSize(value)
+		}
+		execution.Values = append(execution.Values, entry.Values...)
+	}
+	if err := mock.execute(execution); err != nil {
+		return err
+	}
+
+	if err := b.Context().Err(); err != nil {
+		return err
+	}
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	return mock.batchThresholds.check(size, len(entries))
+}
@@ -0,0 +1,150 @@
+package gocqlxmock
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type batchSut struct {
+	stmt        string
+	names       []string
+	sessionmock *SessionxMock
+	querymock   *QueryxMock
+	batchmock   *BatchxMock
+}
+
+func makeBatchSut(bt gocql.BatchType) batchSut {
+	sut := batchSut{
+		"INSERT INTO potato (id, day, name) VALUES (?, ?, ?)",
+		[]string{"id", "day", "name"},
+		&SessionxMock{},
+		&QueryxMock{},
+		&BatchxMock{},
+	}
+	sut.sessionmock.On("Query", sut.stmt, sut.names).Return(sut.querymock)
+	sut.sessionmock.On("NewBatch", bt).Return(sut.batchmock)
+	sut.sessionmock.On("ExecuteBatch", sut.batchmock).Return(nil)
+	sut.batchmock.On("BindStruct", sut.querymock, mock.Anything).Return(nil)
+
+	return sut
+}
+
+func Test_BatchxMock_BindStruct(t *testing.T) {
+	t.Run("Should record each statement with its bound values", func(t *testing.T) {
+		// arrange
+		sut := makeBatchSut(gocql.LoggedBatch)
+		sut.batchmock.On("Query", "DELETE FROM potato WHERE id = ?", []interface{}{3}).Return()
+		batch := sut.sessionmock.NewBatch(gocql.LoggedBatch)
+		query := sut.sessionmock.Query(sut.stmt, sut.names)
+
+		// act
+		errFirst := batch.BindStruct(query, potato{1, 1, "first"})
+		errSecond := batch.BindStruct(query, &potato{2, 1, "second"})
+		batch.Query("DELETE FROM potato WHERE id = ?", 3)
+
+		// assert
+		assert.NoError(t, errFirst)
+		assert.NoError(t, errSecond)
+		assert.Equal(t, 3, batch.Size())
+		assert.Equal(t, []BatchEntry{
+			{Stmt: sut.stmt, Values: []interface{}{1, 1, "first"}},
+			{Stmt: sut.stmt, Values: []interface{}{2, 1, "second"}},
+			{Stmt: "DELETE FROM potato WHERE id = ?", Values: []interface{}{3}},
+		}, sut.batchmock.Entries())
+	})
+
+	t.Run("Should not record statements whose binding failed", func(t *testing.T) {
+		// arrange
+		sut := makeBatchSut(gocql.LoggedBatch)
+		query := sut.sessionmock.Query(sut.stmt, sut.names)
+
+		// act
+		err := sut.batchmock.BindStruct(query, struct{ ID int }{1})
+
+		// assert
+		assert.ErrorContains(t, err, `could not find name "day"`)
+		assert.Empty(t, sut.batchmock.Entries())
+	})
+}
+
+func Test_BatchxMock_Assertions(t *testing.T) {
+	t.Run("Should assert the type and consistency of the batch", func(t *testing.T) {
+		// arrange
+		sut := makeBatchSut(gocql.UnloggedBatch)
+		sut.batchmock.On("SetConsistency", gocql.LocalQuorum).Return()
+		spy := &testingTSpy{}
+
+		// act
+		batch := sut.sessionmock.NewBatch(gocql.UnloggedBatch)
+		batch.SetConsistency(gocql.LocalQuorum)
+
+		// assert
+		assert.True(t, sut.batchmock.AssertType(t, gocql.UnloggedBatch))
+		assert.True(t, sut.batchmock.AssertConsistency(t, gocql.LocalQuorum))
+		assert.False(t, sut.batchmock.AssertType(spy, gocql.CounterBatch))
+		assert.False(t, sut.batchmock.AssertConsistency(spy, gocql.One))
+		assert.Equal(t, []string{
+			"gocqlxmock: batch is of type UNLOGGED, expected COUNTER",
+			"gocqlxmock: batch runs with consistency LOCAL_QUORUM, expected ONE",
+		}, spy.errors)
+	})
+
+	t.Run("Should check batches against the consistency policy of the session", func(t *testing.T) {
+		// arrange
+		sut := makeBatchSut(gocql.LoggedBatch)
+		spy := &testingTSpy{}
+		sut.sessionmock.Test(spy)
+		sut.sessionmock.WithConsistencyPolicy(RequireWriteConsistency(gocql.LocalQuorum))
+		batch := sut.sessionmock.NewBatch(gocql.LoggedBatch)
+		_ = batch.BindStruct(sut.sessionmock.Query(sut.stmt, sut.names), potato{1, 1, "first"})
+
+		// act
+		err := sut.sessionmock.ExecuteBatch(batch)
+
+		// assert
+		assert.ErrorContains(t, err, "consistency policy violated")
+		assert.Len(t, spy.errors, 1)
+		executions := sut.sessionmock.Executions()
+		assert.Equal(t, "BEGIN BATCH "+sut.stmt+"; APPLY BATCH", executions[len(executions)-1].Stmt)
+		assert.Equal(t, StatementBatch, executions[len(executions)-1].Kind)
+	})
+}
+
+func Test_SessionxMock_ExecuteBatch(t *testing.T) {
+	t.Run("Should warn about batches past the warn threshold", func(t *testing.T) {
+		// arrange
+		sut := makeBatchSut(gocql.LoggedBatch)
+		sut.sessionmock.WithBatchSizeThresholds(10, 100)
+		batch := sut.sessionmock.NewBatch(gocql.LoggedBatch)
+		_ = batch.BindStruct(sut.sessionmock.Query(sut.stmt, sut.names), potato{1, 1, "potato"})
+
+		// act
+		err := sut.sessionmock.ExecuteBatch(batch)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			"Batch of 1 statements is of size 22, exceeding specified threshold of 10 by 12.",
+		}, sut.sessionmock.BatchWarnings())
+		sut.sessionmock.AssertCalled(t, "ExecuteBatch", sut.batchmock)
+	})
+
+	t.Run("Should reject batches past the fail threshold", func(t *testing.T) {
+		// arrange
+		sut := makeBatchSut(gocql.LoggedBatch)
+		sut.sessionmock.WithBatchSizeThresholds(10, 100)
+		batch := sut.sessionmock.NewBatch(gocql.LoggedBatch)
+		_ = batch.BindStruct(sut.sessionmock.Query(sut.stmt, sut.names), potato{1, 1, strings.Repeat("potato", 20)})
+
+		// act
+		err := sut.sessionmock.ExecuteBatch(batch)
+
+		// assert
+		assert.EqualError(t, err, "Batch too large")
+		sut.sessionmock.AssertNotCalled(t, "ExecuteBatch", sut.batchmock)
+	})
+}
@@ -0,0 +1,65 @@
+package gocqlxmock
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/scylladb/go-reflectx"
+	"github.com/scylladb/gocqlx/v2"
+)
+
+// bindStructValues resolves the values gocqlx would bind for names from arg0,
+// falling back to arg1, using the default gocqlx mapper.
+func bindStructValues(names []string, tr gocqlx.Transformer, arg0 interface{}, arg1 map[string]interface{}) ([]interface{}, error) {
+	values := make([]interface{}, 0, len(names))
+
+	v := reflect.ValueOf(arg0)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("bind error: expected a struct, got %T", arg0)
+	}
+
+	err := gocqlx.DefaultMapper.TraversalsByNameFunc(v.Type(), names, func(i int, t []int) error {
+		if len(t) != 0 {
+			values = append(values, reflectx.FieldByIndexesReadOnly(v, t).Interface())
+		} else {
+			value, ok := arg1[names[i]]
+			if !ok {
+				return fmt.Errorf("bind error: could not find name %q in %#v and %#v", names[i], arg0, arg1)
+			}
+			values = append(values, value)
+		}
+
+		if tr != nil {
+			values[i] = tr(names[i], values[i])
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// bindMapValues resolves the values gocqlx would bind for names from arg.
+func bindMapValues(names []string, tr gocqlx.Transformer, arg map[string]interface{}) ([]interface{}, error) {
+	values := make([]interface{}, 0, len(names))
+
+	for _, name := range names {
+		value, ok := arg[name]
+		if !ok {
+			return nil, fmt.Errorf("bind error: could not find name %q in %#v", name, arg)
+		}
+
+		if tr != nil {
+			value = tr(name, value)
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
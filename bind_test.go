@@ -0,0 +1,74 @@
+package gocqlxmock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type bindEntity struct {
+	ID        string
+	FirstName string
+}
+
+func Test_BindStructValues(t *testing.T) {
+	t.Run("Should resolve the values of the struct fields by name", func(t *testing.T) {
+		// arrange
+		arg := &bindEntity{ID: "id", FirstName: "larry"}
+
+		// act
+		result, err := bindStructValues([]string{"first_name", "id"}, nil, arg, nil)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{"larry", "id"}, result)
+	})
+
+	t.Run("Should fall back to the map and apply the transformer", func(t *testing.T) {
+		// arrange
+		arg := &bindEntity{ID: "id"}
+		tr := func(name string, value interface{}) interface{} { return name + ":" + value.(string) }
+
+		// act
+		result, err := bindStructValues([]string{"id", "extra"}, tr, arg, map[string]interface{}{"extra": "value"})
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{"id:id", "extra:value"}, result)
+	})
+
+	t.Run("Should return error when a name cannot be found", func(t *testing.T) {
+		// act
+		_, err := bindStructValues([]string{"missing"}, nil, &bindEntity{}, nil)
+
+		// assert
+		assert.Error(t, err)
+	})
+
+	t.Run("Should return error when the argument is not a struct", func(t *testing.T) {
+		// act
+		_, err := bindStructValues([]string{"id"}, nil, "potato", nil)
+
+		// assert
+		assert.Error(t, err)
+	})
+}
+
+func Test_BindMapValues(t *testing.T) {
+	t.Run("Should resolve the values of the map by name", func(t *testing.T) {
+		// act
+		result, err := bindMapValues([]string{"b", "a"}, nil, map[string]interface{}{"a": 1, "b": 2})
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{2, 1}, result)
+	})
+
+	t.Run("Should return error when a name cannot be found", func(t *testing.T) {
+		// act
+		_, err := bindMapValues([]string{"c"}, nil, map[string]interface{}{})
+
+		// assert
+		assert.Error(t, err)
+	})
+}
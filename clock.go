@@ -0,0 +1,55 @@
+package gocqlxmock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time to a FakeSessionx.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the Clock of the system.
+var SystemClock Clock = systemClock{}
+
+// FakeClock is a Clock that only moves when told to. It is safe for
+// concurrent use.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock returns a FakeClock telling now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (clock *FakeClock) Now() time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	return clock.now
+}
+
+// Set moves the clock to now, even backwards.
+func (clock *FakeClock) Set(now time.Time) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	clock.now = now
+}
+
+// Advance moves the clock forward by d.
+func (clock *FakeClock) Advance(d time.Duration) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	clock.now = clock.now.Add(d)
+}
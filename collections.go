@@ -0,0 +1,338 @@
+package gocqlxmock
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gocql/gocql"
+)
+
+// components splits data into the values it is made of, each serialized
+// with its length, a negative length standing for null. It reads n values,
+// or up to the end of data when n is negative, as for tuples and UDTs.
+func components(data []byte, n int) ([][]byte, error) {
+	var values [][]byte
+	for i := 0; n < 0 && len(data) > 0 || i < n; i++ {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("unexpected end of value")
+		}
+		size := int(int32(binary.BigEndian.Uint32(data)))
+		data = data[4:]
+
+		if size < 0 {
+			values = append(values, nil)
+			continue
+		}
+		if len(data) < size {
+			return nil, fmt.Errorf("unexpected end of value")
+		}
+		values = append(values, data[:size:size])
+		data = data[size:]
+	}
+
+	return values, nil
+}
+
+// join serializes values the way components reads them back.
+func join(buf []byte, values [][]byte) []byte {
+	for _, value := range values {
+		if value == nil {
+			buf = binary.BigEndian.AppendUint32(buf, 0xffffffff)
+			continue
+		}
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(value)))
+		buf = append(buf, value...)
+	}
+
+	return buf
+}
+
+// elements splits data, a serialized collection of type typ, into its
+// elements, or its keys and values alternately for maps.
+func elements(typ gocql.CollectionType, data []byte) ([][]byte, error) {
+	if data == nil {
+		return nil, nil
+	}
+	if len(data) < 4 {
+		return nil, fmt.Errorf("unexpected end of collection")
+	}
+
+	n := int(int32(binary.BigEndian.Uint32(data)))
+	if typ.Type() == gocql.TypeMap {
+		n *= 2
+	}
+
+	return components(data[4:], n)
+}
+
+// collection serializes elems as a collection of type typ.
+func collection(typ gocql.CollectionType, elems [][]byte) []byte {
+	n := len(elems)
+	if typ.Type() == gocql.TypeMap {
+		n /= 2
+	}
+
+	return join(binary.BigEndian.AppendUint32(nil, uint32(n)), elems)
+}
+
+// canonical returns data, a serialized value of typ, the way Scylla stores
+// it: the elements of sets sorted and unique, and the entries of maps sorted
+// by unique keys, down to nested values.
+func canonical(typ gocql.TypeInfo, data []byte) []byte {
+	if data == nil {
+		return nil
+	}
+
+	switch typ := typ.(type) {
+	case gocql.CollectionType:
+		elems, err := elements(typ, data)
+		if err != nil {
+			return data
+		}
+
+		switch typ.Type() {
+		case gocql.TypeList:
+			for i := range elems {
+				elems[i] = canonical(typ.Elem, elems[i])
+			}
+		case gocql.TypeSet:
+			for i := range elems {
+				elems[i] = canonical(typ.Elem, elems[i])
+			}
+			elems = union(typ.Elem, nil, elems)
+		case gocql.TypeMap:
+			for i := 0; i < len(elems); i += 2 {
+				elems[i] = canonical(typ.Key, elems[i])
+				elems[i+1] = canonical(typ.Elem, elems[i+1])
+			}
+			elems = merge(typ.Key, nil, elems)
+		}
+		return collection(typ, elems)
+	case gocql.TupleTypeInfo:
+		values, err := components(data, -1)
+		if err != nil || len(values) > len(typ.Elems) {
+			return data
+		}
+		for i := range values {
+			values[i] = canonical(typ.Elems[i], values[i])
+		}
+		return join(nil, values)
+	case gocql.UDTTypeInfo:
+		values, err := components(data, -1)
+		if err != nil || len(values) > len(typ.Elements) {
+			return data
+		}
+		for i := range values {
+			values[i] = canonical(typ.Elements[i].Type, values[i])
+		}
+		return join(nil, values)
+	default:
+		return data
+	}
+}
+
+// union returns the sorted, unique elements of a and b, of type typ.
+func union(typ gocql.TypeInfo, a, b [][]byte) [][]byte {
+	elems := append(append([][]byte(nil), a...), b...)
+	sort.SliceStable(elems, func(i, j int) bool {
+		return compareValues(typ, elems[i], elems[j]) < 0
+	})
+
+	unique := elems[:0]
+	for _, elem := range elems {
+		if len(unique) == 0 || compareValues(typ, unique[len(unique)-1], elem) != 0 {
+			unique = append(unique, elem)
+		}
+	}
+
+	return unique
+}
+
+// merge returns the entries of a overwritten by the ones of b, sorted by
+// their keys of type typ. Entries are keys and values alternately.
+func merge(typ gocql.TypeInfo, a, b [][]byte) [][]byte {
+	type entry struct{ key, value []byte }
+
+	var entries []entry
+	for _, elems := range [][][]byte{a, b} {
+		for i := 0; i+1 < len(elems); i += 2 {
+			entries = append(entries, entry{elems[i], elems[i+1]})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return compareValues(typ, entries[i].key, entries[j].key) < 0
+	})
+
+	var merged [][]byte
+	for _, e := range entries {
+		if n := len(merged); n > 0 && compareValues(typ, merged[n-2], e.key) == 0 {
+			merged[n-1] = e.value
+			continue
+		}
+		merged = append(merged, e.key, e.value)
+	}
+
+	return merged
+}
+
+// without returns the elems of type typ that are not in removed. With step
+// 2, elems are map entries and removed holds keys.
+func without(typ gocql.TypeInfo, elems, removed [][]byte, step int) [][]byte {
+	var kept [][]byte
+	for i := 0; i < len(elems); i += step {
+		found := false
+		for _, r := range removed {
+			if compareValues(typ, elems[i], r) == 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			kept = append(kept, elems[i:i+step]...)
+		}
+	}
+
+	return kept
+}
+
+// frozen reports whether column holds a frozen value rather than one whose
+// elements are written separately.
+func frozen(column *gocql.ColumnMetadata) bool {
+	_, ok := column.Type.(gocql.CollectionType)
+
+	return !ok || strings.HasPrefix(column.Validator, "frozen<")
+}
+
+// stored returns value as column stores it: non-frozen collections with no
+// elements are null.
+func stored(column *gocql.ColumnMetadata, value []byte) []byte {
+	if !frozen(column) && len(value) == 4 && binary.BigEndian.Uint32(value) == 0 {
+		return nil
+	}
+
+	return value
+}
+
+// collectionOp is an update of the elements of a non-frozen collection,
+// applied on top of its current value.
+type collectionOp struct {
+	// operator is "+" and "-" to add and remove elements, "prepend" to add
+	// elements in front of a list, "put" to set the element at key, and
+	// "discard" to delete it.
+	operator string
+	key      []byte
+	value    []byte
+}
+
+// applyOps returns data, the current value of a collection of type typ,
+// once ops are applied, nil when it ends up empty.
+func applyOps(typ gocql.CollectionType, data []byte, ops []collectionOp) ([]byte, error) {
+	elems, err := elements(typ, data)
+	if err != nil {
+		return nil, invalidf("%s", err)
+	}
+
+	for _, op := range ops {
+		if op.operator == "put" || op.operator == "discard" {
+			if elems, err = applyElementOp(typ, elems, op); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		operandType := typ
+		if typ.Type() == gocql.TypeMap && op.operator == "-" {
+			operandType = setOf(typ.Key)
+		}
+		operand, err := elements(operandType, op.value)
+		if err != nil {
+			return nil, invalidf("%s", err)
+		}
+
+		switch {
+		case typ.Type() == gocql.TypeList && op.operator == "+":
+			elems = append(elems, operand...)
+		case typ.Type() == gocql.TypeList && op.operator == "prepend":
+			elems = append(append([][]byte(nil), operand...), elems...)
+		case typ.Type() == gocql.TypeSet && op.operator == "+":
+			elems = union(typ.Elem, elems, operand)
+		case typ.Type() == gocql.TypeMap && op.operator == "+":
+			elems = merge(typ.Key, elems, operand)
+		case typ.Type() == gocql.TypeMap:
+			elems = without(typ.Key, elems, operand, 2)
+		default:
+			elems = without(typ.Elem, elems, operand, 1)
+		}
+	}
+
+	if len(elems) == 0 {
+		return nil, nil
+	}
+
+	return collection(typ, elems), nil
+}
+
+// applyElementOp sets or deletes the element at the index of a list, or at
+// the key of a map.
+func applyElementOp(typ gocql.CollectionType, elems [][]byte, op collectionOp) ([][]byte, error) {
+	if typ.Type() == gocql.TypeMap {
+		elems = without(typ.Key, elems, [][]byte{op.key}, 2)
+		if op.operator == "put" && op.value != nil {
+			elems = merge(typ.Key, elems, [][]byte{op.key, op.value})
+		}
+		return elems, nil
+	}
+
+	var index int32
+	if err := gocql.Unmarshal(nativeType(gocql.TypeInt), op.key, &index); err != nil {
+		return nil, invalidf("%s", err)
+	}
+	switch {
+	case elems == nil && op.operator == "put":
+		return nil, invalidf("Attempted to set an element on a list which is null")
+	case elems == nil:
+		return nil, invalidf("Attempted to delete an element from a list which is null")
+	case index < 0 || int(index) >= len(elems):
+		return nil, invalidf("List index %d out of bound, list has size %d", index, len(elems))
+	}
+
+	if op.operator == "put" && op.value != nil {
+		elems = append([][]byte(nil), elems...)
+		elems[index] = op.value
+		return elems, nil
+	}
+
+	return append(append([][]byte(nil), elems[:index]...), elems[index+1:]...), nil
+}
+
+// setOf returns the type of a set of elem.
+func setOf(elem gocql.TypeInfo) gocql.CollectionType {
+	return gocql.CollectionType{NativeType: gocql.NewNativeType(protoVersion, gocql.TypeSet, ""), Elem: elem}
+}
+
+// contains reports whether data, a serialized collection of type typ,
+// holds value among its elements, or among its keys when key is set.
+func contains(typ gocql.CollectionType, data, value []byte, key bool) bool {
+	elems, err := elements(typ, data)
+	if err != nil {
+		return false
+	}
+
+	elemType, start, step := typ.Elem, 0, 1
+	if typ.Type() == gocql.TypeMap {
+		start, step = 1, 2
+		if key {
+			elemType, start = typ.Key, 0
+		}
+	}
+
+	for i := start; i < len(elems); i += step {
+		if compareValues(elemType, elems[i], value) == 0 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,271 @@
+package gocqlxmock
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/mock"
+)
+
+// Execution is a terminal call made on a QueryxMock handed out by a
+// SessionxMock, along with the options the query ran with.
+type Execution struct {
+	Stmt              string
+	Method            string
+	Kind              StatementKind
+	LWT               bool
+	Values            []interface{}
+	Consistency       gocql.Consistency
+	SerialConsistency gocql.SerialConsistency
+	CustomPayload     map[string][]byte
+}
+
+// ConsistencyPolicy inspects an execution before it happens and returns an
+// error when it breaks a rule.
+type ConsistencyPolicy func(execution Execution) error
+
+type consistencyDefaults struct {
+	consistency       *gocql.Consistency
+	serialConsistency *gocql.SerialConsistency
+}
+
+// RequireWriteConsistency requires writes, lightweight transactions included,
+// to run with one of the given consistency levels.
+func RequireWriteConsistency(allowed ...gocql.Consistency) ConsistencyPolicy {
+	return func(execution Execution) error {
+		if !execution.Kind.IsWrite() || containsConsistency(allowed, execution.Consistency) {
+			return nil
+		}
+
+		return fmt.Errorf("write ran with consistency %s, expected %s", execution.Consistency, joinLevels(allowed))
+	}
+}
+
+// RequireReadConsistency requires reads to run with one of the given
+// consistency levels.
+func RequireReadConsistency(allowed ...gocql.Consistency) ConsistencyPolicy {
+	return func(execution Execution) error {
+		if execution.Kind != StatementSelect || containsConsistency(allowed, execution.Consistency) {
+			return nil
+		}
+
+		return fmt.Errorf("read ran with consistency %s, expected %s", execution.Consistency, joinLevels(allowed))
+	}
+}
+
+// RequireSerialConsistency requires lightweight transactions to run with one
+// of the given serial consistency levels.
+func RequireSerialConsistency(allowed ...gocql.SerialConsistency) ConsistencyPolicy {
+	return func(execution Execution) error {
+		if !execution.LWT {
+			return nil
+		}
+
+		for _, level := range allowed {
+			if level == execution.SerialConsistency {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("lightweight transaction ran with serial consistency %s, expected %s", execution.SerialConsistency, joinLevels(allowed))
+	}
+}
+
+// CombinePolicies returns a policy that breaks when any of policies does.
+func CombinePolicies(policies ...ConsistencyPolicy) ConsistencyPolicy {
+	return func(execution Execution) error {
+		for _, policy := range policies {
+			if err := policy(execution); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// WithDefaultConsistency sets the consistency of queries that do not call
+// Consistency. It defaults to gocql.Quorum, just like gocql.NewCluster.
+func (mock *SessionxMock) WithDefaultConsistency(c gocql.Consistency) *SessionxMock {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	mock.defaults.consistency = &c
+
+	return mock
+}
+
+// WithDefaultSerialConsistency sets the serial consistency of queries that do
+// not call SerialConsistency. It defaults to gocql.Serial.
+func (mock *SessionxMock) WithDefaultSerialConsistency(sc gocql.SerialConsistency) *SessionxMock {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	mock.defaults.serialConsistency = &sc
+
+	return mock
+}
+
+// WithConsistencyPolicy checks every query handed out by the session against
+// policy right before its terminal call. A violation fails the test set with
+// Test, or panics when there is none, and is returned by the terminal call.
+func (mock *SessionxMock) WithConsistencyPolicy(policy ConsistencyPolicy) *SessionxMock {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	mock.policy = policy
+
+	return mock
+}
+
+// Executions returns the terminal calls made on the queries handed out by the
+// session, in call order.
+func (mock *SessionxMock) Executions() []Execution {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	return append([]Execution(nil), mock.executions...)
+}
+
+// AssertConsistencyPolicy asserts that every execution so far meets policy.
+func (mock *SessionxMock) AssertConsistencyPolicy(t mock.TestingT, policy ConsistencyPolicy) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	result := true
+	for _, execution := range mock.Executions() {
+		if err := policy(execution); err != nil {
+			t.Errorf("gocqlxmock: consistency policy violated by %q: %s", execution.Stmt, err)
+			result = false
+		}
+	}
+
+	return result
+}
+
+// AssertConsistency asserts that every execution of stmt ran with c.
+func (mock *SessionxMock) AssertConsistency(t mock.TestingT, stmt string, c gocql.Consistency) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	return mock.assertExecutions(t, stmt, func(execution Execution) error {
+		if execution.Consistency != c {
+			return fmt.Errorf("ran with consistency %s, expected %s", execution.Consistency, c)
+		}
+
+		return nil
+	})
+}
+
+// AssertSerialConsistency asserts that every execution of stmt ran with sc.
+func (mock *SessionxMock) AssertSerialConsistency(t mock.TestingT, stmt string, sc gocql.SerialConsistency) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	return mock.assertExecutions(t, stmt, func(execution Execution) error {
+		if execution.SerialConsistency != sc {
+			return fmt.Errorf("ran with serial consistency %s, expected %s", execution.SerialConsistency, sc)
+		}
+
+		return nil
+	})
+}
+
+func (mock *SessionxMock) assertExecutions(t mock.TestingT, stmt string, check func(Execution) error) bool {
+	found := false
+	result := true
+
+	for _, execution := range mock.Executions() {
+		if execution.Stmt != stmt {
+			continue
+		}
+
+		found = true
+		if err := check(execution); err != nil {
+			t.Errorf("gocqlxmock: %q %s", stmt, err)
+			result = false
+		}
+	}
+
+	if !found {
+		t.Errorf("gocqlxmock: %q was never executed", stmt)
+		return false
+	}
+
+	return result
+}
+
+func (mock *SessionxMock) defaultConsistency() gocql.Consistency {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	if mock.defaults.consistency != nil {
+		return *mock.defaults.consistency
+	}
+
+	return gocql.Quorum
+}
+
+func (mock *SessionxMock) defaultSerialConsistency() gocql.SerialConsistency {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	if mock.defaults.serialConsistency != nil {
+		return *mock.defaults.serialConsistency
+	}
+
+	return gocql.Serial
+}
+
+// execute records execution and checks it against the consistency policy,
+// returning the violation it reported.
+func (mock *SessionxMock) execute(execution Execution) error {
+	mock.mu.Lock()
+	mock.executions = append(mock.executions, execution)
+	policy := mock.policy
+	t := mock.test
+	mock.mu.Unlock()
+
+	if policy == nil {
+		return nil
+	}
+
+	if err := policy(execution); err != nil {
+		err = fmt.Errorf("gocqlxmock: consistency policy violated by %q: %s", execution.Stmt, err)
+		failf(t, "%s", err)
+		return err
+	}
+
+	return nil
+}
+
+func containsConsistency(levels []gocql.Consistency, c gocql.Consistency) bool {
+	for _, level := range levels {
+		if level == c {
+			return true
+		}
+	}
+
+	return false
+}
+
+func joinLevels(levels interface{}) string {
+	var names []string
+
+	switch levels := levels.(type) {
+	case []gocql.Consistency:
+		for _, level := range levels {
+			names = append(names, level.String())
+		}
+	case []gocql.SerialConsistency:
+		for _, level := range levels {
+			names = append(names, level.String())
+		}
+	}
+
+	return strings.Join(names, " or ")
+}
@@ -0,0 +1,160 @@
+package gocqlxmock
+
+import (
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+type consistencySut struct {
+	insertStmt  string
+	lwtStmt     string
+	selectStmt  string
+	names       []string
+	policy      ConsistencyPolicy
+	sessionmock *SessionxMock
+	querymock   *QueryxMock
+	spy         *testingTSpy
+}
+
+func makeConsistencySut() consistencySut {
+	policy := CombinePolicies(
+		RequireWriteConsistency(gocql.LocalQuorum),
+		RequireSerialConsistency(gocql.LocalSerial),
+	)
+
+	sut := consistencySut{
+		"INSERT INTO potato (name) VALUES (?)",
+		"UPDATE potato SET name = ? WHERE id = ? IF name = ?",
+		"SELECT name FROM potato WHERE id = ?",
+		[]string{"name"},
+		policy,
+		&SessionxMock{},
+		&QueryxMock{},
+		&testingTSpy{},
+	}
+	sut.sessionmock.Test(sut.spy)
+	sut.querymock.On("Consistency", gocql.LocalQuorum).Return(sut.querymock)
+	sut.querymock.On("SerialConsistency", gocql.LocalSerial).Return(sut.querymock)
+	sut.querymock.On("ExecRelease").Return(nil)
+	sut.querymock.On("ExecCAS").Return(true, nil)
+	sut.querymock.On("Select", nil).Return(nil)
+
+	return sut
+}
+
+func Test_Sessionx_WithConsistencyPolicy(t *testing.T) {
+	t.Run("Should let queries meeting the policy run", func(t *testing.T) {
+		// arrange
+		sut := makeConsistencySut()
+		sut.sessionmock.WithConsistencyPolicy(sut.policy)
+		sut.sessionmock.On("Query", sut.insertStmt, sut.names).Return(sut.querymock)
+		sut.sessionmock.On("Query", sut.lwtStmt, sut.names).Return(sut.querymock)
+
+		// act
+		err := sut.sessionmock.Query(sut.insertStmt, sut.names).Consistency(gocql.LocalQuorum).ExecRelease()
+		applied, casErr := sut.sessionmock.Query(sut.lwtStmt, sut.names).Consistency(gocql.LocalQuorum).SerialConsistency(gocql.LocalSerial).ExecCAS()
+
+		// assert
+		assert.NoError(t, err)
+		assert.NoError(t, casErr)
+		assert.True(t, applied)
+		assert.Empty(t, sut.spy.errors)
+	})
+
+	t.Run("Should fail with the statement when a write uses the default consistency", func(t *testing.T) {
+		// arrange
+		sut := makeConsistencySut()
+		sut.sessionmock.WithConsistencyPolicy(sut.policy)
+		sut.sessionmock.On("Query", sut.insertStmt, sut.names).Return(sut.querymock)
+
+		// act
+		err := sut.sessionmock.Query(sut.insertStmt, sut.names).ExecRelease()
+
+		// assert
+		assert.EqualError(t, err, sut.spy.errors[0])
+		assert.False(t, sut.spy.failed)
+		assert.Contains(t, sut.spy.errors[0], sut.insertStmt)
+		assert.Contains(t, sut.spy.errors[0], "write ran with consistency QUORUM, expected LOCAL_QUORUM")
+	})
+
+	t.Run("Should fail when a lightweight transaction uses the wrong serial consistency", func(t *testing.T) {
+		// arrange
+		sut := makeConsistencySut()
+		sut.sessionmock.WithConsistencyPolicy(sut.policy).WithDefaultConsistency(gocql.LocalQuorum)
+		sut.sessionmock.On("Query", sut.lwtStmt, sut.names).Return(sut.querymock)
+
+		// act
+		_, err := sut.sessionmock.Query(sut.lwtStmt, sut.names).ExecCAS()
+
+		// assert
+		assert.ErrorContains(t, err, "consistency policy violated")
+		assert.Contains(t, sut.spy.errors[0], "serial consistency SERIAL, expected LOCAL_SERIAL")
+	})
+
+	t.Run("Should panic on violations when no test is set", func(t *testing.T) {
+		// arrange
+		sut := makeConsistencySut()
+		sessionmock := &SessionxMock{}
+		sessionmock.WithConsistencyPolicy(RequireReadConsistency(gocql.One))
+		sessionmock.On("Query", sut.selectStmt, sut.names).Return(sut.querymock)
+
+		// act / assert
+		assert.Panics(t, func() { _ = sessionmock.Query(sut.selectStmt, sut.names).Select(nil) })
+	})
+}
+
+func Test_Sessionx_AssertConsistency(t *testing.T) {
+	t.Run("Should assert the consistency of every execution of a statement", func(t *testing.T) {
+		// arrange
+		sut := makeConsistencySut()
+		sut.sessionmock.IsolateQueries().WithDefaultSerialConsistency(gocql.LocalSerial)
+		sut.sessionmock.On("Query", sut.insertStmt, sut.names).Return(sut.querymock)
+		sut.sessionmock.On("Query", sut.lwtStmt, sut.names).Return(sut.querymock)
+		_ = sut.sessionmock.Query(sut.insertStmt, sut.names).Consistency(gocql.LocalQuorum).ExecRelease()
+		_, _ = sut.sessionmock.Query(sut.lwtStmt, sut.names).ExecCAS()
+
+		// act / assert
+		assert.True(t, sut.sessionmock.AssertConsistency(t, sut.insertStmt, gocql.LocalQuorum))
+		assert.True(t, sut.sessionmock.AssertSerialConsistency(t, sut.lwtStmt, gocql.LocalSerial))
+		assert.False(t, sut.sessionmock.AssertConsistency(sut.spy, sut.lwtStmt, gocql.LocalQuorum))
+		assert.False(t, sut.sessionmock.AssertConsistency(sut.spy, sut.selectStmt, gocql.One))
+		assert.Contains(t, sut.spy.errors[0], "ran with consistency QUORUM, expected LOCAL_QUORUM")
+		assert.Contains(t, sut.spy.errors[1], "was never executed")
+	})
+
+	t.Run("Should assert every execution against a policy", func(t *testing.T) {
+		// arrange
+		sut := makeConsistencySut()
+		sut.sessionmock.On("Query", sut.insertStmt, sut.names).Return(sut.querymock)
+		_ = sut.sessionmock.Query(sut.insertStmt, sut.names).ExecRelease()
+
+		// act
+		result := sut.sessionmock.AssertConsistencyPolicy(sut.spy, sut.policy)
+
+		// assert
+		assert.False(t, result)
+		assert.Len(t, sut.spy.errors, 1)
+		assert.Equal(t, []Execution{{
+			Stmt:              sut.insertStmt,
+			Method:            "ExecRelease",
+			Kind:              StatementInsert,
+			Consistency:       gocql.Quorum,
+			SerialConsistency: gocql.Serial,
+		}}, sut.sessionmock.Executions())
+	})
+}
+
+func Test_Queryx_GetConsistency(t *testing.T) {
+	t.Run("Should fall back to gocql defaults outside a session", func(t *testing.T) {
+		// arrange
+		sut := makeConsistencySut()
+
+		// act / assert
+		assert.Equal(t, gocql.Quorum, sut.querymock.GetConsistency())
+		assert.Equal(t, gocql.Serial, sut.querymock.GetSerialConsistency())
+		sut.querymock.Consistency(gocql.LocalQuorum)
+		assert.Equal(t, gocql.LocalQuorum, sut.querymock.GetConsistency())
+	})
+}
@@ -0,0 +1,79 @@
+package gocqlxmock
+
+import (
+	"context"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// ContextMatcher reports whether a context.Context meets a condition.
+type ContextMatcher func(ctx context.Context) bool
+
+// MatchContext returns an argument matcher, to be used with On, AssertCalled
+// and friends in place of a context.Context, that matches contexts meeting
+// every one of matchers.
+//
+// Matchers run when the call is made, so for expectations they see the
+// cancellation state of the context at call time.
+func MatchContext(matchers ...ContextMatcher) interface{} {
+	return mock.MatchedBy(func(ctx context.Context) bool {
+		if ctx == nil {
+			return false
+		}
+
+		for _, matcher := range matchers {
+			if !matcher(ctx) {
+				return false
+			}
+		}
+
+		return true
+	})
+}
+
+// ContextValue matches contexts carrying value under key.
+func ContextValue(key, value interface{}) ContextMatcher {
+	return func(ctx context.Context) bool {
+		return assert.ObjectsAreEqual(value, ctx.Value(key))
+	}
+}
+
+// ContextHasValue matches contexts carrying any value under key.
+func ContextHasValue(key interface{}) ContextMatcher {
+	return func(ctx context.Context) bool {
+		return ctx.Value(key) != nil
+	}
+}
+
+// ContextDeadline matches contexts with a deadline.
+func ContextDeadline() ContextMatcher {
+	return func(ctx context.Context) bool {
+		_, ok := ctx.Deadline()
+		return ok
+	}
+}
+
+// ContextDeadlineWithin matches contexts whose deadline is at most d from now.
+func ContextDeadlineWithin(d time.Duration) ContextMatcher {
+	return func(ctx context.Context) bool {
+		deadline, ok := ctx.Deadline()
+		return ok && time.Until(deadline) <= d
+	}
+}
+
+// ContextCanceled matches contexts that are done, either canceled or past
+// their deadline.
+func ContextCanceled() ContextMatcher {
+	return func(ctx context.Context) bool {
+		return ctx.Err() != nil
+	}
+}
+
+// ContextActive matches contexts that are not done.
+func ContextActive() ContextMatcher {
+	return func(ctx context.Context) bool {
+		return ctx.Err() == nil
+	}
+}
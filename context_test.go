@@ -0,0 +1,108 @@
+package gocqlxmock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type tenantKey struct{}
+
+type contextSut struct {
+	stmt        string
+	names       []string
+	tenantA     context.Context
+	tenantB     context.Context
+	sessionmock *SessionxMock
+	queryA      *QueryxMock
+	queryB      *QueryxMock
+}
+
+func makeContextSut() contextSut {
+	return contextSut{
+		"statement",
+		[]string{"name"},
+		context.WithValue(context.Background(), tenantKey{}, "A"),
+		context.WithValue(context.Background(), tenantKey{}, "B"),
+		&SessionxMock{},
+		&QueryxMock{},
+		&QueryxMock{},
+	}
+}
+
+func Test_MatchContext(t *testing.T) {
+	t.Run("Should select the expectation by context value", func(t *testing.T) {
+		// arrange
+		sut := makeContextSut()
+		sut.sessionmock.On("ContextQuery", MatchContext(ContextValue(tenantKey{}, "A")), sut.stmt, sut.names).Return(sut.queryA)
+		sut.sessionmock.On("ContextQuery", MatchContext(ContextValue(tenantKey{}, "B")), sut.stmt, sut.names).Return(sut.queryB)
+
+		// act
+		resultB := sut.sessionmock.ContextQuery(sut.tenantB, sut.stmt, sut.names)
+		resultA := sut.sessionmock.ContextQuery(sut.tenantA, sut.stmt, sut.names)
+
+		// assert
+		assert.Same(t, sut.queryA, resultA)
+		assert.Same(t, sut.queryB, resultB)
+		assert.Equal(t, sut.tenantA, sut.queryA.Context())
+		sut.sessionmock.AssertCalled(t, "ContextQuery", MatchContext(ContextHasValue(tenantKey{})), sut.stmt, sut.names)
+	})
+
+	t.Run("Should not match context.Background when a value is required", func(t *testing.T) {
+		// arrange
+		sut := makeContextSut()
+		sut.queryA.On("WithContext", MatchContext(ContextValue(tenantKey{}, "A"))).Return(sut.queryA)
+
+		// act / assert
+		assert.Panics(t, func() { sut.queryA.WithContext(context.Background()) })
+		sut.queryA.AssertNotCalled(t, "WithContext", MatchContext(ContextValue(tenantKey{}, "A")))
+	})
+
+	t.Run("Should match contexts by deadline", func(t *testing.T) {
+		// arrange
+		sut := makeContextSut()
+		ctx, cancel := context.WithTimeout(sut.tenantA, time.Second)
+		defer cancel()
+		sut.queryA.On("WithContext", MatchContext(ContextDeadline(), ContextDeadlineWithin(2*time.Second))).Return(sut.queryA)
+		sut.queryA.On("WithContext", MatchContext()).Return(sut.queryB)
+
+		// act
+		withDeadline := sut.queryA.WithContext(ctx)
+		withoutDeadline := sut.queryA.WithContext(sut.tenantA)
+
+		// assert
+		assert.Same(t, sut.queryA, withDeadline)
+		assert.Same(t, sut.queryB, withoutDeadline)
+	})
+
+	t.Run("Should match contexts by cancellation state", func(t *testing.T) {
+		// arrange
+		sut := makeContextSut()
+		ctx, cancel := context.WithCancel(sut.tenantA)
+		cancel()
+		sut.queryA.On("WithContext", MatchContext(ContextCanceled())).Return(sut.queryB)
+		sut.queryA.On("WithContext", MatchContext(ContextActive())).Return(sut.queryA)
+
+		// act
+		canceled := sut.queryA.WithContext(ctx)
+		active := sut.queryA.WithContext(sut.tenantA)
+
+		// assert
+		assert.Same(t, sut.queryB, canceled)
+		assert.Same(t, sut.queryA, active)
+	})
+}
+
+func Test_Queryx_Context(t *testing.T) {
+	t.Run("Should fall back to Ctx and then to context.Background", func(t *testing.T) {
+		// arrange
+		sut := makeContextSut()
+		sut.queryB.Ctx = sut.tenantB
+
+		// act / assert
+		assert.Equal(t, context.Background(), sut.queryA.Context())
+		assert.Equal(t, sut.tenantB, sut.queryB.Context())
+	})
+}
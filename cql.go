@@ -0,0 +1,270 @@
+package gocqlxmock
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenQuotedIdent
+	tokenString
+	tokenNumber
+	tokenBlob
+	tokenUUID
+	tokenMarker
+	tokenSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// is reports whether the token is the keyword or symbol s, ignoring case.
+func (tok token) is(s string) bool {
+	return (tok.kind == tokenIdent || tok.kind == tokenSymbol) && strings.EqualFold(tok.text, s)
+}
+
+func (tok token) isLiteral() bool {
+	switch tok.kind {
+	case tokenString, tokenNumber, tokenBlob, tokenUUID:
+		return true
+	case tokenIdent:
+		return tok.is("true") || tok.is("false") || tok.is("null") || tok.is("NaN") || tok.is("Infinity")
+	default:
+		return false
+	}
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+
+// lexError is an error of lex at byte pos of the statement.
+type lexError struct {
+	msg string
+	pos int
+}
+
+func (err *lexError) Error() string {
+	return fmt.Sprintf("%s at position %d", err.msg, err.pos)
+}
+
+// lex splits a CQL statement into tokens, dropping comments and whitespace.
+func lex(stmt string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(stmt); {
+		c := stmt[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(stmt[i:], "--") || strings.HasPrefix(stmt[i:], "//"):
+			end := strings.IndexByte(stmt[i:], '\n')
+			if end < 0 {
+				return tokens, nil
+			}
+			i += end + 1
+		case strings.HasPrefix(stmt[i:], "/*"):
+			end := strings.Index(stmt[i+2:], "*/")
+			if end < 0 {
+				return nil, &lexError{"unterminated comment", i}
+			}
+			i += end + 4
+		case c == '\'':
+			text, n, err := lexQuoted(stmt[i:], '\'')
+			if err != nil {
+				return nil, &lexError{err.Error(), i}
+			}
+			tokens = append(tokens, token{tokenString, text, i})
+			i += n
+		case c == '"':
+			text, n, err := lexQuoted(stmt[i:], '"')
+			if err != nil {
+				return nil, &lexError{err.Error(), i}
+			}
+			tokens = append(tokens, token{tokenQuotedIdent, text, i})
+			i += n
+		case uuidPattern.MatchString(stmt[i:]):
+			tokens = append(tokens, token{tokenUUID, stmt[i : i+36], i})
+			i += 36
+		case c == '0' && i+1 < len(stmt) && (stmt[i+1] == 'x' || stmt[i+1] == 'X'):
+			n := 2
+			for i+n < len(stmt) && isHex(stmt[i+n]) {
+				n++
+			}
+			tokens = append(tokens, token{tokenBlob, stmt[i : i+n], i})
+			i += n
+		case isDigit(c) || (c == '-' && i+1 < len(stmt) && isDigit(stmt[i+1]) && !lastIsOperand(tokens)):
+			n := 1
+			for i+n < len(stmt) && (isDigit(stmt[i+n]) || stmt[i+n] == '.' || stmt[i+n] == 'e' || stmt[i+n] == 'E' ||
+				((stmt[i+n] == '-' || stmt[i+n] == '+') && (stmt[i+n-1] == 'e' || stmt[i+n-1] == 'E'))) {
+				n++
+			}
+			tokens = append(tokens, token{tokenNumber, stmt[i : i+n], i})
+			i += n
+		case isIdentStart(c):
+			n := 1
+			for i+n < len(stmt) && isIdentPart(stmt[i+n]) {
+				n++
+			}
+			tokens = append(tokens, token{tokenIdent, stmt[i : i+n], i})
+			i += n
+		case c == '?':
+			tokens = append(tokens, token{tokenMarker, "?", i})
+			i++
+		case c == ':' && i+1 < len(stmt) && isIdentStart(stmt[i+1]):
+			n := 2
+			for i+n < len(stmt) && isIdentPart(stmt[i+n]) {
+				n++
+			}
+			tokens = append(tokens, token{tokenMarker, stmt[i : i+n], i})
+			i += n
+		default:
+			n := 1
+			if i+1 < len(stmt) {
+				switch stmt[i : i+2] {
+				case "<=", ">=", "!=", "+=", "-=":
+					n = 2
+				}
+			}
+			if !strings.ContainsRune("()[]{},;=<>.*+-:", rune(c)) && n == 1 {
+				return nil, &lexError{fmt.Sprintf("unexpected character %q", c), i}
+			}
+			tokens = append(tokens, token{tokenSymbol, stmt[i : i+n], i})
+			i += n
+		}
+	}
+
+	return tokens, nil
+}
+
+func lexQuoted(s string, quote byte) (string, int, error) {
+	var b strings.Builder
+
+	for i := 1; i < len(s); i++ {
+		if s[i] != quote {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == quote {
+			b.WriteByte(quote)
+			i++
+			continue
+		}
+
+		return b.String(), i + 1, nil
+	}
+
+	return "", 0, fmt.Errorf("unterminated %c", quote)
+}
+
+func lastIsOperand(tokens []token) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+
+	last := tokens[len(tokens)-1]
+	return last.kind != tokenSymbol || last.text == ")" || last.text == "]" || last.text == "}"
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHex(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isIdentStart(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+// StatementKind is the kind of a CQL statement, given by its leading keyword.
+type StatementKind int
+
+const (
+	StatementOther StatementKind = iota
+	StatementSelect
+	StatementInsert
+	StatementUpdate
+	StatementDelete
+	StatementBatch
+	StatementSchema
+)
+
+func (kind StatementKind) String() string {
+	switch kind {
+	case StatementSelect:
+		return "SELECT"
+	case StatementInsert:
+		return "INSERT"
+	case StatementUpdate:
+		return "UPDATE"
+	case StatementDelete:
+		return "DELETE"
+	case StatementBatch:
+		return "BATCH"
+	case StatementSchema:
+		return "SCHEMA"
+	default:
+		return "OTHER"
+	}
+}
+
+// IsWrite reports whether statements of this kind modify data.
+func (kind StatementKind) IsWrite() bool {
+	switch kind {
+	case StatementInsert, StatementUpdate, StatementDelete, StatementBatch:
+		return true
+	default:
+		return false
+	}
+}
+
+// classify returns the kind of stmt and whether it is a lightweight
+// transaction, i.e. a write with an IF clause.
+func classify(stmt string) (kind StatementKind, lwt bool) {
+	tokens, err := lex(stmt)
+	if err != nil || len(tokens) == 0 {
+		return StatementOther, false
+	}
+
+	first := tokens[0]
+	switch {
+	case first.is("SELECT"):
+		kind = StatementSelect
+	case first.is("INSERT"):
+		kind = StatementInsert
+	case first.is("UPDATE"):
+		kind = StatementUpdate
+	case first.is("DELETE"):
+		kind = StatementDelete
+	case first.is("BEGIN"), first.is("APPLY"):
+		kind = StatementBatch
+	case first.is("CREATE"), first.is("ALTER"), first.is("DROP"):
+		kind = StatementSchema
+	default:
+		return StatementOther, false
+	}
+
+	if kind.IsWrite() {
+		for _, tok := range tokens[1:] {
+			if tok.is("IF") {
+				lwt = true
+				break
+			}
+		}
+	}
+
+	return kind, lwt
+}
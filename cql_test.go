@@ -0,0 +1,68 @@
+package gocqlxmock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Lex(t *testing.T) {
+	t.Run("Should split a statement into tokens", func(t *testing.T) {
+		// act
+		tokens, err := lex(`SELECT "Name", id FROM ks.potato -- comment
+			WHERE id = 123e4567-e89b-12d3-a456-426614174000 AND n >= -1.5 AND b = 0xCAFE AND s = 'it''s' AND m = :m /* x */ LIMIT ?;`)
+
+		// assert
+		assert.NoError(t, err)
+		var texts []string
+		var kinds []tokenKind
+		for _, tok := range tokens {
+			texts = append(texts, tok.text)
+			kinds = append(kinds, tok.kind)
+		}
+		assert.Equal(t, []string{
+			"SELECT", "Name", ",", "id", "FROM", "ks", ".", "potato",
+			"WHERE", "id", "=", "123e4567-e89b-12d3-a456-426614174000", "AND", "n", ">=", "-1.5",
+			"AND", "b", "=", "0xCAFE", "AND", "s", "=", "it's", "AND", "m", "=", ":m", "LIMIT", "?", ";",
+		}, texts)
+		assert.Equal(t, tokenQuotedIdent, kinds[1])
+		assert.Equal(t, tokenUUID, kinds[11])
+		assert.Equal(t, tokenNumber, kinds[15])
+		assert.Equal(t, tokenBlob, kinds[19])
+		assert.Equal(t, tokenString, kinds[23])
+		assert.Equal(t, tokenMarker, kinds[27])
+	})
+
+	t.Run("Should return error on unterminated strings", func(t *testing.T) {
+		// act
+		_, err := lex(`SELECT * FROM potato WHERE name = 'larry`)
+
+		// assert
+		assert.Error(t, err)
+	})
+}
+
+func Test_Classify(t *testing.T) {
+	t.Run("Should classify statements by their leading keyword", func(t *testing.T) {
+		for stmt, expected := range map[string]StatementKind{
+			"select * from potato":                                       StatementSelect,
+			"INSERT INTO potato (id) VALUES (?)":                         StatementInsert,
+			"UPDATE potato SET a = ? WHERE id = ?":                       StatementUpdate,
+			"DELETE FROM potato WHERE id = ?":                            StatementDelete,
+			"BEGIN BATCH INSERT INTO potato (id) VALUES (1) APPLY BATCH": StatementBatch,
+			"CREATE TABLE potato (id int PRIMARY KEY)":                   StatementSchema,
+			"USE ks": StatementOther,
+		} {
+			kind, _ := classify(stmt)
+			assert.Equal(t, expected, kind, stmt)
+		}
+	})
+
+	t.Run("Should detect lightweight transactions", func(t *testing.T) {
+		_, insertLWT := classify("INSERT INTO potato (id) VALUES (?) IF NOT EXISTS")
+		_, selectLWT := classify("SELECT * FROM potato")
+
+		assert.True(t, insertLWT)
+		assert.False(t, selectLWT)
+	})
+}
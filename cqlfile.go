@@ -0,0 +1,77 @@
+package gocqlxmock
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// LoadSchema runs the statements of the files of fsys matching pattern, such
+// as "schema/*.cql", in name order, the way cqlsh -f does: statements end
+// with ';' and USE sets the keyspace of the statements that follow it in its
+// file. Errors are prefixed with the file and line of the failing statement.
+func (session *FakeSessionx) LoadSchema(fsys fs.FS, pattern string) error {
+	names, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no schema files match %q", pattern)
+	}
+
+	for _, name := range names {
+		src, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		if err := session.loadSchema(name, string(src)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadSchema runs the statements of src, the content of the file name.
+func (session *FakeSessionx) loadSchema(name, src string) error {
+	tokens, err := lex(src)
+	if err != nil {
+		var lexErr *lexError
+		if errors.As(err, &lexErr) {
+			return fmt.Errorf("%s:%d: %s", name, lineOf(src, lexErr.pos), lexErr.msg)
+		}
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	loader := *session
+	for len(tokens) > 0 {
+		end := 0
+		for end < len(tokens) && !tokens[end].is(";") {
+			end++
+		}
+		stmt, stop := tokens[:end], len(src)
+		if end < len(tokens) {
+			stop = tokens[end].pos
+			end++
+		}
+		tokens = tokens[end:]
+
+		switch {
+		case len(stmt) == 0:
+		case stmt[0].is("USE") && len(stmt) == 2:
+			loader.keyspace = identifier(stmt[1])
+		default:
+			if err := loader.ExecStmt(src[stmt[0].pos:stop]); err != nil {
+				return fmt.Errorf("%s:%d: %w", name, lineOf(src, stmt[0].pos), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// lineOf returns the line of src byte pos is on.
+func lineOf(src string, pos int) int {
+	return 1 + strings.Count(src[:pos], "\n")
+}
@@ -0,0 +1,87 @@
+package gocqlxmock
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FakeSessionx_LoadSchema(t *testing.T) {
+	t.Run("Should run the statements of the files in name order", func(t *testing.T) {
+		// arrange
+		session := NewFakeSessionx()
+		fsys := fstest.MapFS{
+			"schema/001_keyspace.cql": migrationFile(`-- the keyspace
+CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1};
+USE ks;
+CREATE TYPE address (street text, number int);`),
+			"schema/002_tables.cql": migrationFile(`CREATE TABLE ks.potato (
+	id int PRIMARY KEY,
+	name text, -- ';' in comments and 'strings;' is fine
+	home frozen<address>
+);
+CREATE INDEX ON ks.potato (name)`),
+			"schema/README.md": migrationFile("not CQL"),
+		}
+
+		// act
+		err := session.LoadSchema(fsys, "schema/*.cql")
+
+		// assert
+		assert.NoError(t, err)
+		table, tableErr := session.Schema().Table("ks", "potato")
+		assert.NoError(t, tableErr)
+		assert.Equal(t, "potato_name_idx", table.Columns["name"].Index.Name)
+		assert.IsType(t, gocql.UDTTypeInfo{}, table.Columns["home"].Type)
+	})
+
+	t.Run("Should switch to quoted and mixed case keyspaces like CQL", func(t *testing.T) {
+		// arrange
+		session := NewFakeSessionx()
+		fsys := fstest.MapFS{
+			"schema.cql": migrationFile(`CREATE KEYSPACE "MyKs" WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1};
+CREATE KEYSPACE OtherKs WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1};
+USE "MyKs";
+CREATE TABLE potato (id int PRIMARY KEY);
+USE OtherKs;
+CREATE TABLE tomato (id int PRIMARY KEY);`),
+		}
+
+		// act
+		err := session.LoadSchema(fsys, "*.cql")
+
+		// assert
+		assert.NoError(t, err)
+		_, potatoErr := session.Schema().Table("MyKs", "potato")
+		_, tomatoErr := session.Schema().Table("otherks", "tomato")
+		assert.NoError(t, potatoErr)
+		assert.NoError(t, tomatoErr)
+	})
+
+	t.Run("Should report the file and line of failing statements", func(t *testing.T) {
+		// arrange
+		session := NewFakeSessionx()
+		fsys := fstest.MapFS{
+			"schema.cql": migrationFile(`CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1};
+
+CREATE TABLE ks.potato (id int PRIMARY KEY);
+CREATE INDEX ON ks.potato (name);`),
+			"broken.cql": migrationFile("CREATE KEYSPACE ks\nWITH replication = {'class: 1};"),
+		}
+
+		// act
+		err := session.LoadSchema(fsys, "schema.cql")
+		errLex := session.LoadSchema(fsys, "broken.cql")
+		errNone := session.LoadSchema(fsys, "*.txt")
+
+		// assert
+		assert.EqualError(t, err, "schema.cql:4: Undefined column name name")
+		var requestErr *RequestError
+		assert.True(t, errors.As(err, &requestErr))
+		assert.EqualError(t, errLex, "broken.cql:2: unterminated '")
+		assert.EqualError(t, errNone, `no schema files match "*.txt"`)
+	})
+}
@@ -0,0 +1,1468 @@
+package gocqlxmock
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gocql/gocql"
+)
+
+// appliedColumn is the column lightweight transactions report their outcome
+// in.
+const appliedColumn = "[applied]"
+
+// result is what a statement returns: its columns and serialized rows.
+type result struct {
+	columns []gocql.ColumnInfo
+	rows    [][][]byte
+}
+
+// predicate is a relation of a WHERE or IF clause, with its values bound.
+type predicate struct {
+	column   *gocql.ColumnMetadata
+	operator string
+	values   [][]byte
+}
+
+// test reports whether value, nil for null, satisfies the predicate.
+func (p predicate) test(value []byte) bool {
+	switch p.operator {
+	case "IN":
+		for _, v := range p.values {
+			if (value == nil) == (v == nil) && compareValues(p.column.Type, value, v) == 0 {
+				return true
+			}
+		}
+		return false
+	case "=":
+		return (value == nil) == (p.values[0] == nil) && compareValues(p.column.Type, value, p.values[0]) == 0
+	case "!=":
+		return (value == nil) != (p.values[0] == nil) || compareValues(p.column.Type, value, p.values[0]) != 0
+	}
+
+	if value == nil || p.values[0] == nil {
+		return false
+	}
+
+	if collection, ok := p.column.Type.(gocql.CollectionType); ok && strings.HasPrefix(p.operator, "CONTAINS") {
+		return contains(collection, value, p.values[0], p.operator == "CONTAINS KEY")
+	}
+
+	c := compareValues(p.column.Type, value, p.values[0])
+	switch p.operator {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	default:
+		return false
+	}
+}
+
+// restrictions are the predicates of a WHERE clause, sorted by what they
+// restrict.
+type restrictions struct {
+	predicates []predicate
+	// eq holds the values of the EQ and IN predicates on primary key
+	// columns.
+	eq map[string][][]byte
+	// slices holds the range predicates on clustering columns.
+	slices map[string][]predicate
+	// filtered holds the columns restricted in a way that needs filtering.
+	filtered []string
+	// indexed is the column restricted through its secondary index, if any.
+	indexed string
+}
+
+func restrict(table *gocql.TableMetadata, where []relation, ev evaluator) (*restrictions, error) {
+	res := &restrictions{eq: map[string][][]byte{}, slices: map[string][]predicate{}}
+
+	for _, rel := range where {
+		column, err := tableColumn(table, rel.column)
+		if err != nil {
+			return nil, err
+		}
+
+		values, err := ev.relationValues(rel, column.Type)
+		if err != nil {
+			return nil, err
+		}
+		p := predicate{column, rel.operator, values}
+		res.predicates = append(res.predicates, p)
+
+		key := column.Kind == gocql.ColumnPartitionKey || column.Kind == gocql.ColumnClusteringKey
+		switch {
+		case key && (rel.operator == "=" || rel.operator == "IN"):
+			if _, ok := res.eq[column.Name]; ok || len(res.slices[column.Name]) > 0 {
+				return nil, invalidf("%s cannot be restricted by more than one relation if it includes an Equal", column.Name)
+			}
+			for _, value := range values {
+				if value == nil {
+					return nil, invalidf("Invalid null value in condition for column %s", column.Name)
+				}
+			}
+			res.eq[column.Name] = values
+		case column.Kind == gocql.ColumnClusteringKey && rel.operator != "!=" && !strings.HasPrefix(rel.operator, "CONTAINS"):
+			if _, ok := res.eq[column.Name]; ok {
+				return nil, invalidf("%s cannot be restricted by more than one relation if it includes an Equal", column.Name)
+			}
+			res.slices[column.Name] = append(res.slices[column.Name], p)
+		case res.indexed == "" && indexes(column, rel.operator):
+			res.indexed = column.Name
+		default:
+			res.filtered = append(res.filtered, column.Name)
+		}
+	}
+
+	// Clustering columns can only be restricted by EQ and IN up to the one
+	// restricted by a range, without gaps, to read a contiguous slice.
+	sliced := false
+	for i, column := range table.ClusteringColumns {
+		_, eq := res.eq[column.Name]
+		slice := len(res.slices[column.Name]) > 0
+		if !eq && !slice {
+			for _, next := range table.ClusteringColumns[i+1:] {
+				if _, ok := res.eq[next.Name]; ok || len(res.slices[next.Name]) > 0 {
+					res.filtered = append(res.filtered, next.Name)
+				}
+			}
+			break
+		}
+		if sliced {
+			res.filtered = append(res.filtered, column.Name)
+		}
+		sliced = sliced || slice
+	}
+
+	return res, nil
+}
+
+// indexes reports whether the secondary index of column serves relations
+// with operator.
+func indexes(column *gocql.ColumnMetadata, operator string) bool {
+	target, _ := column.Index.Options["target"].(string)
+
+	switch operator {
+	case "=":
+		return target == column.Name || target == "full("+column.Name+")"
+	case "CONTAINS":
+		return target == "values("+column.Name+")"
+	case "CONTAINS KEY":
+		return target == "keys("+column.Name+")"
+	default:
+		return false
+	}
+}
+
+// partitionRestricted reports whether every partition key column is
+// restricted by EQ or IN.
+func (res *restrictions) partitionRestricted(table *gocql.TableMetadata) bool {
+	for _, column := range table.PartitionKey {
+		if _, ok := res.eq[column.Name]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// needsFiltering reports whether reading the restricted rows means scanning
+// and filtering more rows than it returns.
+func (res *restrictions) needsFiltering(table *gocql.TableMetadata) bool {
+	if len(res.filtered) > 0 {
+		return true
+	}
+	if res.partitionRestricted(table) {
+		return false
+	}
+
+	return len(res.eq) > 0 || len(res.slices) > 0
+}
+
+// missing returns the names of columns with no EQ or IN restriction.
+func (res *restrictions) missing(columns []*gocql.ColumnMetadata) []string {
+	var missing []string
+	for _, column := range columns {
+		if _, ok := res.eq[column.Name]; !ok {
+			missing = append(missing, column.Name)
+		}
+	}
+
+	return missing
+}
+
+// keys returns the combinations of the EQ and IN values of columns.
+func (res *restrictions) keys(columns []*gocql.ColumnMetadata) [][][]byte {
+	keys := [][][]byte{nil}
+	for _, column := range columns {
+		values, ok := res.eq[column.Name]
+		if !ok {
+			break
+		}
+
+		combined := make([][][]byte, 0, len(keys)*len(values))
+		for _, key := range keys {
+			for _, value := range values {
+				combined = append(combined, append(append([][]byte(nil), key...), value))
+			}
+		}
+		keys = combined
+	}
+
+	return keys
+}
+
+// relationValues returns the serialized values of rel on a column of type
+// typ, or of the type of its elements or keys for CONTAINS relations.
+func (ev evaluator) relationValues(rel relation, typ gocql.TypeInfo) ([][]byte, error) {
+	if strings.HasPrefix(rel.operator, "CONTAINS") {
+		collection, ok := typ.(gocql.CollectionType)
+		switch {
+		case !ok:
+			return nil, invalidf("Cannot use %s on non-collection column %s", rel.operator, rel.column)
+		case rel.operator == "CONTAINS KEY" && collection.Type() != gocql.TypeMap:
+			return nil, invalidf("Cannot use CONTAINS KEY on non-map column %s", rel.column)
+		case rel.operator == "CONTAINS KEY":
+			typ = collection.Key
+		default:
+			typ = collection.Elem
+		}
+	}
+
+	if rel.operator != "IN" {
+		value, err := ev.bytes(rel.value, typ)
+		if err == errUnset {
+			return nil, invalidf("Invalid unset value for column %s", rel.column)
+		}
+		return [][]byte{value}, err
+	}
+
+	if !rel.inMarker {
+		values := make([][]byte, 0, len(rel.values))
+		for _, t := range rel.values {
+			value, err := ev.bytes(t, typ)
+			if err == errUnset {
+				return nil, invalidf("Invalid unset value for column %s", rel.column)
+			}
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	}
+
+	list, err := ev.value(rel.value, typ)
+	if err == errUnset {
+		return nil, invalidf("Invalid unset value for column %s", rel.column)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, invalidf("Invalid list value for IN relation on %s: %T", rel.column, list)
+	}
+	values := make([][]byte, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		value, err := gocql.Marshal(typ, v.Index(i).Interface())
+		if err != nil {
+			return nil, invalidf("%s", err)
+		}
+		values = append(values, canonical(typ, value))
+	}
+
+	return values, nil
+}
+
+// int returns the value of t as an integer, such as a LIMIT or a TTL.
+func (ev evaluator) int(t term, typ gocql.Type, what string) (int64, bool, error) {
+	info := nativeType(typ)
+	data, err := ev.bytes(t, info)
+	if err == errUnset || err == nil && data == nil {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	value, err := decode(info, data)
+	if err != nil {
+		return 0, false, invalidf("Invalid value for %s: %s", what, err)
+	}
+
+	return reflect.ValueOf(value).Int(), true, nil
+}
+
+func tableColumn(table *gocql.TableMetadata, name string) (*gocql.ColumnMetadata, error) {
+	column, ok := table.Columns[name]
+	if !ok {
+		return nil, invalidf("Undefined column name %s", name)
+	}
+
+	return column, nil
+}
+
+// rowValue returns the value of column for row r of partition p at now, r
+// being nil for partitions with only static values.
+func rowValue(p *partition, r *row, column *gocql.ColumnMetadata, now int64) []byte {
+	switch column.Kind {
+	case gocql.ColumnPartitionKey:
+		return p.key[column.ComponentIndex]
+	case gocql.ColumnClusteringKey:
+		if r == nil || column.ComponentIndex >= len(r.clustering) {
+			return nil
+		}
+		return r.clustering[column.ComponentIndex]
+	case gocql.ColumnStatic:
+		return p.static.value(column.Name, now)
+	default:
+		return r.value(column.Name, now)
+	}
+}
+
+// rowCell returns the live cell of column for row r of partition p at now.
+func rowCell(p *partition, r *row, column *gocql.ColumnMetadata, now int64) *cell {
+	if column.Kind == gocql.ColumnStatic {
+		return p.static.live(column.Name, now)
+	}
+
+	return r.live(column.Name, now)
+}
+
+// allColumns returns the columns of table the way SELECT * orders them:
+// partition key, clustering key, then the others by name.
+func allColumns(table *gocql.TableMetadata) []*gocql.ColumnMetadata {
+	columns := append([]*gocql.ColumnMetadata(nil), table.PartitionKey...)
+	columns = append(columns, table.ClusteringColumns...)
+
+	var others []*gocql.ColumnMetadata
+	for _, column := range table.Columns {
+		if column.Kind != gocql.ColumnPartitionKey && column.Kind != gocql.ColumnClusteringKey {
+			others = append(others, column)
+		}
+	}
+	sort.Slice(others, func(i, j int) bool { return others[i].Name < others[j].Name })
+
+	return append(columns, others...)
+}
+
+func columnInfo(table *gocql.TableMetadata, name string, typ gocql.TypeInfo) gocql.ColumnInfo {
+	return gocql.ColumnInfo{Keyspace: table.Keyspace, Table: table.Name, Name: name, TypeInfo: typ}
+}
+
+// selected is a column of the result of a SELECT.
+type selected struct {
+	column   *gocql.ColumnMetadata
+	function string
+}
+
+// value returns the selected value for row r of partition p at now.
+func (sel selected) value(p *partition, r *row, now int64) []byte {
+	switch sel.function {
+	case "writetime":
+		c := rowCell(p, r, sel.column, now)
+		if c == nil {
+			return nil
+		}
+		data, _ := gocql.Marshal(nativeType(gocql.TypeBigInt), c.timestamp)
+		return data
+	case "ttl":
+		c := rowCell(p, r, sel.column, now)
+		if c == nil || c.expires == 0 {
+			return nil
+		}
+		data, _ := gocql.Marshal(nativeType(gocql.TypeInt), c.expires-now)
+		return data
+	default:
+		return rowValue(p, r, sel.column, now)
+	}
+}
+
+// selectedRow is a row read by a SELECT, r being nil for partitions with
+// only static values.
+type selectedRow struct {
+	p *partition
+	r *row
+}
+
+func (s *store) selectRows(table *gocql.TableMetadata, stmt *selectStmt, ev evaluator) (*result, error) {
+	now := ev.now.Unix()
+
+	res, err := restrict(table, stmt.where, ev)
+	if err != nil {
+		return nil, err
+	}
+	if res.needsFiltering(table) && !stmt.allowFiltering {
+		return nil, invalidf("Cannot execute this query as it might involve data filtering and thus may have unpredictable performance. " +
+			"If you want to execute this query despite the performance unpredictability, use ALLOW FILTERING")
+	}
+
+	var (
+		selection []selected
+		infos     []gocql.ColumnInfo
+		count     = -1
+	)
+	if stmt.selectors == nil {
+		for _, column := range allColumns(table) {
+			selection = append(selection, selected{column: column})
+			infos = append(infos, columnInfo(table, column.Name, column.Type))
+		}
+	}
+	for i, sel := range stmt.selectors {
+		name := sel.alias
+		if sel.function == "count" {
+			if name == "" {
+				name = "count"
+			}
+			count = i
+			selection = append(selection, selected{function: "count"})
+			infos = append(infos, columnInfo(table, name, nativeType(gocql.TypeBigInt)))
+			continue
+		}
+
+		column, err := tableColumn(table, sel.column)
+		if err != nil {
+			return nil, err
+		}
+
+		typ := column.Type
+		switch sel.function {
+		case "writetime", "ttl":
+			if column.Kind == gocql.ColumnPartitionKey || column.Kind == gocql.ColumnClusteringKey {
+				return nil, invalidf("Cannot use selection function %s on PRIMARY KEY part %s", functionName(sel.function), column.Name)
+			}
+			if column.Type.Type() == gocql.TypeCounter {
+				return nil, invalidf("Cannot use selection function %s on counter column %s", functionName(sel.function), column.Name)
+			}
+			typ = nativeType(gocql.TypeBigInt)
+			if sel.function == "ttl" {
+				typ = nativeType(gocql.TypeInt)
+			}
+			if name == "" {
+				name = sel.function + "(" + column.Name + ")"
+			}
+		}
+		if name == "" {
+			name = column.Name
+		}
+
+		selection = append(selection, selected{column, sel.function})
+		infos = append(infos, columnInfo(table, name, typ))
+	}
+
+	if stmt.distinct {
+		if err := checkDistinct(table, selection); err != nil {
+			return nil, err
+		}
+	}
+
+	reversed, err := ordering(table, stmt, res)
+	if err != nil {
+		return nil, err
+	}
+
+	limit, _, err := ev.int(termOrNull(stmt.limit), gocql.TypeInt, "limit")
+	if err != nil {
+		return nil, err
+	}
+	perPartitionLimit, _, err := ev.int(termOrNull(stmt.perPartitionLimit), gocql.TypeInt, "per partition limit")
+	if err != nil {
+		return nil, err
+	}
+	if stmt.limit != nil && limit <= 0 || stmt.perPartitionLimit != nil && perPartitionLimit <= 0 {
+		return nil, invalidf("LIMIT must be strictly positive")
+	}
+
+	var rows []selectedRow
+	for _, p := range s.partitions(table, res) {
+		partitionRows := p.selectRows(res, stmt.distinct, now)
+		if reversed {
+			for i, j := 0, len(partitionRows)-1; i < j; i, j = i+1, j-1 {
+				partitionRows[i], partitionRows[j] = partitionRows[j], partitionRows[i]
+			}
+		}
+		if perPartitionLimit > 0 && int64(len(partitionRows)) > perPartitionLimit {
+			partitionRows = partitionRows[:perPartitionLimit]
+		}
+		rows = append(rows, partitionRows...)
+	}
+
+	if reversed || len(stmt.orderBy) > 0 {
+		sort.SliceStable(rows, func(i, j int) bool {
+			c := compareClustering(table, clusteringOf(rows[i]), clusteringOf(rows[j]))
+			if reversed {
+				return c > 0
+			}
+			return c < 0
+		})
+	}
+
+	if count >= 0 {
+		counted := make([][]byte, len(selection))
+		for i, sel := range selection {
+			switch {
+			case i == count:
+				counted[i], _ = gocql.Marshal(nativeType(gocql.TypeBigInt), int64(len(rows)))
+			case len(rows) > 0:
+				counted[i] = sel.value(rows[0].p, rows[0].r, now)
+			}
+		}
+		return &result{columns: infos, rows: [][][]byte{counted}}, nil
+	}
+
+	if limit > 0 && int64(len(rows)) > limit {
+		rows = rows[:limit]
+	}
+
+	out := &result{columns: infos, rows: make([][][]byte, 0, len(rows))}
+	for _, r := range rows {
+		values := make([][]byte, len(selection))
+		for i, sel := range selection {
+			values[i] = sel.value(r.p, r.r, now)
+		}
+		out.rows = append(out.rows, values)
+	}
+
+	return out, nil
+}
+
+func termOrNull(t *term) term {
+	if t == nil {
+		return term{kind: termLiteral, literal: token{kind: tokenIdent, text: "null"}}
+	}
+
+	return *t
+}
+
+func functionName(function string) string {
+	if function == "writetime" {
+		return "writeTime"
+	}
+
+	return function
+}
+
+func clusteringOf(r selectedRow) [][]byte {
+	if r.r == nil {
+		return nil
+	}
+
+	return r.r.clustering
+}
+
+func checkDistinct(table *gocql.TableMetadata, selection []selected) error {
+	selectedColumns := map[string]bool{}
+	for _, sel := range selection {
+		if sel.column == nil {
+			continue
+		}
+		if sel.column.Kind != gocql.ColumnPartitionKey && sel.column.Kind != gocql.ColumnStatic {
+			return invalidf("SELECT DISTINCT queries must only request partition key columns and/or static columns (not %s)", sel.column.Name)
+		}
+		selectedColumns[sel.column.Name] = true
+	}
+
+	for _, column := range table.PartitionKey {
+		if !selectedColumns[column.Name] {
+			return invalidf("SELECT DISTINCT queries must request all the partition key columns (missing %s)", column.Name)
+		}
+	}
+
+	return nil
+}
+
+// ordering validates the ORDER BY clause of stmt and reports whether it
+// reverses the clustering order.
+func ordering(table *gocql.TableMetadata, stmt *selectStmt, res *restrictions) (reversed bool, err error) {
+	if len(stmt.orderBy) == 0 {
+		return false, nil
+	}
+	if !res.partitionRestricted(table) {
+		return false, invalidf("ORDER BY is only supported when the partition key is restricted by an EQ or an IN.")
+	}
+
+	for i, name := range stmt.orderBy {
+		column, err := tableColumn(table, name)
+		if err != nil {
+			return false, err
+		}
+		if column.Kind != gocql.ColumnClusteringKey {
+			return false, invalidf("Order by is currently only supported on the clustered columns of the PRIMARY KEY, got %s", name)
+		}
+		if column.ComponentIndex != i {
+			return false, invalidf("Order by currently only support the ordering of columns following their declared order in the PRIMARY KEY")
+		}
+
+		columnReversed := stmt.descending[i] != (column.Order == gocql.DESC)
+		if i > 0 && columnReversed != reversed {
+			return false, invalidf("Unsupported order by relation")
+		}
+		reversed = columnReversed
+	}
+
+	return reversed, nil
+}
+
+// partitions returns the partitions of table a read with res looks at, in
+// token order.
+func (s *store) partitions(table *gocql.TableMetadata, res *restrictions) []*partition {
+	data := s.table(table, false)
+	if data == nil {
+		return nil
+	}
+	if !res.partitionRestricted(table) {
+		return data.sortedPartitions()
+	}
+
+	var partitions []*partition
+	seen := map[*partition]bool{}
+	for _, key := range res.keys(table.PartitionKey) {
+		if p := data.partition(key, false); p != nil && !seen[p] {
+			seen[p] = true
+			partitions = append(partitions, p)
+		}
+	}
+	sort.SliceStable(partitions, func(i, j int) bool { return partitions[i].token < partitions[j].token })
+
+	return partitions
+}
+
+// selectRows returns the rows of p live at now satisfying res, or the
+// partition alone when it only has static values.
+func (p *partition) selectRows(res *restrictions, distinct bool, now int64) []selectedRow {
+	var rows []selectedRow
+	for _, r := range p.rows {
+		if r.exists(now) && satisfies(res.predicates, p, r, now) {
+			rows = append(rows, selectedRow{p, r})
+			if distinct {
+				return []selectedRow{{p, nil}}
+			}
+		}
+	}
+
+	if len(rows) == 0 && p.static.exists(now) && satisfies(res.predicates, p, nil, now) {
+		rows = append(rows, selectedRow{p, nil})
+	}
+
+	return rows
+}
+
+func satisfies(predicates []predicate, p *partition, r *row, now int64) bool {
+	for _, pred := range predicates {
+		if !pred.test(rowValue(p, r, pred.column, now)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// mutationKind is what a mutation does to its row.
+type mutationKind int
+
+const (
+	mutateRow mutationKind = iota
+	deleteRow
+	deleteRange
+	deletePartition
+)
+
+// mutation is a change to a row, or to a range of rows, of a partition.
+type mutation struct {
+	table      *gocql.TableMetadata
+	kind       mutationKind
+	key        [][]byte
+	clustering [][]byte
+	timestamp  int64
+	// marker reports whether the mutation writes the row marker of an
+	// INSERT.
+	marker bool
+	// ttl and expires are the TTL of the marker and cells written, and
+	// when they expire.
+	ttl, expires int64
+	cells        map[string]cell
+	// counters are the increments of the counter columns written.
+	counters map[string]int64
+	// collections are the updates of the elements of the non-frozen
+	// collection columns written.
+	collections map[string][]collectionOp
+	// tombstone is the deletion of a deleteRange mutation.
+	tombstone rangeTombstone
+}
+
+func (s *store) apply(m mutation, now int64) {
+	p := s.table(m.table, true).partition(m.key, true)
+
+	switch m.kind {
+	case deletePartition:
+		p.deletePartition(m.timestamp)
+		return
+	case deleteRange:
+		p.deleteRange(m.tombstone)
+		return
+	}
+
+	var r *row
+	if m.clustering != nil || len(m.table.ClusteringColumns) == 0 {
+		r = p.row(m.table, m.clustering, true)
+	}
+
+	if m.kind == deleteRow {
+		p.deleteRow(r, m.timestamp)
+		return
+	}
+
+	if m.marker {
+		p.mark(r, cell{timestamp: m.timestamp, ttl: m.ttl, expires: m.expires}, now)
+	}
+	for name, c := range m.cells {
+		target := r
+		if m.table.Columns[name].Kind == gocql.ColumnStatic {
+			target = p.static
+		}
+		c.timestamp = m.timestamp
+		if !c.deleted {
+			c.ttl, c.expires = m.ttl, m.expires
+		}
+		p.write(target, name, c, now)
+	}
+	for name, delta := range m.counters {
+		target := r
+		if m.table.Columns[name].Kind == gocql.ColumnStatic {
+			target = p.static
+		}
+		p.add(target, name, delta, m.timestamp)
+	}
+	for name, ops := range m.collections {
+		target := r
+		if m.table.Columns[name].Kind == gocql.ColumnStatic {
+			target = p.static
+		}
+		c := cell{timestamp: m.timestamp, ttl: m.ttl, expires: m.expires}
+		p.update(target, m.table.Columns[name], ops, c, now)
+	}
+}
+
+// condition is the IF clause of a lightweight transaction.
+type condition struct {
+	ifNotExists bool
+	ifExists    bool
+	predicates  []predicate
+}
+
+// write is a planned INSERT, UPDATE or DELETE.
+type write struct {
+	table     *gocql.TableMetadata
+	mutations []mutation
+	// condition is the IF clause of a conditional write, nil otherwise.
+	condition *condition
+}
+
+// size returns the size of the keys and values w writes.
+func (w write) size() int {
+	size := 0
+	for _, m := range w.mutations {
+		for _, part := range m.key {
+			size += len(part)
+		}
+		for _, part := range m.clustering {
+			size += len(part)
+		}
+		for _, c := range m.cells {
+			size += len(c.value)
+		}
+		for _, ops := range m.collections {
+			for _, op := range ops {
+				size += len(op.key) + len(op.value)
+			}
+		}
+	}
+
+	return size
+}
+
+// check evaluates the condition of w against the row it writes at now, and
+// returns the row as a conditional write reports it.
+func (s *store) check(w write, now int64) (bool, [][]byte) {
+	p, r := s.locate(w.mutations[0])
+
+	applied := true
+	switch {
+	case w.condition.ifNotExists:
+		applied = !r.exists(now)
+	case w.condition.ifExists:
+		applied = r.exists(now)
+	default:
+		for _, pred := range w.condition.predicates {
+			var value []byte
+			if p != nil {
+				value = rowValue(p, r, pred.column, now)
+			}
+			if !pred.test(value) {
+				applied = false
+				break
+			}
+		}
+	}
+
+	columns := allColumns(w.table)
+	prior := make([][]byte, len(columns))
+	if r.exists(now) || p != nil && p.static.exists(now) {
+		for i, column := range columns {
+			prior[i] = rowValue(p, r, column, now)
+		}
+	}
+
+	return applied, prior
+}
+
+// locate returns the partition and row m writes, nil when they do not exist.
+func (s *store) locate(m mutation) (*partition, *row) {
+	var (
+		p *partition
+		r *row
+	)
+	if data := s.table(m.table, false); data != nil {
+		p = data.partition(m.key, false)
+	}
+	if p != nil && (m.clustering != nil || len(m.table.ClusteringColumns) == 0) {
+		r = p.row(m.table, m.clustering, false)
+	}
+
+	return p, r
+}
+
+// verify checks the collection updates of writes against the current value
+// of their columns, before any of them is applied, since setting or
+// deleting a list element by index fails on a missing one.
+func (s *store) verify(writes []write, now int64) error {
+	for _, w := range writes {
+		for _, m := range w.mutations {
+			for name, ops := range m.collections {
+				column := m.table.Columns[name]
+
+				var current []byte
+				if p, r := s.locate(m); p != nil {
+					current = rowValue(p, r, column, now)
+				}
+				if _, err := applyOps(column.Type.(gocql.CollectionType), current, ops); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// exec runs writes at once at now, applying all of them or, when one of
+// their conditions does not hold, none. It reports the outcome of
+// conditional writes like Scylla does: the [applied] column followed by the
+// prior values of the row of each condition.
+func (s *store) exec(writes []write, now int64) (*result, error) {
+	applied := true
+	var (
+		table  *gocql.TableMetadata
+		priors [][][]byte
+	)
+	for _, w := range writes {
+		if w.condition == nil {
+			continue
+		}
+		ok, prior := s.check(w, now)
+		applied = applied && ok
+		table = w.table
+		priors = append(priors, prior)
+	}
+
+	if applied {
+		if err := s.verify(writes, now); err != nil {
+			return nil, err
+		}
+		for _, w := range writes {
+			for _, m := range w.mutations {
+				s.apply(m, now)
+			}
+		}
+	}
+	if table == nil {
+		return &result{}, nil
+	}
+
+	data, _ := gocql.Marshal(nativeType(gocql.TypeBoolean), applied)
+	out := &result{columns: []gocql.ColumnInfo{columnInfo(table, appliedColumn, nativeType(gocql.TypeBoolean))}}
+	for _, column := range allColumns(table) {
+		out.columns = append(out.columns, columnInfo(table, column.Name, column.Type))
+	}
+	for _, prior := range priors {
+		out.rows = append(out.rows, append([][]byte{data}, prior...))
+	}
+
+	return out, nil
+}
+
+// writeDefaults are what writes fall back to when their USING clause does
+// not tell.
+type writeDefaults struct {
+	timestamp int64
+	ttl       int64
+}
+
+// writeTimestamp returns the timestamp of a write: the one of its USING
+// clause, falling back to timestamp.
+func (ev evaluator) writeTimestamp(u using, timestamp int64) (int64, error) {
+	if u.timestamp == nil {
+		return timestamp, nil
+	}
+
+	value, ok, err := ev.int(*u.timestamp, gocql.TypeBigInt, "timestamp")
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, invalidf("Invalid null value of timestamp")
+	}
+
+	return value, nil
+}
+
+// writeTTL returns the TTL of a write and when its cells expire: the TTL of
+// its USING clause, falling back to ttl, 0 meaning none.
+func (ev evaluator) writeTTL(u using, ttl int64) (int64, int64, error) {
+	if u.ttl != nil {
+		value, ok, err := ev.int(*u.ttl, gocql.TypeInt, "ttl")
+		if err != nil {
+			return 0, 0, err
+		}
+		if ok {
+			ttl = value
+		}
+	}
+
+	switch {
+	case ttl < 0:
+		return 0, 0, invalidf("A TTL must be greater or equal to 0, but was %d", ttl)
+	case ttl > maxTTL:
+		return 0, 0, invalidf("ttl is too large. requested (%d) maximum (%d)", ttl, maxTTL)
+	case ttl == 0:
+		return 0, 0, nil
+	default:
+		return ttl, ev.now.Unix() + ttl, nil
+	}
+}
+
+// conditions binds the IF clause of a write.
+func conditions(table *gocql.TableMetadata, ifNotExists, ifExists bool, relations []relation, ev evaluator) (*condition, error) {
+	if !ifNotExists && !ifExists && len(relations) == 0 {
+		return nil, nil
+	}
+
+	cond := &condition{ifNotExists: ifNotExists, ifExists: ifExists}
+	for _, rel := range relations {
+		column, err := tableColumn(table, rel.column)
+		if err != nil {
+			return nil, err
+		}
+		if column.Kind == gocql.ColumnPartitionKey || column.Kind == gocql.ColumnClusteringKey {
+			return nil, invalidf("PRIMARY KEY column '%s' cannot have IF conditions", column.Name)
+		}
+
+		values, err := ev.relationValues(rel, column.Type)
+		if err != nil {
+			return nil, err
+		}
+		cond.predicates = append(cond.predicates, predicate{column, rel.operator, values})
+	}
+
+	return cond, nil
+}
+
+// plan turns a write statement into the mutations it applies.
+func plan(table *gocql.TableMetadata, stmt interface{}, ev evaluator, defaults writeDefaults) (write, error) {
+	switch stmt := stmt.(type) {
+	case *insertStmt:
+		return planInsert(table, stmt, ev, defaults)
+	case *updateStmt:
+		return planUpdate(table, stmt, ev, defaults)
+	case *deleteStmt:
+		return planDelete(table, stmt, ev, defaults)
+	default:
+		return write{}, invalidf("Only INSERT, UPDATE and DELETE statements can be written")
+	}
+}
+
+func planInsert(table *gocql.TableMetadata, stmt *insertStmt, ev evaluator, defaults writeDefaults) (write, error) {
+	w := write{table: table}
+	if counterTable(table) {
+		return w, invalidf("INSERT statements are not allowed on counter tables, use UPDATE instead")
+	}
+
+	ts, err := ev.writeTimestamp(stmt.using, defaults.timestamp)
+	if err != nil {
+		return w, err
+	}
+	ttl, expires, err := ev.writeTTL(stmt.using, defaults.ttl)
+	if err != nil {
+		return w, err
+	}
+	if w.condition, err = conditions(table, stmt.ifNotExists, false, nil, ev); err != nil {
+		return w, err
+	}
+	if w.condition != nil && stmt.using.timestamp != nil {
+		return w, invalidf("Cannot provide custom timestamp for conditional updates")
+	}
+
+	m := mutation{
+		table:      table,
+		key:        make([][]byte, len(table.PartitionKey)),
+		clustering: make([][]byte, len(table.ClusteringColumns)),
+		timestamp:  ts,
+		marker:     true,
+		ttl:        ttl,
+		expires:    expires,
+		cells:      map[string]cell{},
+	}
+	seen := map[string]bool{}
+	for i, name := range stmt.columns {
+		column, err := tableColumn(table, name)
+		if err != nil {
+			return w, err
+		}
+		if seen[name] {
+			return w, invalidf("Multiple definitions found for column %s", name)
+		}
+		seen[name] = true
+
+		value, err := ev.bytes(stmt.values[i], column.Type)
+		switch column.Kind {
+		case gocql.ColumnPartitionKey, gocql.ColumnClusteringKey:
+			if err == errUnset {
+				return w, invalidf("Invalid unset value for column %s", name)
+			}
+			if err != nil {
+				return w, err
+			}
+			if value == nil {
+				return w, invalidf("Invalid null value in condition for column %s", name)
+			}
+			if column.Kind == gocql.ColumnPartitionKey {
+				m.key[column.ComponentIndex] = value
+			} else {
+				m.clustering[column.ComponentIndex] = value
+			}
+		default:
+			if err == errUnset {
+				continue
+			}
+			if err != nil {
+				return w, err
+			}
+			value = stored(column, value)
+			m.cells[name] = cell{value: value, deleted: value == nil}
+		}
+	}
+
+	var missing []string
+	for _, column := range table.PartitionKey {
+		if !seen[column.Name] {
+			missing = append(missing, column.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return w, invalidf("Some partition key parts are missing: %s", strings.Join(missing, ", "))
+	}
+	for _, column := range table.ClusteringColumns {
+		if !seen[column.Name] {
+			missing = append(missing, column.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return w, invalidf("Some clustering keys are missing: %s", strings.Join(missing, ", "))
+	}
+
+	w.mutations = []mutation{m}
+
+	return w, nil
+}
+
+func planUpdate(table *gocql.TableMetadata, stmt *updateStmt, ev evaluator, defaults writeDefaults) (write, error) {
+	w := write{table: table}
+
+	ts, err := ev.writeTimestamp(stmt.using, defaults.timestamp)
+	if err != nil {
+		return w, err
+	}
+	ttl, expires, err := ev.writeTTL(stmt.using, defaults.ttl)
+	if err != nil {
+		return w, err
+	}
+
+	counter := counterTable(table)
+	switch {
+	case counter && stmt.using.timestamp != nil:
+		return w, invalidf("Cannot provide custom timestamp for counter updates")
+	case counter && stmt.using.ttl != nil:
+		return w, invalidf("Cannot provide custom TTL for counter updates")
+	case counter && (stmt.ifExists || len(stmt.conditions) > 0):
+		return w, invalidf("Conditional updates are not supported on counter tables")
+	}
+
+	cells := map[string]cell{}
+	counters := map[string]int64{}
+	collections := map[string][]collectionOp{}
+	static := true
+	for _, a := range stmt.assignments {
+		column, err := tableColumn(table, a.column)
+		if err != nil {
+			return w, err
+		}
+		if column.Kind == gocql.ColumnPartitionKey || column.Kind == gocql.ColumnClusteringKey {
+			return w, invalidf("PRIMARY KEY part %s found in SET part", column.Name)
+		}
+		_, set := cells[column.Name]
+		_, added := counters[column.Name]
+		ops, updated := collections[column.Name]
+		if set || added || updated && (a.key == nil || ops[0].key == nil) {
+			return w, invalidf("Multiple incompatible setting of column %s", column.Name)
+		}
+		static = static && column.Kind == gocql.ColumnStatic
+
+		if counter {
+			delta, err := ev.counterDelta(a, column)
+			if err == errUnset {
+				continue
+			}
+			if err != nil {
+				return w, err
+			}
+			counters[column.Name] = delta
+			continue
+		}
+		if a.operator != "=" || a.key != nil {
+			op, err := ev.collectionOp(a, column)
+			if err == errUnset {
+				continue
+			}
+			if err != nil {
+				return w, err
+			}
+			collections[column.Name] = append(ops, op)
+			continue
+		}
+
+		value, err := ev.bytes(a.value, column.Type)
+		if err == errUnset {
+			continue
+		}
+		if err != nil {
+			return w, err
+		}
+		value = stored(column, value)
+		cells[column.Name] = cell{value: value, deleted: value == nil}
+	}
+
+	keys, err := writeKeys(table, stmt.where, ev, static, false)
+	if err != nil {
+		return w, err
+	}
+	for _, key := range keys {
+		w.mutations = append(w.mutations, mutation{
+			table:       table,
+			key:         key.partition,
+			clustering:  key.clustering,
+			timestamp:   ts,
+			ttl:         ttl,
+			expires:     expires,
+			cells:       cells,
+			counters:    counters,
+			collections: collections,
+		})
+	}
+
+	if w.condition, err = conditions(table, false, stmt.ifExists, stmt.conditions, ev); err != nil {
+		return w, err
+	}
+
+	return w, checkConditional(w, stmt.using)
+}
+
+// counterDelta returns what a of an UPDATE adds to the counter column.
+func (ev evaluator) counterDelta(a assignment, column *gocql.ColumnMetadata) (int64, error) {
+	if (a.operator != "+" && a.operator != "-") || a.key != nil {
+		return 0, invalidf("Cannot set the value of counter column %s (counters can only be incremented/decremented, not set)", column.Name)
+	}
+
+	data, err := ev.bytes(a.value, column.Type)
+	if err != nil {
+		return 0, err
+	}
+	if data == nil {
+		return 0, invalidf("Invalid null value for counter increment")
+	}
+
+	var delta int64
+	if err := gocql.Unmarshal(column.Type, data, &delta); err != nil {
+		return 0, invalidf("%s", err)
+	}
+	if a.operator == "-" {
+		delta = -delta
+	}
+
+	return delta, nil
+}
+
+// collectionOp returns the update a of an UPDATE makes to the elements of
+// the collection column.
+func (ev evaluator) collectionOp(a assignment, column *gocql.ColumnMetadata) (collectionOp, error) {
+	var operation string
+	switch {
+	case a.key != nil:
+		operation = fmt.Sprintf("%s[?] = ?", column.Name)
+	case a.operator == "prepend":
+		operation = fmt.Sprintf("%s = ? + %s", column.Name, column.Name)
+	default:
+		operation = fmt.Sprintf("%s = %s %s ?", column.Name, column.Name, a.operator)
+	}
+
+	typ, ok := column.Type.(gocql.CollectionType)
+	switch {
+	case !ok && a.key != nil:
+		return collectionOp{}, invalidf("Invalid operation (%s) for non collection column %s", operation, column.Name)
+	case !ok:
+		return collectionOp{}, invalidf("Invalid operation (%s) for non counter column %s", operation, column.Name)
+	case frozen(column):
+		return collectionOp{}, invalidf("Invalid operation (%s) for frozen collection column %s", operation, column.Name)
+	case a.operator == "prepend" && typ.Type() != gocql.TypeList:
+		return collectionOp{}, invalidf("Invalid operation (%s) for non list column %s", operation, column.Name)
+	case a.key != nil && typ.Type() == gocql.TypeSet:
+		return collectionOp{}, invalidf("Invalid operation (%s) for set column %s", operation, column.Name)
+	}
+
+	if a.key != nil {
+		key, err := ev.elementKey(*a.key, typ)
+		if err != nil {
+			return collectionOp{}, err
+		}
+		value, err := ev.bytes(a.value, typ.Elem)
+		if err != nil {
+			return collectionOp{}, err
+		}
+		return collectionOp{operator: "put", key: key, value: value}, nil
+	}
+
+	var operand gocql.TypeInfo = typ
+	if typ.Type() == gocql.TypeMap && a.operator == "-" {
+		operand = setOf(typ.Key)
+	}
+	value, err := ev.bytes(a.value, operand)
+	if err != nil {
+		return collectionOp{}, err
+	}
+
+	return collectionOp{operator: a.operator, value: value}, nil
+}
+
+// elementDeletion returns the update a DELETE of col[key] makes to the
+// elements of the collection column.
+func (ev evaluator) elementDeletion(del deletion, column *gocql.ColumnMetadata) (collectionOp, error) {
+	typ, ok := column.Type.(gocql.CollectionType)
+	if !ok || frozen(column) {
+		return collectionOp{}, invalidf("Invalid deletion operation for column %s of type %s", column.Name, column.Validator)
+	}
+
+	if typ.Type() == gocql.TypeSet {
+		elem, err := ev.bytes(*del.key, typ.Elem)
+		if err != nil {
+			return collectionOp{}, err
+		}
+		if elem == nil {
+			return collectionOp{}, invalidf("Invalid null value for set element")
+		}
+		return collectionOp{operator: "-", value: collection(typ, [][]byte{elem})}, nil
+	}
+
+	key, err := ev.elementKey(*del.key, typ)
+	if err != nil {
+		return collectionOp{}, err
+	}
+
+	return collectionOp{operator: "discard", key: key}, nil
+}
+
+// elementKey returns the serialized index of a list element, or key of a
+// map element.
+func (ev evaluator) elementKey(t term, typ gocql.CollectionType) ([]byte, error) {
+	if typ.Type() == gocql.TypeMap {
+		key, err := ev.bytes(t, typ.Key)
+		if err == nil && key == nil {
+			return nil, invalidf("Invalid null map key")
+		}
+		return key, err
+	}
+
+	index, ok, err := ev.int(t, gocql.TypeInt, "list index")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, invalidf("Invalid null value for list index")
+	}
+
+	return gocql.Marshal(nativeType(gocql.TypeInt), int32(index))
+}
+
+func planDelete(table *gocql.TableMetadata, stmt *deleteStmt, ev evaluator, defaults writeDefaults) (write, error) {
+	w := write{table: table}
+
+	ts, err := ev.writeTimestamp(stmt.using, defaults.timestamp)
+	if err != nil {
+		return w, err
+	}
+	if stmt.using.ttl != nil {
+		return w, invalidf("TTL attribute is not allowed for deletes")
+	}
+
+	cells := map[string]cell{}
+	collections := map[string][]collectionOp{}
+	static := len(stmt.columns) > 0
+	for _, del := range stmt.columns {
+		column, err := tableColumn(table, del.column)
+		if err != nil {
+			return w, err
+		}
+		if column.Kind == gocql.ColumnPartitionKey || column.Kind == gocql.ColumnClusteringKey {
+			return w, invalidf("Invalid identifier %s for deletion (should not be a PRIMARY KEY part)", column.Name)
+		}
+		static = static && column.Kind == gocql.ColumnStatic
+		if del.key == nil {
+			cells[column.Name] = cell{deleted: true}
+			continue
+		}
+
+		op, err := ev.elementDeletion(del, column)
+		if err == errUnset {
+			continue
+		}
+		if err != nil {
+			return w, err
+		}
+		collections[column.Name] = append(collections[column.Name], op)
+	}
+
+	keys, err := writeKeys(table, stmt.where, ev, static, len(stmt.columns) == 0)
+	if err != nil {
+		return w, err
+	}
+	for _, key := range keys {
+		m := mutation{
+			table:       table,
+			key:         key.partition,
+			clustering:  key.clustering,
+			timestamp:   ts,
+			cells:       cells,
+			collections: collections,
+		}
+		switch {
+		case len(stmt.columns) > 0:
+		case len(table.ClusteringColumns) == 0 || key.slice == nil && len(key.clustering) == len(table.ClusteringColumns):
+			m.kind = deleteRow
+		case key.slice == nil && len(key.clustering) == 0:
+			m.kind = deletePartition
+		default:
+			m.kind = deleteRange
+			m.tombstone = rangeTombstone{predicates: key.slice, timestamp: ts}
+		}
+		w.mutations = append(w.mutations, m)
+	}
+
+	if w.condition, err = conditions(table, false, stmt.ifExists, stmt.conditions, ev); err != nil {
+		return w, err
+	}
+	if w.condition != nil && w.mutations[0].kind != deleteRow && w.mutations[0].kind != mutateRow {
+		return w, invalidf("DELETE statements must restrict all PRIMARY KEY columns with equality relations in order to use IF conditions")
+	}
+
+	return w, checkConditional(w, stmt.using)
+}
+
+func checkConditional(w write, u using) error {
+	if w.condition == nil {
+		return nil
+	}
+	if u.timestamp != nil {
+		return invalidf("Cannot provide custom timestamp for conditional updates")
+	}
+	if len(w.mutations) > 1 {
+		return invalidf("IN on the clustering key columns is not supported with conditional updates")
+	}
+
+	return nil
+}
+
+// writeKey is a row, or a range of rows, an UPDATE or DELETE writes.
+type writeKey struct {
+	partition  [][]byte
+	clustering [][]byte
+	// slice holds the predicates of a range deletion: EQ predicates on a
+	// clustering prefix, followed by range predicates on the next column.
+	slice []predicate
+}
+
+// writeKeys returns the rows an UPDATE or DELETE with where writes. Writes
+// of static columns only need the partition key, deletions of rows accept a
+// clustering prefix or range.
+func writeKeys(table *gocql.TableMetadata, where []relation, ev evaluator, static, ranges bool) ([]writeKey, error) {
+	res, err := restrict(table, where, ev)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range res.predicates {
+		if p.column.Kind != gocql.ColumnPartitionKey && p.column.Kind != gocql.ColumnClusteringKey {
+			return nil, invalidf("Non PRIMARY KEY columns found in where clause: %s", p.column.Name)
+		}
+	}
+	if missing := res.missing(table.PartitionKey); len(missing) > 0 {
+		return nil, invalidf("Some partition key parts are missing: %s", strings.Join(missing, ", "))
+	}
+	if len(res.filtered) > 0 {
+		return nil, invalidf("PRIMARY KEY column \"%s\" cannot be restricted as preceding column is not restricted", res.filtered[0])
+	}
+
+	missing := res.missing(table.ClusteringColumns)
+	sliced := len(res.slices) > 0
+	switch {
+	case static && len(missing) == len(table.ClusteringColumns) && !sliced:
+	case ranges && len(missing) > 0:
+	case sliced:
+		return nil, invalidf("Slice restrictions are not supported on the clustering columns in UPDATE statements")
+	case len(missing) > 0:
+		return nil, invalidf("Some clustering keys are missing: %s", strings.Join(missing, ", "))
+	}
+
+	var keys []writeKey
+	for _, partitionKey := range res.keys(table.PartitionKey) {
+		for _, clustering := range res.keys(table.ClusteringColumns) {
+			key := writeKey{partition: partitionKey, clustering: clustering}
+			if ranges && (sliced || len(clustering) > 0 && len(clustering) < len(table.ClusteringColumns)) {
+				for i, value := range clustering {
+					key.slice = append(key.slice, predicate{table.ClusteringColumns[i], "=", [][]byte{value}})
+				}
+				if sliced {
+					key.slice = append(key.slice, res.slices[table.ClusteringColumns[len(clustering)].Name]...)
+				}
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,737 @@
+package gocqlxmock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Guilospanck/igocqlx"
+	"github.com/gocql/gocql"
+	"github.com/scylladb/gocqlx/v2"
+)
+
+var (
+	_ IBatchSessionx  = &FakeSessionx{}
+	_ igocqlx.IQueryx = &FakeQueryx{}
+	_ IBatchx         = &FakeBatchx{}
+)
+
+// cluster is the state the sessions of a FakeSessionx share.
+type cluster struct {
+	mu     sync.Mutex
+	schema *Schema
+	store  *store
+	clock  Clock
+	// last is the last timestamp the server gave a write.
+	last       int64
+	thresholds batchThresholds
+}
+
+// FakeSessionx is a stateful igocqlx.ISessionx: instead of matching
+// expectations, it runs statements against an in-memory schema and store
+// the way Scylla does. It is safe for concurrent use once configured.
+type FakeSessionx struct {
+	cluster     *cluster
+	keyspace    string
+	clientClock Clock
+	// last is the last timestamp the client gave a write, guarded by the
+	// lock of the cluster.
+	last int64
+}
+
+// NewFakeSessionx returns a FakeSessionx with an empty schema, telling the
+// time with SystemClock.
+func NewFakeSessionx() *FakeSessionx {
+	return &FakeSessionx{
+		cluster: &cluster{
+			schema: NewSchema(),
+			store:  newStore(),
+			clock:  SystemClock,
+		},
+	}
+}
+
+// WithKeyspace sets the keyspace unqualified names refer to.
+func (session *FakeSessionx) WithKeyspace(keyspace string) *FakeSessionx {
+	session.keyspace = keyspace
+
+	return session
+}
+
+// WithClock sets the clock of the server, which expires cells written with
+// a TTL and timestamps the writes of queries with DefaultTimestamp(false) and
+// lightweight transactions.
+func (session *FakeSessionx) WithClock(clock Clock) *FakeSessionx {
+	session.cluster.mu.Lock()
+	defer session.cluster.mu.Unlock()
+
+	session.cluster.clock = clock
+
+	return session
+}
+
+// WithClientClock sets the clock of the client, which timestamps writes by
+// default. It falls back to the clock of the server.
+func (session *FakeSessionx) WithClientClock(clock Clock) *FakeSessionx {
+	session.clientClock = clock
+
+	return session
+}
+
+// Client returns another session to the same cluster, whose client clock is
+// clock, to simulate clients with skewed clocks.
+func (session *FakeSessionx) Client(clock Clock) *FakeSessionx {
+	return &FakeSessionx{
+		cluster:     session.cluster,
+		keyspace:    session.keyspace,
+		clientClock: clock,
+	}
+}
+
+// WithBatchSizeThresholds sets the sizes, in bytes, past which batches are
+// warned about and rejected with "Batch too large". The size of a batch is
+// the size of the keys and values it writes.
+func (session *FakeSessionx) WithBatchSizeThresholds(warn, fail int) *FakeSessionx {
+	session.cluster.mu.Lock()
+	defer session.cluster.mu.Unlock()
+
+	session.cluster.thresholds.warn, session.cluster.thresholds.fail = warn, fail
+
+	return session
+}
+
+// BatchWarnings returns the warnings about the size of the batches run so
+// far.
+func (session *FakeSessionx) BatchWarnings() []string {
+	session.cluster.mu.Lock()
+	defer session.cluster.mu.Unlock()
+
+	return append([]string(nil), session.cluster.thresholds.warnings...)
+}
+
+// Schema returns the schema of the session.
+func (session *FakeSessionx) Schema() *Schema {
+	return session.cluster.schema
+}
+
+func (session *FakeSessionx) ContextQuery(ctx context.Context, stmt string, names []string) igocqlx.IQueryx {
+	return &FakeQueryx{
+		session:          session,
+		ctx:              ctx,
+		stmt:             stmt,
+		bindNames:        names,
+		defaultTimestamp: true,
+	}
+}
+
+func (session *FakeSessionx) Query(stmt string, names []string) igocqlx.IQueryx {
+	return session.ContextQuery(context.Background(), stmt, names)
+}
+
+// ExecStmt runs the DDL or DML statement stmt.
+func (session *FakeSessionx) ExecStmt(stmt string) error {
+	_, err := session.exec(context.Background(), stmt, nil, true, nil)
+
+	return err
+}
+
+func (session *FakeSessionx) AwaitSchemaAgreement(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (session *FakeSessionx) Close() {}
+
+// timestamp returns the timestamp of a write, telling the time with clock.
+// Timestamps of a clock never go backwards nor repeat, like the ones of the
+// server, so that writes of a test with a FakeClock are ordered.
+func timestamp(clock Clock, last *int64) int64 {
+	ts := clock.Now().UnixNano() / 1000
+	if ts <= *last {
+		ts = *last + 1
+	}
+	*last = ts
+
+	return ts
+}
+
+// exec runs stmt with values. Writes are timestamped by the client when
+// defaultTimestamp is set, with explicit when given, and by the server
+// otherwise.
+func (session *FakeSessionx) exec(ctx context.Context, stmt string, values []interface{}, defaultTimestamp bool, explicit *int64) (*result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if kind, _ := classify(stmt); kind == StatementSchema {
+		if err := session.execSchema(stmt); err != nil {
+			return nil, err
+		}
+		return &result{}, nil
+	}
+
+	parsed, err := parseBound(stmt, values)
+	if err != nil {
+		return nil, err
+	}
+
+	c := session.cluster
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock.Now()
+	ev := evaluator{values: values, now: now}
+
+	table, err := session.table(parsed.stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := parsed.stmt.(*selectStmt); ok {
+		return c.store.selectRows(table, s, ev)
+	}
+
+	_, lwt := classify(stmt)
+	ts := session.writeTimestamp(lwt, defaultTimestamp, explicit)
+	w, err := plan(table, parsed.stmt, ev, writeDefaults{ts, c.schema.defaultTTL(table)})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.store.exec([]write{w}, now.Unix())
+}
+
+// execSchema applies the DDL statement stmt, dropping the data of the tables
+// and columns it drops.
+func (session *FakeSessionx) execSchema(stmt string) error {
+	c := session.cluster
+	if err := c.schema.Exec(session.keyspace, stmt); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.store.prune(c.schema)
+
+	return nil
+}
+
+// parseBound parses the DML statement stmt, checking that values binds all
+// of its markers.
+func parseBound(stmt string, values []interface{}) (dml, error) {
+	parsed, err := parseDML(stmt)
+	if err != nil {
+		return dml{}, err
+	}
+	if parsed.markers != len(values) {
+		return dml{}, invalidf("Invalid amount of bind variables: expected %d, got %d", parsed.markers, len(values))
+	}
+
+	return parsed, nil
+}
+
+// table returns the table a DML statement refers to. It is called with the
+// lock of the cluster held.
+func (session *FakeSessionx) table(stmt interface{}) (*gocql.TableMetadata, error) {
+	c := session.cluster
+
+	keyspace, name := statementName(stmt)
+	if keyspace == "" {
+		keyspace = session.keyspace
+	}
+	if _, err := c.schema.lookupKeyspace(keyspace, ""); err != nil {
+		return nil, err
+	}
+
+	return c.schema.Table(keyspace, name)
+}
+
+// writeTimestamp returns the timestamp of a write. It is called with the
+// lock of the cluster held.
+func (session *FakeSessionx) writeTimestamp(lwt, defaultTimestamp bool, explicit *int64) int64 {
+	c := session.cluster
+
+	ts := timestamp(c.clock, &c.last)
+	switch {
+	case lwt, !defaultTimestamp:
+	case explicit != nil:
+		ts = *explicit
+	case session.clientClock != nil:
+		ts = timestamp(session.clientClock, &session.last)
+	}
+
+	return ts
+}
+
+// statementName returns the keyspace and table a DML statement refers to.
+func statementName(stmt interface{}) (keyspace, table string) {
+	switch stmt := stmt.(type) {
+	case *selectStmt:
+		return stmt.keyspace, stmt.table
+	case *insertStmt:
+		return stmt.keyspace, stmt.table
+	case *updateStmt:
+		return stmt.keyspace, stmt.table
+	case *deleteStmt:
+		return stmt.keyspace, stmt.table
+	default:
+		return "", ""
+	}
+}
+
+// FakeQueryx is a query of a FakeSessionx. Like a gocqlx.Queryx, it is not
+// safe for concurrent use.
+type FakeQueryx struct {
+	session   *FakeSessionx
+	ctx       context.Context
+	stmt      string
+	bindNames []string
+	values    []interface{}
+	err       error
+	tr        gocqlx.Transformer
+
+	defaultTimestamp bool
+	timestamp        *int64
+}
+
+func (query *FakeQueryx) bind(values []interface{}, err error) igocqlx.IQueryx {
+	query.values, query.err = values, err
+
+	return query
+}
+
+func (query *FakeQueryx) statement() string {
+	return query.stmt
+}
+
+func (query *FakeQueryx) names() []string {
+	return query.bindNames
+}
+
+func (query *FakeQueryx) transformer() gocqlx.Transformer {
+	if query.tr != nil {
+		return query.tr
+	}
+
+	return gocqlx.DefaultBindTransformer
+}
+
+func (query *FakeQueryx) WithBindTransformer(tr gocqlx.Transformer) igocqlx.IQueryx {
+	query.tr = tr
+
+	return query
+}
+
+func (query *FakeQueryx) BindStruct(arg interface{}) igocqlx.IQueryx {
+	return query.bind(bindStructValues(query.bindNames, query.transformer(), arg, nil))
+}
+
+func (query *FakeQueryx) BindStructMap(arg0 interface{}, arg1 map[string]interface{}) igocqlx.IQueryx {
+	return query.bind(bindStructValues(query.bindNames, query.transformer(), arg0, arg1))
+}
+
+func (query *FakeQueryx) BindMap(arg map[string]interface{}) igocqlx.IQueryx {
+	return query.bind(bindMapValues(query.bindNames, query.transformer(), arg))
+}
+
+func (query *FakeQueryx) Bind(v ...interface{}) igocqlx.IQueryx {
+	return query.bind(v, nil)
+}
+
+func (query *FakeQueryx) Err() error {
+	return query.err
+}
+
+// iter runs the query.
+func (query *FakeQueryx) iter() *FakeIterx {
+	if query.err != nil {
+		return &FakeIterx{err: query.err}
+	}
+
+	res, err := query.session.exec(query.ctx, query.stmt, query.values, query.defaultTimestamp, query.timestamp)
+	if err != nil {
+		return &FakeIterx{err: err}
+	}
+
+	return newFakeIterx(res)
+}
+
+func (query *FakeQueryx) Exec() error {
+	return query.iter().Close()
+}
+
+func (query *FakeQueryx) ExecRelease() error {
+	return query.Exec()
+}
+
+func (query *FakeQueryx) ExecCAS() (applied bool, err error) {
+	iter := query.iter()
+	iter.StructOnly()
+	if err := iter.Get(&struct{}{}); err != nil {
+		return false, err
+	}
+
+	return iter.applied, iter.Close()
+}
+
+func (query *FakeQueryx) ExecCASRelease() (bool, error) {
+	return query.ExecCAS()
+}
+
+func (query *FakeQueryx) Get(dest interface{}) error {
+	return query.iter().Get(dest)
+}
+
+func (query *FakeQueryx) GetRelease(dest interface{}) error {
+	return query.Get(dest)
+}
+
+func (query *FakeQueryx) GetCAS(dest interface{}) (applied bool, err error) {
+	iter := query.iter()
+	if err := iter.Get(dest); err != nil {
+		return false, err
+	}
+
+	return iter.applied, iter.Close()
+}
+
+func (query *FakeQueryx) GetCASRelease(dest interface{}) (bool, error) {
+	return query.GetCAS(dest)
+}
+
+func (query *FakeQueryx) Select(dest interface{}) error {
+	return query.iter().Select(dest)
+}
+
+func (query *FakeQueryx) SelectRelease(dest interface{}) error {
+	return query.Select(dest)
+}
+
+func (query *FakeQueryx) Iter() igocqlx.IIterx {
+	return query.iter()
+}
+
+func (query *FakeQueryx) Consistency(c gocql.Consistency) igocqlx.IQueryx {
+	return query
+}
+
+func (query *FakeQueryx) CustomPayload(customPayload map[string][]byte) igocqlx.IQueryx {
+	return query
+}
+
+func (query *FakeQueryx) Trace(trace gocql.Tracer) igocqlx.IQueryx {
+	return query
+}
+
+func (query *FakeQueryx) Observer(observer gocql.QueryObserver) igocqlx.IQueryx {
+	return query
+}
+
+func (query *FakeQueryx) PageSize(n int) igocqlx.IQueryx {
+	return query
+}
+
+func (query *FakeQueryx) DefaultTimestamp(enable bool) igocqlx.IQueryx {
+	query.defaultTimestamp = enable
+
+	return query
+}
+
+// WithTimestamp sets the timestamp of the writes of the query, enabling
+// DefaultTimestamp like gocql does.
+func (query *FakeQueryx) WithTimestamp(timestamp int64) igocqlx.IQueryx {
+	query.defaultTimestamp = true
+	query.timestamp = &timestamp
+
+	return query
+}
+
+func (query *FakeQueryx) RoutingKey(routingKey []byte) igocqlx.IQueryx {
+	return query
+}
+
+func (query *FakeQueryx) WithContext(ctx context.Context) igocqlx.IQueryx {
+	query.ctx = ctx
+
+	return query
+}
+
+func (query *FakeQueryx) Prefetch(p float64) igocqlx.IQueryx {
+	return query
+}
+
+func (query *FakeQueryx) RetryPolicy(r gocql.RetryPolicy) igocqlx.IQueryx {
+	return query
+}
+
+func (query *FakeQueryx) SetSpeculativeExecutionPolicy(sp gocql.SpeculativeExecutionPolicy) igocqlx.IQueryx {
+	return query
+}
+
+func (query *FakeQueryx) Idempotent(value bool) igocqlx.IQueryx {
+	return query
+}
+
+func (query *FakeQueryx) SerialConsistency(cons gocql.SerialConsistency) igocqlx.IQueryx {
+	return query
+}
+
+func (query *FakeQueryx) PageState(state []byte) igocqlx.IQueryx {
+	return query
+}
+
+func (query *FakeQueryx) NoSkipMetadata() igocqlx.IQueryx {
+	return query
+}
+
+func (query *FakeQueryx) Release() {}
+
+// Scan runs the query and scans its first row into dest, returning
+// gocql.ErrNotFound when there is none.
+func (query *FakeQueryx) Scan(dest ...interface{}) error {
+	iter := query.iter()
+	if iter.err != nil {
+		return iter.err
+	}
+	if len(iter.rows) == 0 {
+		return gocql.ErrNotFound
+	}
+
+	iter.Scan(dest...)
+
+	return iter.Close()
+}
+
+// FakeBatchx is a batch of a FakeSessionx. Like a gocqlx.Batch, it is not
+// safe for concurrent use.
+type FakeBatchx struct {
+	session *FakeSessionx
+	typ     gocql.BatchType
+	ctx     context.Context
+	entries []BatchEntry
+
+	consistency      gocql.Consistency
+	defaultTimestamp bool
+	timestamp        *int64
+}
+
+func (session *FakeSessionx) NewBatch(bt gocql.BatchType) IBatchx {
+	return &FakeBatchx{
+		session:          session,
+		typ:              bt,
+		ctx:              context.Background(),
+		consistency:      gocql.Quorum,
+		defaultTimestamp: true,
+	}
+}
+
+func (session *FakeSessionx) ExecuteBatch(batch IBatchx) error {
+	_, err := session.execBatch(batch)
+
+	return err
+}
+
+// ExecuteBatchCAS runs a batch with conditions and scans the first row of
+// its outcome into dest, like gocql.Session.ExecuteBatchCAS does.
+func (session *FakeSessionx) ExecuteBatchCAS(batch IBatchx, dest ...interface{}) (applied bool, iter igocqlx.IIterx, err error) {
+	res, err := session.execBatch(batch)
+	if err != nil {
+		return false, nil, err
+	}
+	if len(res.rows) == 0 {
+		return false, nil, gocql.ErrNotFound
+	}
+
+	it := newFakeIterx(res)
+	if len(it.columns) > 1 {
+		it.Scan(append([]interface{}{&applied}, dest...)...)
+	} else {
+		it.Scan(&applied)
+	}
+
+	return applied, it, nil
+}
+
+// execBatch runs the statements of batch at once, with the same timestamp,
+// the way Scylla does.
+func (session *FakeSessionx) execBatch(batch IBatchx) (*result, error) {
+	b, ok := batch.(*FakeBatchx)
+	if !ok {
+		return nil, fmt.Errorf("gocqlxmock: FakeSessionx cannot run a %T", batch)
+	}
+	if err := b.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	statements := make([]dml, len(b.entries))
+	lwt := false
+	for i, entry := range b.entries {
+		kind, conditional := classify(entry.Stmt)
+		if kind != StatementInsert && kind != StatementUpdate && kind != StatementDelete {
+			return nil, invalidf("Invalid statement in batch: only UPDATE, INSERT and DELETE statements are allowed.")
+		}
+		parsed, err := parseBound(entry.Stmt, entry.Values)
+		if err != nil {
+			return nil, err
+		}
+		statements[i] = parsed
+		lwt = lwt || conditional
+	}
+
+	c := session.cluster
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock.Now()
+	ts := session.writeTimestamp(lwt, b.defaultTimestamp, b.timestamp)
+
+	tables := make([]*gocql.TableMetadata, len(statements))
+	counters, others := false, false
+	for i, parsed := range statements {
+		table, err := session.table(parsed.stmt)
+		if err != nil {
+			return nil, err
+		}
+		if counterTable(table) {
+			counters = true
+		} else {
+			others = true
+		}
+		tables[i] = table
+	}
+
+	switch {
+	case b.typ == gocql.CounterBatch && others:
+		return nil, invalidf("Cannot include non-counter statement in a counter batch")
+	case b.typ == gocql.LoggedBatch && counters:
+		return nil, invalidf("Cannot include a counter statement in a logged batch")
+	case counters && others:
+		return nil, invalidf("Counter and non-counter mutations cannot exist in the same batch")
+	}
+
+	writes := make([]write, len(statements))
+	for i, parsed := range statements {
+		var err error
+		ev := evaluator{values: b.entries[i].Values, now: now}
+		if writes[i], err = plan(tables[i], parsed.stmt, ev, writeDefaults{ts, c.schema.defaultTTL(tables[i])}); err != nil {
+			return nil, err
+		}
+	}
+	if lwt {
+		if err := checkConditionalBatch(writes); err != nil {
+			return nil, err
+		}
+	}
+
+	size := 0
+	for _, w := range writes {
+		size += w.size()
+	}
+	if err := c.thresholds.check(size, len(writes)); err != nil {
+		return nil, err
+	}
+
+	return c.store.exec(writes, now.Unix())
+}
+
+// checkConditionalBatch fails when the writes of a batch with conditions
+// span more than one partition.
+func checkConditionalBatch(writes []write) error {
+	var first *mutation
+	for _, w := range writes {
+		if w.table != writes[0].table {
+			return invalidf("Batch with conditions cannot span multiple tables")
+		}
+		for i, m := range w.mutations {
+			if first == nil {
+				first = &w.mutations[i]
+			}
+			if partitionKey(m.key) != partitionKey(first.key) {
+				return invalidf("Batch with conditions cannot span multiple partitions")
+			}
+		}
+	}
+
+	return nil
+}
+
+// Entries returns the statements added to the batch so far, with their
+// bound values.
+func (batch *FakeBatchx) Entries() []BatchEntry {
+	return batch.entries
+}
+
+func (batch *FakeBatchx) add(qry igocqlx.IQueryx, bind func(names []string, tr gocqlx.Transformer) ([]interface{}, error)) error {
+	entry, err := batchEntry(qry, bind)
+	if err != nil {
+		return err
+	}
+	batch.entries = append(batch.entries, entry)
+
+	return nil
+}
+
+func (batch *FakeBatchx) BindStruct(qry igocqlx.IQueryx, arg interface{}) error {
+	return batch.add(qry, func(names []string, tr gocqlx.Transformer) ([]interface{}, error) {
+		return bindStructValues(names, tr, arg, nil)
+	})
+}
+
+func (batch *FakeBatchx) BindStructMap(qry igocqlx.IQueryx, arg0 interface{}, arg1 map[string]interface{}) error {
+	return batch.add(qry, func(names []string, tr gocqlx.Transformer) ([]interface{}, error) {
+		return bindStructValues(names, tr, arg0, arg1)
+	})
+}
+
+func (batch *FakeBatchx) BindMap(qry igocqlx.IQueryx, arg map[string]interface{}) error {
+	return batch.add(qry, func(names []string, tr gocqlx.Transformer) ([]interface{}, error) {
+		return bindMapValues(names, tr, arg)
+	})
+}
+
+func (batch *FakeBatchx) Bind(qry igocqlx.IQueryx, v ...interface{}) error {
+	return batch.add(qry, func([]string, gocqlx.Transformer) ([]interface{}, error) {
+		return v, nil
+	})
+}
+
+func (batch *FakeBatchx) Query(stmt string, v ...interface{}) {
+	batch.entries = append(batch.entries, BatchEntry{Stmt: stmt, Values: v})
+}
+
+func (batch *FakeBatchx) Size() int {
+	return len(batch.entries)
+}
+
+func (batch *FakeBatchx) SetConsistency(c gocql.Consistency) {
+	batch.consistency = c
+}
+
+func (batch *FakeBatchx) GetConsistency() gocql.Consistency {
+	return batch.consistency
+}
+
+func (batch *FakeBatchx) SerialConsistency(cons gocql.SerialConsistency) IBatchx {
+	return batch
+}
+
+func (batch *FakeBatchx) DefaultTimestamp(enable bool) IBatchx {
+	batch.defaultTimestamp = enable
+
+	return batch
+}
+
+// WithTimestamp sets the timestamp of the writes of the batch, enabling
+// DefaultTimestamp like gocql does.
+func (batch *FakeBatchx) WithTimestamp(timestamp int64) IBatchx {
+	batch.defaultTimestamp = true
+	batch.timestamp = &timestamp
+
+	return batch
+}
+
+func (batch *FakeBatchx) WithContext(ctx context.Context) IBatchx {
+	batch.ctx = ctx
+
+	return batch
+}
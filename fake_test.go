@@ -0,0 +1,773 @@
+package gocqlxmock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/scylladb/gocqlx/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type potato struct {
+	ID   int
+	Day  int
+	Name string
+}
+
+type fakeSut struct {
+	clock   *FakeClock
+	session *FakeSessionx
+}
+
+func makeFakeSut(t *testing.T) fakeSut {
+	sut := fakeSut{
+		NewFakeClock(time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)),
+		NewFakeSessionx().WithKeyspace("ks"),
+	}
+	sut.session.WithClock(sut.clock)
+
+	for _, stmt := range []string{
+		"CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}",
+		"CREATE TABLE potato (id int, day int, name text, PRIMARY KEY (id, day))",
+	} {
+		if err := sut.session.ExecStmt(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return sut
+}
+
+func (sut fakeSut) insert(t *testing.T, p potato, timestamp int64) {
+	err := sut.session.Query("INSERT INTO potato (id, day, name) VALUES (?, ?, ?)", []string{"id", "day", "name"}).
+		BindStruct(p).WithTimestamp(timestamp).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (sut fakeSut) name(t *testing.T) (string, int64) {
+	var name string
+	var writetime int64
+	err := sut.session.Query("SELECT name, WRITETIME(name) FROM potato WHERE id = ? AND day = ?", nil).Bind(1, 1).Scan(&name, &writetime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return name, writetime
+}
+
+func Test_FakeSessionx_Timestamps(t *testing.T) {
+	t.Run("Should keep the write with the highest timestamp", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+
+		// act
+		sut.insert(t, potato{1, 1, "newer"}, 200)
+		sut.insert(t, potato{1, 1, "older"}, 100)
+
+		// assert
+		name, writetime := sut.name(t)
+		assert.Equal(t, "newer", name)
+		assert.Equal(t, int64(200), writetime)
+	})
+
+	t.Run("Should keep the greatest value of writes with the same timestamp", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+
+		// act
+		sut.insert(t, potato{1, 1, "b"}, 100)
+		sut.insert(t, potato{1, 1, "a"}, 100)
+
+		// assert
+		name, _ := sut.name(t)
+		assert.Equal(t, "b", name)
+	})
+
+	t.Run("Should keep deletions over writes with the same timestamp", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		sut.insert(t, potato{1, 1, "potato"}, 100)
+
+		// act
+		err := sut.session.Query("DELETE name FROM potato USING TIMESTAMP 100 WHERE id = 1 AND day = 1", nil).Exec()
+
+		// assert
+		assert.NoError(t, err)
+		name, writetime := sut.name(t)
+		assert.Equal(t, "", name)
+		assert.Equal(t, int64(0), writetime)
+	})
+
+	t.Run("Should shadow older writes with a deletion", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		sut.insert(t, potato{1, 1, "potato"}, 100)
+		err := sut.session.Query("DELETE FROM potato USING TIMESTAMP 300 WHERE id = ?", nil).Bind(1).Exec()
+
+		// act
+		sut.insert(t, potato{1, 1, "late"}, 200)
+		var potatoes []potato
+		selectErr := sut.session.Query("SELECT * FROM potato WHERE id = 1", nil).Select(&potatoes)
+
+		// assert
+		assert.NoError(t, err)
+		assert.NoError(t, selectErr)
+		assert.Empty(t, potatoes)
+	})
+
+	t.Run("Should shadow older writes with a range deletion", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		for day := 1; day <= 4; day++ {
+			sut.insert(t, potato{1, day, "potato"}, 100)
+		}
+		err := sut.session.Query("DELETE FROM potato USING TIMESTAMP 300 WHERE id = 1 AND day >= 2 AND day < 4", nil).Exec()
+
+		// act
+		sut.insert(t, potato{1, 3, "late"}, 200)
+		var days []int
+		selectErr := sut.session.Query("SELECT day FROM potato WHERE id = 1", nil).Select(&days)
+
+		// assert
+		assert.NoError(t, err)
+		assert.NoError(t, selectErr)
+		assert.Equal(t, []int{1, 4}, days)
+	})
+
+	t.Run("Should timestamp writes with the clock of their client", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		now := sut.clock.Now()
+		ahead := sut.session.Client(NewFakeClock(now.Add(time.Second)))
+		behind := sut.session.Client(NewFakeClock(now))
+
+		// act
+		errAhead := ahead.Query("UPDATE potato SET name = 'ahead' WHERE id = 1 AND day = 1", nil).Exec()
+		errBehind := behind.Query("UPDATE potato SET name = 'behind' WHERE id = 1 AND day = 1", nil).Exec()
+
+		// assert
+		assert.NoError(t, errAhead)
+		assert.NoError(t, errBehind)
+		name, writetime := sut.name(t)
+		assert.Equal(t, "ahead", name)
+		assert.Equal(t, now.Add(time.Second).UnixNano()/1000, writetime)
+	})
+
+	t.Run("Should timestamp writes with the clock of the server without DefaultTimestamp", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		client := sut.session.Client(NewFakeClock(sut.clock.Now().Add(time.Hour)))
+
+		// act
+		err := client.Query("UPDATE potato SET name = 'server' WHERE id = 1 AND day = 1", nil).DefaultTimestamp(false).Exec()
+
+		// assert
+		assert.NoError(t, err)
+		_, writetime := sut.name(t)
+		assert.Equal(t, sut.clock.Now().UnixNano()/1000, writetime)
+	})
+
+	t.Run("Should order the writes of a clock that does not move", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+
+		// act
+		errFirst := sut.session.Query("UPDATE potato SET name = 'b' WHERE id = 1 AND day = 1", nil).Exec()
+		errSecond := sut.session.Query("UPDATE potato SET name = 'a' WHERE id = 1 AND day = 1", nil).Exec()
+
+		// assert
+		assert.NoError(t, errFirst)
+		assert.NoError(t, errSecond)
+		name, _ := sut.name(t)
+		assert.Equal(t, "a", name)
+	})
+
+	t.Run("Should reject custom timestamps on conditional updates", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+
+		// act
+		err := sut.session.Query("UPDATE potato USING TIMESTAMP 100 SET name = 'a' WHERE id = 1 AND day = 1 IF EXISTS", nil).Exec()
+
+		// assert
+		assert.EqualError(t, err, "Cannot provide custom timestamp for conditional updates")
+	})
+}
+
+func Test_FakeQueryx_Select(t *testing.T) {
+	t.Run("Should read the rows of a partition in clustering order", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		for _, day := range []int{3, 1, 2} {
+			sut.insert(t, potato{1, day, "potato"}, 100)
+		}
+		sut.insert(t, potato{2, 1, "tomato"}, 100)
+
+		// act
+		var ascending, descending []potato
+		errAscending := sut.session.Query("SELECT * FROM potato WHERE id = ?", []string{"id"}).BindMap(map[string]interface{}{"id": 1}).Select(&ascending)
+		errDescending := sut.session.Query("SELECT * FROM potato WHERE id = 1 ORDER BY day DESC LIMIT 2", nil).Select(&descending)
+
+		// assert
+		assert.NoError(t, errAscending)
+		assert.NoError(t, errDescending)
+		assert.Equal(t, []potato{{1, 1, "potato"}, {1, 2, "potato"}, {1, 3, "potato"}}, ascending)
+		assert.Equal(t, []potato{{1, 3, "potato"}, {1, 2, "potato"}}, descending)
+	})
+
+	t.Run("Should return ErrNotFound from Get when there is no row", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		var p potato
+
+		// act
+		err := sut.session.Query("SELECT * FROM potato WHERE id = 1 AND day = 1", nil).Get(&p)
+
+		// assert
+		assert.Equal(t, gocql.ErrNotFound, err)
+	})
+
+	t.Run("Should fail like Scylla on statements it would reject", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+
+		for stmt, expected := range map[string]string{
+			"SELECT * FROM tomato":                                  "unconfigured table tomato",
+			"SELECT color FROM potato":                              "Undefined column name color",
+			"SELECT * FROM potato WHERE name = 'a'":                 "Cannot execute this query as it might involve data filtering and thus may have unpredictable performance. If you want to execute this query despite the performance unpredictability, use ALLOW FILTERING",
+			"SELECT WRITETIME(day) FROM potato":                     "Cannot use selection function writeTime on PRIMARY KEY part day",
+			"INSERT INTO potato (id, name) VALUES (1, 'a')":         "Some clustering keys are missing: day",
+			"UPDATE potato SET name = 'a' WHERE day = 1":            "Some partition key parts are missing: id",
+			"UPDATE potato SET id = 2 WHERE id = 1 AND day = 1":     "PRIMARY KEY part id found in SET part",
+			"INSERT INTO potato (id, day, name) VALUES (1, 1, 2.5)": "Invalid FLOAT constant (2.5) for type text",
+		} {
+			// act
+			err := sut.session.Query(stmt, nil).Exec()
+
+			// assert
+			assert.EqualError(t, err, expected, stmt)
+			assert.Implements(t, (*gocql.RequestError)(nil), err, stmt)
+		}
+	})
+
+	t.Run("Should filter rows with ALLOW FILTERING", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		sut.insert(t, potato{1, 1, "potato"}, 100)
+		sut.insert(t, potato{2, 1, "tomato"}, 100)
+
+		// act
+		var ids []int
+		err := sut.session.Query("SELECT id FROM potato WHERE name = ? ALLOW FILTERING", nil).Bind("tomato").Select(&ids)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, []int{2}, ids)
+	})
+
+	t.Run("Should filter rows on indexed columns without ALLOW FILTERING", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		sut.insert(t, potato{1, 1, "potato"}, 100)
+		sut.insert(t, potato{2, 1, "tomato"}, 100)
+		if err := sut.session.ExecStmt("CREATE INDEX ON potato (name)"); err != nil {
+			t.Fatal(err)
+		}
+
+		// act
+		var ids []int
+		err := sut.session.Query("SELECT id FROM potato WHERE name = ?", nil).Bind("tomato").Select(&ids)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, []int{2}, ids)
+	})
+
+	t.Run("Should forget the data of dropped tables and columns", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		sut.insert(t, potato{1, 1, "potato"}, 100)
+
+		// act
+		for _, stmt := range []string{
+			"ALTER TABLE potato DROP name",
+			"ALTER TABLE potato ADD name text",
+			"CREATE TABLE tomato (id int PRIMARY KEY)",
+			"INSERT INTO tomato (id) VALUES (1)",
+			"DROP TABLE tomato",
+			"CREATE TABLE tomato (id int PRIMARY KEY)",
+		} {
+			if err := sut.session.ExecStmt(stmt); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// assert
+		name := new(string)
+		assert.NoError(t, sut.session.Query("SELECT name FROM potato WHERE id = 1 AND day = 1", nil).Scan(&name))
+		assert.Nil(t, name)
+		var ids []int
+		assert.NoError(t, sut.session.Query("SELECT id FROM tomato", nil).Select(&ids))
+		assert.Empty(t, ids)
+	})
+
+	t.Run("Should honour the context of the query", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// act
+		err := sut.session.ContextQuery(ctx, "SELECT * FROM potato", nil).Select(&[]potato{})
+
+		// assert
+		assert.Equal(t, context.Canceled, err)
+	})
+}
+
+func Test_FakeQueryx_ExecCAS(t *testing.T) {
+	t.Run("Should apply INSERT IF NOT EXISTS only once", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		stmt := "INSERT INTO potato (id, day, name) VALUES (?, ?, ?) IF NOT EXISTS"
+
+		// act
+		first, errFirst := sut.session.Query(stmt, nil).Bind(1, 1, "first").ExecCAS()
+		var existing potato
+		second, errSecond := sut.session.Query(stmt, nil).Bind(1, 1, "second").GetCAS(&existing)
+
+		// assert
+		assert.NoError(t, errFirst)
+		assert.NoError(t, errSecond)
+		assert.True(t, first)
+		assert.False(t, second)
+		assert.Equal(t, potato{1, 1, "first"}, existing)
+	})
+
+	t.Run("Should apply conditional updates whose condition holds", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		sut.insert(t, potato{1, 1, "potato"}, 100)
+		stmt := "UPDATE potato SET name = ? WHERE id = 1 AND day = 1 IF name = ?"
+
+		// act
+		missed, errMissed := sut.session.Query(stmt, nil).Bind("tomato", "carrot").ExecCAS()
+		applied, errApplied := sut.session.Query(stmt, nil).Bind("tomato", "potato").ExecCAS()
+
+		// assert
+		assert.NoError(t, errMissed)
+		assert.NoError(t, errApplied)
+		assert.False(t, missed)
+		assert.True(t, applied)
+		name, _ := sut.name(t)
+		assert.Equal(t, "tomato", name)
+	})
+}
+
+func Test_FakeSessionx_TTL(t *testing.T) {
+	t.Run("Should expire rows inserted with a TTL", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		err := sut.session.Query("INSERT INTO potato (id, day, name) VALUES (1, 1, 'potato') USING TTL ?", nil).Bind(60).Exec()
+
+		// act
+		sut.clock.Advance(59 * time.Second)
+		var ttl int
+		errAlive := sut.session.Query("SELECT TTL(name) FROM potato WHERE id = 1 AND day = 1", nil).Get(&ttl)
+		sut.clock.Advance(time.Second)
+		errExpired := sut.session.Query("SELECT * FROM potato WHERE id = 1 AND day = 1", nil).Get(&potato{})
+
+		// assert
+		assert.NoError(t, err)
+		assert.NoError(t, errAlive)
+		assert.Equal(t, 1, ttl)
+		assert.Equal(t, gocql.ErrNotFound, errExpired)
+	})
+
+	t.Run("Should keep the row of an expired cell written by an UPDATE", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		sut.insert(t, potato{1, 1, "potato"}, 100)
+		err := sut.session.Query("UPDATE potato USING TTL 10 SET name = 'tomato' WHERE id = 1 AND day = 1", nil).Exec()
+
+		// act
+		sut.clock.Advance(10 * time.Second)
+		var p potato
+		getErr := sut.session.Query("SELECT * FROM potato WHERE id = 1 AND day = 1", nil).Get(&p)
+
+		// assert
+		assert.NoError(t, err)
+		assert.NoError(t, getErr)
+		assert.Equal(t, potato{1, 1, ""}, p)
+	})
+
+	t.Run("Should expire writes with the default TTL of their table", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		errCreate := sut.session.ExecStmt("CREATE TABLE rate (id int PRIMARY KEY, hits int) WITH default_time_to_live = 30")
+		errInsert := sut.session.Query("INSERT INTO rate (id, hits) VALUES (1, 1)", nil).Exec()
+		errForever := sut.session.Query("INSERT INTO rate (id, hits) VALUES (2, 1) USING TTL 0", nil).Exec()
+
+		// act
+		sut.clock.Advance(30 * time.Second)
+		var ids []int
+		err := sut.session.Query("SELECT id FROM rate", nil).Select(&ids)
+
+		// assert
+		assert.NoError(t, errCreate)
+		assert.NoError(t, errInsert)
+		assert.NoError(t, errForever)
+		assert.NoError(t, err)
+		assert.Equal(t, []int{2}, ids)
+	})
+
+	t.Run("Should reject invalid TTLs", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		stmt := "INSERT INTO potato (id, day) VALUES (1, 1) USING TTL ?"
+
+		// act
+		errNegative := sut.session.Query(stmt, nil).Bind(-1).Exec()
+		errLarge := sut.session.Query(stmt, nil).Bind(maxTTL + 1).Exec()
+
+		// assert
+		assert.EqualError(t, errNegative, "A TTL must be greater or equal to 0, but was -1")
+		assert.EqualError(t, errLarge, "ttl is too large. requested (630720001) maximum (630720000)")
+	})
+}
+
+func Test_FakeSessionx_ExecuteBatch(t *testing.T) {
+	insert := "INSERT INTO potato (id, day, name) VALUES (?, ?, ?)"
+	names := []string{"id", "day", "name"}
+
+	t.Run("Should apply the statements of a batch with the same timestamp", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		batch := sut.session.NewBatch(gocql.LoggedBatch)
+		errFirst := batch.BindStruct(sut.session.Query(insert, names), potato{1, 1, "first"})
+		errSecond := batch.BindStruct(sut.session.Query(insert, names), potato{1, 2, "second"})
+
+		// act
+		err := sut.session.ExecuteBatch(batch)
+
+		// assert
+		assert.NoError(t, errFirst)
+		assert.NoError(t, errSecond)
+		assert.NoError(t, err)
+		var writetimes []int64
+		selectErr := sut.session.Query("SELECT WRITETIME(name) FROM potato WHERE id = 1", nil).Select(&writetimes)
+		assert.NoError(t, selectErr)
+		assert.Len(t, writetimes, 2)
+		assert.Equal(t, writetimes[0], writetimes[1])
+	})
+
+	t.Run("Should apply none of the statements when a condition does not hold", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		sut.insert(t, potato{1, 1, "potato"}, 100)
+		batch := sut.session.NewBatch(gocql.LoggedBatch)
+		batch.Query("INSERT INTO potato (id, day, name) VALUES (1, 2, 'tomato')")
+		batch.Query("UPDATE potato SET name = 'carrot' WHERE id = 1 AND day = 1 IF name = 'tomato'")
+
+		// act
+		var p potato
+		applied, iter, err := sut.session.ExecuteBatchCAS(batch, &p.ID, &p.Day, &p.Name)
+
+		// assert
+		assert.NoError(t, err)
+		assert.False(t, applied)
+		assert.NoError(t, iter.Close())
+		assert.Equal(t, potato{1, 1, "potato"}, p)
+		var days []int
+		assert.NoError(t, sut.session.Query("SELECT day FROM potato WHERE id = 1", nil).Select(&days))
+		assert.Equal(t, []int{1}, days)
+	})
+
+	t.Run("Should fail like Scylla on invalid batches", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		sut.session.WithBatchSizeThresholds(10, 20)
+		if err := sut.session.ExecStmt("CREATE TABLE views (id int PRIMARY KEY, n counter)"); err != nil {
+			t.Fatal(err)
+		}
+		counter := "UPDATE views SET n = n + 1 WHERE id = 1"
+		large := "INSERT INTO potato (id, day, name) VALUES (1, 1, 'a rather large potato')"
+
+		for expected, batch := range map[string]struct {
+			bt    gocql.BatchType
+			stmts []string
+		}{
+			"Invalid statement in batch: only UPDATE, INSERT and DELETE statements are allowed.": {gocql.LoggedBatch, []string{"SELECT * FROM potato"}},
+			"Cannot include non-counter statement in a counter batch":                            {gocql.CounterBatch, []string{large}},
+			"Cannot include a counter statement in a logged batch":                               {gocql.LoggedBatch, []string{counter}},
+			"Counter and non-counter mutations cannot exist in the same batch":                   {gocql.UnloggedBatch, []string{counter, large}},
+			"Batch with conditions cannot span multiple partitions": {gocql.LoggedBatch, []string{
+				"INSERT INTO potato (id, day) VALUES (1, 1) IF NOT EXISTS",
+				"INSERT INTO potato (id, day) VALUES (2, 1)",
+			}},
+			"Batch too large": {gocql.UnloggedBatch, []string{large}},
+		} {
+			b := sut.session.NewBatch(batch.bt)
+			for _, stmt := range batch.stmts {
+				b.Query(stmt)
+			}
+
+			// act
+			err := sut.session.ExecuteBatch(b)
+
+			// assert
+			assert.EqualError(t, err, expected)
+		}
+	})
+
+	t.Run("Should warn about batches past the warn threshold", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		sut.session.WithBatchSizeThresholds(10, 100)
+		batch := sut.session.NewBatch(gocql.UnloggedBatch)
+		_ = batch.BindStruct(sut.session.Query(insert, names), potato{1, 1, "potato"})
+
+		// act
+		err := sut.session.ExecuteBatch(batch)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			"Batch of 1 statements is of size 14, exceeding specified threshold of 10 by 4.",
+		}, sut.session.BatchWarnings())
+	})
+}
+
+func makeCounterSut(t *testing.T) fakeSut {
+	sut := makeFakeSut(t)
+	if err := sut.session.ExecStmt("CREATE TABLE views (id int PRIMARY KEY, n counter, m counter)"); err != nil {
+		t.Fatal(err)
+	}
+
+	return sut
+}
+
+func Test_FakeSessionx_Counters(t *testing.T) {
+	increment := "UPDATE views SET n = n + ? WHERE id = ?"
+
+	t.Run("Should accumulate increments and decrements", func(t *testing.T) {
+		// arrange
+		sut := makeCounterSut(t)
+
+		// act
+		errFirst := sut.session.Query(increment, nil).Bind(5, 1).Exec()
+		errSecond := sut.session.Query(increment, nil).Bind(int64(3), 1).Exec()
+		errThird := sut.session.Query("UPDATE views SET n = n - 2, m = m + 1 WHERE id = ?", nil).Bind(1).Exec()
+
+		// assert
+		assert.NoError(t, errFirst)
+		assert.NoError(t, errSecond)
+		assert.NoError(t, errThird)
+		var views struct{ ID, N, M int64 }
+		assert.NoError(t, sut.session.Query("SELECT * FROM views WHERE id = 1", nil).Get(&views))
+		assert.Equal(t, int64(6), views.N)
+		assert.Equal(t, int64(1), views.M)
+		var counts []int64
+		assert.NoError(t, sut.session.Query("SELECT n FROM views", nil).Select(&counts))
+		assert.Equal(t, []int64{6}, counts)
+		var n int64
+		iter := sut.session.Query("SELECT n FROM views WHERE id = 1", nil).Iter()
+		assert.True(t, iter.Scan(&n))
+		assert.NoError(t, iter.Close())
+		assert.Equal(t, int64(6), n)
+	})
+
+	t.Run("Should restart deleted counters from zero", func(t *testing.T) {
+		// arrange
+		sut := makeCounterSut(t)
+		_ = sut.session.Query(increment, nil).Bind(5, 1).Exec()
+
+		// act
+		errDelete := sut.session.Query("DELETE n FROM views WHERE id = 1", nil).Exec()
+		errIncrement := sut.session.Query(increment, nil).Bind(1, 1).Exec()
+
+		// assert
+		assert.NoError(t, errDelete)
+		assert.NoError(t, errIncrement)
+		var n int64
+		assert.NoError(t, sut.session.Query("SELECT n FROM views WHERE id = 1", nil).Scan(&n))
+		assert.Equal(t, int64(1), n)
+	})
+
+	t.Run("Should apply counter batches", func(t *testing.T) {
+		// arrange
+		sut := makeCounterSut(t)
+		batch := sut.session.NewBatch(gocql.CounterBatch)
+		batch.Query(increment, 1, 1)
+		batch.Query(increment, 2, 1)
+
+		// act
+		err := sut.session.ExecuteBatch(batch)
+
+		// assert
+		assert.NoError(t, err)
+		var n int64
+		assert.NoError(t, sut.session.Query("SELECT n FROM views WHERE id = 1", nil).Scan(&n))
+		assert.Equal(t, int64(3), n)
+	})
+
+	t.Run("Should fail like Scylla on invalid counter writes", func(t *testing.T) {
+		// arrange
+		sut := makeCounterSut(t)
+
+		for stmt, expected := range map[string]string{
+			"UPDATE views SET n = 1 WHERE id = 1":                       "Cannot set the value of counter column n (counters can only be incremented/decremented, not set)",
+			"UPDATE views SET n = n + null WHERE id = 1":                "Invalid null value for counter increment",
+			"UPDATE views USING TIMESTAMP 1 SET n = n + 1 WHERE id = 1": "Cannot provide custom timestamp for counter updates",
+			"UPDATE views USING TTL 1 SET n = n + 1 WHERE id = 1":       "Cannot provide custom TTL for counter updates",
+			"UPDATE views SET n = n + 1 WHERE id = 1 IF EXISTS":         "Conditional updates are not supported on counter tables",
+			"INSERT INTO views (id, n) VALUES (1, 1)":                   "INSERT statements are not allowed on counter tables, use UPDATE instead",
+			"SELECT WRITETIME(n) FROM views":                            "Cannot use selection function writeTime on counter column n",
+		} {
+			// act
+			err := sut.session.Query(stmt, nil).Exec()
+
+			// assert
+			assert.EqualError(t, err, expected, stmt)
+		}
+	})
+}
+
+type address struct {
+	gocqlx.UDT
+	Street string
+	Number int
+}
+
+type profile struct {
+	ID      int
+	Tags    []string
+	Friends []int
+	Scores  map[string]int
+	Home    address
+}
+
+func makeCollectionSut(t *testing.T) fakeSut {
+	sut := makeFakeSut(t)
+	for _, stmt := range []string{
+		"CREATE TYPE address (street text, number int)",
+		"CREATE TABLE profiles (id int PRIMARY KEY, tags list<text>, friends set<int>, scores map<text, int>, home frozen<address>, point tuple<int, int>)",
+	} {
+		if err := sut.session.ExecStmt(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return sut
+}
+
+func (sut fakeSut) profile(t *testing.T) profile {
+	var p profile
+	err := sut.session.Query("SELECT id, tags, friends, scores, home FROM profiles WHERE id = 1", nil).Get(&p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func Test_FakeSessionx_Collections(t *testing.T) {
+	insert := "INSERT INTO profiles (id, tags, friends, scores, home) VALUES (?, ?, ?, ?, ?)"
+	names := []string{"id", "tags", "friends", "scores", "home"}
+
+	t.Run("Should store collections and UDTs the way Scylla does", func(t *testing.T) {
+		// arrange
+		sut := makeCollectionSut(t)
+		p := profile{1, []string{"b", "a"}, []int{3, 1, 3}, map[string]int{"x": 1}, address{Street: "Main", Number: 7}}
+
+		// act
+		err := sut.session.Query(insert, names).BindStruct(p).Exec()
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, profile{1, []string{"b", "a"}, []int{1, 3}, map[string]int{"x": 1}, address{Street: "Main", Number: 7}}, sut.profile(t))
+	})
+
+	t.Run("Should append, prepend, set and remove elements", func(t *testing.T) {
+		// arrange
+		sut := makeCollectionSut(t)
+		_ = sut.session.Query(insert, names).BindStruct(profile{1, []string{"b"}, []int{1, 2}, map[string]int{"x": 1, "y": 2}, address{}}).Exec()
+
+		// act
+		for _, stmt := range []string{
+			"UPDATE profiles SET tags = tags + ['c'], friends = friends - {1}, scores['z'] = 3 WHERE id = 1",
+			"UPDATE profiles SET tags = ['a'] + tags, scores = scores - {'x'} WHERE id = 1",
+			"UPDATE profiles SET tags[1] = 'B', friends = friends + {0} WHERE id = 1",
+			"DELETE tags[2], scores['y'] FROM profiles WHERE id = 1",
+		} {
+			assert.NoError(t, sut.session.Query(stmt, nil).Exec(), stmt)
+		}
+
+		// assert
+		p := sut.profile(t)
+		assert.Equal(t, []string{"a", "B"}, p.Tags)
+		assert.Equal(t, []int{0, 2}, p.Friends)
+		assert.Equal(t, map[string]int{"z": 3}, p.Scores)
+	})
+
+	t.Run("Should scan tuples into one destination per element", func(t *testing.T) {
+		// arrange
+		sut := makeCollectionSut(t)
+		_ = sut.session.Query("INSERT INTO profiles (id, point) VALUES (1, (2, 3))", nil).Exec()
+
+		// act
+		var x, y int
+		errScan := sut.session.Query("SELECT point FROM profiles WHERE id = 1", nil).Scan(&x, &y)
+		row := map[string]interface{}{}
+		scanned := sut.session.Query("SELECT point FROM profiles WHERE id = 1", nil).Iter().MapScan(row)
+
+		// assert
+		assert.NoError(t, errScan)
+		assert.Equal(t, []int{2, 3}, []int{x, y})
+		assert.True(t, scanned)
+		assert.Equal(t, map[string]interface{}{"point[0]": 2, "point[1]": 3}, row)
+	})
+
+	t.Run("Should filter rows by the elements of collections", func(t *testing.T) {
+		// arrange
+		sut := makeCollectionSut(t)
+		_ = sut.session.Query(insert, names).BindStruct(profile{1, []string{"a"}, nil, map[string]int{"x": 1}, address{}}).Exec()
+		_ = sut.session.Query(insert, names).BindStruct(profile{2, []string{"b"}, nil, map[string]int{"y": 1}, address{}}).Exec()
+
+		// act
+		var byTag, byKey []int
+		errTag := sut.session.Query("SELECT id FROM profiles WHERE tags CONTAINS ? ALLOW FILTERING", nil).Bind("b").Select(&byTag)
+		errKey := sut.session.Query("SELECT id FROM profiles WHERE scores CONTAINS KEY 'x' ALLOW FILTERING", nil).Select(&byKey)
+
+		// assert
+		assert.NoError(t, errTag)
+		assert.NoError(t, errKey)
+		assert.Equal(t, []int{2}, byTag)
+		assert.Equal(t, []int{1}, byKey)
+	})
+
+	t.Run("Should fail like Scylla on invalid collection writes", func(t *testing.T) {
+		// arrange
+		sut := makeCollectionSut(t)
+		_ = sut.session.Query("INSERT INTO profiles (id, tags) VALUES (1, ['a'])", nil).Exec()
+
+		for stmt, expected := range map[string]string{
+			"UPDATE profiles SET tags[3] = 'b' WHERE id = 1":           "List index 3 out of bound, list has size 1",
+			"UPDATE profiles SET tags[0] = 'b' WHERE id = 2":           "Attempted to set an element on a list which is null",
+			"UPDATE profiles SET friends = {1} + friends WHERE id = 1": "Invalid operation (friends = ? + friends) for non list column friends",
+			"UPDATE profiles SET id = id + 1 WHERE id = 1":             "PRIMARY KEY part id found in SET part",
+			"UPDATE profiles SET point = point + (1, 1) WHERE id = 1":  "Invalid operation (point = point + ?) for non counter column point",
+			"DELETE home['street'] FROM profiles WHERE id = 1":         "Invalid deletion operation for column home of type frozen<address>",
+		} {
+			// act
+			err := sut.session.Query(stmt, nil).Exec()
+
+			// assert
+			assert.EqualError(t, err, expected, stmt)
+		}
+	})
+}
@@ -0,0 +1,411 @@
+package gocqlxmock
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"math/big"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"gopkg.in/inf.v0"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadFixtures inserts the rows of the fixture files of fsys matching
+// pattern, in name order. YAML and JSON files map tables, optionally
+// keyspace qualified, to lists of rows, each mapping columns to values. CSV
+// files hold the rows of the table they are named after, such as potato.csv
+// or ks.potato.csv, with a header naming columns and empty cells for null.
+//
+// Tables, columns and UDT fields are lower-cased unless double-quoted, as in
+// CQL. Values are converted to the type of their column: uuids, timestamps
+// in RFC 3339, dates as 2006-01-02, times and durations are given as
+// strings, blobs in base64, and collections, tuples and UDTs as lists and
+// objects, written in JSON in CSV cells. Rows of counter tables are seeded
+// by incrementing their counters from zero. Errors are prefixed with the
+// file, table and row they are found in.
+func (session *FakeSessionx) LoadFixtures(fsys fs.FS, pattern string) error {
+	names, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no fixture files match %q", pattern)
+	}
+
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		tables, err := parseFixtures(name, data)
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+
+		keys := make([]string, 0, len(tables))
+		for table := range tables {
+			keys = append(keys, table)
+		}
+		sort.Strings(keys)
+
+		for _, table := range keys {
+			for i, row := range tables[table] {
+				if err := session.insertFixture(table, row); err != nil {
+					return fmt.Errorf("%s: %s: row %d: %w", name, table, i+1, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseFixtures parses the fixture file name, mapping tables to their rows.
+func parseFixtures(name string, data []byte) (map[string][]map[string]interface{}, error) {
+	tables := map[string][]map[string]interface{}{}
+
+	switch ext := path.Ext(name); ext {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &tables); err != nil {
+			return nil, err
+		}
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&tables); err != nil {
+			return nil, err
+		}
+	case ".csv":
+		records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return nil, fmt.Errorf("missing header")
+		}
+
+		table := strings.TrimSuffix(path.Base(name), ext)
+		for _, record := range records[1:] {
+			row := map[string]interface{}{}
+			for i, column := range records[0] {
+				if record[i] != "" {
+					row[column] = record[i]
+				}
+			}
+			tables[table] = append(tables[table], row)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported fixture format %q", ext)
+	}
+
+	return tables, nil
+}
+
+// insertFixture inserts row into the, possibly keyspace qualified, table.
+func (session *FakeSessionx) insertFixture(table string, row map[string]interface{}) error {
+	keyspace, name := session.keyspace, fixtureIdent(table)
+	if i := strings.IndexByte(table, '.'); i >= 0 {
+		keyspace, name = fixtureIdent(table[:i]), fixtureIdent(table[i+1:])
+	}
+
+	metadata, err := session.cluster.schema.Table(keyspace, name)
+	if err != nil {
+		return err
+	}
+
+	keys := map[string]string{}
+	columns := make([]string, 0, len(row))
+	for key := range row {
+		column := fixtureIdent(key)
+		if other, ok := keys[column]; ok {
+			return fmt.Errorf("columns %s and %s both refer to column %s", other, key, column)
+		}
+		keys[column] = key
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	names := make([]string, len(columns))
+	markers := make([]string, len(columns))
+	values := make([]interface{}, len(columns))
+	kinds := make([]gocql.ColumnKind, len(columns))
+	for i, column := range columns {
+		info, err := tableColumn(metadata, column)
+		if err != nil {
+			return err
+		}
+		if values[i], err = fixtureValue(info.Type, row[keys[column]]); err != nil {
+			return fmt.Errorf("invalid value for column %s: %s", column, err)
+		}
+		names[i], markers[i], kinds[i] = quoteIdent(column), "?", info.Kind
+	}
+
+	qualified := quoteIdent(keyspace) + "." + quoteIdent(name)
+	if counterTable(metadata) {
+		return session.incrementFixture(qualified, names, values, kinds)
+	}
+
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", qualified, strings.Join(names, ", "), strings.Join(markers, ", "))
+	_, err = session.exec(context.Background(), stmt, values, true, nil)
+
+	return err
+}
+
+// incrementFixture seeds a row of the counter table, which can not be
+// inserted into, by incrementing its counters by their value. Null counters
+// are left out.
+func (session *FakeSessionx) incrementFixture(table string, names []string, values []interface{}, kinds []gocql.ColumnKind) error {
+	var (
+		assignments, conditions []string
+		increments, keys        []interface{}
+	)
+	for i, name := range names {
+		switch {
+		case kinds[i] == gocql.ColumnPartitionKey || kinds[i] == gocql.ColumnClusteringKey:
+			conditions = append(conditions, name+" = ?")
+			keys = append(keys, values[i])
+		case values[i] != nil:
+			assignments = append(assignments, name+" = "+name+" + ?")
+			increments = append(increments, values[i])
+		}
+	}
+	if len(assignments) == 0 {
+		return fmt.Errorf("no counter to increment in counter table %s", table)
+	}
+
+	stmt := fmt.Sprintf("UPDATE %s SET %s WHERE %s", table, strings.Join(assignments, ", "), strings.Join(conditions, " AND "))
+	_, err := session.exec(context.Background(), stmt, append(increments, keys...), true, nil)
+
+	return err
+}
+
+// fixtureIdent returns the name an identifier of a fixture file refers to,
+// lower-cased unless it is double-quoted, as in CQL.
+func fixtureIdent(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return strings.ReplaceAll(s[1:len(s)-1], `""`, `"`)
+	}
+
+	return strings.ToLower(s)
+}
+
+// quoteIdent quotes the identifier s, keeping its case.
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// fixtureValue converts v, a value decoded from a fixture file, to a value
+// gocql marshals as typ.
+func fixtureValue(typ gocql.TypeInfo, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	switch typ.(type) {
+	case gocql.CollectionType, gocql.TupleTypeInfo, gocql.UDTTypeInfo:
+		if s, ok := v.(string); ok {
+			decoder := json.NewDecoder(strings.NewReader(s))
+			decoder.UseNumber()
+			if err := decoder.Decode(&v); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	switch typ := typ.(type) {
+	case gocql.CollectionType:
+		return fixtureCollection(typ, v)
+	case gocql.TupleTypeInfo:
+		elems, ok := v.([]interface{})
+		if !ok || len(elems) != len(typ.Elems) {
+			return nil, fmt.Errorf("expected a list of %d values but got %v", len(typ.Elems), v)
+		}
+		tuple := make([]interface{}, len(elems))
+		for i, elem := range elems {
+			var err error
+			if tuple[i], err = fixtureValue(typ.Elems[i], elem); err != nil {
+				return nil, err
+			}
+		}
+		return tuple, nil
+	case gocql.UDTTypeInfo:
+		fields, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an object but got %v", v)
+		}
+		udt := map[string]interface{}{}
+		for key, value := range fields {
+			name, field := fixtureIdent(key), -1
+			for i, elem := range typ.Elements {
+				if elem.Name == name {
+					field = i
+				}
+			}
+			if field < 0 {
+				return nil, fmt.Errorf("unknown field %s of type %s", name, typ.Name)
+			}
+			var err error
+			if udt[name], err = fixtureValue(typ.Elements[field].Type, value); err != nil {
+				return nil, err
+			}
+		}
+		return udt, nil
+	default:
+		return fixtureNative(typ.Type(), v)
+	}
+}
+
+// fixtureCollection converts v, a list or an object, to a collection of typ.
+func fixtureCollection(typ gocql.CollectionType, v interface{}) (interface{}, error) {
+	if typ.Type() != gocql.TypeMap {
+		elems, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected a list but got %v", v)
+		}
+		list := make([]interface{}, len(elems))
+		for i, elem := range elems {
+			var err error
+			if list[i], err = fixtureValue(typ.Elem, elem); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+
+	entries := map[interface{}]interface{}{}
+	switch m := v.(type) {
+	case map[string]interface{}:
+		for key, value := range m {
+			entries[key] = value
+		}
+	case map[interface{}]interface{}:
+		entries = m
+	default:
+		return nil, fmt.Errorf("expected an object but got %v", v)
+	}
+
+	converted := make(map[interface{}]interface{}, len(entries))
+	for key, value := range entries {
+		k, err := fixtureValue(typ.Key, key)
+		if err != nil {
+			return nil, err
+		}
+		if b, ok := k.([]byte); ok {
+			k = string(b)
+		}
+		if converted[k], err = fixtureValue(typ.Elem, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return converted, nil
+}
+
+// fixtureNative converts v to a value of the native type typ.
+func fixtureNative(typ gocql.Type, v interface{}) (interface{}, error) {
+	s, isString := v.(string)
+
+	switch typ {
+	case gocql.TypeTinyInt, gocql.TypeSmallInt, gocql.TypeInt, gocql.TypeBigInt, gocql.TypeCounter:
+		return fixtureInt(v)
+	case gocql.TypeFloat, gocql.TypeDouble:
+		return fixtureFloat(v)
+	case gocql.TypeVarint:
+		n, ok := new(big.Int).SetString(fmt.Sprint(v), 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid varint %v", v)
+		}
+		return n, nil
+	case gocql.TypeDecimal:
+		d, ok := new(inf.Dec).SetString(fmt.Sprint(v))
+		if !ok {
+			return nil, fmt.Errorf("invalid decimal %v", v)
+		}
+		return d, nil
+	case gocql.TypeBoolean:
+		if isString {
+			return strconv.ParseBool(s)
+		}
+	case gocql.TypeTimestamp:
+		if isString {
+			return time.Parse(time.RFC3339Nano, s)
+		}
+		if t, ok := v.(time.Time); ok {
+			return t, nil
+		}
+		ms, err := fixtureInt(v)
+		if err != nil {
+			return nil, err
+		}
+		return time.UnixMilli(ms).UTC(), nil
+	case gocql.TypeDate:
+		if isString {
+			return time.Parse("2006-01-02", s)
+		}
+		if t, ok := v.(time.Time); ok {
+			return t, nil
+		}
+		return nil, fmt.Errorf("invalid date %v", v)
+	case gocql.TypeTime:
+		if isString {
+			t, err := time.Parse("15:04:05.999999999", s)
+			if err != nil {
+				return nil, err
+			}
+			return t.Sub(time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC)), nil
+		}
+	case gocql.TypeDuration:
+		if isString {
+			return time.ParseDuration(s)
+		}
+	case gocql.TypeBlob:
+		if isString {
+			return base64.StdEncoding.DecodeString(s)
+		}
+	case gocql.TypeUUID, gocql.TypeTimeUUID:
+		if isString {
+			return gocql.ParseUUID(s)
+		}
+	}
+
+	return v, nil
+}
+
+// fixtureInt converts v, a number or a string, to an integer.
+func fixtureInt(v interface{}) (int64, error) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), nil
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("invalid integer %v", v)
+		}
+		return int64(v), nil
+	default:
+		return strconv.ParseInt(fmt.Sprint(v), 10, 64)
+	}
+}
+
+// fixtureFloat converts v, a number or a string, to a float.
+func fixtureFloat(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	default:
+		return strconv.ParseFloat(fmt.Sprint(v), 64)
+	}
+}
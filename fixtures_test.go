@@ -0,0 +1,183 @@
+package gocqlxmock
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+type account struct {
+	ID      gocql.UUID
+	Created time.Time
+	Avatar  []byte
+	Tags    []string
+	Scores  map[int]float64
+	Home    address
+}
+
+func makeFixturesSut(t *testing.T) *FakeSessionx {
+	session := makeMigrateSut(t)
+	for _, stmt := range []string{
+		"CREATE TYPE address (street text, number int)",
+		`CREATE TABLE account (
+			id uuid PRIMARY KEY,
+			created timestamp,
+			avatar blob,
+			tags list<text>,
+			scores map<int, double>,
+			home frozen<address>,
+			point tuple<int, int>
+		)`,
+	} {
+		if err := session.ExecStmt(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return session
+}
+
+func Test_FakeSessionx_LoadFixtures(t *testing.T) {
+	id := "a6f6c55e-2c2a-11ed-a261-0242ac120002"
+	uuid, _ := gocql.ParseUUID(id)
+	expected := account{
+		ID:      uuid,
+		Created: time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC),
+		Avatar:  []byte("potato"),
+		Tags:    []string{"a", "b"},
+		Scores:  map[int]float64{1: 1.5},
+		Home:    address{Street: "Main", Number: 1},
+	}
+
+	for name, data := range map[string]string{
+		"account.yaml": `
+account:
+  - id: ` + id + `
+    created: 2022-05-01T12:00:00Z
+    avatar: cG90YXRv
+    tags: [a, b]
+    scores: {1: 1.5}
+    home: {street: Main, number: 1}
+    point: [1, 2]
+`,
+		"account.json": `{"ks.account": [{
+			"id": "` + id + `", "created": "2022-05-01T12:00:00Z", "avatar": "cG90YXRv",
+			"tags": ["a", "b"], "scores": {"1": 1.5}, "home": {"street": "Main", "number": 1}, "point": [1, 2]
+		}]}`,
+		"account.csv": "id,created,avatar,tags,scores,home,point\n" +
+			id + `,2022-05-01T12:00:00Z,cG90YXRv,"[""a"", ""b""]","{""1"": 1.5}","{""street"": ""Main"", ""number"": 1}","[1, 2]"` + "\n",
+	} {
+		t.Run("Should load rows from "+name, func(t *testing.T) {
+			// arrange
+			session := makeFixturesSut(t)
+
+			// act
+			err := session.LoadFixtures(fstest.MapFS{name: migrationFile(data)}, "*")
+
+			// assert
+			assert.NoError(t, err)
+			var actual account
+			var x, y int
+			scanErr := session.Query("SELECT id, created, avatar, tags, scores, home, point FROM account", nil).
+				Scan(&actual.ID, &actual.Created, &actual.Avatar, &actual.Tags, &actual.Scores, &actual.Home, &x, &y)
+			assert.NoError(t, scanErr)
+			assert.Equal(t, expected, actual)
+			assert.Equal(t, []int{1, 2}, []int{x, y})
+		})
+	}
+
+	t.Run("Should fail on rows that do not fit the schema", func(t *testing.T) {
+		// arrange
+		session := makeFixturesSut(t)
+		fsys := fstest.MapFS{
+			"column.yaml": migrationFile("account:\n  - id: " + id + "\n  - id: " + id + "\n    color: red\n"),
+			"value.yaml":  migrationFile("account:\n  - id: potato\n"),
+			"table.csv":   migrationFile("id\n1\n"),
+			"format.xml":  migrationFile("<account/>"),
+		}
+
+		for pattern, expected := range map[string]string{
+			"column.yaml": "column.yaml: account: row 2: Undefined column name color",
+			"value.yaml":  "value.yaml: account: row 1: invalid value for column id: invalid UUID \"potato\"",
+			"table.csv":   "table.csv: table: row 1: unconfigured table table",
+			"format.xml":  `format.xml: unsupported fixture format ".xml"`,
+		} {
+			// act
+			err := session.LoadFixtures(fsys, pattern)
+
+			// assert
+			assert.EqualError(t, err, expected, pattern)
+		}
+	})
+	t.Run("Should resolve identifiers and dates like CQL", func(t *testing.T) {
+		for name, data := range map[string]string{
+			"harvest.yaml": "Harvest:\n  - ID: 1\n    Day: 2024-01-02\n    Name: potato\n    '\"Label\"': big\n",
+			"harvest.json": `{"HARVEST": [{"id": 1, "day": "2024-01-02", "NAME": "potato", "\"Label\"": "big"}]}`,
+			"harvest.csv":  "Id,DAY,name,\"\"\"Label\"\"\"\n1,2024-01-02,potato,big\n",
+		} {
+			t.Run(name, func(t *testing.T) {
+				// arrange
+				session := makeFixturesSut(t)
+				if err := session.ExecStmt(`CREATE TABLE harvest (id int PRIMARY KEY, day date, name text, "Label" text)`); err != nil {
+					t.Fatal(err)
+				}
+
+				// act
+				err := session.LoadFixtures(fstest.MapFS{name: migrationFile(data)}, "*")
+
+				// assert
+				assert.NoError(t, err)
+				var (
+					day         time.Time
+					crop, label string
+				)
+				scanErr := session.Query(`SELECT day, name, "Label" FROM harvest WHERE id = 1`, nil).Scan(&day, &crop, &label)
+				assert.NoError(t, scanErr)
+				assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), day)
+				assert.Equal(t, "potato", crop)
+				assert.Equal(t, "big", label)
+			})
+		}
+	})
+
+	t.Run("Should seed counter tables by incrementing their counters", func(t *testing.T) {
+		// arrange
+		session := makeFixturesSut(t)
+		if err := session.ExecStmt("CREATE TABLE views (id int, day int, hits counter, likes counter, PRIMARY KEY (id, day))"); err != nil {
+			t.Fatal(err)
+		}
+		fsys := fstest.MapFS{
+			"views.yaml": migrationFile("views:\n  - id: 1\n    day: 2\n    hits: 10\n    likes: 3\n  - id: 1\n    day: 2\n    hits: 5\n"),
+			"empty.yaml": migrationFile("views:\n  - id: 2\n    day: 2\n"),
+		}
+
+		// act
+		err := session.LoadFixtures(fsys, "views.yaml")
+		errEmpty := session.LoadFixtures(fsys, "empty.yaml")
+
+		// assert
+		assert.NoError(t, err)
+		assert.EqualError(t, errEmpty, `empty.yaml: views: row 1: no counter to increment in counter table "ks"."views"`)
+		var hits, likes int64
+		scanErr := session.Query("SELECT hits, likes FROM views WHERE id = 1 AND day = 2", nil).Scan(&hits, &likes)
+		assert.NoError(t, scanErr)
+		assert.Equal(t, int64(15), hits)
+		assert.Equal(t, int64(3), likes)
+	})
+
+	t.Run("Should fail on keys referring to the same column", func(t *testing.T) {
+		// arrange
+		session := makeFixturesSut(t)
+		fsys := fstest.MapFS{"account.json": migrationFile(`{"account": [{"id": "` + id + `", "ID": "` + id + `"}]}`)}
+
+		// act
+		err := session.LoadFixtures(fsys, "*")
+
+		// assert
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "both refer to column id")
+	})
+}
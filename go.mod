@@ -2,14 +2,16 @@ module github.com/Guilospanck/gocqlxmock
 
 go 1.18
 
-require github.com/gocql/gocql v1.0.0
+require (
+	github.com/gocql/gocql v1.0.0
+	github.com/scylladb/go-reflectx v1.0.1
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/scylladb/go-reflectx v1.0.1 // indirect
 	github.com/stretchr/objx v0.3.0 // indirect
-	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b // indirect
 )
 
 require (
@@ -18,5 +20,5 @@ require (
 	github.com/hailocab/go-hostpool v0.0.0-20160125115350-e80d13ce29ed // indirect
 	github.com/scylladb/gocqlx/v2 v2.7.0
 	github.com/stretchr/testify v1.7.1
-	gopkg.in/inf.v0 v0.9.1 // indirect
+	gopkg.in/inf.v0 v0.9.1
 )
@@ -0,0 +1,205 @@
+package gocqlxmock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// UpdateGoldenEnv is the environment variable that, set to true as in
+// GOCQLXMOCK_UPDATE=1 go test ./..., makes AssertGolden write golden files
+// instead of comparing them.
+const UpdateGoldenEnv = "GOCQLXMOCK_UPDATE"
+
+// AssertGolden asserts that actual matches the content of the golden file at
+// path, such as "testdata/TestSave.golden". With UpdateGoldenEnv set, it
+// writes actual to the file instead.
+func AssertGolden(t mock.TestingT, path, actual string) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	if update, _ := strconv.ParseBool(os.Getenv(UpdateGoldenEnv)); update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Errorf("gocqlxmock: golden: %s", err)
+			return false
+		}
+		if err := os.WriteFile(path, []byte(actual), 0o644); err != nil {
+			t.Errorf("gocqlxmock: golden: %s", err)
+			return false
+		}
+		return true
+	}
+
+	expected, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("gocqlxmock: golden: %s does not exist, run the test with %s=1 to create it", path, UpdateGoldenEnv)
+		return false
+	}
+	if err != nil {
+		t.Errorf("gocqlxmock: golden: %s", err)
+		return false
+	}
+
+	return assert.Equal(t, string(expected), actual, "golden file %s differs, run the test with %s=1 to accept the changes", path, UpdateGoldenEnv)
+}
+
+// Dump returns the live rows of tables, optionally keyspace qualified, or
+// of every table when none is given, in a stable text format meant for
+// AssertGolden. Tables come by name and rows in the order SELECT * returns
+// them, their values written as CQL literals, timestamps and TTLs left out.
+func (session *FakeSessionx) Dump(tables ...string) (string, error) {
+	if len(tables) == 0 {
+		tables = session.cluster.schema.tableNames()
+	}
+
+	var b strings.Builder
+	for i, table := range tables {
+		keyspace, name := session.keyspace, table
+		if k, n, ok := strings.Cut(table, "."); ok {
+			keyspace, name = k, n
+		}
+
+		stmt := fmt.Sprintf("SELECT * FROM %s.%s", quoteIdent(keyspace), quoteIdent(name))
+		res, err := session.exec(context.Background(), stmt, nil, true, nil)
+		if err != nil {
+			return "", err
+		}
+
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "%s.%s\n", keyspace, name)
+		for _, row := range res.rows {
+			values := make([]string, len(row))
+			for j, data := range row {
+				values[j] = res.columns[j].Name + "=" + cqlLiteral(res.columns[j].TypeInfo, data)
+			}
+			fmt.Fprintf(&b, "  %s\n", strings.Join(values, ", "))
+		}
+	}
+
+	return b.String(), nil
+}
+
+// tableNames returns the names of the tables of the schema, keyspace
+// qualified and sorted.
+func (schema *Schema) tableNames() []string {
+	schema.mu.RLock()
+	defer schema.mu.RUnlock()
+
+	var names []string
+	for _, ks := range schema.keyspaces {
+		for name := range ks.Tables {
+			names = append(names, ks.Name+"."+name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// cqlLiteral writes data, a serialized value of typ, as a CQL literal.
+func cqlLiteral(typ gocql.TypeInfo, data []byte) string {
+	if data == nil {
+		return "null"
+	}
+
+	switch typ := typ.(type) {
+	case gocql.CollectionType:
+		elems, err := elements(typ, data)
+		if err != nil {
+			return fmt.Sprintf("0x%x", data)
+		}
+		values := make([]string, 0, len(elems))
+		switch typ.Type() {
+		case gocql.TypeMap:
+			for i := 0; i+1 < len(elems); i += 2 {
+				values = append(values, cqlLiteral(typ.Key, elems[i])+": "+cqlLiteral(typ.Elem, elems[i+1]))
+			}
+			return "{" + strings.Join(values, ", ") + "}"
+		case gocql.TypeSet:
+			for _, elem := range elems {
+				values = append(values, cqlLiteral(typ.Elem, elem))
+			}
+			return "{" + strings.Join(values, ", ") + "}"
+		default:
+			for _, elem := range elems {
+				values = append(values, cqlLiteral(typ.Elem, elem))
+			}
+			return "[" + strings.Join(values, ", ") + "]"
+		}
+	case gocql.TupleTypeInfo:
+		parts, err := components(data, -1)
+		if err != nil {
+			return fmt.Sprintf("0x%x", data)
+		}
+		values := make([]string, len(typ.Elems))
+		for i, elem := range typ.Elems {
+			var component []byte
+			if i < len(parts) {
+				component = parts[i]
+			}
+			values[i] = cqlLiteral(elem, component)
+		}
+		return "(" + strings.Join(values, ", ") + ")"
+	case gocql.UDTTypeInfo:
+		parts, err := components(data, -1)
+		if err != nil {
+			return fmt.Sprintf("0x%x", data)
+		}
+		values := make([]string, len(typ.Elements))
+		for i, field := range typ.Elements {
+			var component []byte
+			if i < len(parts) {
+				component = parts[i]
+			}
+			values[i] = field.Name + ": " + cqlLiteral(field.Type, component)
+		}
+		return "{" + strings.Join(values, ", ") + "}"
+	}
+
+	value, err := decode(typ, data)
+	if err != nil {
+		return fmt.Sprintf("0x%x", data)
+	}
+
+	switch value := value.(type) {
+	case string:
+		return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	case []byte:
+		return fmt.Sprintf("0x%x", value)
+	case time.Time:
+		if typ.Type() == gocql.TypeDate {
+			return "'" + value.UTC().Format("2006-01-02") + "'"
+		}
+		return "'" + value.UTC().Format("2006-01-02T15:04:05.000Z") + "'"
+	case time.Duration:
+		t := time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC).Add(value)
+		return "'" + t.Format("15:04:05.000000000") + "'"
+	case gocql.Duration:
+		return fmt.Sprintf("%dmo%dd%dns", value.Months, value.Days, value.Nanoseconds)
+	case float32:
+		return strconv.FormatFloat(float64(value), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	case fmt.Stringer:
+		if typ.Type() == gocql.TypeInet {
+			return "'" + value.String() + "'"
+		}
+		return value.String()
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,83 @@
+package gocqlxmock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FakeSessionx_Dump(t *testing.T) {
+	t.Run("Should dump every table in a stable format", func(t *testing.T) {
+		// arrange
+		sut := makeCollectionSut(t)
+		for _, stmt := range []string{
+			"INSERT INTO potato (id, day, name) VALUES (2, 1, 'it''s a potato')",
+			"INSERT INTO potato (id, day) VALUES (1, 2)",
+			"INSERT INTO profiles (id, tags, friends, scores, home, point) VALUES (1, ['b', 'a'], {3, 1}, {'x': 1}, {street: 'Main', number: 1}, (1, 2))",
+		} {
+			if err := sut.session.ExecStmt(stmt); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// act
+		dump, err := sut.session.Dump()
+
+		// assert
+		assert.NoError(t, err)
+		AssertGolden(t, "testdata/Test_FakeSessionx_Dump.golden", dump)
+	})
+
+	t.Run("Should dump the given tables only", func(t *testing.T) {
+		// arrange
+		sut := makeCollectionSut(t)
+		sut.insert(t, potato{1, 1, "potato"}, 100)
+
+		// act
+		dump, err := sut.session.Dump("ks.potato")
+		_, errUnknown := sut.session.Dump("tomato")
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, "ks.potato\n  id=1, day=1, name='potato'\n", dump)
+		assert.EqualError(t, errUnknown, "unconfigured table tomato")
+	})
+}
+
+func Test_AssertGolden(t *testing.T) {
+	t.Run("Should fail when the golden file differs or does not exist", func(t *testing.T) {
+		// arrange
+		path := filepath.Join(t.TempDir(), "dump.golden")
+		spy := &testingTSpy{}
+		t.Setenv(UpdateGoldenEnv, "")
+
+		// act
+		missing := AssertGolden(spy, path, "potato\n")
+		_ = os.WriteFile(path, []byte("tomato\n"), 0o644)
+		differs := AssertGolden(spy, path, "potato\n")
+		matches := AssertGolden(spy, path, "tomato\n")
+
+		// assert
+		assert.False(t, missing)
+		assert.False(t, differs)
+		assert.True(t, matches)
+		assert.Len(t, spy.errors, 2)
+		assert.Contains(t, spy.errors[0], "run the test with GOCQLXMOCK_UPDATE=1 to create it")
+	})
+
+	t.Run("Should write the golden file when GOCQLXMOCK_UPDATE is set", func(t *testing.T) {
+		// arrange
+		path := filepath.Join(t.TempDir(), "testdata", "dump.golden")
+		t.Setenv(UpdateGoldenEnv, "1")
+
+		// act
+		ok := AssertGolden(t, path, "potato\n")
+
+		// assert
+		assert.True(t, ok)
+		data, _ := os.ReadFile(path)
+		assert.Equal(t, "potato\n", string(data))
+	})
+}
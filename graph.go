@@ -0,0 +1,114 @@
+package gocqlxmock
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// TestingT is the part of *testing.T used by the NewXxxMock constructors.
+type TestingT interface {
+	mock.TestingT
+	Fatalf(format string, args ...interface{})
+	Cleanup(func())
+}
+
+type graphNode interface {
+	AssertExpectations(t mock.TestingT) bool
+	mockGraph() *mockGraph
+}
+
+// mockGraph keeps track of the mocks returned by a mock, so that the
+// expectations of a whole session -> query -> iterator graph can be asserted
+// from its root.
+type mockGraph struct {
+	mu       sync.Mutex
+	bound    bool
+	children []graphNode
+}
+
+func (graph *mockGraph) adopt(child interface{}) {
+	node, ok := child.(graphNode)
+	if !ok || node.mockGraph() == graph {
+		return
+	}
+
+	graph.mu.Lock()
+	defer graph.mu.Unlock()
+
+	for _, known := range graph.children {
+		if known == node {
+			return
+		}
+	}
+	graph.children = append(graph.children, node)
+}
+
+func (graph *mockGraph) nodes() []graphNode {
+	graph.mu.Lock()
+	defer graph.mu.Unlock()
+
+	return append([]graphNode(nil), graph.children...)
+}
+
+// bindTest reports unexpected calls of m through t, the way testify does,
+// and asserts the expectations of the graph rooted at root when the test
+// finishes.
+func bindTest(t TestingT, m interface{ Test(mock.TestingT) }, root graphNode) {
+	graph := root.mockGraph()
+	graph.mu.Lock()
+	graph.bound = true
+	graph.mu.Unlock()
+
+	m.Test(t)
+	t.Cleanup(func() {
+		assertGraph(t, root)
+	})
+}
+
+// assertGraph asserts the expectations of root and of every mock reachable
+// from it, except those bound to a test of their own.
+func assertGraph(t mock.TestingT, root graphNode) bool {
+	result := true
+	visited := map[graphNode]bool{}
+	queue := []graphNode{root}
+
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+
+		if visited[node] {
+			continue
+		}
+		visited[node] = true
+
+		graph := node.mockGraph()
+		graph.mu.Lock()
+		bound := graph.bound
+		graph.mu.Unlock()
+		if bound && node != root {
+			continue
+		}
+
+		if !node.AssertExpectations(t) {
+			result = false
+		}
+		queue = append(queue, graph.nodes()...)
+	}
+
+	return result
+}
+
+// failf reports a failure through t, or panics when there is no test, just
+// like testify does for unexpected calls. It does not stop the test, as it
+// may run on a goroutine other than the test's, where t.FailNow is invalid:
+// callers return the failure instead.
+func failf(t mock.TestingT, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if t == nil {
+		panic(msg)
+	}
+
+	t.Errorf("%s", msg)
+}
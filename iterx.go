@@ -1,58 +1,127 @@
 package gocqlxmock
 
 import (
+	"sync"
+
 	"github.com/Guilospanck/igocqlx"
 	"github.com/stretchr/testify/mock"
 )
 
 type IterxMock struct {
 	mock.Mock
+
+	graph mockGraph
+
+	mu              sync.Mutex
+	payload         map[string][]byte
+	payloadReceived map[string][]byte
+	rows            *FakeIterx
+	log             callLog
+}
+
+// NewIterxMock creates an IterxMock bound to t: unexpected calls fail the test
+// and its expectations are asserted when the test finishes.
+func NewIterxMock(t TestingT) *IterxMock {
+	mock := &IterxMock{}
+	bindTest(t, mock, mock)
+
+	return mock
+}
+
+func (mock *IterxMock) mockGraph() *mockGraph {
+	return &mock.graph
+}
+
+func (mock *IterxMock) called(method string, arguments ...interface{}) mock.Arguments {
+	args := mock.MethodCalled(method, arguments...)
+	mock.log.record(method, arguments, args)
+
+	return args
+}
+
+func (mock *IterxMock) iterx(args mock.Arguments) igocqlx.IIterx {
+	result := args.Get(0).(igocqlx.IIterx)
+	mock.graph.adopt(result)
+
+	return result
 }
 
 func (mock *IterxMock) Unsafe() igocqlx.IIterx {
-	args := mock.Called()
+	args := mock.called("Unsafe")
+	mock.cursor(func(iter *FakeIterx) { iter.Unsafe() })
 
-	return args.Get(0).(igocqlx.IIterx)
+	return mock.iterx(args)
 }
 
 func (mock *IterxMock) StructOnly() igocqlx.IIterx {
-	args := mock.Called()
+	args := mock.called("StructOnly")
+	mock.cursor(func(iter *FakeIterx) { iter.StructOnly() })
 
-	return args.Get(0).(igocqlx.IIterx)
+	return mock.iterx(args)
 }
 
 func (mock *IterxMock) Get(dest interface{}) error {
-	args := mock.Called(dest)
+	args := mock.called("Get", dest)
+
+	err := args.Error(0)
+	if err == nil {
+		mock.cursor(func(iter *FakeIterx) { err = iter.Get(dest) })
+	}
 
-	return args.Error(0)
+	return err
 }
 
 func (mock *IterxMock) Select(dest interface{}) error {
-	args := mock.Called(dest)
+	args := mock.called("Select", dest)
 
-	return args.Error(0)
+	err := args.Error(0)
+	if err == nil {
+		mock.cursor(func(iter *FakeIterx) { err = iter.Select(dest) })
+	}
+
+	return err
 }
 
 func (mock *IterxMock) StructScan(dest interface{}) bool {
-	args := mock.Called(dest)
+	args := mock.called("StructScan", dest)
+
+	ok := args.Get(0).(bool)
+	if ok {
+		mock.cursor(func(iter *FakeIterx) { ok = iter.StructScan(dest) })
+	}
 
-	return args.Get(0).(bool)
+	return ok
 }
 
 func (mock *IterxMock) Scan(dest ...interface{}) bool {
-	args := mock.Called(dest)
+	args := mock.called("Scan", dest)
+
+	ok := args.Get(0).(bool)
+	if ok {
+		mock.cursor(func(iter *FakeIterx) { ok = iter.Scan(dest...) })
+	}
 
-	return args.Get(0).(bool)
+	return ok
 }
 
 func (mock *IterxMock) Close() error {
-	args := mock.Called()
+	args := mock.called("Close")
 
-	return args.Error(0)
+	err := args.Error(0)
+	if err == nil {
+		mock.cursor(func(iter *FakeIterx) { err = iter.Close() })
+	}
+
+	return err
 }
 
 func (mock *IterxMock) MapScan(m map[string]interface{}) bool {
-	args := mock.Called(m)
+	args := mock.called("MapScan", m)
+
+	ok := args.Bool(0)
+	if ok {
+		mock.cursor(func(iter *FakeIterx) { ok = iter.MapScan(m) })
+	}
 
-	return args.Bool(0)
+	return ok
 }
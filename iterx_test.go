@@ -216,3 +216,22 @@ func Test_Iterx_MapScan(t *testing.T) {
 		assert.Equal(t, result, sut.boolVar)
 	})
 }
+
+func Test_NewIterxMock(t *testing.T) {
+	t.Run("Should assert the iterator and the iterators it returned on cleanup", func(t *testing.T) {
+		// arrange
+		spy := &testingTSpy{}
+		iterxmock := NewIterxMock(spy)
+		unsafe := &IterxMock{}
+		iterxmock.On("Unsafe").Return(unsafe)
+		unsafe.On("Close").Return(nil)
+
+		// act
+		iterxmock.Unsafe()
+		spy.runCleanups()
+
+		// assert
+		assert.Len(t, spy.errors, 1)
+		assert.Contains(t, spy.errors[0], "0 out of 1 expectation(s) were met")
+	})
+}
@@ -0,0 +1,396 @@
+package gocqlxmock
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// LintRule names a CQL anti-pattern detected in lint mode.
+type LintRule string
+
+const (
+	LintMissingPartitionKey LintRule = "missing-partition-key"
+	LintAllowFiltering      LintRule = "allow-filtering"
+	LintUnboundedScan       LintRule = "unbounded-scan"
+	LintLargeInList         LintRule = "large-in-list"
+	LintLiteralValues       LintRule = "literal-values"
+)
+
+// DefaultMaxInValues is the largest IN list accepted when
+// LintOptions.MaxInValues is not set.
+const DefaultMaxInValues = 10
+
+// LintOptions configures the lint mode of a SessionxMock.
+type LintOptions struct {
+	// PartitionKeys maps a table, optionally prefixed by its keyspace, to
+	// its partition key columns. SELECTs on tables that are not listed are
+	// only reported when they have no WHERE clause at all.
+	PartitionKeys map[string][]string
+	// MaxInValues is the largest IN list accepted.
+	MaxInValues int
+	// Disabled lists rules that are not checked.
+	Disabled []LintRule
+}
+
+// LintIssue is an anti-pattern found in a statement.
+type LintIssue struct {
+	Rule    LintRule
+	Stmt    string
+	Message string
+}
+
+func (issue LintIssue) String() string {
+	return fmt.Sprintf("%s: %s in %q", issue.Rule, issue.Message, issue.Stmt)
+}
+
+// WithLint analyses every statement given to Query, ContextQuery and
+// ExecStmt. Issues are kept for LintIssues and AssertNoLintIssues and, when
+// the session has a test set with Test, reported to it right away.
+func (mock *SessionxMock) WithLint(options LintOptions) *SessionxMock {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	mock.lint = &options
+
+	return mock
+}
+
+// LintIssues returns the issues found so far in lint mode.
+func (mock *SessionxMock) LintIssues() []LintIssue {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	return append([]LintIssue(nil), mock.lintIssues...)
+}
+
+// AssertNoLintIssues asserts that lint mode found no issues.
+func (mock *SessionxMock) AssertNoLintIssues(t mock.TestingT) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	issues := mock.LintIssues()
+	for _, issue := range issues {
+		t.Errorf("gocqlxmock: lint: %s", issue)
+	}
+
+	return len(issues) == 0
+}
+
+func (mock *SessionxMock) lintStatement(stmt string) {
+	mock.mu.Lock()
+	options := mock.lint
+	t := mock.test
+	mock.mu.Unlock()
+
+	if options == nil {
+		return
+	}
+
+	issues := LintStatement(stmt, *options)
+	if len(issues) == 0 {
+		return
+	}
+
+	mock.mu.Lock()
+	mock.lintIssues = append(mock.lintIssues, issues...)
+	mock.mu.Unlock()
+
+	if t != nil {
+		for _, issue := range issues {
+			t.Errorf("gocqlxmock: lint: %s", issue)
+		}
+	}
+}
+
+// LintStatement returns the anti-patterns found in stmt.
+func LintStatement(stmt string, options LintOptions) []LintIssue {
+	tokens, err := lex(stmt)
+	if err != nil || len(tokens) == 0 {
+		return nil
+	}
+
+	linter := &linter{
+		stmt:    stmt,
+		tokens:  tokens,
+		options: options,
+	}
+	if linter.options.MaxInValues <= 0 {
+		linter.options.MaxInValues = DefaultMaxInValues
+	}
+
+	kind, _ := classify(stmt)
+	switch {
+	case kind == StatementSelect:
+		linter.lintSelect()
+	case kind.IsWrite():
+		linter.lintWrite()
+	}
+
+	return linter.issues
+}
+
+type linter struct {
+	stmt    string
+	tokens  []token
+	options LintOptions
+	issues  []LintIssue
+}
+
+func (linter *linter) report(rule LintRule, format string, args ...interface{}) {
+	for _, disabled := range linter.options.Disabled {
+		if disabled == rule {
+			return
+		}
+	}
+
+	linter.issues = append(linter.issues, LintIssue{
+		Rule:    rule,
+		Stmt:    linter.stmt,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (linter *linter) lintSelect() {
+	tokens := linter.tokens
+	table := tableAfter(tokens, "FROM")
+	where := clause(tokens, "WHERE", "GROUP", "ORDER", "PER", "LIMIT", "ALLOW", ";")
+	conditions := splitConditions(where)
+
+	restricted := map[string]bool{}
+	for _, condition := range conditions {
+		columns, operator := conditionColumns(condition)
+		if operator.is("=") || operator.is("IN") {
+			for _, column := range columns {
+				restricted[column] = true
+			}
+		}
+		linter.lintInList(condition, operator)
+	}
+
+	partitionKeys, known := linter.partitionKeys(table)
+	restrictsPartition := len(conditions) > 0
+	if known {
+		for _, column := range partitionKeys {
+			if !restricted[strings.ToLower(column)] {
+				restrictsPartition = false
+			}
+		}
+	}
+
+	if !restrictsPartition {
+		if known {
+			linter.report(LintMissingPartitionKey, "SELECT does not restrict partition key (%s) of %s", strings.Join(partitionKeys, ", "), table)
+		} else {
+			linter.report(LintMissingPartitionKey, "SELECT on %s has no WHERE clause", table)
+		}
+
+		if indexOf(tokens, "LIMIT") < 0 {
+			linter.report(LintUnboundedScan, "SELECT scans %s without LIMIT", table)
+		}
+	}
+
+	if allow := indexOf(tokens, "ALLOW"); allow >= 0 && allow+1 < len(tokens) && tokens[allow+1].is("FILTERING") {
+		linter.report(LintAllowFiltering, "SELECT uses ALLOW FILTERING")
+	}
+}
+
+func (linter *linter) lintWrite() {
+	skip := false
+	for _, tok := range linter.tokens {
+		if skip {
+			skip = false
+			continue
+		}
+		if tok.is("TTL") || tok.is("TIMESTAMP") {
+			skip = true
+			continue
+		}
+
+		if tok.isLiteral() {
+			linter.report(LintLiteralValues, "write uses literal %s instead of a bind marker", tok.text)
+			break
+		}
+	}
+
+	for _, condition := range splitConditions(clause(linter.tokens, "WHERE", "IF", ";")) {
+		_, operator := conditionColumns(condition)
+		linter.lintInList(condition, operator)
+	}
+}
+
+func (linter *linter) lintInList(condition []token, operator token) {
+	if !operator.is("IN") {
+		return
+	}
+
+	in := indexOf(condition, "IN")
+	if in+1 >= len(condition) || !condition[in+1].is("(") {
+		return
+	}
+
+	end := closing(condition, in+1)
+	values := 0
+	if end > in+2 {
+		values = 1
+		depth := 0
+		for _, tok := range condition[in+2 : end] {
+			switch {
+			case tok.is("(") || tok.is("[") || tok.is("{"):
+				depth++
+			case tok.is(")") || tok.is("]") || tok.is("}"):
+				depth--
+			case tok.is(",") && depth == 0:
+				values++
+			}
+		}
+	}
+
+	if values > linter.options.MaxInValues {
+		linter.report(LintLargeInList, "IN list has %d values, more than %d", values, linter.options.MaxInValues)
+	}
+}
+
+func (linter *linter) partitionKeys(table string) ([]string, bool) {
+	for name, columns := range linter.options.PartitionKeys {
+		name = strings.ToLower(name)
+		if name == table || (!strings.Contains(name, ".") && strings.HasSuffix(table, "."+name)) {
+			return columns, true
+		}
+	}
+
+	return nil, false
+}
+
+// tableAfter returns the, possibly keyspace qualified, table name following
+// keyword.
+func tableAfter(tokens []token, keyword string) string {
+	index := indexOf(tokens, keyword)
+	if index < 0 || index+1 >= len(tokens) {
+		return ""
+	}
+
+	name := identifier(tokens[index+1])
+	if index+3 < len(tokens) && tokens[index+2].is(".") {
+		name += "." + identifier(tokens[index+3])
+	}
+
+	return name
+}
+
+// identifier returns the name of an identifier token as CQL sees it:
+// unquoted identifiers are case insensitive.
+func identifier(tok token) string {
+	if tok.kind == tokenQuotedIdent {
+		return tok.text
+	}
+
+	return strings.ToLower(tok.text)
+}
+
+// indexOf returns the index of the first top level occurrence of keyword.
+func indexOf(tokens []token, keyword string) int {
+	depth := 0
+	for i, tok := range tokens {
+		switch {
+		case tok.is("(") || tok.is("[") || tok.is("{"):
+			depth++
+		case tok.is(")") || tok.is("]") || tok.is("}"):
+			depth--
+		case depth == 0 && tok.is(keyword):
+			return i
+		}
+	}
+
+	return -1
+}
+
+// closing returns the index of the bracket closing the one at open, or the
+// index of the last token when it is not closed.
+func closing(tokens []token, open int) int {
+	depth := 0
+	for i := open; i < len(tokens); i++ {
+		switch {
+		case tokens[i].is("(") || tokens[i].is("[") || tokens[i].is("{"):
+			depth++
+		case tokens[i].is(")") || tokens[i].is("]") || tokens[i].is("}"):
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return len(tokens) - 1
+}
+
+// clause returns the tokens following keyword up to the first top level
+// occurrence of one of terminators.
+func clause(tokens []token, keyword string, terminators ...string) []token {
+	start := indexOf(tokens, keyword)
+	if start < 0 {
+		return nil
+	}
+
+	rest := tokens[start+1:]
+	end := len(rest)
+	for _, terminator := range terminators {
+		if index := indexOf(rest, terminator); index >= 0 && index < end {
+			end = index
+		}
+	}
+
+	return rest[:end]
+}
+
+// splitConditions splits a WHERE clause on its top level ANDs.
+func splitConditions(tokens []token) [][]token {
+	var conditions [][]token
+
+	for len(tokens) > 0 {
+		and := indexOf(tokens, "AND")
+		if and < 0 {
+			conditions = append(conditions, tokens)
+			break
+		}
+
+		conditions = append(conditions, tokens[:and])
+		tokens = tokens[and+1:]
+	}
+
+	return conditions
+}
+
+// conditionColumns returns the columns restricted by a condition and its
+// operator. Conditions on functions, such as token(), restrict no column.
+func conditionColumns(condition []token) ([]string, token) {
+	if len(condition) == 0 {
+		return nil, token{}
+	}
+
+	var columns []string
+	rest := condition
+	switch {
+	case condition[0].is("("):
+		end := closing(condition, 0)
+		for _, tok := range condition[1:end] {
+			if tok.kind == tokenIdent || tok.kind == tokenQuotedIdent {
+				columns = append(columns, identifier(tok))
+			}
+		}
+		rest = condition[end+1:]
+	case len(condition) > 1 && condition[1].is("("):
+		rest = condition[closing(condition, 1)+1:]
+	default:
+		columns = append(columns, identifier(condition[0]))
+		rest = condition[1:]
+	}
+
+	if len(rest) == 0 {
+		return columns, token{}
+	}
+
+	return columns, rest[0]
+}
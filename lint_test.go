@@ -0,0 +1,116 @@
+package gocqlxmock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func lintRules(issues []LintIssue) []LintRule {
+	rules := []LintRule{}
+	for _, issue := range issues {
+		rules = append(rules, issue.Rule)
+	}
+
+	return rules
+}
+
+func Test_LintStatement(t *testing.T) {
+	options := LintOptions{
+		PartitionKeys: map[string][]string{
+			"potato":      {"id"},
+			"ks.tracking": {"first_name", "last_name"},
+		},
+		MaxInValues: 3,
+	}
+
+	for _, testCase := range []struct {
+		name     string
+		stmt     string
+		expected []LintRule
+	}{
+		{"restricted partition key", "SELECT * FROM potato WHERE id = ?", []LintRule{}},
+		{"restricted partition key with IN", "SELECT * FROM ks.potato WHERE id IN ? AND name > ?", []LintRule{}},
+		{"composite partition key", "SELECT * FROM ks.tracking WHERE first_name = ? AND last_name = ? LIMIT 10", []LintRule{}},
+		{"tuple restriction", "SELECT * FROM ks.tracking WHERE (first_name, last_name) IN ((?, ?))", []LintRule{}},
+		{"partially restricted partition key", "SELECT * FROM ks.tracking WHERE first_name = ? LIMIT 10", []LintRule{LintMissingPartitionKey}},
+		{"token range", "SELECT * FROM potato WHERE token(id) > ?", []LintRule{LintMissingPartitionKey, LintUnboundedScan}},
+		{"no WHERE on unknown table", "SELECT * FROM larry", []LintRule{LintMissingPartitionKey, LintUnboundedScan}},
+		{"WHERE on unknown table", "SELECT * FROM larry WHERE a = ?", []LintRule{}},
+		{"allow filtering", "SELECT * FROM potato WHERE id = ? AND name = ? ALLOW FILTERING", []LintRule{LintAllowFiltering}},
+		{"large IN list", "SELECT * FROM potato WHERE id IN (?, ?, ?, ?)", []LintRule{LintLargeInList}},
+		{"small IN list", "SELECT * FROM potato WHERE id IN (?, ?, ?)", []LintRule{}},
+		{"literal insert", "INSERT INTO potato (id, name) VALUES (?, 'larry') USING TTL 10", []LintRule{LintLiteralValues}},
+		{"bound insert", "INSERT INTO potato (id, name) VALUES (?, ?) USING TTL 10 AND TIMESTAMP 100", []LintRule{}},
+		{"literal update", "UPDATE potato SET views = views + 1 WHERE id = ?", []LintRule{LintLiteralValues}},
+		{"large IN delete", "DELETE FROM potato WHERE id IN (?, ?, ?, ?)", []LintRule{LintLargeInList}},
+		{"schema statement", "CREATE TABLE potato (id int PRIMARY KEY)", []LintRule{}},
+	} {
+		t.Run("Should lint "+testCase.name, func(t *testing.T) {
+			// act
+			issues := LintStatement(testCase.stmt, options)
+
+			// assert
+			assert.Equal(t, testCase.expected, lintRules(issues))
+		})
+	}
+
+	t.Run("Should skip disabled rules", func(t *testing.T) {
+		// act
+		issues := LintStatement("SELECT * FROM larry", LintOptions{Disabled: []LintRule{LintUnboundedScan}})
+
+		// assert
+		assert.Equal(t, []LintRule{LintMissingPartitionKey}, lintRules(issues))
+	})
+}
+
+func Test_Sessionx_WithLint(t *testing.T) {
+	t.Run("Should collect issues of statements given to the session", func(t *testing.T) {
+		// arrange
+		sut := makeSessionxSut()
+		sut.sessionxmock.WithLint(LintOptions{})
+		sut.sessionxmock.On("Query", "SELECT * FROM potato", sut.names).Return(sut.querymock)
+		sut.sessionxmock.On("ContextQuery", sut.ctx, "SELECT * FROM potato WHERE id = ?", sut.names).Return(sut.querymock)
+		sut.sessionxmock.On("ExecStmt", "INSERT INTO potato (id) VALUES (1)").Return(nil)
+
+		// act
+		sut.sessionxmock.Query("SELECT * FROM potato", sut.names)
+		sut.sessionxmock.ContextQuery(sut.ctx, "SELECT * FROM potato WHERE id = ?", sut.names)
+		_ = sut.sessionxmock.ExecStmt("INSERT INTO potato (id) VALUES (1)")
+
+		// assert
+		spy := &testingTSpy{}
+		assert.Equal(t, []LintRule{LintMissingPartitionKey, LintUnboundedScan, LintLiteralValues}, lintRules(sut.sessionxmock.LintIssues()))
+		assert.False(t, sut.sessionxmock.AssertNoLintIssues(spy))
+		assert.Len(t, spy.errors, 3)
+	})
+
+	t.Run("Should report issues right away to the test of the session", func(t *testing.T) {
+		// arrange
+		sut := makeSessionxSut()
+		spy := &testingTSpy{}
+		sut.sessionxmock.Test(spy)
+		sut.sessionxmock.WithLint(LintOptions{})
+		sut.sessionxmock.On("ExecStmt", "DELETE FROM potato WHERE id = 1").Return(nil)
+
+		// act
+		_ = sut.sessionxmock.ExecStmt("DELETE FROM potato WHERE id = 1")
+
+		// assert
+		assert.Len(t, spy.errors, 1)
+		assert.Contains(t, spy.errors[0], "literal-values")
+		assert.False(t, spy.failed)
+	})
+
+	t.Run("Should not lint when lint mode is off", func(t *testing.T) {
+		// arrange
+		sut := makeSessionxSut()
+		sut.sessionxmock.On("ExecStmt", "DELETE FROM potato WHERE id = 1").Return(nil)
+
+		// act
+		_ = sut.sessionxmock.ExecStmt("DELETE FROM potato WHERE id = 1")
+
+		// assert
+		assert.True(t, sut.sessionxmock.AssertNoLintIssues(t))
+	})
+}
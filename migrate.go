@@ -0,0 +1,230 @@
+package gocqlxmock
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Guilospanck/igocqlx"
+	"github.com/gocql/gocql"
+	"github.com/scylladb/gocqlx/v2/migrate"
+	"github.com/scylladb/gocqlx/v2/qb"
+)
+
+// migrateUpstream is the version of gocqlx whose migrate package Migrate and
+// ListMigrations are forked from. They must be synced with it whenever the
+// gocqlx dependency is bumped.
+const migrateUpstream = "v2.7.0"
+
+// The statements gocqlx's migrate package keeps track of migrations with.
+const (
+	migrateInfoSchema = `CREATE TABLE IF NOT EXISTS gocqlx_migrate (
+	name text,
+	checksum text,
+	done int,
+	start_time timestamp,
+	end_time timestamp,
+	PRIMARY KEY(name)
+)`
+	migrateSelectInfo = "SELECT * FROM gocqlx_migrate"
+)
+
+// MigrateCallbackFunc is called by Migrate the way migrate.Callback is
+// called by migrate.FromFS.
+type MigrateCallbackFunc func(ctx context.Context, session igocqlx.ISessionx, ev migrate.CallbackEvent, name string) error
+
+// ListMigrations returns the migrations applied to session. It is a fork of
+// migrate.List of gocqlx v2.7.0 taking an igocqlx.ISessionx.
+func ListMigrations(ctx context.Context, session igocqlx.ISessionx) ([]*migrate.Info, error) {
+	if err := session.ContextQuery(ctx, migrateInfoSchema, nil).ExecRelease(); err != nil {
+		return nil, err
+	}
+
+	var v []*migrate.Info
+	if err := session.ContextQuery(ctx, migrateSelectInfo, nil).SelectRelease(&v); err == gocql.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return v, err
+	}
+
+	sort.Slice(v, func(i, j int) bool {
+		return v[i].Name < v[j].Name
+	})
+
+	return v, nil
+}
+
+// Migrate applies the *.cql files of f to session. It is a fork of
+// migrate.FromFS of gocqlx v2.7.0, which only takes a gocqlx.Session, changed
+// only to take an igocqlx.ISessionx: it issues the same statements, keeps
+// the same bookkeeping and returns the same errors. Run against a
+// FakeSessionx, it tests migration files, resumed partial migrations and
+// checksum mismatches, but not the upstream code itself. callback, if not
+// nil, handles the `-- CALL <name>;` comments and the migration events.
+// migrate.DefaultAwaitSchemaAgreement is honoured.
+func Migrate(ctx context.Context, session igocqlx.ISessionx, f fs.FS, callback MigrateCallbackFunc) error {
+	dbm, err := ListMigrations(ctx, session)
+	if err != nil {
+		return fmt.Errorf("list migrations: %s", err)
+	}
+
+	fm, err := fs.Glob(f, "*.cql")
+	if err != nil {
+		return fmt.Errorf("list migrations: %w", err)
+	}
+	if len(fm) == 0 {
+		return fmt.Errorf("no migration files found")
+	}
+	sort.Strings(fm)
+
+	if len(dbm) > len(fm) {
+		return fmt.Errorf("database is ahead")
+	}
+
+	for i := 0; i < len(dbm); i++ {
+		if dbm[i].Name != fm[i] {
+			return errors.New("inconsistent migrations")
+		}
+		b, err := fs.ReadFile(f, fm[i])
+		if err != nil {
+			return fmt.Errorf("calculate checksum for %q: %s", fm[i], err)
+		}
+		if dbm[i].Checksum != migrationChecksum(b) {
+			return fmt.Errorf("file %q was tempered with, expected md5 %s", fm[i], dbm[i].Checksum)
+		}
+	}
+
+	if len(dbm) > 0 {
+		last := len(dbm) - 1
+		if err := applyMigration(ctx, session, f, fm[last], dbm[last].Done, callback); err != nil {
+			return fmt.Errorf("apply migration %q: %s", fm[last], err)
+		}
+	}
+
+	for i := len(dbm); i < len(fm); i++ {
+		if err := applyMigration(ctx, session, f, fm[i], 0, callback); err != nil {
+			return fmt.Errorf("apply migration %q: %s", fm[i], err)
+		}
+	}
+
+	if err = session.AwaitSchemaAgreement(ctx); err != nil {
+		return fmt.Errorf("awaiting schema agreement: %s", err)
+	}
+
+	return nil
+}
+
+func migrationChecksum(b []byte) string {
+	v := md5.Sum(b)
+
+	return hex.EncodeToString(v[:])
+}
+
+var migrateCallbackRegexp = regexp.MustCompile("^-- *CALL +(.+);$")
+
+// applyMigration applies the statements of the file at path past the done
+// first ones, recording its progress after each of them.
+func applyMigration(ctx context.Context, session igocqlx.ISessionx, f fs.FS, path string, done int, callback MigrateCallbackFunc) error {
+	b, err := fs.ReadFile(f, path)
+	if err != nil {
+		return err
+	}
+
+	info := migrate.Info{
+		Name:      filepath.Base(path),
+		StartTime: time.Now(),
+		Checksum:  migrationChecksum(b),
+	}
+
+	stmt, names := qb.Insert("gocqlx_migrate").Columns(
+		"name",
+		"checksum",
+		"done",
+		"start_time",
+		"end_time",
+	).ToCql()
+
+	update := session.ContextQuery(ctx, stmt, names)
+	defer update.Release()
+
+	if migrate.DefaultAwaitSchemaAgreement.ShouldAwait(migrate.AwaitSchemaAgreementBeforeEachFile) {
+		if err = session.AwaitSchemaAgreement(ctx); err != nil {
+			return fmt.Errorf("awaiting schema agreement: %s", err)
+		}
+	}
+
+	i := 0
+	r := bytes.NewBuffer(b)
+	for {
+		stmt, err := r.ReadString(';')
+		if err == io.EOF {
+			if strings.TrimSpace(stmt) == "" {
+				break
+			}
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+		i++
+
+		if i <= done {
+			continue
+		}
+
+		if callback != nil && i == 1 {
+			if err := callback(ctx, session, migrate.BeforeMigration, info.Name); err != nil {
+				return fmt.Errorf("before migration callback: %s", err)
+			}
+		}
+
+		if migrate.DefaultAwaitSchemaAgreement.ShouldAwait(migrate.AwaitSchemaAgreementBeforeEachStatement) {
+			if err = session.AwaitSchemaAgreement(ctx); err != nil {
+				return fmt.Errorf("awaiting schema agreement: %s", err)
+			}
+		}
+
+		stmt = strings.TrimSpace(stmt)
+
+		if cb := migrateCallbackRegexp.FindStringSubmatch(stmt); cb != nil {
+			if callback == nil {
+				return fmt.Errorf("statement %d: missing callback handler while trying to call %s", i, cb[1])
+			}
+			if err := callback(ctx, session, migrate.CallComment, cb[1]); err != nil {
+				return fmt.Errorf("callback %s: %s", cb[1], err)
+			}
+		} else {
+			q := session.ContextQuery(ctx, stmt, nil).RetryPolicy(nil)
+			if err := q.ExecRelease(); err != nil {
+				return fmt.Errorf("statement %d: %s", i, err)
+			}
+		}
+
+		info.Done = i
+		info.EndTime = time.Now()
+		if err := update.BindStruct(info).Exec(); err != nil {
+			return fmt.Errorf("migration statement %d: %s", i, err)
+		}
+	}
+	if i == 0 {
+		return fmt.Errorf("no migration statements found in %q", info.Name)
+	}
+
+	if callback != nil && i > done {
+		if err := callback(ctx, session, migrate.AfterMigration, info.Name); err != nil {
+			return fmt.Errorf("after migration callback: %s", err)
+		}
+	}
+
+	return nil
+}
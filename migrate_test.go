@@ -0,0 +1,136 @@
+package gocqlxmock
+
+import (
+	"context"
+	"runtime/debug"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Guilospanck/igocqlx"
+	"github.com/scylladb/gocqlx/v2/migrate"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeMigrateSut(t *testing.T) *FakeSessionx {
+	session := NewFakeSessionx().WithKeyspace("ks")
+	if err := session.ExecStmt("CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}"); err != nil {
+		t.Fatal(err)
+	}
+
+	return session
+}
+
+func migrationFile(data string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(data)}
+}
+
+func Test_Migrate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Should apply migration files once, in order", func(t *testing.T) {
+		// arrange
+		session := makeMigrateSut(t)
+		f := fstest.MapFS{
+			"001_init.cql": migrationFile("-- potatoes\nCREATE TABLE potato (id int PRIMARY KEY);\nINSERT INTO potato (id) VALUES (1);"),
+			"002_name.cql": migrationFile("ALTER TABLE potato ADD name text;\nUPDATE potato SET name = 'larry' WHERE id = 1"),
+		}
+
+		// act
+		err := Migrate(ctx, session, f, nil)
+		errAgain := Migrate(ctx, session, f, nil)
+
+		// assert
+		assert.NoError(t, err)
+		assert.NoError(t, errAgain)
+		infos, _ := ListMigrations(ctx, session)
+		assert.Len(t, infos, 2)
+		assert.Equal(t, "001_init.cql", infos[0].Name)
+		assert.Equal(t, 2, infos[1].Done)
+		var name string
+		assert.NoError(t, session.Query("SELECT name FROM potato WHERE id = 1", nil).Get(&name))
+		assert.Equal(t, "larry", name)
+	})
+
+	t.Run("Should resume partially applied migrations", func(t *testing.T) {
+		// arrange
+		session := makeMigrateSut(t)
+		f := fstest.MapFS{
+			"001_init.cql": migrationFile("CREATE TABLE potato (id int PRIMARY KEY);\nINSERT INTO tomato (id) VALUES (1);"),
+		}
+
+		// act
+		err := Migrate(ctx, session, f, nil)
+		errAgain := Migrate(ctx, session, f, nil)
+
+		// assert
+		assert.EqualError(t, err, `apply migration "001_init.cql": statement 2: unconfigured table tomato`)
+		assert.EqualError(t, errAgain, `apply migration "001_init.cql": statement 2: unconfigured table tomato`)
+		infos, _ := ListMigrations(ctx, session)
+		assert.Equal(t, 1, infos[0].Done)
+	})
+
+	t.Run("Should reject files changed since they were applied", func(t *testing.T) {
+		// arrange
+		session := makeMigrateSut(t)
+		f := fstest.MapFS{"001_init.cql": migrationFile("CREATE TABLE potato (id int PRIMARY KEY);")}
+		if err := Migrate(ctx, session, f, nil); err != nil {
+			t.Fatal(err)
+		}
+		infos, _ := ListMigrations(ctx, session)
+		f["001_init.cql"] = migrationFile("CREATE TABLE potato (id bigint PRIMARY KEY);")
+
+		// act
+		err := Migrate(ctx, session, f, nil)
+
+		// assert
+		assert.EqualError(t, err, `file "001_init.cql" was tempered with, expected md5 `+infos[0].Checksum)
+	})
+
+	t.Run("Should call the callback on events and CALL comments", func(t *testing.T) {
+		// arrange
+		session := makeMigrateSut(t)
+		f := fstest.MapFS{
+			"001_init.cql": migrationFile("CREATE TABLE potato (id int PRIMARY KEY);\n-- CALL seed;"),
+		}
+		var events []string
+		callback := func(ctx context.Context, session igocqlx.ISessionx, ev migrate.CallbackEvent, name string) error {
+			events = append(events, name)
+			if ev == migrate.CallComment {
+				return session.Query("INSERT INTO potato (id) VALUES (1)", nil).Exec()
+			}
+			return nil
+		}
+
+		// act
+		err := Migrate(ctx, session, f, callback)
+		errMissing := Migrate(ctx, makeMigrateSut(t), f, nil)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"001_init.cql", "seed", "001_init.cql"}, events)
+		var id int
+		assert.NoError(t, session.Query("SELECT id FROM potato", nil).Get(&id))
+		assert.EqualError(t, errMissing, `apply migration "001_init.cql": statement 2: missing callback handler while trying to call seed`)
+	})
+}
+
+func Test_Migrate_Upstream(t *testing.T) {
+	t.Run("Should track the gocqlx version the fork is synced with", func(t *testing.T) {
+		// arrange
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			t.Skip("no build information")
+		}
+
+		// act
+		version := ""
+		for _, dep := range info.Deps {
+			if dep.Path == "github.com/scylladb/gocqlx/v2" {
+				version = dep.Version
+			}
+		}
+
+		// assert
+		assert.Equal(t, migrateUpstream, version, "sync Migrate and ListMigrations with the migrate package of gocqlx %s", version)
+	})
+}
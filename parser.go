@@ -0,0 +1,142 @@
+package gocqlxmock
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gocql/gocql"
+)
+
+var _ gocql.RequestError = &RequestError{}
+
+// RequestError is an error returned by the fake session for a statement the
+// database would reject, with the error code and message Scylla would send.
+type RequestError struct {
+	ErrorCode int
+	Msg       string
+}
+
+func (err *RequestError) Code() int {
+	return err.ErrorCode
+}
+
+func (err *RequestError) Message() string {
+	return err.Msg
+}
+
+func (err *RequestError) Error() string {
+	return err.Msg
+}
+
+func invalidf(format string, args ...interface{}) error {
+	return &RequestError{gocql.ErrCodeInvalid, fmt.Sprintf(format, args...)}
+}
+
+// parser walks the tokens of a statement.
+type parser struct {
+	stmt   string
+	tokens []token
+	pos    int
+}
+
+func newParser(stmt string) (*parser, error) {
+	tokens, err := lex(stmt)
+	if err != nil {
+		return nil, &RequestError{gocql.ErrCodeSyntax, err.Error()}
+	}
+
+	return &parser{stmt: stmt, tokens: tokens}, nil
+}
+
+func (p *parser) peek() token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+
+	return token{kind: tokenEOF, pos: len(p.stmt)}
+}
+
+func (p *parser) next() token {
+	tok := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+
+	return tok
+}
+
+// done reports whether the statement has been read, but for a trailing ';'.
+func (p *parser) done() bool {
+	p.accept(";")
+
+	return p.pos >= len(p.tokens)
+}
+
+// accept consumes the keywords or symbols words when they come next.
+func (p *parser) accept(words ...string) bool {
+	if p.pos+len(words) > len(p.tokens) {
+		return false
+	}
+
+	for i, word := range words {
+		if !p.tokens[p.pos+i].is(word) {
+			return false
+		}
+	}
+	p.pos += len(words)
+
+	return true
+}
+
+func (p *parser) expect(words ...string) error {
+	if !p.accept(words...) {
+		return p.errorf("expecting %s", strings.Join(words, " "))
+	}
+
+	return nil
+}
+
+// ident reads an identifier, as CQL sees it.
+func (p *parser) ident() (string, error) {
+	tok := p.peek()
+	if tok.kind != tokenIdent && tok.kind != tokenQuotedIdent {
+		return "", p.errorf("expecting an identifier")
+	}
+	p.pos++
+
+	return identifier(tok), nil
+}
+
+// name reads a, possibly keyspace qualified, name.
+func (p *parser) name() (keyspace, name string, err error) {
+	name, err = p.ident()
+	if err != nil {
+		return "", "", err
+	}
+
+	if p.accept(".") {
+		keyspace = name
+		if name, err = p.ident(); err != nil {
+			return "", "", err
+		}
+	}
+
+	return keyspace, name, nil
+}
+
+// errorf returns a syntax error at the next token, located like Scylla does.
+func (p *parser) errorf(format string, args ...interface{}) error {
+	tok := p.peek()
+	line := 1 + strings.Count(p.stmt[:tok.pos], "\n")
+	column := tok.pos - strings.LastIndex(p.stmt[:tok.pos], "\n") - 1
+
+	input := tok.text
+	if tok.kind == tokenEOF {
+		input = "<EOF>"
+	}
+
+	return &RequestError{
+		gocql.ErrCodeSyntax,
+		fmt.Sprintf("line %d:%d %s at input '%s'", line, column, fmt.Sprintf(format, args...), input),
+	}
+}
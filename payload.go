@@ -0,0 +1,157 @@
+package gocqlxmock
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// CustomPayloadGetter is implemented by QueryxMock and IterxMock, just like
+// gocql.Iter, so that code under test can read the custom payload of a
+// response through a type assertion.
+type CustomPayloadGetter interface {
+	GetCustomPayload() map[string][]byte
+}
+
+// WithCustomPayloadResponse makes the queries of stmt handed out by the
+// session respond with payload, unless the query has a response of its own.
+func (mock *SessionxMock) WithCustomPayloadResponse(stmt string, payload map[string][]byte) *SessionxMock {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	if mock.payloads == nil {
+		mock.payloads = map[string]map[string][]byte{}
+	}
+	mock.payloads[stmt] = payload
+
+	return mock
+}
+
+// AssertCustomPayload asserts that every execution of stmt sent exactly
+// payload.
+func (mock *SessionxMock) AssertCustomPayload(t mock.TestingT, stmt string, payload map[string][]byte) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	return mock.assertExecutions(t, stmt, func(execution Execution) error {
+		if !equalPayloads(execution.CustomPayload, payload) {
+			return fmt.Errorf("ran with custom payload %s, expected %s", formatPayload(execution.CustomPayload), formatPayload(payload))
+		}
+
+		return nil
+	})
+}
+
+func (mock *SessionxMock) customPayloadResponse(stmt string) map[string][]byte {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	return mock.payloads[stmt]
+}
+
+// WithCustomPayloadResponse makes every terminal call of the query respond
+// with payload.
+func (mock *QueryxMock) WithCustomPayloadResponse(payload map[string][]byte) *QueryxMock {
+	root := mock.root()
+	root.state.mu.Lock()
+	defer root.state.mu.Unlock()
+
+	root.state.payloadResponse = payload
+
+	return mock
+}
+
+// GetCustomPayload returns the custom payload of the response to the last
+// terminal call of the query.
+func (mock *QueryxMock) GetCustomPayload() map[string][]byte {
+	mock.state.mu.Lock()
+	defer mock.state.mu.Unlock()
+
+	return mock.state.payloadReceived
+}
+
+// respond sets the custom payload of the response to a terminal call, and
+// hands it to iter when the call returned an IterxMock.
+func (mock *QueryxMock) respond(iter interface{}) {
+	root := mock.root()
+	root.state.mu.Lock()
+	payload := root.state.payloadResponse
+	root.state.mu.Unlock()
+
+	mock.state.mu.Lock()
+	session := mock.state.session
+	mock.state.mu.Unlock()
+
+	if payload == nil && session != nil {
+		payload = session.customPayloadResponse(mock.statement())
+	}
+
+	mock.state.mu.Lock()
+	mock.state.payloadReceived = payload
+	mock.state.mu.Unlock()
+
+	if iter, ok := iter.(*IterxMock); ok {
+		iter.mu.Lock()
+		iter.payloadReceived = payload
+		iter.mu.Unlock()
+	}
+}
+
+// WithCustomPayload makes the iterator respond with payload, whatever the
+// response of the query it is returned by.
+func (mock *IterxMock) WithCustomPayload(payload map[string][]byte) *IterxMock {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	mock.payload = payload
+
+	return mock
+}
+
+// GetCustomPayload returns the custom payload of the response the iterator
+// reads: the one given to WithCustomPayload or else the response of the query
+// that returned it.
+func (mock *IterxMock) GetCustomPayload() map[string][]byte {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	if mock.payload != nil {
+		return mock.payload
+	}
+
+	return mock.payloadReceived
+}
+
+func equalPayloads(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for key, value := range a {
+		other, ok := b[key]
+		if !ok || !bytes.Equal(value, other) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func formatPayload(payload map[string][]byte) string {
+	keys := make([]string, 0, len(payload))
+	for key := range payload {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	entries := make([]string, 0, len(keys))
+	for _, key := range keys {
+		entries = append(entries, fmt.Sprintf("%s: %x", key, payload[key]))
+	}
+
+	return "{" + strings.Join(entries, ", ") + "}"
+}
@@ -0,0 +1,117 @@
+package gocqlxmock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type payloadSut struct {
+	stmt        string
+	payload     map[string][]byte
+	response    map[string][]byte
+	sessionmock *SessionxMock
+	querymock   *QueryxMock
+	itermock    *IterxMock
+}
+
+func makePayloadSut() payloadSut {
+	sut := payloadSut{
+		"SELECT name FROM potato WHERE id = ?",
+		map[string][]byte{"tenant": []byte("A")},
+		map[string][]byte{"scylla-rate-limit": {0x01}},
+		&SessionxMock{},
+		&QueryxMock{},
+		&IterxMock{},
+	}
+	sut.sessionmock.On("Query", sut.stmt, []string{"id"}).Return(sut.querymock)
+	sut.querymock.On("CustomPayload", sut.payload).Return(sut.querymock)
+	sut.querymock.On("Iter").Return(sut.itermock)
+	sut.querymock.On("Exec").Return(nil)
+
+	return sut
+}
+
+func Test_Sessionx_AssertCustomPayload(t *testing.T) {
+	t.Run("Should pass when every execution sent the payload", func(t *testing.T) {
+		// arrange
+		sut := makePayloadSut()
+
+		// act
+		_ = sut.sessionmock.Query(sut.stmt, []string{"id"}).CustomPayload(sut.payload).Exec()
+
+		// assert
+		assert.True(t, sut.sessionmock.AssertCustomPayload(t, sut.stmt, map[string][]byte{"tenant": []byte("A")}))
+		assert.Equal(t, sut.payload, sut.sessionmock.Executions()[0].CustomPayload)
+	})
+
+	t.Run("Should report the payload bytes that differ", func(t *testing.T) {
+		// arrange
+		spy := &testingTSpy{}
+		sut := makePayloadSut()
+
+		// act
+		_ = sut.sessionmock.Query(sut.stmt, []string{"id"}).CustomPayload(sut.payload).Exec()
+
+		// assert
+		assert.False(t, sut.sessionmock.AssertCustomPayload(spy, sut.stmt, map[string][]byte{"tenant": []byte("B")}))
+		assert.Equal(t, []string{`gocqlxmock: "SELECT name FROM potato WHERE id = ?" ran with custom payload {tenant: 41}, expected {tenant: 42}`}, spy.errors)
+	})
+}
+
+func Test_CustomPayloadResponse(t *testing.T) {
+	t.Run("Should respond with the payload configured on the session", func(t *testing.T) {
+		// arrange
+		sut := makePayloadSut()
+		sut.sessionmock.WithCustomPayloadResponse(sut.stmt, sut.response)
+
+		// act
+		query := sut.sessionmock.Query(sut.stmt, []string{"id"})
+		before := query.(CustomPayloadGetter).GetCustomPayload()
+		err := query.Exec()
+
+		// assert
+		assert.NoError(t, err)
+		assert.Nil(t, before)
+		assert.Equal(t, sut.response, query.(CustomPayloadGetter).GetCustomPayload())
+	})
+
+	t.Run("Should prefer the payload configured on the query", func(t *testing.T) {
+		// arrange
+		sut := makePayloadSut()
+		sut.sessionmock.WithCustomPayloadResponse(sut.stmt, map[string][]byte{"other": nil})
+		sut.querymock.WithCustomPayloadResponse(sut.response)
+
+		// act
+		query := sut.sessionmock.Query(sut.stmt, []string{"id"})
+		_ = query.Exec()
+
+		// assert
+		assert.Equal(t, sut.response, query.(CustomPayloadGetter).GetCustomPayload())
+	})
+
+	t.Run("Should attach the response to the iterators returned by Iter", func(t *testing.T) {
+		// arrange
+		sut := makePayloadSut()
+		sut.sessionmock.WithCustomPayloadResponse(sut.stmt, sut.response)
+
+		// act
+		iter := sut.sessionmock.Query(sut.stmt, []string{"id"}).Iter()
+
+		// assert
+		assert.Equal(t, sut.response, iter.(CustomPayloadGetter).GetCustomPayload())
+	})
+
+	t.Run("Should prefer the payload configured on the iterator", func(t *testing.T) {
+		// arrange
+		sut := makePayloadSut()
+		sut.sessionmock.WithCustomPayloadResponse(sut.stmt, map[string][]byte{"other": nil})
+		sut.itermock.WithCustomPayload(sut.response)
+
+		// act
+		iter := sut.sessionmock.Query(sut.stmt, []string{"id"}).Iter()
+
+		// assert
+		assert.Equal(t, sut.response, iter.(CustomPayloadGetter).GetCustomPayload())
+	})
+}
@@ -2,6 +2,8 @@ package gocqlxmock
 
 import (
 	"context"
+	"strings"
+	"sync"
 
 	"github.com/Guilospanck/igocqlx"
 	"github.com/gocql/gocql"
@@ -9,217 +11,595 @@ import (
 	"github.com/stretchr/testify/mock"
 )
 
+var _ gocql.RetryableQuery = &QueryxMock{}
+
 type QueryxMock struct {
 	mock.Mock
 	Ctx   context.Context
 	Stmt  string
 	Names []string
+
+	graph    mockGraph
+	template *QueryxMock
+	state    queryState
+	log      callLog
+	// callsMu guards the Calls of a view, which are recorded without going
+	// through its expectations.
+	callsMu sync.Mutex
+}
+
+// queryState is what a query accumulates through its chained calls.
+type queryState struct {
+	mu     sync.Mutex
+	tr     gocqlx.Transformer
+	values []interface{}
+	ctx    context.Context
+	stmt   string
+	names  []string
+
+	session           *SessionxMock
+	observer          gocql.QueryObserver
+	tracer            gocql.Tracer
+	traced            int
+	traces            []TraceSession
+	retryPolicy       gocql.RetryPolicy
+	attempts          int
+	speculativePolicy gocql.SpeculativeExecutionPolicy
+	idempotent        bool
+	routingKey        []byte
+	customPayload     map[string][]byte
+	payloadResponse   map[string][]byte
+	payloadReceived   map[string][]byte
+	rows              *Rows
+	// rejected is the error the statement of the query fails with, as
+	// told by the schema of its session.
+	rejected error
+
+	speculativeAttempts int
+	consistency         *gocql.Consistency
+	serialConsistency   *gocql.SerialConsistency
+}
+
+// NewQueryxMock creates a QueryxMock for stmt and names bound to t: unexpected
+// calls fail the test and the expectations of the query, and of every query
+// and iterator it returned, are asserted when the test finishes.
+func NewQueryxMock(t TestingT, stmt string, names []string) *QueryxMock {
+	mock := &QueryxMock{
+		Ctx:   context.Background(),
+		Stmt:  stmt,
+		Names: names,
+	}
+	bindTest(t, mock, mock)
+
+	return mock
+}
+
+func (mock *QueryxMock) mockGraph() *mockGraph {
+	return &mock.graph
+}
+
+// Values returns the values bound to the query so far.
+func (mock *QueryxMock) Values() []interface{} {
+	mock.state.mu.Lock()
+	defer mock.state.mu.Unlock()
+
+	return append([]interface{}(nil), mock.state.values...)
+}
+
+// Context returns the context the query runs with: the one given to
+// WithContext or ContextQuery, falling back to Ctx and context.Background.
+func (mock *QueryxMock) Context() context.Context {
+	mock.state.mu.Lock()
+	defer mock.state.mu.Unlock()
+
+	switch {
+	case mock.state.ctx != nil:
+		return mock.state.ctx
+	case mock.Ctx != nil:
+		return mock.Ctx
+	default:
+		return context.Background()
+	}
+}
+
+func (mock *QueryxMock) setContext(ctx context.Context) {
+	mock.state.mu.Lock()
+	defer mock.state.mu.Unlock()
+
+	mock.state.ctx = ctx
+}
+
+// GetConsistency returns the consistency the query runs with: the one given
+// to Consistency, falling back to the default of its session and gocql.Quorum.
+func (mock *QueryxMock) GetConsistency() gocql.Consistency {
+	mock.state.mu.Lock()
+	consistency, session := mock.state.consistency, mock.state.session
+	mock.state.mu.Unlock()
+
+	switch {
+	case consistency != nil:
+		return *consistency
+	case session != nil:
+		return session.defaultConsistency()
+	default:
+		return gocql.Quorum
+	}
+}
+
+// GetSerialConsistency returns the serial consistency the query runs with:
+// the one given to SerialConsistency, falling back to the default of its
+// session and gocql.Serial.
+func (mock *QueryxMock) GetSerialConsistency() gocql.SerialConsistency {
+	mock.state.mu.Lock()
+	serialConsistency, session := mock.state.serialConsistency, mock.state.session
+	mock.state.mu.Unlock()
+
+	switch {
+	case serialConsistency != nil:
+		return *serialConsistency
+	case session != nil:
+		return session.defaultSerialConsistency()
+	default:
+		return gocql.Serial
+	}
+}
+
+func (mock *QueryxMock) setSession(session *SessionxMock, stmt string, names []string) {
+	mock.state.mu.Lock()
+	defer mock.state.mu.Unlock()
+
+	mock.state.session = session
+	mock.state.stmt = stmt
+	mock.state.names = names
+}
+
+// reject makes the terminal calls of the query fail with err, unless nil.
+func (mock *QueryxMock) reject(err error) {
+	mock.state.mu.Lock()
+	defer mock.state.mu.Unlock()
+
+	mock.state.rejected = err
+}
+
+// statement returns the statement of the query: the one given to the
+// session that handed it out, falling back to Stmt.
+func (mock *QueryxMock) statement() string {
+	mock.state.mu.Lock()
+	defer mock.state.mu.Unlock()
+
+	if mock.state.session != nil {
+		return mock.state.stmt
+	}
+
+	return mock.Stmt
+}
+
+func (mock *QueryxMock) names() []string {
+	mock.state.mu.Lock()
+	defer mock.state.mu.Unlock()
+
+	if mock.state.session != nil {
+		return mock.state.names
+	}
+
+	return mock.Names
+}
+
+// terminal hands the execution about to happen to the session of the query,
+// failing when it violates the consistency policy of the session.
+func (mock *QueryxMock) terminal(method string) error {
+	mock.state.mu.Lock()
+	session := mock.state.session
+	mock.state.mu.Unlock()
+
+	if session == nil {
+		return nil
+	}
+
+	stmt := mock.statement()
+	kind, lwt := classify(stmt)
+	return session.execute(Execution{
+		Stmt:              stmt,
+		Method:            method,
+		Kind:              kind,
+		LWT:               lwt || strings.Contains(method, "CAS"),
+		Values:            mock.Values(),
+		Consistency:       mock.GetConsistency(),
+		SerialConsistency: mock.GetSerialConsistency(),
+		CustomPayload:     mock.sentPayload(),
+	})
+}
+
+func (mock *QueryxMock) sentPayload() map[string][]byte {
+	mock.state.mu.Lock()
+	defer mock.state.mu.Unlock()
+
+	return mock.state.customPayload
+}
+
+func (mock *QueryxMock) root() *QueryxMock {
+	if mock.template != nil {
+		return mock.template
+	}
+
+	return mock
+}
+
+// view returns a QueryxMock for a single use of mock: expectations are
+// matched against mock, while chained state and calls are kept apart.
+func (mock *QueryxMock) view() *QueryxMock {
+	root := mock.root()
+
+	return &QueryxMock{
+		Ctx:      root.Ctx,
+		Stmt:     root.Stmt,
+		Names:    root.Names,
+		template: root,
+	}
+}
+
+func (mock *QueryxMock) called(method string, arguments ...interface{}) mock.Arguments {
+	args := mock.attemptCalled(method, arguments...)
+	mock.log.record(method, arguments, args)
+
+	return args
+}
+
+// attemptCalled makes a call without logging it, as terminal calls are
+// logged once with their final result.
+func (mock *QueryxMock) attemptCalled(method string, arguments ...interface{}) mock.Arguments {
+	root := mock.root()
+	args := root.MethodCalled(method, arguments...)
+
+	if mock != root {
+		recordCall(mock, method, arguments, args)
+	}
+
+	return args
+}
+
+// recordCall adds a call returning returns to the Calls of view, whose
+// expectations are those of its root.
+func recordCall(view *QueryxMock, method string, arguments []interface{}, returns mock.Arguments) {
+	view.callsMu.Lock()
+	defer view.callsMu.Unlock()
+
+	view.Calls = append(view.Calls, mock.Call{
+		Parent:          &view.Mock,
+		Method:          method,
+		Arguments:       arguments,
+		ReturnArguments: returns,
+	})
+}
+
+// AssertCalled asserts that the method was called with arguments. It is safe
+// to call on views while calls are recorded.
+func (mock *QueryxMock) AssertCalled(t mock.TestingT, methodName string, arguments ...interface{}) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	mock.callsMu.Lock()
+	defer mock.callsMu.Unlock()
+
+	return mock.Mock.AssertCalled(t, methodName, arguments...)
+}
+
+// AssertNotCalled asserts that the method was not called with arguments. It
+// is safe to call on views while calls are recorded.
+func (mock *QueryxMock) AssertNotCalled(t mock.TestingT, methodName string, arguments ...interface{}) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	mock.callsMu.Lock()
+	defer mock.callsMu.Unlock()
+
+	return mock.Mock.AssertNotCalled(t, methodName, arguments...)
+}
+
+// AssertNumberOfCalls asserts that the method was called expectedCalls
+// times. It is safe to call on views while calls are recorded.
+func (mock *QueryxMock) AssertNumberOfCalls(t mock.TestingT, methodName string, expectedCalls int) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	mock.callsMu.Lock()
+	defer mock.callsMu.Unlock()
+
+	return mock.Mock.AssertNumberOfCalls(t, methodName, expectedCalls)
+}
+
+func (mock *QueryxMock) queryx(args mock.Arguments) igocqlx.IQueryx {
+	result := args.Get(0).(igocqlx.IQueryx)
+
+	root := mock.root()
+	if result == igocqlx.IQueryx(root) {
+		return mock
+	}
+	root.graph.adopt(result)
+
+	return result
+}
+
+func (mock *QueryxMock) iterx(args mock.Arguments) igocqlx.IIterx {
+	result := args.Get(0).(igocqlx.IIterx)
+	mock.root().graph.adopt(result)
+
+	return result
+}
+
+func (mock *QueryxMock) bind(values []interface{}, err error) {
+	mock.state.mu.Lock()
+	defer mock.state.mu.Unlock()
+
+	if err != nil {
+		values = nil
+	}
+	mock.state.values = values
+}
+
+func (mock *QueryxMock) transformer() gocqlx.Transformer {
+	mock.state.mu.Lock()
+	defer mock.state.mu.Unlock()
+
+	if mock.state.tr != nil {
+		return mock.state.tr
+	}
+
+	return gocqlx.DefaultBindTransformer
 }
 
 func (mock *QueryxMock) WithBindTransformer(tr gocqlx.Transformer) igocqlx.IQueryx {
-	args := mock.Called(tr)
+	args := mock.called("WithBindTransformer", tr)
+
+	mock.state.mu.Lock()
+	mock.state.tr = tr
+	mock.state.mu.Unlock()
 
-	return args.Get(0).(igocqlx.IQueryx)
+	return mock.queryx(args)
 }
 
 func (mock *QueryxMock) BindStruct(arg interface{}) igocqlx.IQueryx {
-	args := mock.Called(arg)
+	args := mock.called("BindStruct", arg)
+	mock.bind(bindStructValues(mock.names(), mock.transformer(), arg, nil))
 
-	return args.Get(0).(igocqlx.IQueryx)
+	return mock.queryx(args)
 }
 
 func (mock *QueryxMock) BindStructMap(arg0 interface{}, arg1 map[string]interface{}) igocqlx.IQueryx {
-	args := mock.Called(arg0, arg1)
+	args := mock.called("BindStructMap", arg0, arg1)
+	mock.bind(bindStructValues(mock.names(), mock.transformer(), arg0, arg1))
 
-	return args.Get(0).(igocqlx.IQueryx)
+	return mock.queryx(args)
 }
 
 func (mock *QueryxMock) BindMap(arg map[string]interface{}) igocqlx.IQueryx {
-	args := mock.Called(arg)
+	args := mock.called("BindMap", arg)
+	mock.bind(bindMapValues(mock.names(), mock.transformer(), arg))
 
-	return args.Get(0).(igocqlx.IQueryx)
+	return mock.queryx(args)
 }
 
 func (mock *QueryxMock) Bind(v ...interface{}) igocqlx.IQueryx {
-	args := mock.Called(v)
+	args := mock.called("Bind", v)
+	mock.bind(v, nil)
 
-	return args.Get(0).(igocqlx.IQueryx)
+	return mock.queryx(args)
 }
 
 func (mock *QueryxMock) Err() error {
-	args := mock.Called()
+	args := mock.called("Err")
 
 	return args.Error(0)
 }
 
 func (mock *QueryxMock) Exec() error {
-	args := mock.Called()
+	args := mock.run("Exec", 0, nil)
 
 	return args.Error(0)
 }
 
 func (mock *QueryxMock) ExecRelease() error {
-	args := mock.Called()
+	args := mock.run("ExecRelease", 0, nil)
 
 	return args.Error(0)
 }
 
 func (mock *QueryxMock) ExecCAS() (applied bool, err error) {
-	args := mock.Called()
+	args := mock.run("ExecCAS", 1, nil)
 
 	return args.Get(0).(bool), args.Error(1)
 }
 
 func (mock *QueryxMock) ExecCASRelease() (bool, error) {
-	args := mock.Called()
+	args := mock.run("ExecCASRelease", 1, nil)
 
 	return args.Get(0).(bool), args.Error(1)
 }
 
 func (mock *QueryxMock) Get(dest interface{}) error {
-	args := mock.Called(dest)
+	args := mock.run("Get", 0, dest, dest)
 
 	return args.Error(0)
 }
 
 func (mock *QueryxMock) GetRelease(dest interface{}) error {
-	args := mock.Called(dest)
+	args := mock.run("GetRelease", 0, dest, dest)
 
 	return args.Error(0)
 }
 
 func (mock *QueryxMock) GetCAS(dest interface{}) (applied bool, err error) {
-	args := mock.Called(dest)
+	args := mock.run("GetCAS", 1, dest, dest)
 
 	return args.Get(0).(bool), args.Error(1)
 }
 
 func (mock *QueryxMock) GetCASRelease(dest interface{}) (bool, error) {
-	args := mock.Called(dest)
+	args := mock.run("GetCASRelease", 1, dest, dest)
 
 	return args.Get(0).(bool), args.Error(1)
 }
 
 func (mock *QueryxMock) Select(dest interface{}) error {
-	args := mock.Called(dest)
+	args := mock.run("Select", 0, dest, dest)
 
 	return args.Error(0)
 }
 
 func (mock *QueryxMock) SelectRelease(dest interface{}) error {
-	args := mock.Called(dest)
+	args := mock.run("SelectRelease", 0, dest, dest)
 
 	return args.Error(0)
 }
 
 func (mock *QueryxMock) Iter() igocqlx.IIterx {
-	args := mock.Called()
+	args := mock.run("Iter", -1, nil)
 
-	return args.Get(0).(igocqlx.IIterx)
+	return mock.iterx(args)
 }
 
 func (mock *QueryxMock) Consistency(c gocql.Consistency) igocqlx.IQueryx {
-	args := mock.Called(c)
+	args := mock.called("Consistency", c)
 
-	return args.Get(0).(igocqlx.IQueryx)
+	mock.state.mu.Lock()
+	mock.state.consistency = &c
+	mock.state.mu.Unlock()
+
+	return mock.queryx(args)
 }
 
 func (mock *QueryxMock) CustomPayload(customPayload map[string][]byte) igocqlx.IQueryx {
-	args := mock.Called(customPayload)
+	args := mock.called("CustomPayload", customPayload)
+
+	mock.state.mu.Lock()
+	mock.state.customPayload = customPayload
+	mock.state.mu.Unlock()
 
-	return args.Get(0).(igocqlx.IQueryx)
+	return mock.queryx(args)
 }
 
 func (mock *QueryxMock) Trace(trace gocql.Tracer) igocqlx.IQueryx {
-	args := mock.Called(trace)
+	args := mock.called("Trace", trace)
+
+	mock.state.mu.Lock()
+	mock.state.tracer = trace
+	mock.state.mu.Unlock()
 
-	return args.Get(0).(igocqlx.IQueryx)
+	return mock.queryx(args)
 }
 
 func (mock *QueryxMock) Observer(observer gocql.QueryObserver) igocqlx.IQueryx {
-	args := mock.Called(observer)
+	args := mock.called("Observer", observer)
 
-	return args.Get(0).(igocqlx.IQueryx)
+	mock.state.mu.Lock()
+	mock.state.observer = observer
+	mock.state.mu.Unlock()
+
+	return mock.queryx(args)
 }
 
 func (mock *QueryxMock) PageSize(n int) igocqlx.IQueryx {
-	args := mock.Called(n)
+	args := mock.called("PageSize", n)
 
-	return args.Get(0).(igocqlx.IQueryx)
+	return mock.queryx(args)
 }
 
 func (mock *QueryxMock) DefaultTimestamp(enable bool) igocqlx.IQueryx {
-	args := mock.Called(enable)
+	args := mock.called("DefaultTimestamp", enable)
 
-	return args.Get(0).(igocqlx.IQueryx)
+	return mock.queryx(args)
 }
 
 func (mock *QueryxMock) WithTimestamp(timestamp int64) igocqlx.IQueryx {
-	args := mock.Called(timestamp)
+	args := mock.called("WithTimestamp", timestamp)
 
-	return args.Get(0).(igocqlx.IQueryx)
+	return mock.queryx(args)
 }
 
 func (mock *QueryxMock) RoutingKey(routingKey []byte) igocqlx.IQueryx {
-	args := mock.Called(routingKey)
+	args := mock.called("RoutingKey", routingKey)
+
+	mock.state.mu.Lock()
+	mock.state.routingKey = routingKey
+	mock.state.mu.Unlock()
 
-	return args.Get(0).(igocqlx.IQueryx)
+	return mock.queryx(args)
 }
 
 func (mock *QueryxMock) WithContext(ctx context.Context) igocqlx.IQueryx {
-	args := mock.Called(ctx)
+	args := mock.called("WithContext", ctx)
+	mock.setContext(ctx)
 
-	return args.Get(0).(igocqlx.IQueryx)
+	return mock.queryx(args)
 }
 
 func (mock *QueryxMock) Prefetch(p float64) igocqlx.IQueryx {
-	args := mock.Called(p)
+	args := mock.called("Prefetch", p)
 
-	return args.Get(0).(igocqlx.IQueryx)
+	return mock.queryx(args)
 }
 
 func (mock *QueryxMock) RetryPolicy(r gocql.RetryPolicy) igocqlx.IQueryx {
-	args := mock.Called(r)
+	args := mock.called("RetryPolicy", r)
 
-	return args.Get(0).(igocqlx.IQueryx)
+	mock.state.mu.Lock()
+	mock.state.retryPolicy = r
+	mock.state.mu.Unlock()
+
+	return mock.queryx(args)
 }
 
 func (mock *QueryxMock) SetSpeculativeExecutionPolicy(sp gocql.SpeculativeExecutionPolicy) igocqlx.IQueryx {
-	args := mock.Called(sp)
+	args := mock.called("SetSpeculativeExecutionPolicy", sp)
+
+	mock.state.mu.Lock()
+	mock.state.speculativePolicy = sp
+	mock.state.mu.Unlock()
 
-	return args.Get(0).(igocqlx.IQueryx)
+	return mock.queryx(args)
 }
 
 func (mock *QueryxMock) Idempotent(value bool) igocqlx.IQueryx {
-	args := mock.Called(value)
+	args := mock.called("Idempotent", value)
 
-	return args.Get(0).(igocqlx.IQueryx)
+	mock.state.mu.Lock()
+	mock.state.idempotent = value
+	mock.state.mu.Unlock()
+
+	return mock.queryx(args)
 }
 
 func (mock *QueryxMock) SerialConsistency(cons gocql.SerialConsistency) igocqlx.IQueryx {
-	args := mock.Called(cons)
+	args := mock.called("SerialConsistency", cons)
+
+	mock.state.mu.Lock()
+	mock.state.serialConsistency = &cons
+	mock.state.mu.Unlock()
 
-	return args.Get(0).(igocqlx.IQueryx)
+	return mock.queryx(args)
 }
 
 func (mock *QueryxMock) PageState(state []byte) igocqlx.IQueryx {
-	args := mock.Called(state)
+	args := mock.called("PageState", state)
 
-	return args.Get(0).(igocqlx.IQueryx)
+	return mock.queryx(args)
 }
 
 func (mock *QueryxMock) NoSkipMetadata() igocqlx.IQueryx {
-	args := mock.Called()
+	args := mock.called("NoSkipMetadata")
 
-	return args.Get(0).(igocqlx.IQueryx)
+	return mock.queryx(args)
 }
 
 func (mock *QueryxMock) Release() {
-	mock.Called()
+	mock.called("Release")
 }
 
 func (mock *QueryxMock) Scan(dest ...interface{}) error {
-	args := mock.Called(dest...)
+	args := mock.run("Scan", 0, dest, dest...)
 
 	return args.Error(0)
 }
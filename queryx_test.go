@@ -924,3 +924,43 @@ func Test_Queryx_Scan(t *testing.T) {
 		assert.Error(t, err, sut.errMsg)
 	})
 }
+
+func Test_NewQueryxMock(t *testing.T) {
+	t.Run("Should create a query with the statement and names and assert it on cleanup", func(t *testing.T) {
+		// arrange
+		spy := &testingTSpy{}
+		stmt := "statement"
+		names := []string{"name"}
+
+		// act
+		result := NewQueryxMock(spy, stmt, names)
+		result.On("Iter").Return(result).Once()
+		spy.runCleanups()
+
+		// assert
+		assert.Equal(t, stmt, result.Stmt)
+		assert.Equal(t, names, result.Names)
+		assert.Equal(t, context.Background(), result.Ctx)
+		assert.Len(t, spy.errors, 1)
+	})
+}
+
+func Test_Queryx_Values(t *testing.T) {
+	t.Run("Should keep the values bound by the last bind call", func(t *testing.T) {
+		// arrange
+		sut := makeQueryxSut()
+		sut.queryxmock.Names = []string{"larry"}
+		arg := makeMapArg("larry")
+		sut.queryxmock.On("BindMap", arg).Return(sut.queryxmock)
+		sut.queryxmock.On("Bind", []interface{}{1, 2}).Return(sut.queryxmock)
+
+		// act
+		sut.queryxmock.BindMap(arg)
+		mapValues := sut.queryxmock.Values()
+		sut.queryxmock.Bind(1, 2)
+
+		// assert
+		assert.Equal(t, []interface{}{arg["larry"]}, mapValues)
+		assert.Equal(t, []interface{}{1, 2}, sut.queryxmock.Values())
+	})
+}
@@ -0,0 +1,531 @@
+package gocqlxmock
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/mock"
+)
+
+// Ring is a fake token ring of the Murmur3 partitioner. Every host owns a
+// single token, evenly spaced across the ring, and the replicas of a token
+// are the host owning it and the next ones, as with SimpleStrategy.
+type Ring struct {
+	mu                sync.Mutex
+	hosts             []net.IP
+	tokens            []int64
+	replicationFactor int
+	partitionKeys     map[string][]string
+	routes            []Route
+}
+
+// Route is the routing of a terminal call made through a ring.
+type Route struct {
+	Stmt  string
+	Table string
+	// RoutingKey is the one given to RoutingKey or, when there is none, the
+	// one computed from the partition key values bound to the query. It is
+	// nil when the query could not be routed.
+	RoutingKey []byte
+	Token      int64
+	Replicas   []net.IP
+	// Host is the host that served the call, nil when none did.
+	Host net.IP
+}
+
+// HotPartition is a partition routed to at least the threshold given to
+// HotPartitions.
+type HotPartition struct {
+	Table      string
+	RoutingKey []byte
+	Token      int64
+	Count      int
+}
+
+// NewRing creates a ring of hosts, FakeHostAddresses when none is given,
+// storing replicationFactor replicas of every partition.
+func NewRing(replicationFactor int, hosts ...net.IP) *Ring {
+	if len(hosts) == 0 {
+		hosts = FakeHostAddresses
+	}
+	if replicationFactor < 1 {
+		replicationFactor = 1
+	}
+	if replicationFactor > len(hosts) {
+		replicationFactor = len(hosts)
+	}
+
+	ring := &Ring{
+		hosts:             append([]net.IP(nil), hosts...),
+		replicationFactor: replicationFactor,
+		partitionKeys:     map[string][]string{},
+	}
+
+	step := math.MaxUint64 / uint64(len(hosts))
+	for i := range hosts {
+		ring.tokens = append(ring.tokens, int64(uint64(math.MaxInt64)+1+uint64(i+1)*step))
+	}
+
+	return ring
+}
+
+// WithPartitionKey declares the partition key columns of table, optionally
+// prefixed by its keyspace, so that routing keys can be computed from the
+// values bound to queries on it.
+func (ring *Ring) WithPartitionKey(table string, columns ...string) *Ring {
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+
+	ring.partitionKeys[strings.ToLower(table)] = columns
+
+	return ring
+}
+
+// Hosts returns the hosts of the ring.
+func (ring *Ring) Hosts() []net.IP {
+	return append([]net.IP(nil), ring.hosts...)
+}
+
+// Replicas returns the hosts storing the partition of token, the primary
+// replica first.
+func (ring *Ring) Replicas(token int64) []net.IP {
+	primary := sort.Search(len(ring.tokens), func(i int) bool {
+		return ring.tokens[i] >= token
+	})
+
+	var replicas []net.IP
+	for i := 0; i < ring.replicationFactor; i++ {
+		replicas = append(replicas, ring.hosts[(primary+i)%len(ring.hosts)])
+	}
+
+	return replicas
+}
+
+// Routes returns the routing of the terminal calls made so far, in call order.
+func (ring *Ring) Routes() []Route {
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+
+	return append([]Route(nil), ring.routes...)
+}
+
+// HotPartitions returns the partitions routed to at least threshold times,
+// the hottest first.
+func (ring *Ring) HotPartitions(threshold int) []HotPartition {
+	var partitions []HotPartition
+	seen := map[string]int{}
+
+	for _, route := range ring.Routes() {
+		if route.RoutingKey == nil {
+			continue
+		}
+
+		key := route.Table + "\x00" + string(route.RoutingKey)
+		if i, ok := seen[key]; ok {
+			partitions[i].Count++
+			continue
+		}
+
+		seen[key] = len(partitions)
+		partitions = append(partitions, HotPartition{
+			Table:      route.Table,
+			RoutingKey: route.RoutingKey,
+			Token:      route.Token,
+			Count:      1,
+		})
+	}
+
+	hot := partitions[:0]
+	for _, partition := range partitions {
+		if partition.Count >= threshold {
+			hot = append(hot, partition)
+		}
+	}
+	sort.SliceStable(hot, func(i, j int) bool {
+		return hot[i].Count > hot[j].Count
+	})
+
+	return hot
+}
+
+// AssertRoutingKey asserts that every execution of stmt was routed with
+// routingKey.
+func (ring *Ring) AssertRoutingKey(t mock.TestingT, stmt string, routingKey []byte) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	found := false
+	result := true
+	for _, route := range ring.Routes() {
+		if route.Stmt != stmt {
+			continue
+		}
+
+		found = true
+		if !bytes.Equal(route.RoutingKey, routingKey) {
+			t.Errorf("gocqlxmock: %q routed with key %x, expected %x", stmt, route.RoutingKey, routingKey)
+			result = false
+		}
+	}
+
+	if !found {
+		t.Errorf("gocqlxmock: %q was never executed", stmt)
+		return false
+	}
+
+	return result
+}
+
+// AssertTokenAware asserts that every execution so far had a routing key, so
+// that a token aware host policy could send it straight to a replica.
+func (ring *Ring) AssertTokenAware(t mock.TestingT) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	result := true
+	for _, route := range ring.Routes() {
+		if route.RoutingKey == nil {
+			t.Errorf("gocqlxmock: %q has no routing key", route.Stmt)
+			result = false
+		}
+	}
+
+	return result
+}
+
+// route returns the route of a call to stmt and the hosts to attempt it on:
+// its replicas first, then the other hosts of the ring.
+func (ring *Ring) route(stmt string, routingKey []byte, columns []string, values []interface{}) (Route, []net.IP) {
+	table := statementTable(stmt)
+	route := Route{
+		Stmt:       stmt,
+		Table:      table,
+		RoutingKey: routingKey,
+	}
+
+	if route.RoutingKey == nil {
+		ring.mu.Lock()
+		partitionKeys := ring.partitionKeysOf(table)
+		ring.mu.Unlock()
+
+		route.RoutingKey = composeRoutingKey(partitionKeys, columns, values)
+	}
+	if route.RoutingKey == nil {
+		return route, ring.Hosts()
+	}
+
+	route.Token = Murmur3Token(route.RoutingKey)
+	route.Replicas = ring.Replicas(route.Token)
+
+	hosts := append([]net.IP(nil), route.Replicas...)
+	for _, host := range ring.hosts {
+		if !containsHost(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+
+	return route, hosts
+}
+
+func (ring *Ring) record(route Route) {
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+
+	ring.routes = append(ring.routes, route)
+}
+
+func (ring *Ring) partitionKeysOf(table string) []string {
+	for name, columns := range ring.partitionKeys {
+		if name == table || (!strings.Contains(name, ".") && strings.HasSuffix(table, "."+name)) {
+			return columns
+		}
+	}
+
+	return nil
+}
+
+// WithRing routes the queries handed out by the session through ring: they
+// are attempted on their replicas first and their routes are recorded.
+func (mock *SessionxMock) WithRing(ring *Ring) *SessionxMock {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	mock.ring = ring
+
+	return mock
+}
+
+func (mock *SessionxMock) tokenRing() *Ring {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	return mock.ring
+}
+
+// Murmur3Token returns the token of routingKey for the Murmur3 partitioner.
+func Murmur3Token(routingKey []byte) int64 {
+	return murmur3H1(routingKey)
+}
+
+// statementTable returns the, possibly keyspace qualified, table of stmt.
+func statementTable(stmt string) string {
+	tokens, err := lex(stmt)
+	if err != nil {
+		return ""
+	}
+
+	switch kind, _ := classify(stmt); kind {
+	case StatementSelect, StatementDelete:
+		return tableAfter(tokens, "FROM")
+	case StatementInsert:
+		return tableAfter(tokens, "INTO")
+	case StatementUpdate:
+		return tableAfter(tokens, "UPDATE")
+	default:
+		return ""
+	}
+}
+
+// markerColumns returns the column each bind marker of stmt stands for, as
+// far as it can be told from the statement: the name of named markers, the
+// column listed at the same position for INSERT and the column compared to
+// the marker otherwise.
+func markerColumns(stmt string) []string {
+	tokens, err := lex(stmt)
+	if err != nil {
+		return nil
+	}
+
+	var inserted []string
+	if kind, _ := classify(stmt); kind == StatementInsert {
+		for open, tok := range tokens {
+			if !tok.is("(") {
+				continue
+			}
+
+			for _, tok := range tokens[open+1 : closing(tokens, open)] {
+				if tok.kind == tokenIdent || tok.kind == tokenQuotedIdent {
+					inserted = append(inserted, identifier(tok))
+				}
+			}
+			break
+		}
+	}
+
+	var columns []string
+	for i, tok := range tokens {
+		if tok.kind != tokenMarker {
+			continue
+		}
+
+		column := ""
+		switch {
+		case strings.HasPrefix(tok.text, ":"):
+			column = strings.ToLower(tok.text[1:])
+		case inserted != nil:
+			if len(columns) < len(inserted) {
+				column = inserted[len(columns)]
+			}
+		case i >= 2 && tokens[i-1].is("=") && (tokens[i-2].kind == tokenIdent || tokens[i-2].kind == tokenQuotedIdent):
+			column = identifier(tokens[i-2])
+		}
+		columns = append(columns, column)
+	}
+
+	return columns
+}
+
+// composeRoutingKey builds the routing key of the partition key values the
+// way gocql does: the value itself for single column keys and the values
+// prefixed by their length and followed by a zero byte for composite keys.
+func composeRoutingKey(partitionKeys, columns []string, values []interface{}) []byte {
+	if len(partitionKeys) == 0 {
+		return nil
+	}
+
+	var components [][]byte
+	for _, partitionKey := range partitionKeys {
+		index := -1
+		for i, column := range columns {
+			if strings.EqualFold(column, partitionKey) && i < len(values) {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil
+		}
+
+		component, err := gocql.Marshal(inferType(values[index]), values[index])
+		if err != nil {
+			return nil
+		}
+		components = append(components, component)
+	}
+
+	if len(components) == 1 {
+		return components[0]
+	}
+
+	var buf bytes.Buffer
+	for _, component := range components {
+		length := make([]byte, 2)
+		binary.BigEndian.PutUint16(length, uint16(len(component)))
+		buf.Write(length)
+		buf.Write(component)
+		buf.WriteByte(0)
+	}
+
+	return buf.Bytes()
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	uuidType = reflect.TypeOf(gocql.UUID{})
+)
+
+// inferType returns the CQL type a partition key value most likely has.
+func inferType(value interface{}) gocql.TypeInfo {
+	typ := gocql.TypeBlob
+
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	switch {
+	case !v.IsValid():
+	case v.Type() == timeType:
+		typ = gocql.TypeTimestamp
+	case v.Type() == uuidType:
+		typ = gocql.TypeUUID
+	default:
+		switch v.Kind() {
+		case reflect.String:
+			typ = gocql.TypeVarchar
+		case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+			typ = gocql.TypeBigInt
+		case reflect.Int32, reflect.Uint32:
+			typ = gocql.TypeInt
+		case reflect.Int16, reflect.Uint16:
+			typ = gocql.TypeSmallInt
+		case reflect.Int8, reflect.Uint8:
+			typ = gocql.TypeTinyInt
+		case reflect.Bool:
+			typ = gocql.TypeBoolean
+		case reflect.Float32:
+			typ = gocql.TypeFloat
+		case reflect.Float64:
+			typ = gocql.TypeDouble
+		}
+	}
+
+	return gocql.NewNativeType(4, typ, "")
+}
+
+func containsHost(hosts []net.IP, host net.IP) bool {
+	for _, known := range hosts {
+		if known.Equal(host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+const (
+	murmurC1 int64 = -8663945395140668459 // 0x87c37b91114253d5
+	murmurC2 int64 = 5545529020109919103  // 0x4cf5ad432745937f
+)
+
+// murmur3H1 is the first half of MurmurHash3_x64_128, with the sign
+// extension of tail bytes of the Cassandra implementation.
+func murmur3H1(data []byte) int64 {
+	length := len(data)
+
+	var h1, h2 int64
+
+	blocks := length / 16
+	for i := 0; i < blocks; i++ {
+		k1 := int64(binary.LittleEndian.Uint64(data[i*16:]))
+		k2 := int64(binary.LittleEndian.Uint64(data[i*16+8:]))
+
+		k1 *= murmurC1
+		k1 = rotl(k1, 31)
+		k1 *= murmurC2
+		h1 ^= k1
+
+		h1 = rotl(h1, 27)
+		h1 += h2
+		h1 = h1*5 + 0x52dce729
+
+		k2 *= murmurC2
+		k2 = rotl(k2, 33)
+		k2 *= murmurC1
+		h2 ^= k2
+
+		h2 = rotl(h2, 31)
+		h2 += h1
+		h2 = h2*5 + 0x38495ab5
+	}
+
+	tail := data[blocks*16:]
+	var k1, k2 int64
+	for i := len(tail) - 1; i >= 8; i-- {
+		k2 ^= int64(int8(tail[i])) << (uint(i-8) * 8)
+	}
+	if len(tail) > 8 {
+		k2 *= murmurC2
+		k2 = rotl(k2, 33)
+		k2 *= murmurC1
+		h2 ^= k2
+	}
+	last := len(tail) - 1
+	if last > 7 {
+		last = 7
+	}
+	for i := last; i >= 0; i-- {
+		k1 ^= int64(int8(tail[i])) << (uint(i) * 8)
+	}
+	if len(tail) > 0 {
+		k1 *= murmurC1
+		k1 = rotl(k1, 31)
+		k1 *= murmurC2
+		h1 ^= k1
+	}
+
+	h1 ^= int64(length)
+	h2 ^= int64(length)
+
+	h1 += h2
+	h2 += h1
+
+	h1 = fmix(h1)
+	h2 = fmix(h2)
+
+	return h1 + h2
+}
+
+func rotl(x int64, r uint) int64 {
+	return (x << r) | int64(uint64(x)>>(64-r))
+}
+
+func fmix(n int64) int64 {
+	n ^= int64(uint64(n) >> 33)
+	n *= -49064778989728563 // 0xff51afd7ed558ccd
+	n ^= int64(uint64(n) >> 33)
+	n *= -4265267296055464877 // 0xc4ceb9fe1a85ec53
+	n ^= int64(uint64(n) >> 33)
+
+	return n
+}
@@ -0,0 +1,182 @@
+package gocqlxmock
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+type ringSut struct {
+	stmt        string
+	ring        *Ring
+	sessionmock *SessionxMock
+	querymock   *QueryxMock
+}
+
+func makeRingSut(stmt string, names []string) ringSut {
+	sut := ringSut{
+		stmt,
+		NewRing(2).WithPartitionKey("potato", "id").WithPartitionKey("ks.tomato", "id", "day"),
+		&SessionxMock{},
+		&QueryxMock{},
+	}
+	sut.sessionmock.WithRing(sut.ring)
+	sut.sessionmock.On("Query", sut.stmt, names).Return(sut.querymock)
+
+	return sut
+}
+
+func Test_Murmur3Token(t *testing.T) {
+	t.Run("Should hash like the Cassandra Murmur3 partitioner", func(t *testing.T) {
+		signed, _ := hex.DecodeString("00104327529fb645dd00b883ec39ae448bb800000400066a6b00")
+
+		for _, tc := range []struct {
+			data     []byte
+			expected uint64
+		}{
+			{[]byte(""), 0x0000000000000000},
+			{[]byte("0"), 0x2ac9debed546a380},
+			{[]byte("012345678"), 0x4c1e87519fe738ba},
+			{[]byte("0123456789012345"), 0xa3293ad698ecb99a},
+			{[]byte("0123456789012345678"), 0x2d0338c1ca87d132},
+			{[]byte("hello, world"), 0x342fac623a5ebc8e},
+			{[]byte("The quick brown fox jumps over the lazy dog."), 0xcd99481f9ee902c9},
+			{signed, 0x8000005e19e38f27},
+		} {
+			// act
+			token := Murmur3Token(tc.data)
+
+			// assert
+			assert.Equal(t, int64(tc.expected), token, "data %x", tc.data)
+		}
+	})
+}
+
+func Test_Ring_Replicas(t *testing.T) {
+	t.Run("Should return the owner of the token and the next hosts", func(t *testing.T) {
+		// arrange
+		ring := NewRing(2)
+
+		// act
+		first := ring.Replicas(-1 << 63)
+		last := ring.Replicas(1<<63 - 1)
+
+		// assert
+		assert.Equal(t, []net.IP{FakeHostAddresses[0], FakeHostAddresses[1]}, first)
+		assert.Equal(t, []net.IP{FakeHostAddresses[2], FakeHostAddresses[0]}, last)
+		assert.Equal(t, []net.IP{FakeHostAddresses[1], FakeHostAddresses[2]}, ring.Replicas(0))
+	})
+}
+
+func Test_Sessionx_WithRing(t *testing.T) {
+	t.Run("Should route queries with the routing key given to RoutingKey", func(t *testing.T) {
+		// arrange
+		key := []byte("potato")
+		sut := makeRingSut("SELECT name FROM potato WHERE id = ?", []string{"id"})
+		sut.querymock.On("RoutingKey", key).Return(sut.querymock)
+		sut.querymock.On("Exec").Return(nil)
+
+		// act
+		err := sut.sessionmock.Query(sut.stmt, []string{"id"}).RoutingKey(key).Exec()
+
+		// assert
+		assert.NoError(t, err)
+		route := sut.ring.Routes()[0]
+		assert.Equal(t, "potato", route.Table)
+		assert.Equal(t, key, route.RoutingKey)
+		assert.Equal(t, Murmur3Token(key), route.Token)
+		assert.Equal(t, sut.ring.Replicas(route.Token), route.Replicas)
+		assert.Equal(t, route.Replicas[0], route.Host)
+		assert.True(t, sut.ring.AssertRoutingKey(t, sut.stmt, key))
+	})
+
+	t.Run("Should compute the routing key from the bound partition key values", func(t *testing.T) {
+		// arrange
+		sut := makeRingSut("SELECT name FROM potato WHERE id = ?", []string{"id"})
+		sut.querymock.On("Bind", []interface{}{"A"}).Return(sut.querymock)
+		sut.querymock.On("Exec").Return(nil)
+
+		// act
+		err := sut.sessionmock.Query(sut.stmt, []string{"id"}).Bind("A").Exec()
+
+		// assert
+		assert.NoError(t, err)
+		assert.True(t, sut.ring.AssertRoutingKey(t, sut.stmt, []byte("A")))
+		assert.True(t, sut.ring.AssertTokenAware(t))
+	})
+
+	t.Run("Should compute composite routing keys from the bind markers", func(t *testing.T) {
+		// arrange
+		sut := makeRingSut("INSERT INTO ks.tomato (id, name, day) VALUES (?, ?, ?)", nil)
+		sut.querymock.On("Bind", []interface{}{"A", "B", int32(1)}).Return(sut.querymock)
+		sut.querymock.On("Exec").Return(nil)
+
+		// act
+		err := sut.sessionmock.Query(sut.stmt, nil).Bind("A", "B", int32(1)).Exec()
+
+		// assert
+		assert.NoError(t, err)
+		assert.True(t, sut.ring.AssertRoutingKey(t, sut.stmt, []byte{0, 1, 'A', 0, 0, 4, 0, 0, 0, 1, 0}))
+	})
+
+	t.Run("Should report queries that have no routing key", func(t *testing.T) {
+		// arrange
+		spy := &testingTSpy{}
+		sut := makeRingSut("SELECT name FROM potato", nil)
+		sut.querymock.On("Exec").Return(nil)
+
+		// act
+		err := sut.sessionmock.Query(sut.stmt, nil).Exec()
+
+		// assert
+		assert.NoError(t, err)
+		assert.False(t, sut.ring.AssertTokenAware(spy))
+		assert.Equal(t, []string{`gocqlxmock: "SELECT name FROM potato" has no routing key`}, spy.errors)
+		assert.Equal(t, FakeHostAddresses[0], sut.ring.Routes()[0].Host)
+	})
+
+	t.Run("Should attempt the other replicas first when retrying on the next host", func(t *testing.T) {
+		// arrange
+		key := []byte("potato")
+		policy := &gocql.SimpleRetryPolicy{NumRetries: 1}
+		sut := makeRingSut("SELECT name FROM potato WHERE id = ?", []string{"id"})
+		sut.querymock.On("RoutingKey", key).Return(sut.querymock)
+		sut.querymock.On("RetryPolicy", policy).Return(sut.querymock)
+		sut.querymock.On("Exec").Return(fmt.Errorf("overloaded")).Once()
+		sut.querymock.On("Exec").Return(nil).Once()
+
+		// act
+		err := sut.sessionmock.Query(sut.stmt, []string{"id"}).RoutingKey(key).RetryPolicy(policy).Exec()
+
+		// assert
+		assert.NoError(t, err)
+		route := sut.ring.Routes()[0]
+		assert.Equal(t, route.Replicas[1], route.Host)
+	})
+
+	t.Run("Should detect hot partitions", func(t *testing.T) {
+		// arrange
+		sut := makeRingSut("SELECT name FROM potato WHERE id = ?", []string{"id"})
+		sut.querymock.On("Bind", []interface{}{"hot"}).Return(sut.querymock)
+		sut.querymock.On("Bind", []interface{}{"cold"}).Return(sut.querymock)
+		sut.querymock.On("Exec").Return(nil)
+		sut.sessionmock.IsolateQueries()
+
+		// act
+		for _, id := range []string{"hot", "cold", "hot", "hot"} {
+			_ = sut.sessionmock.Query(sut.stmt, []string{"id"}).Bind(id).Exec()
+		}
+
+		// assert
+		assert.Equal(t, []HotPartition{{
+			Table:      "potato",
+			RoutingKey: []byte("hot"),
+			Token:      Murmur3Token([]byte("hot")),
+			Count:      3,
+		}}, sut.ring.HotPartitions(2))
+	})
+}
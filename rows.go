@@ -0,0 +1,192 @@
+package gocqlxmock
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/gocql/gocql"
+	"github.com/scylladb/gocqlx/v2"
+)
+
+// Rows are the rows a mocked query or iterator returns. They are held
+// serialized, the way gocql receives them, so that scanning them follows the
+// rules of gocql and gocqlx, collections, tuples and UDTs included.
+type Rows struct {
+	columns []gocql.ColumnInfo
+	rows    [][][]byte
+}
+
+// NewRows returns Rows of columns, each a name followed by its CQL type, such
+// as "tags list<text>". Columns of user defined types need Schema.Rows.
+func NewRows(columns ...string) *Rows {
+	return NewSchema().Rows("", columns...)
+}
+
+// Rows returns Rows of columns, like NewRows, looking up the user defined
+// types of columns in keyspace. It panics on invalid columns.
+func (schema *Schema) Rows(keyspace string, columns ...string) *Rows {
+	schema.mu.RLock()
+	defer schema.mu.RUnlock()
+
+	rows := &Rows{}
+	for _, column := range columns {
+		info, err := schema.column(keyspace, column)
+		if err != nil {
+			panic(fmt.Sprintf("gocqlxmock: invalid column %q: %s", column, err))
+		}
+		rows.columns = append(rows.columns, info)
+	}
+
+	return rows
+}
+
+// column parses the name and type of column, whose schema lock is held.
+func (schema *Schema) column(keyspace, column string) (gocql.ColumnInfo, error) {
+	p, err := newParser(column)
+	if err != nil {
+		return gocql.ColumnInfo{}, err
+	}
+
+	ddl := &ddl{parser: p, schema: schema, keyspace: keyspace}
+	name, err := ddl.ident()
+	if err != nil {
+		return gocql.ColumnInfo{}, err
+	}
+	typ, _, err := ddl.cqlType(keyspace)
+	if err != nil {
+		return gocql.ColumnInfo{}, err
+	}
+	if !p.done() {
+		return gocql.ColumnInfo{}, p.errorf("extraneous input")
+	}
+
+	return gocql.ColumnInfo{Keyspace: keyspace, Name: name, TypeInfo: typ}, nil
+}
+
+// AddRow adds a row of values, one per column, marshalled the way gocql
+// marshals bound values. It panics on values that cannot be marshalled.
+func (rows *Rows) AddRow(values ...interface{}) *Rows {
+	if len(values) != len(rows.columns) {
+		panic(fmt.Sprintf("gocqlxmock: row of %d values for %d columns", len(values), len(rows.columns)))
+	}
+
+	row := make([][]byte, len(values))
+	for i, value := range values {
+		if _, ok := value.(gocqlx.UDT); ok {
+			value = makeUDT(reflect.ValueOf(value), false)
+		}
+
+		data, err := gocql.Marshal(rows.columns[i].TypeInfo, value)
+		if err != nil {
+			panic(fmt.Sprintf("gocqlxmock: invalid value for column %s: %s", rows.columns[i].Name, err))
+		}
+		row[i] = canonical(rows.columns[i].TypeInfo, data)
+	}
+	rows.rows = append(rows.rows, row)
+
+	return rows
+}
+
+// iter returns an iterator over rows.
+func (rows *Rows) iter() *FakeIterx {
+	return newFakeIterx(&result{columns: rows.columns, rows: rows.rows})
+}
+
+// WithRows makes the Get, Select and Scan calls of the query scan rows into
+// their destination once they succeed, failing like gocqlx does when rows do
+// not fit it.
+func (mock *QueryxMock) WithRows(rows *Rows) *QueryxMock {
+	root := mock.root()
+	root.state.mu.Lock()
+	defer root.state.mu.Unlock()
+
+	root.state.rows = rows
+
+	return mock
+}
+
+// scanRows scans the rows of the query, if any, into copies of the
+// destination of call, the way the terminal calls of a gocqlx.Queryx do, so
+// that concurrent attempts do not race on it. It returns the destination
+// scanned into and a function writing it to the destination of call.
+func (mock *QueryxMock) scanRows(call terminalCall) (interface{}, func(), error) {
+	root := mock.root()
+	root.state.mu.Lock()
+	rows := root.state.rows
+	root.state.mu.Unlock()
+
+	if rows == nil || call.dest == nil {
+		return call.dest, func() {}, nil
+	}
+
+	iter := rows.iter()
+	switch call.method {
+	case "Get", "GetRelease":
+		dest, commit := scratch(call.dest)
+		return dest, commit, iter.Get(dest)
+	case "Select", "SelectRelease":
+		dest, commit := scratch(call.dest)
+		return dest, commit, iter.Select(dest)
+	case "Scan":
+		dests := call.dest.([]interface{})
+		copies, commits := make([]interface{}, len(dests)), make([]func(), len(dests))
+		for i, dest := range dests {
+			copies[i], commits[i] = scratch(dest)
+		}
+		commit := func() {
+			for _, commit := range commits {
+				commit()
+			}
+		}
+		if !iter.Scan(copies...) {
+			if err := iter.Close(); err != nil {
+				return copies, commit, err
+			}
+			return copies, commit, gocql.ErrNotFound
+		}
+		return copies, commit, nil
+	}
+
+	return call.dest, func() {}, nil
+}
+
+// scratch returns a copy of what dest points to, and a function writing the
+// copy to dest. Slices are copied too, as scanning appends to them.
+func scratch(dest interface{}) (interface{}, func()) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return dest, func() {}
+	}
+
+	copied := reflect.New(v.Type().Elem())
+	if elem := v.Elem(); elem.Kind() == reflect.Slice && !elem.IsNil() {
+		copied.Elem().Set(reflect.AppendSlice(reflect.MakeSlice(elem.Type(), 0, elem.Len()), elem))
+	} else {
+		copied.Elem().Set(elem)
+	}
+
+	return copied.Interface(), func() { v.Elem().Set(copied.Elem()) }
+}
+
+// WithRows makes the iterator scan rows, one at a time, into the
+// destinations of its Get, Select, StructScan, Scan and MapScan calls, once
+// their expectation is met: calls still return the error they are set up
+// with, or false.
+func (mock *IterxMock) WithRows(rows *Rows) *IterxMock {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	mock.rows = rows.iter()
+
+	return mock
+}
+
+// cursor runs scan with the iterator over the rows of mock, if any.
+func (mock *IterxMock) cursor(scan func(iter *FakeIterx)) {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	if mock.rows != nil {
+		scan(mock.rows)
+	}
+}
@@ -0,0 +1,165 @@
+package gocqlxmock
+
+import (
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type rowsSut struct {
+	rows      *Rows
+	querymock *QueryxMock
+	itermock  *IterxMock
+	profiles  []profile
+}
+
+func makeRowsSut(t *testing.T) rowsSut {
+	schema := NewSchema()
+	for _, stmt := range []string{
+		"CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}",
+		"CREATE TYPE address (street text, number int)",
+	} {
+		if err := schema.Exec("ks", stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sut := rowsSut{
+		profiles: []profile{
+			{1, []string{"b", "a"}, []int{1, 3}, map[string]int{"x": 1}, address{Street: "Main", Number: 7}},
+			{2, nil, nil, nil, address{}},
+		},
+		querymock: &QueryxMock{},
+		itermock:  &IterxMock{},
+	}
+	sut.rows = schema.Rows("ks", "id int", "tags list<text>", "friends set<int>", "scores map<text, int>", "home frozen<address>")
+	for _, p := range sut.profiles {
+		sut.rows.AddRow(p.ID, p.Tags, p.Friends, p.Scores, p.Home)
+	}
+
+	return sut
+}
+
+func Test_QueryxMock_WithRows(t *testing.T) {
+	t.Run("Should scan rows into the destination of Get and Select", func(t *testing.T) {
+		// arrange
+		sut := makeRowsSut(t)
+		sut.querymock.On("Get", mock.Anything).Return(nil)
+		sut.querymock.On("Select", mock.Anything).Return(nil)
+		sut.querymock.WithRows(sut.rows)
+
+		// act
+		var got profile
+		errGet := sut.querymock.Get(&got)
+		var selected []profile
+		errSelect := sut.querymock.Select(&selected)
+
+		// assert
+		assert.NoError(t, errGet)
+		assert.NoError(t, errSelect)
+		assert.Equal(t, sut.profiles[0], got)
+		assert.Equal(t, sut.profiles, selected)
+	})
+
+	t.Run("Should scan tuples and sets with gocql's rules", func(t *testing.T) {
+		// arrange
+		sut := makeRowsSut(t)
+		rows := NewRows("point tuple<int, text>", "ids set<int>").AddRow([]interface{}{1, "x"}, []int{3, 1, 3})
+		sut.querymock.On("Scan", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+		sut.querymock.WithRows(rows)
+
+		// act
+		var (
+			x   int
+			y   string
+			ids []int
+		)
+		err := sut.querymock.Scan(&x, &y, &ids)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, 1, x)
+		assert.Equal(t, "x", y)
+		assert.Equal(t, []int{1, 3}, ids)
+	})
+
+	t.Run("Should fail like gocqlx when rows do not fit the destination", func(t *testing.T) {
+		// arrange
+		sut := makeRowsSut(t)
+		sut.querymock.On("Get", mock.Anything).Return(nil)
+		sut.querymock.On("Scan", mock.Anything).Return(nil)
+		sut.querymock.WithRows(NewRows("id int", "tags list<text>").AddRow(1, []string{"a"}))
+
+		// act
+		var dest struct{ ID int }
+		errGet := sut.querymock.Get(&dest)
+		var tags []int
+		errScan := sut.querymock.Scan(&tags)
+
+		// assert
+		assert.EqualError(t, errGet, `missing destination name "tags" in struct { ID int }`)
+		assert.EqualError(t, errScan, "gocql: not enough columns to scan into: have 1 want 2")
+	})
+
+	t.Run("Should not scan rows when the call fails", func(t *testing.T) {
+		// arrange
+		sut := makeRowsSut(t)
+		sut.querymock.On("Get", mock.Anything).Return(gocql.ErrNotFound)
+		sut.querymock.WithRows(sut.rows)
+
+		// act
+		var got profile
+		err := sut.querymock.Get(&got)
+
+		// assert
+		assert.Equal(t, gocql.ErrNotFound, err)
+		assert.Equal(t, profile{}, got)
+	})
+}
+
+func Test_IterxMock_WithRows(t *testing.T) {
+	t.Run("Should scan one row per StructScan", func(t *testing.T) {
+		// arrange
+		sut := makeRowsSut(t)
+		sut.itermock.On("StructScan", mock.Anything).Return(true)
+		sut.itermock.On("Close").Return(nil)
+		sut.itermock.WithRows(sut.rows)
+
+		// act
+		var scanned []profile
+		var p profile
+		for sut.itermock.StructScan(&p) {
+			scanned = append(scanned, p)
+			p = profile{}
+		}
+		err := sut.itermock.Close()
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, sut.profiles, scanned)
+		sut.itermock.AssertNumberOfCalls(t, "StructScan", 3)
+	})
+
+	t.Run("Should name tuple elements in MapScan", func(t *testing.T) {
+		// arrange
+		sut := makeRowsSut(t)
+		sut.itermock.On("MapScan", mock.Anything).Return(true)
+		sut.itermock.WithRows(NewRows("id int", "point tuple<int, int>", "scores map<text, int>").
+			AddRow(1, []interface{}{2, 3}, map[string]int{"x": 1}))
+
+		// act
+		row := map[string]interface{}{}
+		scanned := sut.itermock.MapScan(row)
+
+		// assert
+		assert.True(t, scanned)
+		assert.Equal(t, map[string]interface{}{
+			"id":       1,
+			"point[0]": 2,
+			"point[1]": 3,
+			"scores":   map[string]int{"x": 1},
+		}, row)
+	})
+}
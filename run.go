@@ -0,0 +1,519 @@
+package gocqlxmock
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Guilospanck/igocqlx"
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/mock"
+)
+
+// FakeHostAddresses are the hosts a query is attempted on, in order, when
+// retry policies ask for the next host, unless its session has a Ring.
+var FakeHostAddresses = []net.IP{
+	net.IPv4(127, 0, 0, 1),
+	net.IPv4(127, 0, 0, 2),
+	net.IPv4(127, 0, 0, 3),
+}
+
+// terminalCall describes a terminal call: its method, the arguments it is
+// called with, the index of its error among the return values and the
+// destination rows are scanned into.
+type terminalCall struct {
+	method    string
+	arguments []interface{}
+	errIndex  int
+	dest      interface{}
+}
+
+func (call terminalCall) err(args []interface{}) error {
+	if call.errIndex < 0 || args[call.errIndex] == nil {
+		return nil
+	}
+
+	return args[call.errIndex].(error)
+}
+
+// failed returns the return values of the call failing with err. Calls that
+// return no error, such as Iter, return an iterator failing with err.
+func (call terminalCall) failed(err error) []interface{} {
+	if call.errIndex < 0 {
+		return []interface{}{errIterx{err}}
+	}
+
+	args := make([]interface{}, call.errIndex+1)
+	if call.errIndex > 0 {
+		args[0] = false
+	}
+	args[call.errIndex] = err
+
+	return args
+}
+
+// run makes the terminal call method, whose error is the return value at
+// errIndex, feeding the observer and tracer of the query with its attempts.
+// Failed attempts are retried as told by the retry policy of the query, and
+// idempotent queries are executed speculatively as told by their speculative
+// execution policy, the way the gocql query executor does.
+func (mock *QueryxMock) run(method string, errIndex int, dest interface{}, arguments ...interface{}) mock.Arguments {
+	call := terminalCall{
+		method:    method,
+		arguments: arguments,
+		errIndex:  errIndex,
+		dest:      dest,
+	}
+
+	mock.state.mu.Lock()
+	sp, idempotent, rejected := mock.state.speculativePolicy, mock.state.idempotent, mock.state.rejected
+	mock.state.attempts, mock.state.speculativeAttempts = 0, 0
+	mock.state.mu.Unlock()
+
+	if rejected == nil {
+		rejected = mock.terminal(method)
+	}
+	if rejected != nil {
+		args := call.failed(rejected)
+		mock.log.record(method, arguments, args)
+
+		return args
+	}
+
+	route, ring, hosts := mock.route()
+
+	var result outcome
+	if idempotent && sp != nil && sp.Attempts() > 0 {
+		result = mock.speculate(call, sp, hosts)
+	} else {
+		result = mock.do(mock.Context(), call, hostIterator(hosts), nil)
+	}
+	if result.executed {
+		mock.respond(result.args[0])
+		if call.err(result.args) == nil {
+			result.commit()
+			if err := mock.applySchema(); err != nil {
+				result.args = call.failed(err)
+			}
+		}
+	}
+
+	if ring != nil {
+		route.Host = result.host
+		ring.record(route)
+	}
+	mock.log.record(method, arguments, result.args)
+
+	return result.args
+}
+
+// applySchema applies the statement of the query to the schema of its
+// session once executed and, if it is a DDL statement, puts the schema in
+// disagreement.
+func (mock *QueryxMock) applySchema() error {
+	mock.state.mu.Lock()
+	session := mock.state.session
+	mock.state.mu.Unlock()
+
+	if session == nil {
+		return nil
+	}
+
+	stmt := mock.statement()
+	if err := session.applySchema(stmt); err != nil {
+		return err
+	}
+	if kind, _ := classify(stmt); kind == StatementSchema {
+		session.changeSchema(stmt)
+	}
+
+	return nil
+}
+
+// errIterx is the iterator of a query that could not be executed, like the
+// gocql.Iter holding the error of such a query.
+type errIterx struct {
+	err error
+}
+
+func (iter errIterx) Unsafe() igocqlx.IIterx              { return iter }
+func (iter errIterx) StructOnly() igocqlx.IIterx          { return iter }
+func (iter errIterx) Get(interface{}) error               { return iter.err }
+func (iter errIterx) Select(interface{}) error            { return iter.err }
+func (iter errIterx) StructScan(interface{}) bool         { return false }
+func (iter errIterx) Scan(...interface{}) bool            { return false }
+func (iter errIterx) Close() error                        { return iter.err }
+func (iter errIterx) MapScan(map[string]interface{}) bool { return false }
+
+// outcome is the result of an execution and the host that served it, nil
+// when none did. Executions the mock answered without error are executed,
+// and commit writes the rows they scanned to the destination of the call.
+type outcome struct {
+	args     []interface{}
+	host     net.IP
+	executed bool
+	commit   func()
+}
+
+// route returns the route of the query through the ring of its session, if
+// any, and the hosts to attempt it on.
+func (mock *QueryxMock) route() (Route, *Ring, []net.IP) {
+	mock.state.mu.Lock()
+	session, routingKey := mock.state.session, mock.state.routingKey
+	mock.state.mu.Unlock()
+
+	var ring *Ring
+	if session != nil {
+		ring = session.tokenRing()
+	}
+	if ring == nil {
+		return Route{}, nil, FakeHostAddresses
+	}
+
+	stmt := mock.statement()
+	columns := mock.names()
+	if len(columns) == 0 {
+		columns = markerColumns(stmt)
+	}
+	route, hosts := ring.route(stmt, routingKey, columns, mock.Values())
+
+	return route, ring, hosts
+}
+
+// hostIterator returns hosts one at a time, and nil when they run out. It is
+// safe for concurrent use, as speculative executions share it.
+func hostIterator(hosts []net.IP) func() net.IP {
+	var mu sync.Mutex
+	next := 0
+
+	return func() net.IP {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if next == len(hosts) {
+			return nil
+		}
+		next++
+
+		return hosts[next-1]
+	}
+}
+
+// do executes call on the hosts given by nextHost, retrying as told by the
+// retry policy of the query. The attempts of speculative executions go
+// through spec, nil otherwise.
+func (mock *QueryxMock) do(ctx context.Context, call terminalCall, nextHost func() net.IP, spec *speculation) outcome {
+	mock.state.mu.Lock()
+	policy, session := mock.state.retryPolicy, mock.state.session
+	mock.state.mu.Unlock()
+
+	var (
+		lastErr  error
+		lastHost net.IP
+	)
+	host := nextHost()
+
+	for host != nil {
+		if session != nil {
+			if err := sleep(ctx, session.hostLatency(host)); err != nil {
+				return outcome{args: call.failed(err)}
+			}
+		}
+
+		result, err := mock.try(ctx, call, host, spec)
+		if result.executed {
+			return result
+		}
+		switch err {
+		case context.Canceled, context.DeadlineExceeded, gocql.ErrNotFound:
+			return result
+		}
+		if policy == nil || !policy.Attempt(mock) {
+			return result
+		}
+		lastErr, lastHost = err, host
+
+		switch policy.GetRetryType(err) {
+		case gocql.Retry:
+			continue
+		case gocql.RetryNextHost:
+			host = nextHost()
+		case gocql.Rethrow, gocql.Ignore:
+			return result
+		default:
+			return outcome{args: call.failed(gocql.ErrUnknownRetryType), host: host}
+		}
+	}
+
+	if lastErr != nil {
+		return outcome{args: call.failed(lastErr), host: lastHost}
+	}
+
+	return outcome{args: call.failed(gocql.ErrNoConnections)}
+}
+
+// try attempts call on host, returning its outcome and error, and feeds the
+// observer and tracer of the query with the attempt. Attempts made once ctx
+// is done fail with its error, without calling the mock.
+func (mock *QueryxMock) try(ctx context.Context, call terminalCall, host net.IP, spec *speculation) (outcome, error) {
+	if spec != nil {
+		spec.mu.Lock()
+		defer spec.mu.Unlock()
+	}
+	if err := ctx.Err(); err != nil {
+		return outcome{args: call.failed(err)}, err
+	}
+
+	start := time.Now()
+	args := []interface{}(mock.attemptCalled(call.method, call.arguments...))
+	err := call.err(args)
+
+	// Rows are scanned before the attempt is observed, so that the observer
+	// sees what the caller gets.
+	var (
+		dest   interface{}
+		commit func()
+	)
+	executed := err == nil
+	if executed {
+		if dest, commit, err = mock.scanRows(call); err != nil {
+			args = call.failed(err)
+		}
+	}
+	end := time.Now()
+
+	mock.observe(gocql.ObservedQuery{
+		Statement: mock.statement(),
+		Values:    mock.Values(),
+		Start:     start,
+		End:       end,
+		Rows:      observedRows(call.method, dest, err),
+		Host:      fakeHost(host),
+		Err:       err,
+		Attempt:   mock.attempt(),
+	})
+	mock.trace(start, end)
+
+	if spec != nil && executed && err == nil {
+		spec.cancel()
+	}
+
+	return outcome{args, host, executed, commit}, err
+}
+
+// speculation serializes the attempts of the executions of a speculative
+// call, and cancels the others as soon as one succeeds, so that no attempt
+// is matched against the expectations of the query once the call has its
+// result.
+type speculation struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// errExecutionStopped is the result of a speculative execution stopped by
+// the test, as t.FailNow does on an unexpected call.
+var errExecutionStopped = errors.New("gocqlxmock: speculative execution stopped")
+
+// speculate runs the main execution of call and, every sp.Delay() while no
+// execution succeeded, up to sp.Attempts() speculative executions on the
+// next of hosts. The first success is returned or, when every execution failed,
+// the first failure. The executions still running are canceled and waited
+// for, so that none hits the mock once speculate returned.
+func (mock *QueryxMock) speculate(call terminalCall, sp gocql.SpeculativeExecutionPolicy, hosts []net.IP) outcome {
+	var wg sync.WaitGroup
+	parent := mock.Context()
+	ctx, cancel := context.WithCancel(parent)
+	defer wg.Wait()
+	defer cancel()
+
+	spec := &speculation{cancel: cancel}
+	nextHost := hostIterator(hosts)
+	results := make(chan outcome, sp.Attempts()+1)
+	execute := func() {
+		defer wg.Done()
+
+		result := outcome{args: call.failed(errExecutionStopped)}
+		defer func() { results <- result }()
+		result = mock.do(ctx, call, nextHost, spec)
+	}
+
+	wg.Add(1)
+	go execute()
+	running := 1
+
+	ticker := time.NewTicker(sp.Delay())
+	defer ticker.Stop()
+
+	var failure *outcome
+	launched := 0
+	for running > 0 {
+		var tick <-chan time.Time
+		if launched < sp.Attempts() {
+			tick = ticker.C
+		}
+
+		select {
+		case <-tick:
+			launched++
+			mock.state.mu.Lock()
+			mock.state.speculativeAttempts++
+			mock.state.mu.Unlock()
+
+			wg.Add(1)
+			go execute()
+			running++
+		case result := <-results:
+			running--
+			if call.err(result.args) == nil {
+				return result
+			}
+			if failure == nil {
+				failure = &result
+			}
+		case <-parent.Done():
+			return outcome{args: call.failed(parent.Err())}
+		}
+	}
+
+	return *failure
+}
+
+// SpeculativeAttempts returns the number of speculative executions launched
+// for the last terminal call of the query, on top of its main execution.
+func (mock *QueryxMock) SpeculativeAttempts() int {
+	mock.state.mu.Lock()
+	defer mock.state.mu.Unlock()
+
+	return mock.state.speculativeAttempts
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Attempts returns the number of times the last terminal call of the query
+// was attempted, retries included, as counted by gocql for an execution.
+func (mock *QueryxMock) Attempts() int {
+	mock.state.mu.Lock()
+	defer mock.state.mu.Unlock()
+
+	return mock.state.attempts
+}
+
+// SetConsistency sets the consistency of the query without being recorded
+// as a call, as retry policies do through gocql.RetryableQuery.
+func (mock *QueryxMock) SetConsistency(c gocql.Consistency) {
+	mock.state.mu.Lock()
+	defer mock.state.mu.Unlock()
+
+	mock.state.consistency = &c
+}
+
+// attempt counts an attempt and returns its index.
+func (mock *QueryxMock) attempt() int {
+	mock.state.mu.Lock()
+	defer mock.state.mu.Unlock()
+
+	mock.state.attempts++
+
+	return mock.state.attempts - 1
+}
+
+func (mock *QueryxMock) observe(observed gocql.ObservedQuery) {
+	mock.state.mu.Lock()
+	observer, session := mock.state.observer, mock.state.session
+	mock.state.mu.Unlock()
+
+	if observer == nil {
+		return
+	}
+
+	if session != nil {
+		observed.Keyspace = session.keyspace()
+	}
+	observer.ObserveQuery(mock.Context(), observed)
+}
+
+// observedRows returns the number of rows gocql would report for a terminal
+// call: one for single row reads and lightweight transactions, the length of
+// the destination slice for Select and none for plain writes and iterators.
+func observedRows(method string, dest interface{}, err error) int {
+	if err != nil {
+		return 0
+	}
+
+	switch {
+	case strings.HasPrefix(method, "Select"):
+		v := reflect.ValueOf(dest)
+		for v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		if v.Kind() == reflect.Slice {
+			return v.Len()
+		}
+		return 0
+	case strings.Contains(method, "CAS"), strings.HasPrefix(method, "Get"), method == "Scan":
+		return 1
+	default:
+		return 0
+	}
+}
+
+func fakeHost(address net.IP) *gocql.HostInfo {
+	return (&gocql.HostInfo{}).SetConnectAddress(address)
+}
+
+// WithKeyspace sets the keyspace of the session, as reported to query
+// observers.
+func (mock *SessionxMock) WithKeyspace(keyspace string) *SessionxMock {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	mock.keyspaceName = keyspace
+
+	return mock
+}
+
+func (mock *SessionxMock) keyspace() string {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	return mock.keyspaceName
+}
+
+// WithHostLatency delays every attempt of the queries handed out by the
+// session on the fake host at address by latency.
+func (mock *SessionxMock) WithHostLatency(address net.IP, latency time.Duration) *SessionxMock {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	if mock.latencies == nil {
+		mock.latencies = map[string]time.Duration{}
+	}
+	mock.latencies[address.String()] = latency
+
+	return mock
+}
+
+func (mock *SessionxMock) hostLatency(address net.IP) time.Duration {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	return mock.latencies[address.String()]
+}
@@ -0,0 +1,516 @@
+package gocqlxmock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type observerSpy struct {
+	mu       sync.Mutex
+	ctxs     []context.Context
+	observed []gocql.ObservedQuery
+}
+
+func (spy *observerSpy) ObserveQuery(ctx context.Context, observed gocql.ObservedQuery) {
+	spy.mu.Lock()
+	defer spy.mu.Unlock()
+
+	spy.ctxs = append(spy.ctxs, ctx)
+	spy.observed = append(spy.observed, observed)
+}
+
+type runSut struct {
+	ctx         context.Context
+	stmt        string
+	names       []string
+	err         error
+	observer    *observerSpy
+	sessionmock *SessionxMock
+	querymock   *QueryxMock
+}
+
+func makeRunSut() runSut {
+	sut := runSut{
+		context.WithValue(context.Background(), tenantKey{}, "A"),
+		"SELECT name FROM potato WHERE id = ?",
+		[]string{"id"},
+		fmt.Errorf("run_error"),
+		&observerSpy{},
+		&SessionxMock{},
+		&QueryxMock{},
+	}
+	sut.sessionmock.WithKeyspace("ks")
+	sut.sessionmock.On("ContextQuery", sut.ctx, sut.stmt, sut.names).Return(sut.querymock)
+	sut.querymock.On("Observer", sut.observer).Return(sut.querymock)
+	sut.querymock.On("Bind", []interface{}{"id"}).Return(sut.querymock)
+
+	return sut
+}
+
+func Test_Queryx_ObserveQuery(t *testing.T) {
+	t.Run("Should observe terminal calls with a populated ObservedQuery", func(t *testing.T) {
+		// arrange
+		sut := makeRunSut()
+		sut.querymock.On("Select", mock.Anything).Return(nil).After(10 * time.Millisecond).Run(func(args mock.Arguments) {
+			dest := args.Get(0).(*[]string)
+			*dest = append(*dest, "larry", "potato")
+		})
+		var dest []string
+
+		// act
+		before := time.Now()
+		err := sut.sessionmock.ContextQuery(sut.ctx, sut.stmt, sut.names).Observer(sut.observer).Bind("id").Select(&dest)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Len(t, sut.observer.observed, 1)
+		observed := sut.observer.observed[0]
+		assert.Equal(t, "ks", observed.Keyspace)
+		assert.Equal(t, sut.stmt, observed.Statement)
+		assert.Equal(t, []interface{}{"id"}, observed.Values)
+		assert.Equal(t, 2, observed.Rows)
+		assert.Equal(t, 0, observed.Attempt)
+		assert.NoError(t, observed.Err)
+		assert.Equal(t, FakeHostAddresses[0], observed.Host.ConnectAddress())
+		assert.False(t, observed.Start.Before(before))
+		assert.GreaterOrEqual(t, observed.End.Sub(observed.Start), 10*time.Millisecond)
+		assert.Equal(t, sut.ctx, sut.observer.ctxs[0])
+	})
+
+	t.Run("Should report the error of the terminal call", func(t *testing.T) {
+		// arrange
+		sut := makeRunSut()
+		sut.querymock.On("ExecCAS").Return(false, sut.err)
+
+		// act
+		_, err := sut.sessionmock.ContextQuery(sut.ctx, sut.stmt, sut.names).Observer(sut.observer).ExecCAS()
+
+		// assert
+		assert.Equal(t, sut.err, err)
+		assert.Equal(t, sut.err, sut.observer.observed[0].Err)
+		assert.Equal(t, 0, sut.observer.observed[0].Rows)
+	})
+
+	t.Run("Should observe the rows scanned into the destination", func(t *testing.T) {
+		// arrange
+		sut := makeRunSut()
+		sut.querymock.On("Select", mock.Anything).Return(nil)
+		sut.querymock.WithRows(NewRows("name text").AddRow("larry").AddRow("potato"))
+		var dest []string
+
+		// act
+		err := sut.sessionmock.ContextQuery(sut.ctx, sut.stmt, sut.names).Observer(sut.observer).Bind("id").Select(&dest)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"larry", "potato"}, dest)
+		assert.Equal(t, 2, sut.observer.observed[0].Rows)
+		assert.NoError(t, sut.observer.observed[0].Err)
+	})
+
+	t.Run("Should observe the error of a scan that failed", func(t *testing.T) {
+		// arrange
+		sut := makeRunSut()
+		sut.querymock.On("Get", mock.Anything).Return(nil)
+		sut.querymock.WithRows(NewRows("name text"))
+		var dest string
+
+		// act
+		err := sut.sessionmock.ContextQuery(sut.ctx, sut.stmt, sut.names).Observer(sut.observer).Bind("id").Get(&dest)
+
+		// assert
+		assert.Equal(t, gocql.ErrNotFound, err)
+		assert.Equal(t, gocql.ErrNotFound, sut.observer.observed[0].Err)
+		assert.Equal(t, 0, sut.observer.observed[0].Rows)
+	})
+
+	t.Run("Should not observe queries without an observer", func(t *testing.T) {
+		// arrange
+		sut := makeRunSut()
+		sut.querymock.On("Exec").Return(nil)
+
+		// act
+		err := sut.sessionmock.ContextQuery(sut.ctx, sut.stmt, sut.names).Exec()
+
+		// assert
+		assert.NoError(t, err)
+		assert.Empty(t, sut.observer.observed)
+	})
+}
+
+func Test_ObservedRows(t *testing.T) {
+	t.Run("Should count rows the way gocql does", func(t *testing.T) {
+		dest := []int{1, 2, 3}
+
+		assert.Equal(t, 3, observedRows("SelectRelease", &dest, nil))
+		assert.Equal(t, 1, observedRows("Get", nil, nil))
+		assert.Equal(t, 1, observedRows("ExecCAS", nil, nil))
+		assert.Equal(t, 1, observedRows("Scan", nil, nil))
+		assert.Equal(t, 0, observedRows("Exec", nil, nil))
+		assert.Equal(t, 0, observedRows("Iter", nil, nil))
+		assert.Equal(t, 0, observedRows("Get", nil, fmt.Errorf("not found")))
+	})
+}
+
+type retryPolicySpy struct {
+	retryType gocql.RetryType
+	attempts  int
+	seen      []int
+	downgrade bool
+}
+
+func (spy *retryPolicySpy) Attempt(q gocql.RetryableQuery) bool {
+	spy.seen = append(spy.seen, q.Attempts())
+	if spy.downgrade {
+		q.SetConsistency(gocql.One)
+	}
+
+	return q.Attempts() <= spy.attempts
+}
+
+func (spy *retryPolicySpy) GetRetryType(error) gocql.RetryType {
+	return spy.retryType
+}
+
+func Test_Queryx_RetryPolicyAttempts(t *testing.T) {
+	t.Run("Should retry on the same host until the terminal call succeeds", func(t *testing.T) {
+		// arrange
+		sut := makeRunSut()
+		policy := &retryPolicySpy{retryType: gocql.Retry, attempts: 5}
+		sut.querymock.On("RetryPolicy", policy).Return(sut.querymock)
+		sut.querymock.On("ExecRelease").Return(sut.err).Twice()
+		sut.querymock.On("ExecRelease").Return(nil).Once()
+
+		// act
+		query := sut.sessionmock.ContextQuery(sut.ctx, sut.stmt, sut.names).Observer(sut.observer).RetryPolicy(policy)
+		err := query.ExecRelease()
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, 3, query.(*QueryxMock).Attempts())
+		assert.Equal(t, []int{1, 2}, policy.seen)
+		sut.querymock.AssertNumberOfCalls(t, "ExecRelease", 3)
+		for i, observed := range sut.observer.observed {
+			assert.Equal(t, i, observed.Attempt)
+			assert.Equal(t, FakeHostAddresses[0], observed.Host.ConnectAddress())
+		}
+		assert.Equal(t, sut.err, sut.observer.observed[0].Err)
+		assert.NoError(t, sut.observer.observed[2].Err)
+	})
+
+	t.Run("Should count the attempts of each terminal call apart", func(t *testing.T) {
+		// arrange
+		sut := makeRunSut()
+		policy := &gocql.SimpleRetryPolicy{NumRetries: 2}
+		sut.querymock.On("RetryPolicy", policy).Return(sut.querymock)
+		sut.querymock.On("Exec").Return(sut.err).Times(5)
+		sut.querymock.On("Exec").Return(nil).Once()
+
+		// act
+		query := sut.sessionmock.ContextQuery(sut.ctx, sut.stmt, sut.names).Observer(sut.observer).RetryPolicy(policy)
+		first := query.Exec()
+		second := query.Exec()
+
+		// assert
+		assert.Equal(t, sut.err, first)
+		assert.NoError(t, second)
+		assert.Equal(t, 3, query.(*QueryxMock).Attempts())
+		sut.querymock.AssertNumberOfCalls(t, "Exec", 6)
+		for i, observed := range sut.observer.observed {
+			assert.Equal(t, i%3, observed.Attempt)
+		}
+	})
+
+	t.Run("Should move to the next host until hosts run out", func(t *testing.T) {
+		// arrange
+		sut := makeRunSut()
+		policy := &gocql.SimpleRetryPolicy{NumRetries: 10}
+		sut.querymock.On("RetryPolicy", policy).Return(sut.querymock)
+		sut.querymock.On("Exec").Return(sut.err)
+
+		// act
+		query := sut.sessionmock.ContextQuery(sut.ctx, sut.stmt, sut.names).Observer(sut.observer).RetryPolicy(policy)
+		err := query.Exec()
+
+		// assert
+		assert.Equal(t, sut.err, err)
+		assert.Equal(t, len(FakeHostAddresses), query.(*QueryxMock).Attempts())
+		for i, observed := range sut.observer.observed {
+			assert.Equal(t, FakeHostAddresses[i], observed.Host.ConnectAddress())
+		}
+	})
+
+	t.Run("Should stop when the policy refuses another attempt", func(t *testing.T) {
+		// arrange
+		sut := makeRunSut()
+		policy := &retryPolicySpy{retryType: gocql.Retry, attempts: 1}
+		sut.querymock.On("RetryPolicy", policy).Return(sut.querymock)
+		sut.querymock.On("Exec").Return(sut.err)
+
+		// act
+		query := sut.sessionmock.ContextQuery(sut.ctx, sut.stmt, sut.names).RetryPolicy(policy)
+		err := query.Exec()
+
+		// assert
+		assert.Equal(t, sut.err, err)
+		assert.Equal(t, 2, query.(*QueryxMock).Attempts())
+	})
+
+	t.Run("Should rethrow and ignore errors after a single attempt", func(t *testing.T) {
+		for _, retryType := range []gocql.RetryType{gocql.Rethrow, gocql.Ignore} {
+			// arrange
+			sut := makeRunSut()
+			policy := &retryPolicySpy{retryType: retryType, attempts: 5}
+			sut.querymock.On("RetryPolicy", policy).Return(sut.querymock)
+			sut.querymock.On("Get", nil).Return(sut.err)
+
+			// act
+			query := sut.sessionmock.ContextQuery(sut.ctx, sut.stmt, sut.names).RetryPolicy(policy)
+			err := query.Get(nil)
+
+			// assert
+			assert.Equal(t, sut.err, err)
+			assert.Equal(t, 1, query.(*QueryxMock).Attempts())
+		}
+	})
+
+	t.Run("Should not retry logical errors", func(t *testing.T) {
+		// arrange
+		sut := makeRunSut()
+		policy := &retryPolicySpy{retryType: gocql.Retry, attempts: 5}
+		sut.querymock.On("RetryPolicy", policy).Return(sut.querymock)
+		sut.querymock.On("Get", nil).Return(gocql.ErrNotFound)
+
+		// act
+		query := sut.sessionmock.ContextQuery(sut.ctx, sut.stmt, sut.names).RetryPolicy(policy)
+		err := query.Get(nil)
+
+		// assert
+		assert.Equal(t, gocql.ErrNotFound, err)
+		assert.Empty(t, policy.seen)
+	})
+
+	t.Run("Should fail with ErrUnknownRetryType on unknown retry types", func(t *testing.T) {
+		// arrange
+		sut := makeRunSut()
+		policy := &retryPolicySpy{retryType: gocql.RetryType(10), attempts: 5}
+		sut.querymock.On("RetryPolicy", policy).Return(sut.querymock)
+		sut.querymock.On("ExecCAS").Return(false, sut.err)
+
+		// act
+		applied, err := sut.sessionmock.ContextQuery(sut.ctx, sut.stmt, sut.names).RetryPolicy(policy).ExecCAS()
+
+		// assert
+		assert.False(t, applied)
+		assert.Equal(t, gocql.ErrUnknownRetryType, err)
+	})
+
+	t.Run("Should let the policy change the consistency of the query", func(t *testing.T) {
+		// arrange
+		sut := makeRunSut()
+		policy := &retryPolicySpy{retryType: gocql.Retry, attempts: 1, downgrade: true}
+		sut.querymock.On("RetryPolicy", policy).Return(sut.querymock)
+		sut.querymock.On("Exec").Return(sut.err).Once()
+		sut.querymock.On("Exec").Return(nil).Once()
+
+		// act
+		query := sut.sessionmock.ContextQuery(sut.ctx, sut.stmt, sut.names).RetryPolicy(policy)
+		err := query.Exec()
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, gocql.One, query.(*QueryxMock).GetConsistency())
+	})
+}
+
+func Test_Queryx_SpeculativeExecution(t *testing.T) {
+	t.Run("Should return the first success of the speculative attempts", func(t *testing.T) {
+		// arrange
+		sut := makeRunSut()
+		sp := &gocql.SimpleSpeculativeExecution{NumAttempts: 2, TimeoutDelay: 20 * time.Millisecond}
+		sut.sessionmock.WithHostLatency(FakeHostAddresses[0], time.Second)
+		sut.querymock.On("Idempotent", true).Return(sut.querymock)
+		sut.querymock.On("SetSpeculativeExecutionPolicy", sp).Return(sut.querymock)
+		sut.querymock.On("ExecRelease").Return(nil)
+
+		// act
+		start := time.Now()
+		query := sut.sessionmock.ContextQuery(sut.ctx, sut.stmt, sut.names).Observer(sut.observer).Idempotent(true).SetSpeculativeExecutionPolicy(sp)
+		err := query.ExecRelease()
+		elapsed := time.Since(start)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Less(t, int64(elapsed), int64(time.Second))
+		assert.Equal(t, 1, query.(*QueryxMock).SpeculativeAttempts())
+		sut.observer.mu.Lock()
+		defer sut.observer.mu.Unlock()
+		assert.Len(t, sut.observer.observed, 1)
+		assert.Equal(t, FakeHostAddresses[1], sut.observer.observed[0].Host.ConnectAddress())
+	})
+
+	t.Run("Should fire every speculative attempt while the others are slow", func(t *testing.T) {
+		// arrange
+		sut := makeRunSut()
+		sp := &gocql.SimpleSpeculativeExecution{NumAttempts: 2, TimeoutDelay: 10 * time.Millisecond}
+		sut.sessionmock.WithHostLatency(FakeHostAddresses[0], time.Second)
+		sut.sessionmock.WithHostLatency(FakeHostAddresses[1], time.Second)
+		sut.sessionmock.WithHostLatency(FakeHostAddresses[2], 50*time.Millisecond)
+		sut.querymock.On("Idempotent", true).Return(sut.querymock)
+		sut.querymock.On("SetSpeculativeExecutionPolicy", sp).Return(sut.querymock)
+		sut.querymock.On("ExecRelease").Return(nil)
+
+		// act
+		query := sut.sessionmock.ContextQuery(sut.ctx, sut.stmt, sut.names).Idempotent(true).SetSpeculativeExecutionPolicy(sp)
+		err := query.ExecRelease()
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, 2, query.(*QueryxMock).SpeculativeAttempts())
+		sut.querymock.AssertNumberOfCalls(t, "ExecRelease", 1)
+	})
+
+	t.Run("Should wait for the executions left running before returning", func(t *testing.T) {
+		// arrange
+		sut := makeRunSut()
+		sp := &gocql.SimpleSpeculativeExecution{NumAttempts: 1, TimeoutDelay: 10 * time.Millisecond}
+		policy := &gocql.SimpleRetryPolicy{NumRetries: 5}
+		sut.querymock.On("Idempotent", true).Return(sut.querymock)
+		sut.querymock.On("SetSpeculativeExecutionPolicy", sp).Return(sut.querymock)
+		sut.querymock.On("RetryPolicy", policy).Return(sut.querymock)
+		sut.querymock.On("ExecRelease").Return(sut.err).After(40 * time.Millisecond).Once()
+		sut.querymock.On("ExecRelease").Return(nil)
+
+		// act
+		query := sut.sessionmock.ContextQuery(sut.ctx, sut.stmt, sut.names).Observer(sut.observer).
+			Idempotent(true).SetSpeculativeExecutionPolicy(sp).RetryPolicy(policy)
+		err := query.ExecRelease()
+		sut.observer.mu.Lock()
+		observed := len(sut.observer.observed)
+		sut.observer.mu.Unlock()
+		time.Sleep(60 * time.Millisecond)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, 2, observed)
+		sut.querymock.AssertNumberOfCalls(t, "ExecRelease", 2)
+		sut.observer.mu.Lock()
+		defer sut.observer.mu.Unlock()
+		assert.Len(t, sut.observer.observed, 2)
+	})
+
+	t.Run("Should not match attempts against the expectations once one succeeded", func(t *testing.T) {
+		// arrange
+		sut := makeRunSut()
+		sp := &gocql.SimpleSpeculativeExecution{NumAttempts: 2, TimeoutDelay: 5 * time.Millisecond}
+		sut.querymock.On("Idempotent", true).Return(sut.querymock)
+		sut.querymock.On("SetSpeculativeExecutionPolicy", sp).Return(sut.querymock)
+		sut.querymock.On("ExecRelease").Return(nil).After(30 * time.Millisecond).Once()
+		sut.querymock.On("ExecRelease").Return(sut.err).Maybe()
+
+		// act
+		query := sut.sessionmock.ContextQuery(sut.ctx, sut.stmt, sut.names).Idempotent(true).SetSpeculativeExecutionPolicy(sp)
+		err := query.ExecRelease()
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, 2, query.(*QueryxMock).SpeculativeAttempts())
+		sut.querymock.AssertNumberOfCalls(t, "ExecRelease", 1)
+	})
+
+	t.Run("Should count the speculative executions of each terminal call apart", func(t *testing.T) {
+		// arrange
+		sut := makeRunSut()
+		sp := &gocql.SimpleSpeculativeExecution{NumAttempts: 1, TimeoutDelay: 10 * time.Millisecond}
+		sut.sessionmock.WithHostLatency(FakeHostAddresses[0], time.Second)
+		sut.querymock.On("Idempotent", true).Return(sut.querymock)
+		sut.querymock.On("SetSpeculativeExecutionPolicy", sp).Return(sut.querymock)
+		sut.querymock.On("ExecRelease").Return(nil)
+
+		// act
+		query := sut.sessionmock.ContextQuery(sut.ctx, sut.stmt, sut.names).Idempotent(true).SetSpeculativeExecutionPolicy(sp)
+		_ = query.ExecRelease()
+		err := query.ExecRelease()
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, 1, query.(*QueryxMock).SpeculativeAttempts())
+	})
+
+	t.Run("Should not speculate on queries that are not idempotent", func(t *testing.T) {
+		// arrange
+		sut := makeRunSut()
+		sp := &gocql.SimpleSpeculativeExecution{NumAttempts: 2, TimeoutDelay: time.Millisecond}
+		sut.sessionmock.WithHostLatency(FakeHostAddresses[0], 20*time.Millisecond)
+		sut.querymock.On("SetSpeculativeExecutionPolicy", sp).Return(sut.querymock)
+		sut.querymock.On("ExecRelease").Return(nil)
+
+		// act
+		query := sut.sessionmock.ContextQuery(sut.ctx, sut.stmt, sut.names).SetSpeculativeExecutionPolicy(sp)
+		err := query.ExecRelease()
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, 0, query.(*QueryxMock).SpeculativeAttempts())
+	})
+
+	t.Run("Should return the first failure when every attempt fails", func(t *testing.T) {
+		// arrange
+		sut := makeRunSut()
+		sp := &gocql.SimpleSpeculativeExecution{NumAttempts: 1, TimeoutDelay: time.Second}
+		sut.querymock.On("Idempotent", true).Return(sut.querymock)
+		sut.querymock.On("SetSpeculativeExecutionPolicy", sp).Return(sut.querymock)
+		sut.querymock.On("ExecCAS").Return(false, sut.err)
+
+		// act
+		query := sut.sessionmock.ContextQuery(sut.ctx, sut.stmt, sut.names).Idempotent(true).SetSpeculativeExecutionPolicy(sp)
+		applied, err := query.ExecCAS()
+
+		// assert
+		assert.False(t, applied)
+		assert.Equal(t, sut.err, err)
+		assert.Equal(t, 0, query.(*QueryxMock).SpeculativeAttempts())
+	})
+
+	t.Run("Should give up on hosts canceled by the context", func(t *testing.T) {
+		// arrange
+		sut := makeRunSut()
+		ctx, cancel := context.WithTimeout(sut.ctx, 10*time.Millisecond)
+		defer cancel()
+		sut.sessionmock.WithHostLatency(FakeHostAddresses[0], time.Second)
+		sut.sessionmock.On("ContextQuery", ctx, sut.stmt, sut.names).Return(sut.querymock)
+
+		// act
+		err := sut.sessionmock.ContextQuery(ctx, sut.stmt, sut.names).ExecRelease()
+
+		// assert
+		assert.Equal(t, context.DeadlineExceeded, err)
+		sut.querymock.AssertNotCalled(t, "ExecRelease")
+	})
+}
+
+func Test_Queryx_IterFailure(t *testing.T) {
+	t.Run("Should return an iterator failing with the error of a query that could not run", func(t *testing.T) {
+		// arrange
+		sut := makeRunSut()
+		ctx, cancel := context.WithCancel(sut.ctx)
+		cancel()
+		sut.sessionmock.WithHostLatency(FakeHostAddresses[0], time.Second)
+		sut.sessionmock.On("ContextQuery", ctx, sut.stmt, sut.names).Return(sut.querymock)
+
+		// act
+		iter := sut.sessionmock.ContextQuery(ctx, sut.stmt, sut.names).Iter()
+
+		// assert
+		assert.False(t, iter.Scan())
+		assert.Equal(t, context.Canceled, iter.Close())
+		sut.querymock.AssertNotCalled(t, "Iter")
+	})
+}
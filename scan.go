@@ -0,0 +1,392 @@
+package gocqlxmock
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/Guilospanck/igocqlx"
+	"github.com/gocql/gocql"
+	"github.com/scylladb/go-reflectx"
+	"github.com/scylladb/gocqlx/v2"
+)
+
+var _ igocqlx.IIterx = &FakeIterx{}
+
+var (
+	unmarshalerInterface    = reflect.TypeOf((*gocql.Unmarshaler)(nil)).Elem()
+	udtUnmarshalerInterface = reflect.TypeOf((*gocql.UDTUnmarshaler)(nil)).Elem()
+	autoUDTInterface        = reflect.TypeOf((*gocqlx.UDT)(nil)).Elem()
+)
+
+// FakeIterx iterates over the rows a FakeQueryx returned. It scans them the
+// way gocqlx.Iterx does, with gocqlx.DefaultMapper.
+type FakeIterx struct {
+	columns []gocql.ColumnInfo
+	rows    [][][]byte
+	pos     int
+
+	unsafe     bool
+	structOnly bool
+	applied    bool
+	err        error
+
+	fields [][]int
+	values []interface{}
+}
+
+func newFakeIterx(res *result) *FakeIterx {
+	return &FakeIterx{columns: res.columns, rows: res.rows}
+}
+
+// Columns returns the columns of the rows.
+func (iter *FakeIterx) Columns() []gocql.ColumnInfo {
+	return iter.columns
+}
+
+// NumRows returns the number of rows.
+func (iter *FakeIterx) NumRows() int {
+	return len(iter.rows)
+}
+
+func (iter *FakeIterx) Unsafe() igocqlx.IIterx {
+	iter.unsafe = true
+
+	return iter
+}
+
+func (iter *FakeIterx) StructOnly() igocqlx.IIterx {
+	iter.structOnly = true
+
+	return iter
+}
+
+func (iter *FakeIterx) Get(dest interface{}) error {
+	iter.scanAny(dest)
+	iter.Close()
+
+	if iter.err != nil {
+		return iter.err
+	}
+	if len(iter.rows) == 0 {
+		return gocql.ErrNotFound
+	}
+
+	return nil
+}
+
+func (iter *FakeIterx) scanAny(dest interface{}) bool {
+	value, ok := iter.pointer(dest)
+	if !ok {
+		return false
+	}
+
+	base := reflectx.Deref(value.Type())
+	scannable, ok := iter.scannable(base)
+	if !ok {
+		return false
+	}
+
+	if scannable {
+		return iter.scan(value)
+	}
+
+	return iter.structScan(value)
+}
+
+func (iter *FakeIterx) Select(dest interface{}) error {
+	iter.scanAll(dest)
+	iter.Close()
+
+	return iter.err
+}
+
+func (iter *FakeIterx) scanAll(dest interface{}) bool {
+	value, ok := iter.pointer(dest)
+	if !ok {
+		return false
+	}
+
+	slice := reflectx.Deref(value.Type())
+	if slice.Kind() != reflect.Slice {
+		iter.err = fmt.Errorf("expected %s but got %s", reflect.Slice, slice.Kind())
+		return false
+	}
+
+	isPtr := slice.Elem().Kind() == reflect.Ptr
+	base := reflectx.Deref(slice.Elem())
+	scannable, ok := iter.scannable(base)
+	if !ok {
+		return false
+	}
+
+	var (
+		alloc bool
+		v     reflect.Value
+	)
+	for {
+		vp := reflect.New(base)
+
+		if scannable {
+			ok = iter.scan(vp)
+		} else {
+			ok = iter.structScan(vp)
+		}
+		if !ok {
+			break
+		}
+
+		if !alloc {
+			v = reflect.MakeSlice(slice, 0, len(iter.rows))
+			alloc = true
+		}
+
+		if isPtr {
+			v = reflect.Append(v, vp)
+		} else {
+			v = reflect.Append(v, reflect.Indirect(vp))
+		}
+	}
+
+	if alloc {
+		reflect.Indirect(value).Set(v)
+	}
+
+	return true
+}
+
+func (iter *FakeIterx) pointer(dest interface{}) (reflect.Value, bool) {
+	value := reflect.ValueOf(dest)
+
+	if value.Kind() != reflect.Ptr {
+		iter.err = fmt.Errorf("expected a pointer but got %T", dest)
+		return value, false
+	}
+	if value.IsNil() {
+		iter.err = errors.New("expected a pointer but got nil")
+		return value, false
+	}
+
+	return value, true
+}
+
+// scannable reports whether base is scanned as a single column, as opposed
+// to a struct, failing like gocqlx.Iterx when it cannot be.
+func (iter *FakeIterx) scannable(base reflect.Type) (bool, bool) {
+	ptr := reflect.PtrTo(base)
+	scannable := ptr.Implements(unmarshalerInterface) || ptr.Implements(udtUnmarshalerInterface) ||
+		ptr.Implements(autoUDTInterface) || base.Kind() != reflect.Struct ||
+		len(gocqlx.DefaultMapper.TypeMap(base).Index) == 0
+
+	if iter.structOnly && scannable {
+		if base.Kind() != reflect.Struct {
+			iter.err = fmt.Errorf("expected a struct but got %s", base.Kind())
+			return false, false
+		}
+		scannable = false
+	}
+
+	if scannable && len(iter.columns) > 1 {
+		iter.err = fmt.Errorf("expected 1 column in result while scanning scannable type %s but got %d", base.Kind(), len(iter.columns))
+		return false, false
+	}
+
+	return scannable, true
+}
+
+func (iter *FakeIterx) scan(value reflect.Value) bool {
+	return iter.next(udtWrapValue(value, iter.unsafe))
+}
+
+func (iter *FakeIterx) StructScan(dest interface{}) bool {
+	value, ok := iter.pointer(dest)
+	if !ok {
+		return false
+	}
+
+	return iter.structScan(value)
+}
+
+func (iter *FakeIterx) structScan(value reflect.Value) bool {
+	if iter.fields == nil {
+		columns := make([]string, len(iter.columns))
+		for i, column := range iter.columns {
+			columns[i] = column.Name
+		}
+		cas := len(columns) > 0 && columns[0] == appliedColumn
+
+		iter.fields = gocqlx.DefaultMapper.TraversalsByName(value.Type(), columns)
+		if !iter.unsafe && !cas {
+			for i, traversal := range iter.fields {
+				if len(traversal) == 0 {
+					iter.err = fmt.Errorf("missing destination name %q in %s", columns[i], reflect.Indirect(value).Type())
+					return false
+				}
+			}
+		}
+		iter.values = make([]interface{}, len(columns))
+		if cas {
+			iter.values[0] = &iter.applied
+		}
+	}
+
+	v := reflect.Indirect(value)
+	if v.Kind() != reflect.Struct {
+		iter.err = fmt.Errorf("expected a struct but got %s", v.Type())
+		return false
+	}
+	for i, traversal := range iter.fields {
+		if len(traversal) == 0 {
+			continue
+		}
+		iter.values[i] = udtWrapValue(reflectx.FieldByIndexes(v, traversal).Addr(), iter.unsafe)
+	}
+
+	return iter.next(iter.values...)
+}
+
+func (iter *FakeIterx) Scan(dest ...interface{}) bool {
+	for i := range dest {
+		if _, ok := dest[i].(gocqlx.UDT); ok {
+			dest[i] = makeUDT(reflect.ValueOf(dest[i]), iter.unsafe)
+		}
+	}
+
+	return iter.next(dest...)
+}
+
+// next unmarshals the next row into dest, nil destinations skipping their
+// column, like gocql.Iter.Scan does. Tuple columns take one destination per
+// element.
+func (iter *FakeIterx) next(dest ...interface{}) bool {
+	if iter.err != nil || iter.pos >= len(iter.rows) {
+		return false
+	}
+
+	want := 0
+	for _, column := range iter.columns {
+		want += width(column)
+	}
+	if len(dest) != want {
+		iter.err = fmt.Errorf("gocql: not enough columns to scan into: have %d want %d", len(dest), want)
+		return false
+	}
+
+	row := iter.rows[iter.pos]
+	i := 0
+	for j, column := range iter.columns {
+		n := width(column)
+		if dest[i] != nil {
+			var target interface{} = dest[i]
+			if _, ok := column.TypeInfo.(gocql.TupleTypeInfo); ok {
+				target = dest[i : i+n]
+			}
+			if err := gocql.Unmarshal(column.TypeInfo, row[j], target); err != nil {
+				iter.err = err
+				return false
+			}
+		}
+		i += n
+	}
+	iter.pos++
+
+	return true
+}
+
+// width returns the number of destinations column is scanned into.
+func width(column gocql.ColumnInfo) int {
+	if tuple, ok := column.TypeInfo.(gocql.TupleTypeInfo); ok {
+		return len(tuple.Elems)
+	}
+
+	return 1
+}
+
+func (iter *FakeIterx) Close() error {
+	return iter.err
+}
+
+// MapScan scans the next row into m, by column name, like
+// gocql.Iter.MapScan does. Tuple elements are named after
+// gocql.TupleColumnName.
+func (iter *FakeIterx) MapScan(m map[string]interface{}) bool {
+	if iter.err != nil {
+		return false
+	}
+
+	var (
+		names  []string
+		values []interface{}
+	)
+	for _, column := range iter.columns {
+		tuple, ok := column.TypeInfo.(gocql.TupleTypeInfo)
+		if !ok {
+			names = append(names, column.Name)
+			values = append(values, column.TypeInfo.New())
+			continue
+		}
+		for i, elem := range tuple.Elems {
+			names = append(names, gocql.TupleColumnName(column.Name, i))
+			values = append(values, elem.New())
+		}
+	}
+	for i, name := range names {
+		if dest, ok := m[name]; ok {
+			values[i] = dest
+		}
+	}
+
+	if !iter.next(values...) {
+		return false
+	}
+	for i, name := range names {
+		m[name] = reflect.Indirect(reflect.ValueOf(values[i])).Interface()
+	}
+
+	return true
+}
+
+// fakeUDT marshals and unmarshals structs embedding gocqlx.UDT field by
+// field, like gocqlx does.
+type fakeUDT struct {
+	value  reflect.Value
+	field  map[string]reflect.Value
+	unsafe bool
+}
+
+func makeUDT(value reflect.Value, unsafe bool) fakeUDT {
+	return fakeUDT{
+		value:  value,
+		field:  gocqlx.DefaultMapper.FieldMap(value),
+		unsafe: unsafe,
+	}
+}
+
+func (u fakeUDT) MarshalUDT(name string, info gocql.TypeInfo) ([]byte, error) {
+	value, ok := u.field[name]
+	if !ok {
+		return nil, fmt.Errorf("missing name %q in %s", name, u.value.Type())
+	}
+
+	return gocql.Marshal(info, value.Interface())
+}
+
+func (u fakeUDT) UnmarshalUDT(name string, info gocql.TypeInfo, data []byte) error {
+	value, ok := u.field[name]
+	if !ok && !u.unsafe {
+		return fmt.Errorf("missing name %q in %s", name, u.value.Type())
+	}
+	if !ok {
+		return nil
+	}
+
+	return gocql.Unmarshal(info, data, value.Addr().Interface())
+}
+
+func udtWrapValue(value reflect.Value, unsafe bool) interface{} {
+	if value.Type().Implements(autoUDTInterface) {
+		return makeUDT(value, unsafe)
+	}
+
+	return value.Interface()
+}
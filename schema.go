@@ -0,0 +1,1377 @@
+package gocqlxmock
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gocql/gocql"
+)
+
+// protoVersion is the protocol version values are marshalled with.
+const protoVersion = 4
+
+// maxTTL is the greatest TTL, in seconds, a write can have: 20 years.
+const maxTTL = 20 * 365 * 24 * 60 * 60
+
+// Schema is an in-memory CQL schema, built from DDL statements. It is safe
+// for concurrent use: metadata is never modified once handed out, DDL
+// replaces it.
+type Schema struct {
+	mu        sync.RWMutex
+	keyspaces map[string]*gocql.KeyspaceMetadata
+	// defaultTTLs holds the default_time_to_live of tables, by
+	// keyspace.table.
+	defaultTTLs map[string]int64
+}
+
+// NewSchema returns an empty Schema.
+func NewSchema() *Schema {
+	return &Schema{
+		keyspaces:   map[string]*gocql.KeyspaceMetadata{},
+		defaultTTLs: map[string]int64{},
+	}
+}
+
+// Keyspace returns the metadata of keyspace.
+func (schema *Schema) Keyspace(keyspace string) (*gocql.KeyspaceMetadata, bool) {
+	schema.mu.RLock()
+	defer schema.mu.RUnlock()
+
+	metadata, ok := schema.keyspaces[keyspace]
+
+	return metadata, ok
+}
+
+// Table returns the metadata of table in keyspace, failing like Scylla when
+// there is no such table.
+func (schema *Schema) Table(keyspace, table string) (*gocql.TableMetadata, error) {
+	schema.mu.RLock()
+	defer schema.mu.RUnlock()
+
+	if ks, ok := schema.keyspaces[keyspace]; ok {
+		if metadata, ok := ks.Tables[table]; ok {
+			return metadata, nil
+		}
+	}
+
+	return nil, invalidf("unconfigured table %s", table)
+}
+
+// Exec applies the DDL statement stmt, unqualified names referring to
+// keyspace.
+func (schema *Schema) Exec(keyspace, stmt string) error {
+	schema.mu.Lock()
+	defer schema.mu.Unlock()
+
+	staged, err := schema.stage(keyspace, stmt)
+	if err != nil {
+		return err
+	}
+	schema.keyspaces, schema.defaultTTLs = staged.keyspaces, staged.defaultTTLs
+
+	return nil
+}
+
+// stage applies stmt to a copy of the schema, whose lock is held, so that a
+// statement failing halfway, or followed by extraneous input, leaves the
+// schema unchanged.
+func (schema *Schema) stage(keyspace, stmt string) (*Schema, error) {
+	p, err := newParser(stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	staged := &Schema{
+		keyspaces:   copyKeyspaces(schema.keyspaces),
+		defaultTTLs: copyDefaultTTLs(schema.defaultTTLs),
+	}
+	ddl := &ddl{parser: p, schema: staged, keyspace: keyspace}
+	switch {
+	case p.accept("CREATE", "KEYSPACE"):
+		err = ddl.createKeyspace()
+	case p.accept("CREATE", "TABLE"), p.accept("CREATE", "COLUMNFAMILY"):
+		err = ddl.createTable()
+	case p.accept("CREATE", "TYPE"):
+		err = ddl.createType()
+	case p.accept("CREATE", "INDEX"), p.accept("CREATE", "CUSTOM", "INDEX"):
+		err = ddl.createIndex()
+	case p.accept("ALTER", "KEYSPACE"):
+		err = ddl.alterKeyspace()
+	case p.accept("ALTER", "TABLE"), p.accept("ALTER", "COLUMNFAMILY"):
+		err = ddl.alterTable()
+	case p.accept("ALTER", "TYPE"):
+		err = ddl.alterType()
+	case p.accept("DROP", "KEYSPACE"):
+		err = ddl.dropKeyspace()
+	case p.accept("DROP", "TABLE"), p.accept("DROP", "COLUMNFAMILY"):
+		err = ddl.dropTable()
+	case p.accept("DROP", "TYPE"):
+		err = ddl.dropType()
+	case p.accept("DROP", "INDEX"):
+		err = ddl.dropIndex()
+	default:
+		return nil, p.errorf("unsupported statement")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.done() {
+		return nil, p.errorf("extraneous input")
+	}
+
+	return staged, nil
+}
+
+// ddl applies a DDL statement to a schema whose lock is held.
+type ddl struct {
+	*parser
+	schema   *Schema
+	keyspace string
+	// ttl is the default_time_to_live read from the options of a table,
+	// written along with the table.
+	ttl *int64
+}
+
+func (ddl *ddl) ifNotExists() bool {
+	return ddl.accept("IF", "NOT", "EXISTS")
+}
+
+func (ddl *ddl) createKeyspace() error {
+	ifNotExists := ddl.ifNotExists()
+	name, err := ddl.ident()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ddl.schema.keyspaces[name]; ok {
+		if ifNotExists {
+			return ddl.skipRest()
+		}
+		return &RequestError{gocql.ErrCodeAlreadyExists, "Keyspace " + name + " already exists"}
+	}
+
+	metadata := &gocql.KeyspaceMetadata{
+		Name:          name,
+		DurableWrites: true,
+		Tables:        map[string]*gocql.TableMetadata{},
+		UserTypes:     map[string]*gocql.UserTypeMetadata{},
+	}
+
+	if err := ddl.expect("WITH"); err != nil {
+		return err
+	}
+	if err := ddl.keyspaceOptions(metadata); err != nil {
+		return err
+	}
+	ddl.schema.keyspaces[name] = metadata
+
+	return nil
+}
+
+// keyspaceOptions reads the options of the WITH clause of a keyspace into
+// metadata.
+func (ddl *ddl) keyspaceOptions(metadata *gocql.KeyspaceMetadata) error {
+	for {
+		option, err := ddl.ident()
+		if err != nil {
+			return err
+		}
+		if err := ddl.expect("="); err != nil {
+			return err
+		}
+
+		switch option {
+		case "replication":
+			replication, err := ddl.options()
+			if err != nil {
+				return err
+			}
+			metadata.StrategyClass = replication["class"]
+			metadata.StrategyOptions = map[string]interface{}{}
+			for key, value := range replication {
+				if key != "class" {
+					metadata.StrategyOptions[key] = value
+				}
+			}
+		case "durable_writes":
+			metadata.DurableWrites = !ddl.accept("false")
+			ddl.accept("true")
+		default:
+			ddl.skipValue()
+		}
+
+		if !ddl.accept("AND") {
+			break
+		}
+	}
+
+	if metadata.StrategyClass == "" {
+		return &RequestError{gocql.ErrCodeConfig, "Missing mandatory replication strategy class"}
+	}
+
+	return nil
+}
+
+func (ddl *ddl) createTable() error {
+	ifNotExists := ddl.ifNotExists()
+	ks, name, err := ddl.qualifiedName()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ks.Tables[name]; ok {
+		if ifNotExists {
+			return ddl.skipRest()
+		}
+		return &RequestError{gocql.ErrCodeAlreadyExists, "Cannot add already existing table \"" + name + "\" to keyspace \"" + ks.Name + "\""}
+	}
+
+	table := &gocql.TableMetadata{
+		Keyspace: ks.Name,
+		Name:     name,
+		Columns:  map[string]*gocql.ColumnMetadata{},
+	}
+
+	var partitionKey, clusteringKey []string
+	if err := ddl.expect("("); err != nil {
+		return err
+	}
+	for {
+		if ddl.accept("PRIMARY", "KEY") {
+			if partitionKey, clusteringKey, err = ddl.primaryKey(); err != nil {
+				return err
+			}
+		} else {
+			column, err := ddl.columnDefinition(ks.Name, table)
+			if err != nil {
+				return err
+			}
+			if ddl.accept("PRIMARY", "KEY") {
+				if partitionKey != nil {
+					return invalidf("Multiple PRIMARY KEYs specified (exactly one required)")
+				}
+				partitionKey = []string{column.Name}
+			}
+		}
+
+		if !ddl.accept(",") {
+			break
+		}
+		if ddl.peek().is(")") {
+			break
+		}
+	}
+	if err := ddl.expect(")"); err != nil {
+		return err
+	}
+
+	if partitionKey == nil {
+		return invalidf("No PRIMARY KEY specified (exactly one required)")
+	}
+	if err := setPrimaryKey(table, partitionKey, clusteringKey); err != nil {
+		return err
+	}
+	if err := checkCounters(table); err != nil {
+		return err
+	}
+
+	if ddl.accept("WITH") {
+		for {
+			switch {
+			case ddl.accept("CLUSTERING", "ORDER", "BY"):
+				if err := ddl.clusteringOrder(table); err != nil {
+					return err
+				}
+			case ddl.accept("COMPACT", "STORAGE"):
+			default:
+				if err := ddl.tableOption(table); err != nil {
+					return err
+				}
+			}
+
+			if !ddl.accept("AND") {
+				break
+			}
+		}
+	}
+
+	if err := ddl.checkTTL(table); err != nil {
+		return err
+	}
+	ddl.commitTable(ks, table)
+
+	return nil
+}
+
+// checkCounters fails when table has counters in its primary key, or mixes
+// counter and non counter columns, like Scylla does.
+func checkCounters(table *gocql.TableMetadata) error {
+	counters, others := false, false
+	for _, name := range table.OrderedColumns {
+		column := table.Columns[name]
+		key := column.Kind == gocql.ColumnPartitionKey || column.Kind == gocql.ColumnClusteringKey
+		counter := column.Type.Type() == gocql.TypeCounter
+
+		switch {
+		case key && counter:
+			return invalidf("counter type is not supported for PRIMARY KEY part %s", name)
+		case key:
+		case counter:
+			counters = true
+		default:
+			others = true
+		}
+	}
+
+	if counters && others {
+		return invalidf("Cannot mix counter and non counter columns in the same table")
+	}
+
+	return nil
+}
+
+// counterTable reports whether the columns of table are counters.
+func counterTable(table *gocql.TableMetadata) bool {
+	for _, column := range table.Columns {
+		if column.Type.Type() == gocql.TypeCounter {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tableOption reads an option of the WITH clause of a table.
+func (ddl *ddl) tableOption(table *gocql.TableMetadata) error {
+	option, err := ddl.ident()
+	if err != nil {
+		return err
+	}
+	if err := ddl.expect("="); err != nil {
+		return err
+	}
+
+	if option != "default_time_to_live" {
+		ddl.skipValue()
+		return nil
+	}
+
+	value := ddl.next()
+	ttl, err := strconv.ParseInt(value.text, 10, 64)
+	if err != nil || value.kind != tokenNumber {
+		return &RequestError{gocql.ErrCodeConfig, "Invalid integer value " + value.text + " for default_time_to_live"}
+	}
+	if ttl < 0 || ttl > maxTTL {
+		return &RequestError{gocql.ErrCodeConfig, fmt.Sprintf("default_time_to_live must be between 0 and %d, but was %d", maxTTL, ttl)}
+	}
+	ddl.ttl = &ttl
+
+	return nil
+}
+
+// checkTTL fails when a default_time_to_live is set on a counter table, like
+// Scylla does.
+func (ddl *ddl) checkTTL(table *gocql.TableMetadata) error {
+	if ddl.ttl != nil && *ddl.ttl > 0 && counterTable(table) {
+		return invalidf("Cannot set default_time_to_live on a table with counters")
+	}
+
+	return nil
+}
+
+// commitTable writes table to ks, along with the default_time_to_live read
+// from its options.
+func (ddl *ddl) commitTable(ks *gocql.KeyspaceMetadata, table *gocql.TableMetadata) {
+	ks = copyKeyspace(ks)
+	ks.Tables[table.Name] = table
+	ddl.schema.keyspaces[ks.Name] = ks
+
+	if ddl.ttl != nil {
+		ddl.schema.defaultTTLs[ks.Name+"."+table.Name] = *ddl.ttl
+	}
+}
+
+// defaultTTL returns the default_time_to_live of table, in seconds.
+func (schema *Schema) defaultTTL(table *gocql.TableMetadata) int64 {
+	schema.mu.RLock()
+	defer schema.mu.RUnlock()
+
+	return schema.defaultTTLs[table.Keyspace+"."+table.Name]
+}
+
+func (ddl *ddl) columnDefinition(keyspace string, table *gocql.TableMetadata) (*gocql.ColumnMetadata, error) {
+	name, err := ddl.ident()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := table.Columns[name]; ok {
+		return nil, invalidf("Multiple definition of identifier %s", name)
+	}
+
+	typ, validator, err := ddl.cqlType(keyspace)
+	if err != nil {
+		return nil, err
+	}
+
+	column := &gocql.ColumnMetadata{
+		Keyspace:  table.Keyspace,
+		Table:     table.Name,
+		Name:      name,
+		Kind:      gocql.ColumnRegular,
+		Validator: validator,
+		Type:      typ,
+	}
+	if ddl.accept("STATIC") {
+		column.Kind = gocql.ColumnStatic
+	}
+
+	table.Columns[name] = column
+	table.OrderedColumns = append(table.OrderedColumns, name)
+
+	return column, nil
+}
+
+func (ddl *ddl) primaryKey() (partitionKey, clusteringKey []string, err error) {
+	if err := ddl.expect("("); err != nil {
+		return nil, nil, err
+	}
+
+	if ddl.accept("(") {
+		for {
+			column, err := ddl.ident()
+			if err != nil {
+				return nil, nil, err
+			}
+			partitionKey = append(partitionKey, column)
+
+			if !ddl.accept(",") {
+				break
+			}
+		}
+		if err := ddl.expect(")"); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		column, err := ddl.ident()
+		if err != nil {
+			return nil, nil, err
+		}
+		partitionKey = []string{column}
+	}
+
+	for ddl.accept(",") {
+		column, err := ddl.ident()
+		if err != nil {
+			return nil, nil, err
+		}
+		clusteringKey = append(clusteringKey, column)
+	}
+
+	return partitionKey, clusteringKey, ddl.expect(")")
+}
+
+func setPrimaryKey(table *gocql.TableMetadata, partitionKey, clusteringKey []string) error {
+	for i, name := range append(append([]string(nil), partitionKey...), clusteringKey...) {
+		column, ok := table.Columns[name]
+		if !ok {
+			return invalidf("Unknown definition %s referenced in PRIMARY KEY", name)
+		}
+		if column.Kind == gocql.ColumnStatic {
+			return invalidf("Static column %s cannot be part of the PRIMARY KEY", name)
+		}
+		if strings.HasPrefix(column.Validator, "list<") || strings.HasPrefix(column.Validator, "set<") || strings.HasPrefix(column.Validator, "map<") {
+			return invalidf("Invalid non-frozen collection type for PRIMARY KEY component %s", name)
+		}
+
+		if i < len(partitionKey) {
+			column.Kind = gocql.ColumnPartitionKey
+			column.ComponentIndex = i
+			table.PartitionKey = append(table.PartitionKey, column)
+		} else {
+			column.Kind = gocql.ColumnClusteringKey
+			column.ComponentIndex = i - len(partitionKey)
+			column.ClusteringOrder = "asc"
+			table.ClusteringColumns = append(table.ClusteringColumns, column)
+		}
+	}
+
+	if len(clusteringKey) == 0 {
+		for _, column := range table.Columns {
+			if column.Kind == gocql.ColumnStatic {
+				return invalidf("Static columns are only useful (and thus allowed) if the table has at least one clustering column")
+			}
+		}
+	}
+
+	return nil
+}
+
+func (ddl *ddl) clusteringOrder(table *gocql.TableMetadata) error {
+	if err := ddl.expect("("); err != nil {
+		return err
+	}
+
+	for i := 0; ; i++ {
+		name, err := ddl.ident()
+		if err != nil {
+			return err
+		}
+		if i >= len(table.ClusteringColumns) || table.ClusteringColumns[i].Name != name {
+			return invalidf("Only clustering key columns can be defined in CLUSTERING ORDER directive")
+		}
+
+		column := table.ClusteringColumns[i]
+		if ddl.accept("DESC") {
+			column.Order = gocql.DESC
+			column.ClusteringOrder = "desc"
+		} else {
+			ddl.accept("ASC")
+		}
+
+		if !ddl.accept(",") {
+			break
+		}
+	}
+
+	return ddl.expect(")")
+}
+
+func (ddl *ddl) createType() error {
+	ifNotExists := ddl.ifNotExists()
+	ks, name, err := ddl.qualifiedName()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ks.UserTypes[name]; ok {
+		if ifNotExists {
+			return ddl.skipRest()
+		}
+		return invalidf("A user type of name %s.%s already exists", ks.Name, name)
+	}
+
+	metadata := &gocql.UserTypeMetadata{Keyspace: ks.Name, Name: name}
+	if err := ddl.expect("("); err != nil {
+		return err
+	}
+	for {
+		field, err := ddl.ident()
+		if err != nil {
+			return err
+		}
+		typ, _, err := ddl.cqlType(ks.Name)
+		if err != nil {
+			return err
+		}
+		metadata.FieldNames = append(metadata.FieldNames, field)
+		metadata.FieldTypes = append(metadata.FieldTypes, typ)
+
+		if !ddl.accept(",") {
+			break
+		}
+	}
+	if err := ddl.expect(")"); err != nil {
+		return err
+	}
+
+	ks = copyKeyspace(ks)
+	ks.UserTypes[name] = metadata
+	ddl.schema.keyspaces[ks.Name] = ks
+
+	return nil
+}
+
+// qualifiedName reads the name of a table or type and returns it along with
+// its keyspace.
+func (ddl *ddl) qualifiedName() (*gocql.KeyspaceMetadata, string, error) {
+	keyspace, name, err := ddl.name()
+	if err != nil {
+		return nil, "", err
+	}
+
+	ks, err := ddl.schema.lookupKeyspace(keyspace, ddl.keyspace)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return ks, name, nil
+}
+
+func (schema *Schema) lookupKeyspace(keyspace, fallback string) (*gocql.KeyspaceMetadata, error) {
+	if keyspace == "" {
+		keyspace = fallback
+	}
+	if keyspace == "" {
+		return nil, invalidf("No keyspace has been specified. USE a keyspace, or explicitly specify keyspace.tablename")
+	}
+
+	ks, ok := schema.keyspaces[keyspace]
+	if !ok {
+		return nil, invalidf("Keyspace %s doesn't exist", keyspace)
+	}
+
+	return ks, nil
+}
+
+var nativeTypes = map[string]gocql.Type{
+	"ascii":     gocql.TypeAscii,
+	"bigint":    gocql.TypeBigInt,
+	"blob":      gocql.TypeBlob,
+	"boolean":   gocql.TypeBoolean,
+	"counter":   gocql.TypeCounter,
+	"date":      gocql.TypeDate,
+	"decimal":   gocql.TypeDecimal,
+	"double":    gocql.TypeDouble,
+	"duration":  gocql.TypeDuration,
+	"float":     gocql.TypeFloat,
+	"inet":      gocql.TypeInet,
+	"int":       gocql.TypeInt,
+	"smallint":  gocql.TypeSmallInt,
+	"text":      gocql.TypeText,
+	"time":      gocql.TypeTime,
+	"timestamp": gocql.TypeTimestamp,
+	"timeuuid":  gocql.TypeTimeUUID,
+	"tinyint":   gocql.TypeTinyInt,
+	"uuid":      gocql.TypeUUID,
+	"varchar":   gocql.TypeVarchar,
+	"varint":    gocql.TypeVarint,
+}
+
+// cqlType reads a CQL type and returns it along with its normalized text.
+func (ddl *ddl) cqlType(keyspace string) (gocql.TypeInfo, string, error) {
+	tok := ddl.peek()
+	name, err := ddl.ident()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if typ, ok := nativeTypes[name]; ok && tok.kind == tokenIdent {
+		return gocql.NewNativeType(protoVersion, typ, ""), name, nil
+	}
+
+	switch name {
+	case "frozen":
+		if err := ddl.expect("<"); err != nil {
+			return nil, "", err
+		}
+		typ, text, err := ddl.cqlType(keyspace)
+		if err != nil {
+			return nil, "", err
+		}
+		return typ, "frozen<" + text + ">", ddl.expect(">")
+	case "list", "set", "map", "tuple":
+		if err := ddl.expect("<"); err != nil {
+			return nil, "", err
+		}
+
+		var (
+			elems []gocql.TypeInfo
+			texts []string
+		)
+		for {
+			typ, text, err := ddl.cqlType(keyspace)
+			if err != nil {
+				return nil, "", err
+			}
+			elems = append(elems, typ)
+			texts = append(texts, text)
+
+			if !ddl.accept(",") {
+				break
+			}
+		}
+		if err := ddl.expect(">"); err != nil {
+			return nil, "", err
+		}
+
+		text := name + "<" + strings.Join(texts, ", ") + ">"
+		switch {
+		case name == "tuple":
+			return gocql.TupleTypeInfo{NativeType: gocql.NewNativeType(protoVersion, gocql.TypeTuple, ""), Elems: elems}, text, nil
+		case name == "map" && len(elems) == 2:
+			return gocql.CollectionType{NativeType: gocql.NewNativeType(protoVersion, gocql.TypeMap, ""), Key: elems[0], Elem: elems[1]}, text, nil
+		case name == "list" && len(elems) == 1:
+			return gocql.CollectionType{NativeType: gocql.NewNativeType(protoVersion, gocql.TypeList, ""), Elem: elems[0]}, text, nil
+		case name == "set" && len(elems) == 1:
+			return gocql.CollectionType{NativeType: gocql.NewNativeType(protoVersion, gocql.TypeSet, ""), Elem: elems[0]}, text, nil
+		default:
+			return nil, "", invalidf("Invalid %s type %s", name, text)
+		}
+	}
+
+	ks := keyspace
+	if ddl.accept(".") {
+		ks = name
+		if name, err = ddl.ident(); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if metadata, ok := ddl.schema.keyspaces[ks]; ok {
+		if udt, ok := metadata.UserTypes[name]; ok {
+			return udtInfo(udt), name, nil
+		}
+	}
+
+	return nil, "", invalidf("Unknown type %s.%s", ks, name)
+}
+
+// udtInfo returns the type of the values of udt.
+func udtInfo(udt *gocql.UserTypeMetadata) gocql.UDTTypeInfo {
+	info := gocql.UDTTypeInfo{
+		NativeType: gocql.NewNativeType(protoVersion, gocql.TypeUDT, ""),
+		KeySpace:   udt.Keyspace,
+		Name:       udt.Name,
+	}
+	for i, field := range udt.FieldNames {
+		info.Elements = append(info.Elements, gocql.UDTField{Name: field, Type: udt.FieldTypes[i]})
+	}
+
+	return info
+}
+
+// options reads a map literal of options, such as the replication of a
+// keyspace.
+func (ddl *ddl) options() (map[string]string, error) {
+	options := map[string]string{}
+	if err := ddl.expect("{"); err != nil {
+		return nil, err
+	}
+
+	for !ddl.peek().is("}") {
+		key := ddl.next()
+		if err := ddl.expect(":"); err != nil {
+			return nil, err
+		}
+		options[key.text] = ddl.next().text
+
+		if !ddl.accept(",") {
+			break
+		}
+	}
+
+	return options, ddl.expect("}")
+}
+
+// skipValue skips the value of an option, be it a literal or a map.
+func (ddl *ddl) skipValue() {
+	if !ddl.peek().is("{") {
+		ddl.next()
+		return
+	}
+
+	ddl.pos = closing(ddl.tokens, ddl.pos) + 1
+}
+
+// skipRest skips the rest of the statement, for IF NOT EXISTS statements
+// that have nothing to do.
+func (ddl *ddl) skipRest() error {
+	ddl.pos = len(ddl.tokens)
+
+	return nil
+}
+
+// copyKeyspace returns a copy of ks whose tables and types can be replaced.
+func copyKeyspace(ks *gocql.KeyspaceMetadata) *gocql.KeyspaceMetadata {
+	copied := *ks
+	copied.Tables = make(map[string]*gocql.TableMetadata, len(ks.Tables))
+	for name, table := range ks.Tables {
+		copied.Tables[name] = table
+	}
+	copied.UserTypes = make(map[string]*gocql.UserTypeMetadata, len(ks.UserTypes))
+	for name, udt := range ks.UserTypes {
+		copied.UserTypes[name] = udt
+	}
+
+	return &copied
+}
+
+// copyTable returns a copy of table whose columns can be modified.
+func copyTable(table *gocql.TableMetadata) *gocql.TableMetadata {
+	copied := *table
+	copied.Columns = make(map[string]*gocql.ColumnMetadata, len(table.Columns))
+	copied.OrderedColumns = append([]string(nil), table.OrderedColumns...)
+	copied.PartitionKey = make([]*gocql.ColumnMetadata, len(table.PartitionKey))
+	copied.ClusteringColumns = make([]*gocql.ColumnMetadata, len(table.ClusteringColumns))
+
+	for name, column := range table.Columns {
+		c := *column
+		copied.Columns[name] = &c
+
+		switch c.Kind {
+		case gocql.ColumnPartitionKey:
+			copied.PartitionKey[c.ComponentIndex] = &c
+		case gocql.ColumnClusteringKey:
+			copied.ClusteringColumns[c.ComponentIndex] = &c
+		}
+	}
+
+	return &copied
+}
+
+func (ddl *ddl) ifExists() bool {
+	return ddl.accept("IF", "EXISTS")
+}
+
+func (ddl *ddl) alterKeyspace() error {
+	name, err := ddl.ident()
+	if err != nil {
+		return err
+	}
+
+	ks, err := ddl.schema.lookupKeyspace(name, "")
+	if err != nil {
+		return err
+	}
+	if err := ddl.expect("WITH"); err != nil {
+		return err
+	}
+
+	ks = copyKeyspace(ks)
+	if err := ddl.keyspaceOptions(ks); err != nil {
+		return err
+	}
+	ddl.schema.keyspaces[name] = ks
+
+	return nil
+}
+
+func (ddl *ddl) dropKeyspace() error {
+	ifExists := ddl.ifExists()
+	name, err := ddl.ident()
+	if err != nil {
+		return err
+	}
+
+	ks, ok := ddl.schema.keyspaces[name]
+	if !ok {
+		if ifExists {
+			return nil
+		}
+		return &RequestError{gocql.ErrCodeConfig, "Cannot drop non existing keyspace '" + name + "'."}
+	}
+
+	for table := range ks.Tables {
+		delete(ddl.schema.defaultTTLs, name+"."+table)
+	}
+	delete(ddl.schema.keyspaces, name)
+
+	return nil
+}
+
+func (ddl *ddl) alterTable() error {
+	ks, name, err := ddl.qualifiedName()
+	if err != nil {
+		return err
+	}
+
+	table, ok := ks.Tables[name]
+	if !ok {
+		return invalidf("unconfigured table %s", name)
+	}
+	table = copyTable(table)
+
+	switch {
+	case ddl.accept("ADD"):
+		err = ddl.addColumns(ks.Name, table)
+	case ddl.accept("DROP"):
+		err = ddl.dropColumns(table)
+	case ddl.accept("RENAME"):
+		err = ddl.renameColumns(table)
+	case ddl.accept("WITH"):
+		for err == nil {
+			if err = ddl.tableOption(table); err == nil && !ddl.accept("AND") {
+				break
+			}
+		}
+		if err == nil {
+			err = ddl.checkTTL(table)
+		}
+	default:
+		err = ddl.errorf("no viable alternative")
+	}
+	if err != nil {
+		return err
+	}
+	ddl.commitTable(ks, table)
+
+	return nil
+}
+
+// addColumns reads the columns of an ALTER TABLE ADD and adds them to table.
+func (ddl *ddl) addColumns(keyspace string, table *gocql.TableMetadata) error {
+	parens := ddl.accept("(")
+	for {
+		pos := ddl.pos
+		name, err := ddl.ident()
+		if err != nil {
+			return err
+		}
+		if _, ok := table.Columns[name]; ok {
+			return invalidf("Invalid column name %s because it conflicts with an existing column", name)
+		}
+		ddl.pos = pos
+
+		column, err := ddl.columnDefinition(keyspace, table)
+		if err != nil {
+			return err
+		}
+		if column.Kind == gocql.ColumnStatic && len(table.ClusteringColumns) == 0 {
+			return invalidf("Static columns are only useful (and thus allowed) if the table has at least one clustering column")
+		}
+
+		if !parens || !ddl.accept(",") {
+			break
+		}
+	}
+	if parens {
+		if err := ddl.expect(")"); err != nil {
+			return err
+		}
+	}
+
+	return checkCounters(table)
+}
+
+// dropColumns reads the columns of an ALTER TABLE DROP and drops them from
+// table.
+func (ddl *ddl) dropColumns(table *gocql.TableMetadata) error {
+	parens := ddl.accept("(")
+	for {
+		name, err := ddl.ident()
+		if err != nil {
+			return err
+		}
+
+		column, ok := table.Columns[name]
+		switch {
+		case !ok:
+			return invalidf("Column %s was not found in table %s", name, table.Name)
+		case column.Kind == gocql.ColumnPartitionKey || column.Kind == gocql.ColumnClusteringKey:
+			return invalidf("Cannot drop PRIMARY KEY part %s", name)
+		case column.Index.Name != "":
+			return invalidf("Cannot drop column %s because it has dependent secondary indexes (%s)", name, column.Index.Name)
+		}
+
+		delete(table.Columns, name)
+		for i, ordered := range table.OrderedColumns {
+			if ordered == name {
+				table.OrderedColumns = append(table.OrderedColumns[:i], table.OrderedColumns[i+1:]...)
+				break
+			}
+		}
+
+		if !parens || !ddl.accept(",") {
+			break
+		}
+	}
+	if parens {
+		return ddl.expect(")")
+	}
+
+	return nil
+}
+
+// renameColumns reads the renames of an ALTER TABLE RENAME and applies them
+// to the primary key columns of table.
+func (ddl *ddl) renameColumns(table *gocql.TableMetadata) error {
+	for {
+		from, err := ddl.ident()
+		if err != nil {
+			return err
+		}
+		if err := ddl.expect("TO"); err != nil {
+			return err
+		}
+		to, err := ddl.ident()
+		if err != nil {
+			return err
+		}
+
+		column, ok := table.Columns[from]
+		_, exists := table.Columns[to]
+		switch {
+		case !ok:
+			return invalidf("Column %s was not found in table %s", from, table.Name)
+		case exists:
+			return invalidf("Cannot rename column %s to %s in keyspace %s; another column of that name already exist", from, to, table.Keyspace)
+		case column.Kind != gocql.ColumnPartitionKey && column.Kind != gocql.ColumnClusteringKey:
+			return invalidf("Cannot rename non PRIMARY KEY part %s", from)
+		}
+
+		column.Name = to
+		delete(table.Columns, from)
+		table.Columns[to] = column
+		for i, ordered := range table.OrderedColumns {
+			if ordered == from {
+				table.OrderedColumns[i] = to
+			}
+		}
+
+		if !ddl.accept("AND") {
+			return nil
+		}
+	}
+}
+
+func (ddl *ddl) dropTable() error {
+	ifExists := ddl.ifExists()
+	ks, name, err := ddl.qualifiedName()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ks.Tables[name]; !ok {
+		if ifExists {
+			return nil
+		}
+		return &RequestError{gocql.ErrCodeConfig, fmt.Sprintf("Cannot drop non existing table '%s' in keyspace '%s'.", name, ks.Name)}
+	}
+
+	ks = copyKeyspace(ks)
+	delete(ks.Tables, name)
+	ddl.schema.keyspaces[ks.Name] = ks
+	delete(ddl.schema.defaultTTLs, ks.Name+"."+name)
+
+	return nil
+}
+
+func (ddl *ddl) alterType() error {
+	ks, name, err := ddl.qualifiedName()
+	if err != nil {
+		return err
+	}
+
+	udt, ok := ks.UserTypes[name]
+	if !ok {
+		return invalidf("No user type named %s.%s exists.", ks.Name, name)
+	}
+	copied := *udt
+	copied.FieldNames = append([]string(nil), udt.FieldNames...)
+	copied.FieldTypes = append([]gocql.TypeInfo(nil), udt.FieldTypes...)
+
+	switch {
+	case ddl.accept("ADD"):
+		field, err := ddl.ident()
+		if err != nil {
+			return err
+		}
+		typ, _, err := ddl.cqlType(ks.Name)
+		if err != nil {
+			return err
+		}
+		if fieldIndex(&copied, field) >= 0 {
+			return invalidf("Cannot add new field %s to type %s.%s: a field of the same name already exists", field, ks.Name, name)
+		}
+		copied.FieldNames = append(copied.FieldNames, field)
+		copied.FieldTypes = append(copied.FieldTypes, typ)
+	case ddl.accept("RENAME"):
+		for {
+			from, err := ddl.ident()
+			if err != nil {
+				return err
+			}
+			if err := ddl.expect("TO"); err != nil {
+				return err
+			}
+			to, err := ddl.ident()
+			if err != nil {
+				return err
+			}
+
+			i := fieldIndex(&copied, from)
+			switch {
+			case i < 0:
+				return invalidf("Unknown field %s in type %s.%s", from, ks.Name, name)
+			case fieldIndex(&copied, to) >= 0:
+				return invalidf("Duplicate field name %s in type %s.%s", to, ks.Name, name)
+			}
+			copied.FieldNames[i] = to
+
+			if !ddl.accept("AND") {
+				break
+			}
+		}
+	default:
+		return ddl.errorf("no viable alternative")
+	}
+
+	ks = copyKeyspace(ks)
+	ks.UserTypes[name] = &copied
+	refreshType(ks, udtInfo(&copied))
+	ddl.schema.keyspaces[ks.Name] = ks
+
+	return nil
+}
+
+func fieldIndex(udt *gocql.UserTypeMetadata, field string) int {
+	for i, name := range udt.FieldNames {
+		if name == field {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// refreshType replaces the former definitions of the user defined type info
+// by info in the types of the columns and user defined types of ks.
+func refreshType(ks *gocql.KeyspaceMetadata, info gocql.UDTTypeInfo) {
+	for name, udt := range ks.UserTypes {
+		var refreshed *gocql.UserTypeMetadata
+		for i, typ := range udt.FieldTypes {
+			if replaced, ok := replaceType(typ, info); ok {
+				if refreshed == nil {
+					copied := *udt
+					copied.FieldTypes = append([]gocql.TypeInfo(nil), udt.FieldTypes...)
+					refreshed = &copied
+				}
+				refreshed.FieldTypes[i] = replaced
+			}
+		}
+		if refreshed != nil {
+			ks.UserTypes[name] = refreshed
+		}
+	}
+
+	for name, table := range ks.Tables {
+		var refreshed *gocql.TableMetadata
+		for _, column := range table.Columns {
+			if _, ok := replaceType(column.Type, info); ok {
+				refreshed = copyTable(table)
+				break
+			}
+		}
+		if refreshed == nil {
+			continue
+		}
+		for _, column := range refreshed.Columns {
+			column.Type, _ = replaceType(column.Type, info)
+		}
+		ks.Tables[name] = refreshed
+	}
+}
+
+// replaceType returns typ with info in place of the user defined type of the
+// same name, and whether typ refers to it.
+func replaceType(typ gocql.TypeInfo, info gocql.UDTTypeInfo) (gocql.TypeInfo, bool) {
+	switch t := typ.(type) {
+	case gocql.UDTTypeInfo:
+		if t.KeySpace == info.KeySpace && t.Name == info.Name {
+			return info, true
+		}
+		replaced := false
+		elements := append([]gocql.UDTField(nil), t.Elements...)
+		for i, field := range elements {
+			if r, ok := replaceType(field.Type, info); ok {
+				elements[i].Type, replaced = r, true
+			}
+		}
+		t.Elements = elements
+		return t, replaced
+	case gocql.CollectionType:
+		key, replacedKey := replaceType(t.Key, info)
+		elem, replacedElem := replaceType(t.Elem, info)
+		t.Key, t.Elem = key, elem
+		return t, replacedKey || replacedElem
+	case gocql.TupleTypeInfo:
+		replaced := false
+		elems := append([]gocql.TypeInfo(nil), t.Elems...)
+		for i, elem := range elems {
+			if r, ok := replaceType(elem, info); ok {
+				elems[i], replaced = r, true
+			}
+		}
+		t.Elems = elems
+		return t, replaced
+	default:
+		return typ, false
+	}
+}
+
+func (ddl *ddl) dropType() error {
+	ifExists := ddl.ifExists()
+	ks, name, err := ddl.qualifiedName()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ks.UserTypes[name]; !ok {
+		if ifExists {
+			return nil
+		}
+		return invalidf("No user type named %s.%s exists.", ks.Name, name)
+	}
+
+	info := udtInfo(ks.UserTypes[name])
+	for other, udt := range ks.UserTypes {
+		for _, typ := range udt.FieldTypes {
+			if _, ok := replaceType(typ, info); ok {
+				return invalidf("Cannot drop user type %s.%s as it is still used by user type %s", ks.Name, name, other)
+			}
+		}
+	}
+	for table, metadata := range ks.Tables {
+		for _, column := range metadata.Columns {
+			if _, ok := replaceType(column.Type, info); ok {
+				return invalidf("Cannot drop user type %s.%s as it is still used by table %s.%s", ks.Name, name, ks.Name, table)
+			}
+		}
+	}
+
+	ks = copyKeyspace(ks)
+	delete(ks.UserTypes, name)
+	ddl.schema.keyspaces[ks.Name] = ks
+
+	return nil
+}
+
+// indexTargets are the functions an index applies to the values of the
+// column it indexes.
+var indexTargets = []string{"KEYS", "VALUES", "ENTRIES", "FULL"}
+
+func (ddl *ddl) createIndex() error {
+	ifNotExists := ddl.ifNotExists()
+
+	var index string
+	if !ddl.peek().is("ON") {
+		name, err := ddl.ident()
+		if err != nil {
+			return err
+		}
+		index = name
+	}
+	if err := ddl.expect("ON"); err != nil {
+		return err
+	}
+	ks, name, err := ddl.qualifiedName()
+	if err != nil {
+		return err
+	}
+	table, ok := ks.Tables[name]
+	if !ok {
+		return invalidf("unconfigured table %s", name)
+	}
+
+	if err := ddl.expect("("); err != nil {
+		return err
+	}
+	function := ""
+	for _, target := range indexTargets {
+		if ddl.accept(target, "(") {
+			function = strings.ToLower(target)
+			break
+		}
+	}
+	columnName, err := ddl.ident()
+	if err != nil {
+		return err
+	}
+	if function != "" {
+		if err := ddl.expect(")"); err != nil {
+			return err
+		}
+	}
+	if err := ddl.expect(")"); err != nil {
+		return err
+	}
+	if ddl.accept("USING") {
+		ddl.next()
+	}
+	if ddl.accept("WITH") {
+		ddl.skipRest()
+	}
+
+	if index == "" {
+		index = name + "_" + columnName + "_idx"
+	}
+	if existing := findIndex(ks, index); existing != nil {
+		if ifNotExists {
+			return nil
+		}
+		return invalidf("Index %s already exists", index)
+	}
+
+	column, ok := table.Columns[columnName]
+	if !ok {
+		return invalidf("Undefined column name %s", columnName)
+	}
+	if function == "" {
+		function = "values"
+		if frozen(column) {
+			function = ""
+		}
+	}
+	target := columnName
+	if function != "" {
+		target = function + "(" + columnName + ")"
+	}
+
+	switch {
+	case column.Index.Name != "" && ifNotExists:
+		return nil
+	case column.Index.Name != "":
+		return invalidf("Index %s is a duplicate of existing index %s", index, column.Index.Name)
+	case counterTable(table):
+		return invalidf("Secondary indexes are not supported on counter tables")
+	case column.Kind == gocql.ColumnPartitionKey && len(table.PartitionKey) == 1:
+		return invalidf("Cannot create secondary index on the only partition key column %s", columnName)
+	case function == "full" && !frozen(column):
+		return invalidf("full() indexes can only be created on frozen collections")
+	case (function == "keys" || function == "entries") && column.Type.Type() != gocql.TypeMap:
+		return invalidf("Cannot create index on %s of column %s with non-map type", function, columnName)
+	}
+
+	table = copyTable(table)
+	table.Columns[columnName].Index = gocql.ColumnIndexMetadata{
+		Name:    index,
+		Type:    "COMPOSITES",
+		Options: map[string]interface{}{"target": target},
+	}
+	ks = copyKeyspace(ks)
+	ks.Tables[name] = table
+	ddl.schema.keyspaces[ks.Name] = ks
+
+	return nil
+}
+
+// findIndex returns the column of ks indexed by the index of name, nil when
+// there is none.
+func findIndex(ks *gocql.KeyspaceMetadata, name string) *gocql.ColumnMetadata {
+	for _, table := range ks.Tables {
+		for _, column := range table.Columns {
+			if column.Index.Name == name {
+				return column
+			}
+		}
+	}
+
+	return nil
+}
+
+func (ddl *ddl) dropIndex() error {
+	ifExists := ddl.ifExists()
+	ks, name, err := ddl.qualifiedName()
+	if err != nil {
+		return err
+	}
+
+	column := findIndex(ks, name)
+	if column == nil {
+		if ifExists {
+			return nil
+		}
+		return invalidf("Index '%s' could not be found in any of the tables of keyspace '%s'", name, ks.Name)
+	}
+
+	table := copyTable(ks.Tables[column.Table])
+	table.Columns[column.Name].Index = gocql.ColumnIndexMetadata{}
+	ks = copyKeyspace(ks)
+	ks.Tables[table.Name] = table
+	ddl.schema.keyspaces[ks.Name] = ks
+
+	return nil
+}
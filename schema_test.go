@@ -0,0 +1,240 @@
+package gocqlxmock
+
+import (
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeSchemaSut(t *testing.T) *Schema {
+	schema := NewSchema()
+	if err := schema.Exec("", "CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}"); err != nil {
+		t.Fatal(err)
+	}
+
+	return schema
+}
+
+func Test_Schema_Exec(t *testing.T) {
+	t.Run("Should track the tables it creates", func(t *testing.T) {
+		// arrange
+		schema := makeSchemaSut(t)
+
+		// act
+		err := schema.Exec("ks", `CREATE TABLE IF NOT EXISTS potato (
+			id uuid,
+			day date,
+			hour int,
+			tags frozen<list<text>>,
+			owner text STATIC,
+			PRIMARY KEY ((id, day), hour)
+		) WITH CLUSTERING ORDER BY (hour DESC) AND comment = 'potatoes'`)
+
+		// assert
+		assert.NoError(t, err)
+		table, tableErr := schema.Table("ks", "potato")
+		assert.NoError(t, tableErr)
+		assert.Equal(t, []string{"id", "day", "hour", "tags", "owner"}, table.OrderedColumns)
+		assert.Len(t, table.PartitionKey, 2)
+		assert.Equal(t, "hour", table.ClusteringColumns[0].Name)
+		assert.Equal(t, gocql.DESC, table.ClusteringColumns[0].Order)
+		assert.Equal(t, gocql.ColumnStatic, table.Columns["owner"].Kind)
+		assert.Equal(t, "frozen<list<text>>", table.Columns["tags"].Validator)
+	})
+
+	t.Run("Should fail like Scylla on invalid statements", func(t *testing.T) {
+		// arrange
+		schema := makeSchemaSut(t)
+
+		for stmt, expected := range map[string]string{
+			"CREATE KEYSPACE ks WITH replication = {'class': 'SimpleStrategy'}":                  "Keyspace ks already exists",
+			"CREATE TABLE potato (id int)":                                                       "No PRIMARY KEY specified (exactly one required)",
+			"CREATE TABLE potato (id int PRIMARY KEY, name potato)":                              "Unknown type ks.potato",
+			"CREATE TABLE potato (id int PRIMARY KEY, name text STATIC)":                         "Static columns are only useful (and thus allowed) if the table has at least one clustering column",
+			"CREATE TABLE potato (id int, PRIMARY KEY (name))":                                   "Unknown definition name referenced in PRIMARY KEY",
+			"CREATE TABLE potato id int":                                                         "line 1:20 expecting ( at input 'id'",
+			"CREATE TABLE potato (id int PRIMARY KEY, n counter, name text)":                     "Cannot mix counter and non counter columns in the same table",
+			"CREATE TABLE potato (id counter PRIMARY KEY, n counter)":                            "counter type is not supported for PRIMARY KEY part id",
+			"CREATE TABLE potato (id int PRIMARY KEY, n counter) WITH default_time_to_live = 10": "Cannot set default_time_to_live on a table with counters",
+		} {
+			// act
+			err := schema.Exec("ks", stmt)
+
+			// assert
+			assert.EqualError(t, err, expected, stmt)
+		}
+	})
+
+	t.Run("Should resolve user types of the keyspace", func(t *testing.T) {
+		// arrange
+		schema := makeSchemaSut(t)
+
+		// act
+		errType := schema.Exec("ks", "CREATE TYPE address (street text, number int)")
+		errTable := schema.Exec("ks", "CREATE TABLE potato (id int PRIMARY KEY, address frozen<address>)")
+
+		// assert
+		assert.NoError(t, errType)
+		assert.NoError(t, errTable)
+		table, _ := schema.Table("ks", "potato")
+		udt, ok := table.Columns["address"].Type.(gocql.UDTTypeInfo)
+		assert.True(t, ok)
+		assert.Equal(t, []gocql.UDTField{
+			{Name: "street", Type: nativeType(gocql.TypeText)},
+			{Name: "number", Type: nativeType(gocql.TypeInt)},
+		}, udt.Elements)
+	})
+
+	t.Run("Should alter and drop what it tracks", func(t *testing.T) {
+		// arrange
+		schema := makeSchemaSut(t)
+		for _, stmt := range []string{
+			"CREATE TYPE address (street text)",
+			"CREATE TABLE potato (id int, day int, name text, PRIMARY KEY (id, day))",
+			"CREATE TABLE tomato (id int PRIMARY KEY)",
+		} {
+			if err := schema.Exec("ks", stmt); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// act
+		errs := []error{
+			schema.Exec("ks", "ALTER TABLE potato ADD (color text, home frozen<address>)"),
+			schema.Exec("ks", "ALTER TABLE potato DROP name"),
+			schema.Exec("ks", "ALTER TABLE potato RENAME day TO hour"),
+			schema.Exec("ks", "ALTER TYPE address ADD number int"),
+			schema.Exec("ks", "DROP TABLE tomato"),
+		}
+
+		// assert
+		for _, err := range errs {
+			assert.NoError(t, err)
+		}
+		table, _ := schema.Table("ks", "potato")
+		assert.Equal(t, []string{"id", "hour", "color", "home"}, table.OrderedColumns)
+		assert.Equal(t, "hour", table.ClusteringColumns[0].Name)
+		udt := table.Columns["home"].Type.(gocql.UDTTypeInfo)
+		assert.Equal(t, []string{"street", "number"}, []string{udt.Elements[0].Name, udt.Elements[1].Name})
+		_, err := schema.Table("ks", "tomato")
+		assert.EqualError(t, err, "unconfigured table tomato")
+	})
+
+	t.Run("Should track secondary indexes", func(t *testing.T) {
+		// arrange
+		schema := makeSchemaSut(t)
+		if err := schema.Exec("ks", "CREATE TABLE potato (id int PRIMARY KEY, name text, tags set<text>)"); err != nil {
+			t.Fatal(err)
+		}
+
+		// act
+		errName := schema.Exec("ks", "CREATE INDEX ON potato (name)")
+		errTags := schema.Exec("ks", "CREATE INDEX potato_tags ON potato (tags)")
+
+		// assert
+		assert.NoError(t, errName)
+		assert.NoError(t, errTags)
+		table, _ := schema.Table("ks", "potato")
+		assert.Equal(t, "potato_name_idx", table.Columns["name"].Index.Name)
+		assert.Equal(t, "name", table.Columns["name"].Index.Options["target"])
+		assert.Equal(t, "values(tags)", table.Columns["tags"].Index.Options["target"])
+		assert.NoError(t, schema.Exec("ks", "DROP INDEX potato_tags"))
+		table, _ = schema.Table("ks", "potato")
+		assert.Empty(t, table.Columns["tags"].Index.Name)
+	})
+
+	t.Run("Should fail like Scylla on invalid schema changes", func(t *testing.T) {
+		// arrange
+		schema := makeSchemaSut(t)
+		for _, stmt := range []string{
+			"CREATE TYPE address (street text)",
+			"CREATE TABLE potato (id int, day int, name text, home frozen<address>, PRIMARY KEY (id, day))",
+			"CREATE INDEX ON potato (name)",
+		} {
+			if err := schema.Exec("ks", stmt); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for stmt, expected := range map[string]string{
+			"ALTER TABLE tomato ADD color text":       "unconfigured table tomato",
+			"ALTER TABLE potato ADD name text":        "Invalid column name name because it conflicts with an existing column",
+			"ALTER TABLE potato DROP color":           "Column color was not found in table potato",
+			"ALTER TABLE potato DROP day":             "Cannot drop PRIMARY KEY part day",
+			"ALTER TABLE potato DROP name":            "Cannot drop column name because it has dependent secondary indexes (potato_name_idx)",
+			"ALTER TABLE potato RENAME name TO color": "Cannot rename non PRIMARY KEY part name",
+			"DROP TABLE tomato":                       "Cannot drop non existing table 'tomato' in keyspace 'ks'.",
+			"DROP KEYSPACE larry":                     "Cannot drop non existing keyspace 'larry'.",
+			"DROP TYPE address":                       "Cannot drop user type ks.address as it is still used by table ks.potato",
+			"ALTER TYPE address ADD street text":      "Cannot add new field street to type ks.address: a field of the same name already exists",
+			"CREATE INDEX ON potato (color)":          "Undefined column name color",
+			"CREATE INDEX other ON potato (name)":     "Index other is a duplicate of existing index potato_name_idx",
+			"DROP INDEX tomato_idx":                   "Index 'tomato_idx' could not be found in any of the tables of keyspace 'ks'",
+		} {
+			// act
+			err := schema.Exec("ks", stmt)
+
+			// assert
+			assert.EqualError(t, err, expected, stmt)
+		}
+	})
+
+	t.Run("Should leave the schema unchanged when extraneous input follows a statement", func(t *testing.T) {
+		// arrange
+		schema := makeSchemaSut(t)
+		if err := schema.Exec("ks", "CREATE TABLE potato (id int PRIMARY KEY, name text)"); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, stmt := range []string{
+			"CREATE TABLE tomato (id int PRIMARY KEY, name text) garbage",
+			"ALTER TABLE potato ADD color text garbage",
+			"CREATE INDEX ON potato (name) garbage",
+			"DROP TABLE potato garbage",
+		} {
+			// act
+			err := schema.Exec("ks", stmt)
+
+			// assert
+			assert.ErrorContains(t, err, "extraneous input", stmt)
+		}
+		ks, _ := schema.Keyspace("ks")
+		assert.Len(t, ks.Tables, 1)
+		assert.Equal(t, []string{"id", "name"}, ks.Tables["potato"].OrderedColumns)
+		assert.Empty(t, ks.Tables["potato"].Columns["name"].Index.Name)
+	})
+
+	t.Run("Should not keep the default TTL of a table it failed to create", func(t *testing.T) {
+		// arrange
+		schema := makeSchemaSut(t)
+		errFailed := schema.Exec("ks", "CREATE TABLE potato (id int PRIMARY KEY, v text) WITH default_time_to_live = 10 AND CLUSTERING ORDER BY (v DESC)")
+
+		// act
+		errCreated := schema.Exec("ks", "CREATE TABLE potato (id int PRIMARY KEY, v text)")
+
+		// assert
+		assert.Error(t, errFailed)
+		assert.NoError(t, errCreated)
+		table, _ := schema.Table("ks", "potato")
+		assert.Zero(t, schema.defaultTTL(table))
+	})
+
+	t.Run("Should write the default TTL of a table along with it", func(t *testing.T) {
+		// arrange
+		schema := makeSchemaSut(t)
+		if err := schema.Exec("ks", "CREATE TABLE potato (id int PRIMARY KEY, v text) WITH default_time_to_live = 10"); err != nil {
+			t.Fatal(err)
+		}
+
+		// act
+		errFailed := schema.Exec("ks", "ALTER TABLE potato WITH default_time_to_live = 20 AND default_time_to_live = -1")
+		errAltered := schema.Exec("ks", "ALTER TABLE potato WITH default_time_to_live = 30")
+
+		// assert
+		assert.Error(t, errFailed)
+		assert.NoError(t, errAltered)
+		table, _ := schema.Table("ks", "potato")
+		assert.Equal(t, int64(30), schema.defaultTTL(table))
+	})
+}
@@ -0,0 +1,136 @@
+package gocqlxmock
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// Sequence enforces the order in which a set of expectations, possibly
+// spread across SessionxMock, QueryxMock and IterxMock, are invoked.
+type Sequence struct {
+	mu     sync.Mutex
+	t      mock.TestingT
+	steps  []*sequenceStep
+	cursor int
+}
+
+type sequenceStep struct {
+	call  *mock.Call
+	want  int
+	calls int
+}
+
+// InOrder declares that the given calls must happen in the order they are
+// passed. A call may repeat as allowed by its Times/Once/Twice setting, but
+// once a later call happened an earlier one cannot be invoked again.
+//
+// InOrder must be called after the calls are fully configured, as it chains
+// itself in front of any function registered with Run.
+func InOrder(calls ...*mock.Call) *Sequence {
+	seq := &Sequence{
+		cursor: -1,
+	}
+
+	for index, call := range calls {
+		step := &sequenceStep{
+			call: call,
+			want: call.Repeatability,
+		}
+		seq.steps = append(seq.steps, step)
+
+		position := index
+		runFn := call.RunFn
+		call.RunFn = func(args mock.Arguments) {
+			seq.advance(position)
+
+			if runFn != nil {
+				runFn(args)
+			}
+		}
+	}
+
+	return seq
+}
+
+// Test sets the test struct used to report out of order calls. Without it
+// an out of order call panics, just like an unexpected call on a mock.
+func (seq *Sequence) Test(t mock.TestingT) *Sequence {
+	seq.mu.Lock()
+	defer seq.mu.Unlock()
+
+	seq.t = t
+
+	return seq
+}
+
+// AssertExpectations asserts that every call of the sequence was invoked.
+func (seq *Sequence) AssertExpectations(t mock.TestingT) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	seq.mu.Lock()
+	defer seq.mu.Unlock()
+
+	var missing []string
+	for _, step := range seq.steps {
+		if !step.satisfied() {
+			missing = append(missing, "\t"+step.String())
+		}
+	}
+
+	if len(missing) > 0 {
+		t.Errorf("gocqlxmock: sequence has calls that were not made:\n%s", strings.Join(missing, "\n"))
+		return false
+	}
+
+	return true
+}
+
+func (seq *Sequence) advance(position int) {
+	seq.mu.Lock()
+
+	var violation string
+	switch {
+	case position < seq.cursor:
+		violation = fmt.Sprintf("%s was called after %s", seq.steps[position], seq.steps[seq.cursor])
+	case position > seq.cursor:
+		for index := seq.cursor; index < position; index++ {
+			if index >= 0 && !seq.steps[index].satisfied() {
+				violation = fmt.Sprintf("%s was called before %s", seq.steps[position], seq.steps[index])
+				break
+			}
+		}
+	}
+
+	seq.steps[position].calls++
+	seq.cursor = position
+	t := seq.t
+	seq.mu.Unlock()
+
+	if violation == "" {
+		return
+	}
+
+	failf(t, "gocqlxmock: call out of order: %s", violation)
+}
+
+func (step *sequenceStep) satisfied() bool {
+	if step.want > 0 {
+		return step.calls >= step.want
+	}
+
+	return step.calls > 0
+}
+
+func (step *sequenceStep) String() string {
+	args := make([]string, 0, len(step.call.Arguments))
+	for _, arg := range step.call.Arguments {
+		args = append(args, fmt.Sprintf("%v", arg))
+	}
+
+	return fmt.Sprintf("%s(%s)", step.call.Method, strings.Join(args, ", "))
+}
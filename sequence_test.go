@@ -0,0 +1,202 @@
+package gocqlxmock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type testingTSpy struct {
+	mu       sync.Mutex
+	errors   []string
+	failed   bool
+	cleanups []func()
+}
+
+func (spy *testingTSpy) Logf(format string, args ...interface{}) {}
+
+func (spy *testingTSpy) Errorf(format string, args ...interface{}) {
+	spy.mu.Lock()
+	defer spy.mu.Unlock()
+
+	spy.errors = append(spy.errors, fmt.Sprintf(format, args...))
+}
+
+func (spy *testingTSpy) FailNow() {
+	spy.mu.Lock()
+	defer spy.mu.Unlock()
+
+	spy.failed = true
+}
+
+func (spy *testingTSpy) Fatalf(format string, args ...interface{}) {
+	spy.Errorf(format, args...)
+	spy.FailNow()
+}
+
+func (spy *testingTSpy) Cleanup(fn func()) {
+	spy.cleanups = append(spy.cleanups, fn)
+}
+
+func (spy *testingTSpy) Helper() {}
+
+func (spy *testingTSpy) runCleanups() {
+	for i := len(spy.cleanups) - 1; i >= 0; i-- {
+		spy.cleanups[i]()
+	}
+}
+
+type sequenceSut struct {
+	ctx         context.Context
+	stmt        string
+	names       []string
+	arg         *Potato
+	sessionmock *SessionxMock
+	querymock   *QueryxMock
+	iterxmock   *IterxMock
+	spy         *testingTSpy
+}
+
+func makeSequenceSut() sequenceSut {
+	ctx := context.Background()
+	stmt := "statement"
+	names := []string{"name"}
+	arg := makeArg("potato")
+
+	return sequenceSut{
+		ctx,
+		stmt,
+		names,
+		arg,
+		&SessionxMock{},
+		&QueryxMock{},
+		&IterxMock{},
+		&testingTSpy{},
+	}
+}
+
+func Test_Sequence_InOrder(t *testing.T) {
+	t.Run("Should accept calls made in the declared order across mocks", func(t *testing.T) {
+		// arrange
+		sut := makeSequenceSut()
+		seq := InOrder(
+			sut.sessionmock.On("Query", sut.stmt, sut.names).Return(sut.querymock),
+			sut.querymock.On("WithContext", sut.ctx).Return(sut.querymock),
+			sut.querymock.On("BindStruct", sut.arg).Return(sut.querymock),
+			sut.querymock.On("Iter").Return(sut.iterxmock),
+			sut.iterxmock.On("Close").Return(nil),
+		).Test(sut.spy)
+
+		// act
+		err := sut.sessionmock.Query(sut.stmt, sut.names).WithContext(sut.ctx).BindStruct(sut.arg).Iter().Close()
+
+		// assert
+		assert.NoError(t, err)
+		assert.Empty(t, sut.spy.errors)
+		assert.True(t, seq.AssertExpectations(t))
+	})
+
+	t.Run("Should fail when a call happens before the previous one", func(t *testing.T) {
+		// arrange
+		sut := makeSequenceSut()
+		InOrder(
+			sut.querymock.On("WithContext", sut.ctx).Return(sut.querymock),
+			sut.querymock.On("BindStruct", sut.arg).Return(sut.querymock),
+			sut.querymock.On("ExecRelease").Return(nil),
+		).Test(sut.spy)
+
+		// act
+		sut.querymock.WithContext(sut.ctx)
+		_ = sut.querymock.ExecRelease()
+
+		// assert
+		assert.False(t, sut.spy.failed)
+		assert.Len(t, sut.spy.errors, 1)
+		assert.Contains(t, sut.spy.errors[0], "ExecRelease() was called before BindStruct")
+	})
+
+	t.Run("Should fail when an earlier call is repeated after a later one", func(t *testing.T) {
+		// arrange
+		sut := makeSequenceSut()
+		InOrder(
+			sut.querymock.On("Get", sut.arg).Return(nil),
+			sut.querymock.On("ExecCAS").Return(true, nil),
+		).Test(sut.spy)
+
+		// act
+		_ = sut.querymock.Get(sut.arg)
+		_, _ = sut.querymock.ExecCAS()
+		_ = sut.querymock.Get(sut.arg)
+
+		// assert
+		assert.False(t, sut.spy.failed)
+		assert.Contains(t, sut.spy.errors[0], "was called after ExecCAS()")
+	})
+
+	t.Run("Should require repeated calls to be exhausted before moving on", func(t *testing.T) {
+		// arrange
+		sut := makeSequenceSut()
+		InOrder(
+			sut.iterxmock.On("Scan", mock.Anything).Return(true).Twice(),
+			sut.iterxmock.On("Close").Return(nil),
+		).Test(sut.spy)
+
+		// act
+		sut.iterxmock.Scan()
+		_ = sut.iterxmock.Close()
+
+		// assert
+		assert.False(t, sut.spy.failed)
+		assert.Contains(t, sut.spy.errors[0], "Close() was called before Scan")
+	})
+
+	t.Run("Should panic on out of order calls when no test is set", func(t *testing.T) {
+		// arrange
+		sut := makeSequenceSut()
+		InOrder(
+			sut.sessionmock.On("ExecStmt", sut.stmt).Return(nil),
+			sut.sessionmock.On("Close").Return(),
+		)
+
+		// act / assert
+		assert.Panics(t, func() { sut.sessionmock.Close() })
+	})
+
+	t.Run("Should keep running functions registered with Run", func(t *testing.T) {
+		// arrange
+		sut := makeSequenceSut()
+		ran := false
+		InOrder(
+			sut.sessionmock.On("ExecStmt", sut.stmt).Return(nil).Run(func(args mock.Arguments) { ran = true }),
+		)
+
+		// act
+		_ = sut.sessionmock.ExecStmt(sut.stmt)
+
+		// assert
+		assert.True(t, ran)
+	})
+}
+
+func Test_Sequence_AssertExpectations(t *testing.T) {
+	t.Run("Should report calls of the sequence that were never made", func(t *testing.T) {
+		// arrange
+		sut := makeSequenceSut()
+		seq := InOrder(
+			sut.sessionmock.On("ExecStmt", sut.stmt).Return(nil),
+			sut.sessionmock.On("AwaitSchemaAgreement", sut.ctx).Return(nil),
+		)
+		_ = sut.sessionmock.ExecStmt(sut.stmt)
+
+		// act
+		result := seq.AssertExpectations(sut.spy)
+
+		// assert
+		assert.False(t, result)
+		assert.Contains(t, sut.spy.errors[0], "AwaitSchemaAgreement")
+	})
+}
@@ -2,6 +2,8 @@ package gocqlxmock
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/Guilospanck/igocqlx"
 	"github.com/stretchr/testify/mock"
@@ -9,32 +11,155 @@ import (
 
 type SessionxMock struct {
 	mock.Mock
+
+	graph      mockGraph
+	mu         sync.Mutex
+	test       mock.TestingT
+	isolate    bool
+	queries    []*QueryxMock
+	executions []Execution
+	defaults   consistencyDefaults
+	policy     ConsistencyPolicy
+	lint       *LintOptions
+	lintIssues []LintIssue
+
+	keyspaceName string
+	latencies    map[string]time.Duration
+	ring         *Ring
+	payloads     map[string]map[string][]byte
+
+	batchThresholds batchThresholds
+	schema          *Schema
+	agreement       *schemaAgreement
+	log             callLog
+}
+
+// NewSessionxMock creates a SessionxMock bound to t: unexpected calls fail the
+// test and the expectations of the session, and of every query and iterator
+// it returned, are asserted when the test finishes.
+func NewSessionxMock(t TestingT) *SessionxMock {
+	mock := &SessionxMock{}
+	bindTest(t, mock, mock)
+
+	return mock
+}
+
+func (mock *SessionxMock) mockGraph() *mockGraph {
+	return &mock.graph
+}
+
+// Test sets the test struct used to report unexpected calls and violations
+// of the consistency policy.
+func (mock *SessionxMock) Test(t mock.TestingT) {
+	mock.Mock.Test(t)
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	mock.test = t
+}
+
+// IsolateQueries makes every ContextQuery and Query call return its own view
+// of the configured QueryxMock. Views match calls against the expectations of
+// the configured QueryxMock but keep their bound values and calls apart, so a
+// QueryxMock can be shared by concurrent callers.
+func (mock *SessionxMock) IsolateQueries() *SessionxMock {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	mock.isolate = true
+
+	return mock
+}
+
+// Queries returns the QueryxMocks handed out by the session, in call order.
+func (mock *SessionxMock) Queries() []*QueryxMock {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	return append([]*QueryxMock(nil), mock.queries...)
+}
+
+func (mock *SessionxMock) queryx(args mock.Arguments, stmt string, names []string) igocqlx.IQueryx {
+	result := args.Get(0).(igocqlx.IQueryx)
+	mock.graph.adopt(result)
+
+	query, ok := result.(*QueryxMock)
+	if !ok {
+		return result
+	}
+	err := mock.validate(stmt)
+
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	if mock.isolate || mock.schema != nil {
+		query = query.view()
+	}
+	query.setSession(mock, stmt, names)
+	query.reject(err)
+	mock.queries = append(mock.queries, query)
+
+	return query
 }
 
 func (mock *SessionxMock) ContextQuery(ctx context.Context, stmt string, names []string) igocqlx.IQueryx {
+	mock.lintStatement(stmt)
+	mock.checkSchemaAgreement(stmt)
 	args := mock.Called(ctx, stmt, names)
 
-	return args.Get(0).(igocqlx.IQueryx)
+	result := mock.queryx(args, stmt, names)
+	if query, ok := result.(*QueryxMock); ok {
+		query.setContext(ctx)
+	}
+	mock.log.recordHandout("ContextQuery", []interface{}{ctx, stmt, names}, []interface{}{result}, result)
+
+	return result
 }
 
 func (mock *SessionxMock) Query(stmt string, names []string) igocqlx.IQueryx {
+	mock.lintStatement(stmt)
+	mock.checkSchemaAgreement(stmt)
 	args := mock.Called(stmt, names)
 
-	return args.Get(0).(igocqlx.IQueryx)
+	result := mock.queryx(args, stmt, names)
+	mock.log.recordHandout("Query", []interface{}{stmt, names}, []interface{}{result}, result)
+
+	return result
 }
 
 func (mock *SessionxMock) ExecStmt(stmt string) error {
+	mock.lintStatement(stmt)
+	mock.checkSchemaAgreement(stmt)
+	if err := mock.validate(stmt); err != nil {
+		mock.log.record("ExecStmt", []interface{}{stmt}, []interface{}{err})
+		return err
+	}
 	args := mock.Called(stmt)
 
-	return args.Error(0)
+	err := args.Error(0)
+	if kind, _ := classify(stmt); err == nil && kind == StatementSchema {
+		if err = mock.applySchema(stmt); err == nil {
+			mock.changeSchema(stmt)
+		}
+	}
+	mock.log.record("ExecStmt", []interface{}{stmt}, []interface{}{err})
+
+	return err
 }
 
 func (mock *SessionxMock) AwaitSchemaAgreement(ctx context.Context) error {
+	if err := mock.awaitSchemaAgreement(ctx); err != nil {
+		mock.log.record("AwaitSchemaAgreement", []interface{}{ctx}, []interface{}{err})
+		return err
+	}
 	args := mock.Called(ctx)
+	mock.log.record("AwaitSchemaAgreement", []interface{}{ctx}, args)
 
 	return args.Error(0)
 }
 
 func (mock *SessionxMock) Close() {
 	mock.Called()
+	mock.log.record("Close", nil, nil)
 }
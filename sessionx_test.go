@@ -3,9 +3,11 @@ package gocqlxmock
 import (
 	"context"
 	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 type sessionXSut struct {
@@ -152,3 +154,160 @@ func Test_Sessionx_Close(t *testing.T) {
 		sut.sessionxmock.AssertNumberOfCalls(t, "Close", 1)
 	})
 }
+
+func Test_NewSessionxMock(t *testing.T) {
+	t.Run("Should assert the expectations of the whole mock graph on cleanup", func(t *testing.T) {
+		// arrange
+		sut := makeSessionxSut()
+		spy := &testingTSpy{}
+		sessionxmock := NewSessionxMock(spy)
+		iterxmock := &IterxMock{}
+		sessionxmock.On("Query", sut.stmt, sut.names).Return(sut.querymock)
+		sut.querymock.On("Iter").Return(iterxmock)
+		iterxmock.On("Close").Return(nil)
+
+		// act
+		sessionxmock.Query(sut.stmt, sut.names).Iter()
+		spy.runCleanups()
+
+		// assert
+		assert.Len(t, spy.cleanups, 1)
+		assert.Len(t, spy.errors, 1)
+		assert.Contains(t, spy.errors[0], "0 out of 1 expectation(s) were met")
+	})
+
+	t.Run("Should pass on cleanup when every expectation was met", func(t *testing.T) {
+		// arrange
+		sut := makeSessionxSut()
+		spy := &testingTSpy{}
+		sessionxmock := NewSessionxMock(spy)
+		sessionxmock.On("Query", sut.stmt, sut.names).Return(sut.querymock)
+		sut.querymock.On("Exec").Return(nil)
+
+		// act
+		err := sessionxmock.Query(sut.stmt, sut.names).Exec()
+		spy.runCleanups()
+
+		// assert
+		assert.NoError(t, err)
+		assert.Empty(t, spy.errors)
+	})
+
+	t.Run("Should report unexpected calls through Fatalf", func(t *testing.T) {
+		// arrange
+		spy := &testingTSpy{}
+		sessionxmock := NewSessionxMock(spy)
+		sessionxmock.On("ExecStmt", "expected").Return(nil)
+
+		// act
+		assert.Panics(t, func() { _ = sessionxmock.ExecStmt("unexpected") })
+
+		// assert
+		assert.True(t, spy.failed)
+		assert.Contains(t, spy.errors[0], "Unexpected Method Call")
+	})
+
+	t.Run("Should not assert twice mocks bound to a test of their own", func(t *testing.T) {
+		// arrange
+		sut := makeSessionxSut()
+		spy := &testingTSpy{}
+		sessionxmock := NewSessionxMock(spy)
+		querymock := NewQueryxMock(spy, sut.stmt, sut.names)
+		sessionxmock.On("Query", sut.stmt, sut.names).Return(querymock)
+		querymock.On("Exec").Return(nil)
+
+		// act
+		sessionxmock.Query(sut.stmt, sut.names)
+		spy.runCleanups()
+
+		// assert
+		assert.Len(t, spy.errors, 1)
+	})
+}
+
+func Test_Sessionx_IsolateQueries(t *testing.T) {
+	t.Run("Should keep the bound values of concurrent callers apart", func(t *testing.T) {
+		// arrange
+		sut := makeSessionxSut()
+		goroutines := 50
+		querymock := &QueryxMock{Stmt: sut.stmt, Names: []string{"name"}}
+		sut.sessionxmock.IsolateQueries()
+		sut.sessionxmock.On("Query", sut.stmt, querymock.Names).Return(querymock)
+		querymock.On("BindStruct", mock.Anything).Return(querymock)
+		querymock.On("ExecRelease").Return(nil)
+
+		// act
+		var wg sync.WaitGroup
+		results := make([]*QueryxMock, goroutines)
+		for i := 0; i < goroutines; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				query := sut.sessionxmock.Query(sut.stmt, querymock.Names).BindStruct(makeArg(fmt.Sprint(i)))
+				_ = query.ExecRelease()
+				results[i] = query.(*QueryxMock)
+			}(i)
+		}
+		wg.Wait()
+
+		// assert
+		sut.sessionxmock.AssertNumberOfCalls(t, "Query", goroutines)
+		querymock.AssertNumberOfCalls(t, "BindStruct", goroutines)
+		querymock.AssertNumberOfCalls(t, "ExecRelease", goroutines)
+		assert.Len(t, sut.sessionxmock.Queries(), goroutines)
+		for i, query := range results {
+			assert.NotSame(t, querymock, query)
+			assert.Equal(t, []interface{}{fmt.Sprint(i)}, query.Values())
+			query.AssertCalled(t, "BindStruct", makeArg(fmt.Sprint(i)))
+			query.AssertNumberOfCalls(t, "BindStruct", 1)
+			query.AssertNumberOfCalls(t, "ExecRelease", 1)
+		}
+	})
+
+	t.Run("Should let the calls of a view be asserted while they are made", func(t *testing.T) {
+		// arrange
+		sut := makeSessionxSut()
+		goroutines := 50
+		sut.sessionxmock.IsolateQueries()
+		sut.sessionxmock.On("Query", sut.stmt, sut.names).Return(sut.querymock)
+		sut.querymock.On("Bind", mock.Anything).Return(sut.querymock)
+		query := sut.sessionxmock.Query(sut.stmt, sut.names).(*QueryxMock)
+
+		// act
+		var wg sync.WaitGroup
+		for i := 0; i < goroutines; i++ {
+			wg.Add(2)
+			go func(i int) {
+				defer wg.Done()
+
+				query.Bind(i)
+			}(i)
+			go func() {
+				defer wg.Done()
+
+				query.AssertCalled(&testingTSpy{}, "Bind", mock.Anything)
+			}()
+		}
+		wg.Wait()
+
+		// assert
+		query.AssertNumberOfCalls(t, "Bind", goroutines)
+		sut.querymock.AssertNumberOfCalls(t, "Bind", goroutines)
+		assert.Empty(t, query.ExpectedCalls)
+		assert.Equal(t, mock.Arguments{sut.querymock}, query.Calls[0].ReturnArguments)
+	})
+
+	t.Run("Should return the configured query when not isolating", func(t *testing.T) {
+		// arrange
+		sut := makeSessionxSut()
+		sut.sessionxmock.On("Query", sut.stmt, sut.names).Return(sut.querymock)
+
+		// act
+		result := sut.sessionxmock.Query(sut.stmt, sut.names)
+
+		// assert
+		assert.Same(t, sut.querymock, result)
+		assert.Equal(t, []*QueryxMock{sut.querymock}, sut.sessionxmock.Queries())
+	})
+}
@@ -0,0 +1,113 @@
+package gocqlxmock
+
+import "github.com/gocql/gocql"
+
+// Snapshot is the schema and data of a FakeSessionx at some point, which
+// Restore brings back as many times as needed.
+type Snapshot struct {
+	keyspaces   map[string]*gocql.KeyspaceMetadata
+	defaultTTLs map[string]int64
+	store       *store
+}
+
+// Snapshot returns the current schema and data of the session, shared with
+// the sessions of its Client calls.
+func (session *FakeSessionx) Snapshot() *Snapshot {
+	c := session.cluster
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.schema.mu.RLock()
+	defer c.schema.mu.RUnlock()
+
+	return &Snapshot{
+		keyspaces:   copyKeyspaces(c.schema.keyspaces),
+		defaultTTLs: copyDefaultTTLs(c.schema.defaultTTLs),
+		store:       c.store.copy(),
+	}
+}
+
+// Restore brings back the schema and data of snapshot, taken from the
+// session or any other FakeSessionx. The timestamps of later writes keep
+// growing.
+func (session *FakeSessionx) Restore(snapshot *Snapshot) {
+	c := session.cluster
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.schema.mu.Lock()
+	defer c.schema.mu.Unlock()
+
+	c.schema.keyspaces = copyKeyspaces(snapshot.keyspaces)
+	c.schema.defaultTTLs = copyDefaultTTLs(snapshot.defaultTTLs)
+	c.store = snapshot.store.copy()
+}
+
+// Isolate snapshots the session and restores it once t, such as a subtest
+// of a table-driven test sharing seed data, finishes, so that t changes the
+// data freely.
+func (session *FakeSessionx) Isolate(t TestingT) *FakeSessionx {
+	snapshot := session.Snapshot()
+	t.Cleanup(func() {
+		session.Restore(snapshot)
+	})
+
+	return session
+}
+
+// copyKeyspaces copies the keyspaces of a schema. Their metadata is shared,
+// as DDL statements replace it rather than change it.
+func copyKeyspaces(keyspaces map[string]*gocql.KeyspaceMetadata) map[string]*gocql.KeyspaceMetadata {
+	copied := make(map[string]*gocql.KeyspaceMetadata, len(keyspaces))
+	for name, ks := range keyspaces {
+		copied[name] = ks
+	}
+
+	return copied
+}
+
+func copyDefaultTTLs(ttls map[string]int64) map[string]int64 {
+	copied := make(map[string]int64, len(ttls))
+	for name, ttl := range ttls {
+		copied[name] = ttl
+	}
+
+	return copied
+}
+
+// copy returns a deep copy of the store. Cells are shared, as writes replace
+// them rather than change them.
+func (s *store) copy() *store {
+	copied := newStore()
+	for name, data := range s.tables {
+		partitions := make(map[string]*partition, len(data.partitions))
+		for key, p := range data.partitions {
+			partitions[key] = p.copy()
+		}
+		copied.tables[name] = &tableData{partitions: partitions}
+	}
+
+	return copied
+}
+
+func (p *partition) copy() *partition {
+	copied := *p
+	copied.ranges = append([]rangeTombstone(nil), p.ranges...)
+	copied.static = p.static.copy()
+	copied.rows = make([]*row, len(p.rows))
+	for i, r := range p.rows {
+		copied.rows[i] = r.copy()
+	}
+
+	return &copied
+}
+
+func (r *row) copy() *row {
+	copied := *r
+	copied.cells = make(map[string]*cell, len(r.cells))
+	for column, c := range r.cells {
+		copied.cells[column] = c
+	}
+
+	return &copied
+}
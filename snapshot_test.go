@@ -0,0 +1,90 @@
+package gocqlxmock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func (sut fakeSut) names(t *testing.T) []string {
+	var names []string
+	if err := sut.session.Query("SELECT name FROM potato", nil).Select(&names); err != nil {
+		t.Fatal(err)
+	}
+
+	return names
+}
+
+func Test_FakeSessionx_Snapshot(t *testing.T) {
+	t.Run("Should restore the data of the snapshot", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		sut.insert(t, potato{1, 1, "potato"}, 100)
+		snapshot := sut.session.Snapshot()
+
+		// act
+		sut.insert(t, potato{1, 1, "tomato"}, 200)
+		sut.insert(t, potato{2, 1, "carrot"}, 200)
+		sut.session.Restore(snapshot)
+		first := sut.names(t)
+		_ = sut.session.ExecStmt("DELETE FROM potato WHERE id = 1")
+		sut.session.Restore(snapshot)
+
+		// assert
+		assert.Equal(t, []string{"potato"}, first)
+		assert.Equal(t, []string{"potato"}, sut.names(t))
+	})
+
+	t.Run("Should restore the schema of the snapshot", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		snapshot := sut.session.Snapshot()
+
+		// act
+		_ = sut.session.ExecStmt("DROP TABLE potato")
+		_ = sut.session.ExecStmt("CREATE TABLE tomato (id int PRIMARY KEY)")
+		sut.session.Restore(snapshot)
+
+		// assert
+		_, errPotato := sut.session.Schema().Table("ks", "potato")
+		_, errTomato := sut.session.Schema().Table("ks", "tomato")
+		assert.NoError(t, errPotato)
+		assert.EqualError(t, errTomato, "unconfigured table tomato")
+	})
+
+	t.Run("Should keep writes after a restore newer than the snapshot", func(t *testing.T) {
+		// arrange
+		sut := makeFakeSut(t)
+		_ = sut.session.ExecStmt("INSERT INTO potato (id, day, name) VALUES (1, 1, 'potato')")
+		snapshot := sut.session.Snapshot()
+		_ = sut.session.ExecStmt("INSERT INTO potato (id, day, name) VALUES (1, 1, 'tomato')")
+		sut.session.Restore(snapshot)
+
+		// act
+		err := sut.session.ExecStmt("INSERT INTO potato (id, day, name) VALUES (1, 1, 'carrot')")
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"carrot"}, sut.names(t))
+	})
+}
+
+func Test_FakeSessionx_Isolate(t *testing.T) {
+	sut := makeFakeSut(t)
+	sut.insert(t, potato{1, 1, "potato"}, 100)
+
+	for _, name := range []string{"tomato", "carrot"} {
+		t.Run("Should isolate the changes of subtest "+name, func(t *testing.T) {
+			// arrange
+			sut.session.Isolate(t)
+
+			// act
+			sut.insert(t, potato{2, 1, name}, 200)
+
+			// assert
+			assert.Equal(t, []string{"potato", name}, sut.names(t))
+		})
+	}
+
+	assert.Equal(t, []string{"potato"}, sut.names(t))
+}
@@ -0,0 +1,698 @@
+package gocqlxmock
+
+import (
+	"strings"
+)
+
+// termKind is the kind of a value in a DML statement.
+type termKind int
+
+const (
+	termMarker termKind = iota
+	termLiteral
+	termFunction
+	termList
+	termSet
+	termMap
+	termTuple
+	termUDT
+)
+
+// term is a value in a DML statement.
+type term struct {
+	kind termKind
+	// marker is the index of the bind value of a termMarker.
+	marker int
+	// literal is the token of a termLiteral.
+	literal token
+	// name is the name of a termFunction.
+	name string
+	// elems are the arguments of a termFunction, the elements of a
+	// collection, tuple or UDT literal, or the alternating keys and values
+	// of a map literal.
+	elems []term
+	// fields are the field names of a termUDT.
+	fields []string
+}
+
+func (t term) isNull() bool {
+	return t.kind == termLiteral && t.literal.is("null")
+}
+
+// relation is a restriction of a WHERE or IF clause.
+type relation struct {
+	column   string
+	operator string
+	value    term
+	// values are the values of an IN relation with a list of values.
+	values []term
+	// inMarker reports whether an IN relation is given a single bind marker
+	// holding the list of values.
+	inMarker bool
+}
+
+// using is the USING clause of a write.
+type using struct {
+	ttl       *term
+	timestamp *term
+}
+
+// assignment is an assignment of the SET clause of an UPDATE.
+type assignment struct {
+	column string
+	// operator is "=" for plain assignments, "+" or "-" for col = col + v
+	// and col = col - v, and "prepend" for col = v + col.
+	operator string
+	value    term
+	// key is the element of col[key] = v.
+	key *term
+}
+
+// selector is a selected column of a SELECT.
+type selector struct {
+	// function is "", "writetime", "ttl" or "count".
+	function string
+	column   string
+	alias    string
+}
+
+type selectStmt struct {
+	keyspace, table   string
+	distinct          bool
+	selectors         []selector
+	where             []relation
+	orderBy           []string
+	descending        []bool
+	limit             *term
+	perPartitionLimit *term
+	allowFiltering    bool
+}
+
+type insertStmt struct {
+	keyspace, table string
+	columns         []string
+	values          []term
+	ifNotExists     bool
+	using           using
+}
+
+type updateStmt struct {
+	keyspace, table string
+	using           using
+	assignments     []assignment
+	where           []relation
+	ifExists        bool
+	conditions      []relation
+}
+
+// deletion is a deleted column of a DELETE, or an element of it.
+type deletion struct {
+	column string
+	key    *term
+}
+
+type deleteStmt struct {
+	keyspace, table string
+	columns         []deletion
+	using           using
+	where           []relation
+	ifExists        bool
+	conditions      []relation
+}
+
+// dml is a parsed DML statement: a *selectStmt, *insertStmt, *updateStmt or
+// *deleteStmt, along with the number of bind markers in it.
+type dml struct {
+	stmt    interface{}
+	markers int
+}
+
+// parseDML parses a SELECT, INSERT, UPDATE or DELETE statement.
+func parseDML(stmt string) (dml, error) {
+	p, err := newParser(stmt)
+	if err != nil {
+		return dml{}, err
+	}
+
+	d := &dmlParser{parser: p}
+	var parsed interface{}
+	switch {
+	case p.accept("SELECT"):
+		parsed, err = d.selectStmt()
+	case p.accept("INSERT", "INTO"):
+		parsed, err = d.insertStmt()
+	case p.accept("UPDATE"):
+		parsed, err = d.updateStmt()
+	case p.accept("DELETE"):
+		parsed, err = d.deleteStmt()
+	default:
+		return dml{}, p.errorf("unsupported statement")
+	}
+	if err != nil {
+		return dml{}, err
+	}
+
+	if !p.done() {
+		return dml{}, p.errorf("extraneous input")
+	}
+
+	return dml{parsed, d.markers}, nil
+}
+
+type dmlParser struct {
+	*parser
+	markers int
+}
+
+func (d *dmlParser) selectStmt() (*selectStmt, error) {
+	s := &selectStmt{}
+	s.distinct = d.accept("DISTINCT")
+
+	if !d.accept("*") {
+		for {
+			sel, err := d.selector()
+			if err != nil {
+				return nil, err
+			}
+			s.selectors = append(s.selectors, sel)
+
+			if !d.accept(",") {
+				break
+			}
+		}
+	}
+
+	if err := d.expect("FROM"); err != nil {
+		return nil, err
+	}
+	var err error
+	if s.keyspace, s.table, err = d.name(); err != nil {
+		return nil, err
+	}
+
+	if d.accept("WHERE") {
+		if s.where, err = d.relations(); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.accept("ORDER", "BY") {
+		for {
+			column, err := d.ident()
+			if err != nil {
+				return nil, err
+			}
+			s.orderBy = append(s.orderBy, column)
+			descending := d.accept("DESC")
+			if !descending {
+				d.accept("ASC")
+			}
+			s.descending = append(s.descending, descending)
+
+			if !d.accept(",") {
+				break
+			}
+		}
+	}
+
+	if d.accept("PER", "PARTITION", "LIMIT") {
+		limit, err := d.term()
+		if err != nil {
+			return nil, err
+		}
+		s.perPartitionLimit = &limit
+	}
+
+	if d.accept("LIMIT") {
+		limit, err := d.term()
+		if err != nil {
+			return nil, err
+		}
+		s.limit = &limit
+	}
+
+	s.allowFiltering = d.accept("ALLOW", "FILTERING")
+
+	return s, nil
+}
+
+func (d *dmlParser) selector() (selector, error) {
+	var sel selector
+
+	switch {
+	case d.accept("COUNT", "(", "*", ")"):
+		sel.function = "count"
+	case d.accept("WRITETIME", "("), d.accept("TTL", "("):
+		sel.function = strings.ToLower(d.tokens[d.pos-2].text)
+
+		column, err := d.ident()
+		if err != nil {
+			return sel, err
+		}
+		sel.column = column
+
+		if err := d.expect(")"); err != nil {
+			return sel, err
+		}
+	default:
+		column, err := d.ident()
+		if err != nil {
+			return sel, err
+		}
+		sel.column = column
+	}
+
+	if d.accept("AS") {
+		alias, err := d.ident()
+		if err != nil {
+			return sel, err
+		}
+		sel.alias = alias
+	}
+
+	return sel, nil
+}
+
+func (d *dmlParser) insertStmt() (*insertStmt, error) {
+	s := &insertStmt{}
+
+	var err error
+	if s.keyspace, s.table, err = d.name(); err != nil {
+		return nil, err
+	}
+
+	if err := d.expect("("); err != nil {
+		return nil, err
+	}
+	for {
+		column, err := d.ident()
+		if err != nil {
+			return nil, err
+		}
+		s.columns = append(s.columns, column)
+
+		if !d.accept(",") {
+			break
+		}
+	}
+	if err := d.expect(")"); err != nil {
+		return nil, err
+	}
+
+	if err := d.expect("VALUES"); err != nil {
+		return nil, err
+	}
+	if err := d.expect("("); err != nil {
+		return nil, err
+	}
+	if s.values, err = d.terms(")"); err != nil {
+		return nil, err
+	}
+
+	if len(s.values) != len(s.columns) {
+		return nil, invalidf("Unmatched column names/values")
+	}
+
+	s.ifNotExists = d.accept("IF", "NOT", "EXISTS")
+	if s.using, err = d.using(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (d *dmlParser) updateStmt() (*updateStmt, error) {
+	s := &updateStmt{}
+
+	var err error
+	if s.keyspace, s.table, err = d.name(); err != nil {
+		return nil, err
+	}
+	if s.using, err = d.using(); err != nil {
+		return nil, err
+	}
+
+	if err := d.expect("SET"); err != nil {
+		return nil, err
+	}
+	for {
+		a, err := d.assignment()
+		if err != nil {
+			return nil, err
+		}
+		s.assignments = append(s.assignments, a)
+
+		if !d.accept(",") {
+			break
+		}
+	}
+
+	if err := d.expect("WHERE"); err != nil {
+		return nil, err
+	}
+	if s.where, err = d.relations(); err != nil {
+		return nil, err
+	}
+
+	s.ifExists, s.conditions, err = d.conditions()
+
+	return s, err
+}
+
+func (d *dmlParser) assignment() (assignment, error) {
+	a := assignment{operator: "="}
+
+	column, err := d.ident()
+	if err != nil {
+		return a, err
+	}
+	a.column = column
+
+	if d.accept("[") {
+		key, err := d.term()
+		if err != nil {
+			return a, err
+		}
+		a.key = &key
+
+		if err := d.expect("]"); err != nil {
+			return a, err
+		}
+	}
+
+	switch {
+	case d.accept("+="):
+		a.operator = "+"
+	case d.accept("-="):
+		a.operator = "-"
+	default:
+		if err := d.expect("="); err != nil {
+			return a, err
+		}
+
+		if a.key == nil && d.peek().kind != tokenMarker && identifier(d.peek()) == column && d.pos+1 < len(d.tokens) &&
+			(d.tokens[d.pos+1].is("+") || d.tokens[d.pos+1].is("-")) {
+			d.next()
+			a.operator = d.next().text
+		}
+	}
+
+	if a.value, err = d.term(); err != nil {
+		return a, err
+	}
+
+	if a.operator == "=" && a.key == nil && d.accept("+") {
+		if other, err := d.ident(); err != nil || other != column {
+			return a, invalidf("Only expressions of the form X = <value> + X are supported.")
+		}
+		a.operator = "prepend"
+	}
+
+	return a, nil
+}
+
+func (d *dmlParser) deleteStmt() (*deleteStmt, error) {
+	s := &deleteStmt{}
+
+	for !d.peek().is("FROM") {
+		column, err := d.ident()
+		if err != nil {
+			return nil, err
+		}
+
+		del := deletion{column: column}
+		if d.accept("[") {
+			key, err := d.term()
+			if err != nil {
+				return nil, err
+			}
+			del.key = &key
+
+			if err := d.expect("]"); err != nil {
+				return nil, err
+			}
+		}
+		s.columns = append(s.columns, del)
+
+		if !d.accept(",") {
+			break
+		}
+	}
+
+	if err := d.expect("FROM"); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if s.keyspace, s.table, err = d.name(); err != nil {
+		return nil, err
+	}
+	if s.using, err = d.using(); err != nil {
+		return nil, err
+	}
+
+	if err := d.expect("WHERE"); err != nil {
+		return nil, err
+	}
+	if s.where, err = d.relations(); err != nil {
+		return nil, err
+	}
+
+	s.ifExists, s.conditions, err = d.conditions()
+
+	return s, err
+}
+
+func (d *dmlParser) using() (using, error) {
+	var u using
+	if !d.accept("USING") {
+		return u, nil
+	}
+
+	for {
+		switch {
+		case d.accept("TTL"):
+			ttl, err := d.term()
+			if err != nil {
+				return u, err
+			}
+			u.ttl = &ttl
+		case d.accept("TIMESTAMP"):
+			timestamp, err := d.term()
+			if err != nil {
+				return u, err
+			}
+			u.timestamp = &timestamp
+		default:
+			return u, d.errorf("expecting TTL or TIMESTAMP")
+		}
+
+		if !d.accept("AND") {
+			return u, nil
+		}
+	}
+}
+
+func (d *dmlParser) conditions() (ifExists bool, conditions []relation, err error) {
+	if !d.accept("IF") {
+		return false, nil, nil
+	}
+
+	if d.accept("EXISTS") {
+		return true, nil, nil
+	}
+
+	conditions, err = d.relations()
+
+	return false, conditions, err
+}
+
+func (d *dmlParser) relations() ([]relation, error) {
+	var relations []relation
+
+	for {
+		r, err := d.relation()
+		if err != nil {
+			return nil, err
+		}
+		relations = append(relations, r)
+
+		if !d.accept("AND") {
+			return relations, nil
+		}
+	}
+}
+
+func (d *dmlParser) relation() (relation, error) {
+	var r relation
+
+	column, err := d.ident()
+	if err != nil {
+		return r, err
+	}
+	r.column = column
+
+	switch {
+	case d.accept("IN"):
+		r.operator = "IN"
+		if d.peek().kind == tokenMarker {
+			r.value, _ = d.term()
+			r.inMarker = true
+			return r, nil
+		}
+
+		if err := d.expect("("); err != nil {
+			return r, err
+		}
+		r.values, err = d.terms(")")
+		return r, err
+	case d.accept("CONTAINS", "KEY"):
+		r.operator = "CONTAINS KEY"
+	case d.accept("CONTAINS"):
+		r.operator = "CONTAINS"
+	default:
+		tok := d.next()
+		switch tok.text {
+		case "=", "<", "<=", ">", ">=", "!=":
+			r.operator = tok.text
+		default:
+			d.pos--
+			return r, d.errorf("expecting an operator")
+		}
+	}
+
+	r.value, err = d.term()
+
+	return r, err
+}
+
+// terms reads comma separated terms up to the closing symbol end.
+func (d *dmlParser) terms(end string) ([]term, error) {
+	var terms []term
+
+	for !d.accept(end) {
+		t, err := d.term()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, t)
+
+		if !d.accept(",") {
+			if err := d.expect(end); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	return terms, nil
+}
+
+func (d *dmlParser) term() (term, error) {
+	tok := d.peek()
+
+	switch {
+	case tok.kind == tokenMarker:
+		d.next()
+		d.markers++
+		return term{kind: termMarker, marker: d.markers - 1}, nil
+	case tok.isLiteral():
+		d.next()
+		return term{kind: termLiteral, literal: tok}, nil
+	case tok.is("["):
+		d.next()
+		elems, err := d.terms("]")
+		return term{kind: termList, elems: elems}, err
+	case tok.is("("):
+		d.next()
+		if _, ok := nativeTypes[strings.ToLower(d.peek().text)]; ok && d.peek().kind == tokenIdent &&
+			d.pos+1 < len(d.tokens) && d.tokens[d.pos+1].is(")") {
+			// a type hint, such as (int) ?
+			d.pos += 2
+			return d.term()
+		}
+		elems, err := d.terms(")")
+		return term{kind: termTuple, elems: elems}, err
+	case tok.is("{"):
+		d.next()
+		return d.braces()
+	case tok.kind == tokenIdent && d.pos+1 < len(d.tokens) && d.tokens[d.pos+1].is("("):
+		d.pos += 2
+		args, err := d.terms(")")
+		return term{kind: termFunction, name: strings.ToLower(tok.text), elems: args}, err
+	default:
+		return term{}, d.errorf("expecting a value")
+	}
+}
+
+// braces reads a set, map or UDT literal, whose opening brace was read.
+func (d *dmlParser) braces() (term, error) {
+	if d.accept("}") {
+		return term{kind: termSet}, nil
+	}
+
+	// UDT literals have identifiers as keys.
+	if tok := d.peek(); (tok.kind == tokenIdent || tok.kind == tokenQuotedIdent) && !tok.isLiteral() &&
+		d.pos+1 < len(d.tokens) && d.tokens[d.pos+1].is(":") {
+		t := term{kind: termUDT}
+		for {
+			field, err := d.ident()
+			if err != nil {
+				return t, err
+			}
+			if err := d.expect(":"); err != nil {
+				return t, err
+			}
+			value, err := d.term()
+			if err != nil {
+				return t, err
+			}
+			t.fields = append(t.fields, field)
+			t.elems = append(t.elems, value)
+
+			if !d.accept(",") {
+				break
+			}
+		}
+		return t, d.expect("}")
+	}
+
+	first, err := d.term()
+	if err != nil {
+		return term{}, err
+	}
+
+	if !d.accept(":") {
+		t := term{kind: termSet, elems: []term{first}}
+		for d.accept(",") {
+			elem, err := d.term()
+			if err != nil {
+				return t, err
+			}
+			t.elems = append(t.elems, elem)
+		}
+		return t, d.expect("}")
+	}
+
+	t := term{kind: termMap}
+	key := first
+	for {
+		value, err := d.term()
+		if err != nil {
+			return t, err
+		}
+		t.elems = append(t.elems, key, value)
+
+		if !d.accept(",") {
+			break
+		}
+		if key, err = d.term(); err != nil {
+			return t, err
+		}
+		if err := d.expect(":"); err != nil {
+			return t, err
+		}
+	}
+
+	return t, d.expect("}")
+}
@@ -0,0 +1,430 @@
+package gocqlxmock
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/gocql/gocql"
+)
+
+// noTimestamp is the timestamp of deletions that never happened.
+const noTimestamp = math.MinInt64
+
+// store holds the rows of the tables of a FakeSessionx. It is not safe for
+// concurrent use, the session serializes its statements.
+type store struct {
+	tables map[string]*tableData
+}
+
+func newStore() *store {
+	return &store{tables: map[string]*tableData{}}
+}
+
+// tableData holds the partitions of a table, by partition key.
+type tableData struct {
+	partitions map[string]*partition
+}
+
+func (s *store) table(table *gocql.TableMetadata, create bool) *tableData {
+	name := table.Keyspace + "." + table.Name
+
+	data, ok := s.tables[name]
+	if !ok && create {
+		data = &tableData{partitions: map[string]*partition{}}
+		s.tables[name] = data
+	}
+
+	return data
+}
+
+// prune drops the data of the tables and columns schema no longer has, so
+// that the ones created again with the same name start empty.
+func (s *store) prune(schema *Schema) {
+	for name, data := range s.tables {
+		keyspace, table, _ := strings.Cut(name, ".")
+		metadata, err := schema.Table(keyspace, table)
+		if err != nil {
+			delete(s.tables, name)
+			continue
+		}
+
+		for _, p := range data.partitions {
+			for _, r := range append([]*row{p.static}, p.rows...) {
+				for column := range r.cells {
+					if _, ok := metadata.Columns[column]; !ok {
+						delete(r.cells, column)
+					}
+				}
+			}
+		}
+	}
+}
+
+// partition holds the rows of a partition, in clustering order.
+type partition struct {
+	key      [][]byte
+	token    int64
+	deletion int64
+	ranges   []rangeTombstone
+	static   *row
+	rows     []*row
+}
+
+// rangeTombstone deletes the rows of a partition whose clustering key
+// satisfies its predicates, written up to its timestamp.
+type rangeTombstone struct {
+	predicates []predicate
+	timestamp  int64
+}
+
+func (tombstone rangeTombstone) covers(clustering [][]byte) bool {
+	for _, p := range tombstone.predicates {
+		i := p.column.ComponentIndex
+		if i >= len(clustering) || !p.test(clustering[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// row holds the cells of a row. Rows written by INSERT have a marker that
+// keeps them alive even when all their cells are null.
+type row struct {
+	clustering [][]byte
+	marker     *cell
+	deletion   int64
+	cells      map[string]*cell
+}
+
+// cell is a value, or the tombstone of a value, along with the timestamp of
+// the write. Cells written with a TTL expire at expires, in seconds since the
+// epoch like Cassandra counts them.
+type cell struct {
+	value     []byte
+	timestamp int64
+	deleted   bool
+	ttl       int64
+	expires   int64
+}
+
+// alive reports whether c holds a value at now, in seconds since the epoch.
+func (c *cell) alive(now int64) bool {
+	return !c.deleted && (c.expires == 0 || now < c.expires)
+}
+
+func newRow(clustering [][]byte) *row {
+	return &row{
+		clustering: clustering,
+		deletion:   noTimestamp,
+		cells:      map[string]*cell{},
+	}
+}
+
+// partitionKey returns the partition key of key values, as stored in a
+// tableData.
+func partitionKey(key [][]byte) string {
+	if len(key) == 1 {
+		return string(key[0])
+	}
+
+	var buf bytes.Buffer
+	for _, component := range key {
+		buf.WriteByte(byte(len(component) >> 8))
+		buf.WriteByte(byte(len(component)))
+		buf.Write(component)
+		buf.WriteByte(0)
+	}
+
+	return buf.String()
+}
+
+func (data *tableData) partition(key [][]byte, create bool) *partition {
+	id := partitionKey(key)
+
+	p, ok := data.partitions[id]
+	if !ok && create {
+		p = &partition{
+			key:      key,
+			token:    Murmur3Token([]byte(id)),
+			deletion: noTimestamp,
+			static:   newRow(nil),
+		}
+		data.partitions[id] = p
+	}
+
+	return p
+}
+
+// sortedPartitions returns the partitions in token order, like a full scan
+// of the ring does.
+func (data *tableData) sortedPartitions() []*partition {
+	partitions := make([]*partition, 0, len(data.partitions))
+	for _, p := range data.partitions {
+		partitions = append(partitions, p)
+	}
+
+	sort.Slice(partitions, func(i, j int) bool {
+		if partitions[i].token != partitions[j].token {
+			return partitions[i].token < partitions[j].token
+		}
+		return partitionKey(partitions[i].key) < partitionKey(partitions[j].key)
+	})
+
+	return partitions
+}
+
+// compareClustering orders clustering keys as table does, DESC columns
+// included.
+func compareClustering(table *gocql.TableMetadata, a, b [][]byte) int {
+	for i, column := range table.ClusteringColumns {
+		if i >= len(a) || i >= len(b) {
+			break
+		}
+
+		c := compareValues(column.Type, a[i], b[i])
+		if column.Order == gocql.DESC {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+
+	return 0
+}
+
+func (p *partition) row(table *gocql.TableMetadata, clustering [][]byte, create bool) *row {
+	if len(table.ClusteringColumns) == 0 {
+		clustering = nil
+	}
+
+	i := sort.Search(len(p.rows), func(i int) bool {
+		return compareClustering(table, p.rows[i].clustering, clustering) >= 0
+	})
+	if i < len(p.rows) && compareClustering(table, p.rows[i].clustering, clustering) == 0 {
+		return p.rows[i]
+	}
+	if !create {
+		return nil
+	}
+
+	r := newRow(clustering)
+	p.rows = append(p.rows, nil)
+	copy(p.rows[i+1:], p.rows[i:])
+	p.rows[i] = r
+
+	return r
+}
+
+// shadow returns the timestamp of the newest deletion covering r.
+func (p *partition) shadow(r *row) int64 {
+	shadow := p.deletion
+	if r == nil || r == p.static {
+		return shadow
+	}
+
+	if r.deletion > shadow {
+		shadow = r.deletion
+	}
+	for _, tombstone := range p.ranges {
+		if tombstone.timestamp > shadow && tombstone.covers(r.clustering) {
+			shadow = tombstone.timestamp
+		}
+	}
+
+	return shadow
+}
+
+// supersedes reports whether a wins over b when both are written to the
+// same cell at now: the newest write wins and, on a tie, deletions and
+// expired values win over values, expiring values over the others, the
+// latest expiring ones first, then greater values win over smaller ones, as
+// in Cassandra.
+func (a *cell) supersedes(b *cell, now int64) bool {
+	switch {
+	case b == nil:
+		return true
+	case a.timestamp != b.timestamp:
+		return a.timestamp > b.timestamp
+	case a.alive(now) != b.alive(now):
+		return !a.alive(now)
+	case a.expires != b.expires && (a.expires == 0 || b.expires == 0):
+		return b.expires == 0
+	case a.expires != b.expires:
+		return a.expires > b.expires
+	default:
+		return bytes.Compare(a.value, b.value) > 0
+	}
+}
+
+// write writes c to column of r, unless it is shadowed by a newer deletion
+// or loses to the cell already there.
+func (p *partition) write(r *row, column string, c cell, now int64) {
+	if c.timestamp <= p.shadow(r) {
+		return
+	}
+
+	if c.supersedes(r.cells[column], now) {
+		r.cells[column] = &c
+	}
+}
+
+// add adds delta to the counter column of r, unless the increment is
+// shadowed by a newer deletion. Counters sum their increments instead of
+// resolving them by last-write-wins.
+func (p *partition) add(r *row, column string, delta, timestamp int64) {
+	if timestamp <= p.shadow(r) {
+		return
+	}
+
+	ts := timestamp
+	if c := r.cells[column]; c != nil && c.deleted {
+		if c.timestamp >= timestamp {
+			return
+		}
+	} else if c != nil {
+		var value int64
+		_ = gocql.Unmarshal(nativeType(gocql.TypeCounter), c.value, &value)
+		delta += value
+		if c.timestamp > ts {
+			ts = c.timestamp
+		}
+	}
+
+	data, _ := gocql.Marshal(nativeType(gocql.TypeCounter), delta)
+	r.cells[column] = &cell{value: data, timestamp: ts}
+}
+
+// update applies ops to the elements of the collection column of r, unless
+// they are shadowed by a newer deletion. Like counters, elements merge with
+// the live value instead of resolving by last-write-wins, the cell keeping
+// the newest timestamp and, when c has none, the TTL of the value.
+func (p *partition) update(r *row, column *gocql.ColumnMetadata, ops []collectionOp, c cell, now int64) {
+	if c.timestamp <= p.shadow(r) {
+		return
+	}
+
+	var current []byte
+	if old := r.cells[column.Name]; old != nil && old.alive(now) {
+		current = old.value
+		if old.timestamp > c.timestamp {
+			c.timestamp = old.timestamp
+		}
+		if c.expires == 0 {
+			c.ttl, c.expires = old.ttl, old.expires
+		}
+	} else if old != nil && old.timestamp >= c.timestamp {
+		return
+	}
+
+	value, err := applyOps(column.Type.(gocql.CollectionType), current, ops)
+	if err != nil {
+		return
+	}
+	c.value, c.deleted = value, value == nil
+	if c.deleted {
+		c.ttl, c.expires = 0, 0
+	}
+	r.cells[column.Name] = &c
+}
+
+// mark writes the row marker of an INSERT to r.
+func (p *partition) mark(r *row, c cell, now int64) {
+	if c.timestamp <= p.shadow(r) {
+		return
+	}
+
+	if c.supersedes(r.marker, now) {
+		r.marker = &c
+	}
+}
+
+// deleteRow deletes the cells of r written up to timestamp.
+func (p *partition) deleteRow(r *row, timestamp int64) {
+	if timestamp > r.deletion {
+		r.deletion = timestamp
+	}
+	r.purge(r.deletion)
+}
+
+// deleteRange deletes the rows covered by tombstone.
+func (p *partition) deleteRange(tombstone rangeTombstone) {
+	p.ranges = append(p.ranges, tombstone)
+
+	for _, r := range p.rows {
+		if tombstone.covers(r.clustering) {
+			r.purge(tombstone.timestamp)
+		}
+	}
+}
+
+// deletePartition deletes the cells of p written up to timestamp.
+func (p *partition) deletePartition(timestamp int64) {
+	if timestamp > p.deletion {
+		p.deletion = timestamp
+	}
+
+	p.static.purge(p.deletion)
+	for _, r := range p.rows {
+		r.purge(p.deletion)
+	}
+}
+
+// purge drops the cells of r written up to timestamp.
+func (r *row) purge(timestamp int64) {
+	if r.marker != nil && r.marker.timestamp <= timestamp {
+		r.marker = nil
+	}
+
+	for column, c := range r.cells {
+		if c.timestamp <= timestamp {
+			delete(r.cells, column)
+		}
+	}
+}
+
+// value returns the live value of column in r at now, nil when there is
+// none.
+func (r *row) value(column string, now int64) []byte {
+	c := r.live(column, now)
+	if c == nil {
+		return nil
+	}
+
+	return c.value
+}
+
+// live returns the cell of column in r, nil when it is null at now.
+func (r *row) live(column string, now int64) *cell {
+	if r == nil {
+		return nil
+	}
+
+	c, ok := r.cells[column]
+	if !ok || !c.alive(now) {
+		return nil
+	}
+
+	return c
+}
+
+// exists reports whether r has a live marker or cell at now.
+func (r *row) exists(now int64) bool {
+	if r == nil {
+		return false
+	}
+	if r.marker != nil && r.marker.alive(now) {
+		return true
+	}
+
+	for column := range r.cells {
+		if r.live(column, now) != nil {
+			return true
+		}
+	}
+
+	return false
+}
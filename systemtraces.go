@@ -0,0 +1,520 @@
+package gocqlxmock
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// systemTracesAddr is the address the session of a SystemTraces connects to.
+var systemTracesAddr = &net.TCPAddr{IP: net.ParseIP(FakeCoordinator), Port: 9042}
+
+// systemTracesSessions maps the addresses of the sessions of the open
+// SystemTraces to them.
+var systemTracesSessions sync.Map
+
+// SystemTraces serves the synthetic traces of queries from the
+// system_traces tables of a real gocql.Session, the way Scylla serves the
+// traces of queries run with tracing. It lets the tracers created by
+// gocql.NewTraceWriter write them: queries traced by such a tracer on the
+// session of a SystemTraces store their traces in it.
+type SystemTraces struct {
+	mu       sync.Mutex
+	sessions map[string]TraceSession
+	session  *gocql.Session
+}
+
+// NewSystemTraces returns a SystemTraces, whose session talks to an
+// in-process node instead of a cluster. It must be closed once done with.
+func NewSystemTraces() (*SystemTraces, error) {
+	traces := &SystemTraces{sessions: map[string]TraceSession{}}
+
+	cluster := gocql.NewCluster(FakeCoordinator)
+	cluster.ProtoVersion = 4
+	cluster.NumConns = 1
+	cluster.ReconnectInterval = 0
+	cluster.DisableInitialHostLookup = true
+	cluster.Events.DisableTopologyEvents = true
+	cluster.Events.DisableNodeStatusEvents = true
+	cluster.Events.DisableSchemaEvents = true
+	cluster.Dialer = systemTracesDialer{traces}
+
+	session, err := cluster.CreateSession()
+	if err != nil {
+		return nil, err
+	}
+	traces.session = session
+	systemTracesSessions.Store(reflect.ValueOf(session).Pointer(), traces)
+
+	return traces, nil
+}
+
+// Session returns the session to create the trace writers with.
+func (traces *SystemTraces) Session() *gocql.Session {
+	return traces.session
+}
+
+// Close closes the session of traces.
+func (traces *SystemTraces) Close() {
+	systemTracesSessions.Delete(reflect.ValueOf(traces.session).Pointer())
+	traces.session.Close()
+}
+
+// store keeps session in system_traces.
+func (traces *SystemTraces) store(session TraceSession) {
+	traces.mu.Lock()
+	defer traces.mu.Unlock()
+
+	traces.sessions[string(session.ID)] = session
+}
+
+func (traces *SystemTraces) lookup(id []byte) (TraceSession, bool) {
+	traces.mu.Lock()
+	defer traces.mu.Unlock()
+
+	session, ok := traces.sessions[string(id)]
+
+	return session, ok
+}
+
+// tracedSystem returns the SystemTraces tracer writes the traces of, if it
+// was created by gocql.NewTraceWriter on the session of one.
+func tracedSystem(tracer gocql.Tracer) *SystemTraces {
+	if reflect.TypeOf(tracer) != gocqlTraceWriterType {
+		return nil
+	}
+
+	session := reflect.ValueOf(tracer).Elem().FieldByName("session").Pointer()
+	traces, ok := systemTracesSessions.Load(session)
+	if !ok {
+		return nil
+	}
+
+	return traces.(*SystemTraces)
+}
+
+// gocqlTraceWriterType is the type of the tracers created by
+// gocql.NewTraceWriter.
+var gocqlTraceWriterType = reflect.TypeOf(gocql.NewTraceWriter(nil, nil))
+
+// systemTracesDialer connects the session of a SystemTraces to its node.
+type systemTracesDialer struct {
+	traces *SystemTraces
+}
+
+func (dialer systemTracesDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, server := net.Pipe()
+	go (&traceNode{traces: dialer.traces, conn: server}).serve()
+
+	return pipeConn{client}, nil
+}
+
+// pipeConn is a net.Pipe connection reporting a TCP address, as gocql reads
+// the port of its node from it.
+type pipeConn struct {
+	net.Conn
+}
+
+func (conn pipeConn) RemoteAddr() net.Addr {
+	return systemTracesAddr
+}
+
+// Opcodes, result kinds and error codes of the native protocol v4.
+const (
+	opError     = 0x00
+	opStartup   = 0x01
+	opReady     = 0x02
+	opOptions   = 0x05
+	opSupported = 0x06
+	opQuery     = 0x07
+	opResult    = 0x08
+	opPrepare   = 0x09
+	opExecute   = 0x0a
+	opRegister  = 0x0b
+
+	resultRows     = 0x0002
+	resultPrepared = 0x0004
+
+	errCodeInvalid  = 0x2200
+	errCodeProtocol = 0x000a
+)
+
+// Types of the native protocol v4.
+const (
+	typeInt      = 0x0009
+	typeUUID     = 0x000c
+	typeVarchar  = 0x000d
+	typeTimeUUID = 0x000f
+	typeInet     = 0x0010
+)
+
+// flagGlobalTableSpec tells every column of a result is in the same table.
+const flagGlobalTableSpec = 0x0001
+
+// traceTable is a table of system_traces, or of system, a node answers
+// SELECTs of.
+type traceTable struct {
+	keyspace string
+	name     string
+	// columns are the names and types of the selected columns.
+	columns []traceColumn
+	// bySession tells the statement binds the session_id it selects.
+	bySession bool
+	rows      func(traces *SystemTraces, id []byte) [][][]byte
+}
+
+type traceColumn struct {
+	name string
+	typ  uint16
+}
+
+var traceTables = []traceTable{
+	{
+		keyspace: "system",
+		name:     "local",
+		columns: []traceColumn{
+			{"key", typeVarchar},
+			{"data_center", typeVarchar},
+			{"rack", typeVarchar},
+			{"release_version", typeVarchar},
+		},
+		rows: func(*SystemTraces, []byte) [][][]byte {
+			return [][][]byte{{[]byte("local"), []byte("datacenter1"), []byte("rack1"), []byte("3.0.8")}}
+		},
+	},
+	{
+		keyspace: "system_traces",
+		name:     "sessions",
+		columns: []traceColumn{
+			{"coordinator", typeInet},
+			{"duration", typeInt},
+		},
+		bySession: true,
+		rows: func(traces *SystemTraces, id []byte) [][][]byte {
+			session, ok := traces.lookup(id)
+			if !ok {
+				return nil
+			}
+
+			return [][][]byte{{inet(session.Coordinator), cqlInt(int(session.Duration / time.Microsecond))}}
+		},
+	},
+	{
+		keyspace: "system_traces",
+		name:     "events",
+		columns: []traceColumn{
+			{"event_id", typeTimeUUID},
+			{"activity", typeVarchar},
+			{"source", typeInet},
+			{"source_elapsed", typeInt},
+		},
+		bySession: true,
+		rows: func(traces *SystemTraces, id []byte) [][][]byte {
+			session, _ := traces.lookup(id)
+
+			var rows [][][]byte
+			for _, event := range session.Events {
+				eventID := gocql.UUIDFromTime(event.Timestamp)
+				rows = append(rows, [][]byte{eventID[:], []byte(event.Activity), inet(event.Source), cqlInt(event.Elapsed)})
+			}
+
+			return rows
+		},
+	},
+}
+
+// traceNode serves a connection of the session of a SystemTraces, speaking
+// just enough of the native protocol v4 for gocql to connect and read
+// system_traces.
+type traceNode struct {
+	traces *SystemTraces
+	conn   net.Conn
+	// prepared are the tables of the prepared statements, by ID.
+	prepared []traceTable
+}
+
+func (node *traceNode) serve() {
+	defer node.conn.Close()
+
+	header := make([]byte, 9)
+	for {
+		if _, err := io.ReadFull(node.conn, header); err != nil {
+			return
+		}
+		body := make([]byte, binary.BigEndian.Uint32(header[5:]))
+		if _, err := io.ReadFull(node.conn, body); err != nil {
+			return
+		}
+
+		op, response := node.respond(header[4], body)
+
+		frame := []byte{0x84, 0, header[2], header[3], op, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(frame[5:], uint32(len(response)))
+		if _, err := node.conn.Write(append(frame, response...)); err != nil {
+			return
+		}
+	}
+}
+
+// respond returns the opcode and body of the response to the request op
+// with body.
+func (node *traceNode) respond(op byte, body []byte) (byte, []byte) {
+	var w frameWriter
+
+	switch op {
+	case opOptions:
+		w.short(1)
+		w.string("CQL_VERSION")
+		w.short(1)
+		w.string("3.4.4")
+
+		return opSupported, w.Bytes()
+	case opStartup, opRegister:
+		return opReady, nil
+	case opPrepare:
+		r := frameReader{body: body}
+		stmt := r.longString()
+		table, ok := lookupTraceTable(stmt)
+		if r.err != nil || !ok {
+			return node.error(errCodeInvalid, "unconfigured table: "+stmt)
+		}
+		node.prepared = append(node.prepared, table)
+
+		w.int(resultPrepared)
+		w.shortBytes(cqlInt(len(node.prepared) - 1))
+		var binds []traceColumn
+		if table.bySession {
+			binds = []traceColumn{{"session_id", typeUUID}}
+		}
+		w.metadata(table, binds, true)
+		w.metadata(table, table.columns, false)
+
+		return opResult, w.Bytes()
+	case opQuery:
+		r := frameReader{body: body}
+		stmt := r.longString()
+		values := r.queryValues()
+		table, ok := lookupTraceTable(stmt)
+		if r.err != nil || !ok {
+			return node.error(errCodeInvalid, "unconfigured table: "+stmt)
+		}
+
+		return node.rows(table, values)
+	case opExecute:
+		r := frameReader{body: body}
+		id := r.shortBytes()
+		values := r.queryValues()
+		if r.err != nil || len(id) != 4 || int(binary.BigEndian.Uint32(id)) >= len(node.prepared) {
+			return node.error(errCodeProtocol, "unknown prepared statement")
+		}
+
+		return node.rows(node.prepared[binary.BigEndian.Uint32(id)], values)
+	}
+
+	return node.error(errCodeProtocol, "unsupported request")
+}
+
+// rows returns the result of selecting the rows of table, of the session
+// whose ID is bound in values when the table is selected by session.
+func (node *traceNode) rows(table traceTable, values [][]byte) (byte, []byte) {
+	var sessionID []byte
+	if table.bySession && len(values) == 1 {
+		sessionID = values[0]
+	}
+	rows := table.rows(node.traces, sessionID)
+
+	var w frameWriter
+	w.int(resultRows)
+	w.metadata(table, table.columns, false)
+	w.int(len(rows))
+	for _, row := range rows {
+		for _, cell := range row {
+			w.bytes(cell)
+		}
+	}
+
+	return opResult, w.Bytes()
+}
+
+func (node *traceNode) error(code int, message string) (byte, []byte) {
+	var w frameWriter
+	w.int(code)
+	w.string(message)
+
+	return opError, w.Bytes()
+}
+
+// lookupTraceTable returns the table a node answers stmt with.
+func lookupTraceTable(stmt string) (traceTable, bool) {
+	fields := strings.Fields(strings.ToLower(stmt))
+	for i, field := range fields {
+		if field != "from" || i+1 == len(fields) {
+			continue
+		}
+		for _, table := range traceTables {
+			if fields[i+1] == table.keyspace+"."+table.name {
+				return table, true
+			}
+		}
+	}
+
+	return traceTable{}, false
+}
+
+func inet(ip string) []byte {
+	if v4 := net.ParseIP(ip).To4(); v4 != nil {
+		return v4
+	}
+
+	return net.ParseIP(ip)
+}
+
+func cqlInt(n int) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(n))
+
+	return b
+}
+
+// frameWriter writes the body of a frame.
+type frameWriter struct {
+	bytes.Buffer
+}
+
+func (w *frameWriter) int(n int) {
+	w.Write(cqlInt(n))
+}
+
+func (w *frameWriter) short(n int) {
+	w.Write([]byte{byte(n >> 8), byte(n)})
+}
+
+func (w *frameWriter) string(s string) {
+	w.short(len(s))
+	w.WriteString(s)
+}
+
+func (w *frameWriter) shortBytes(b []byte) {
+	w.short(len(b))
+	w.Write(b)
+}
+
+func (w *frameWriter) bytes(b []byte) {
+	if b == nil {
+		w.int(-1)
+		return
+	}
+	w.int(len(b))
+	w.Write(b)
+}
+
+// metadata writes the metadata of columns of table, with the partition key
+// indexes of prepared metadata when prepared.
+func (w *frameWriter) metadata(table traceTable, columns []traceColumn, prepared bool) {
+	if len(columns) == 0 {
+		w.int(0)
+		w.int(0)
+		if prepared {
+			w.int(0)
+		}
+		return
+	}
+
+	w.int(flagGlobalTableSpec)
+	w.int(len(columns))
+	if prepared {
+		w.int(0)
+	}
+	w.string(table.keyspace)
+	w.string(table.name)
+	for _, column := range columns {
+		w.string(column.name)
+		w.short(int(column.typ))
+	}
+}
+
+// frameReader reads the body of a frame, keeping the first error.
+type frameReader struct {
+	body []byte
+	err  error
+}
+
+var errShortFrame = errors.New("gocqlxmock: frame too short")
+
+func (r *frameReader) next(n int) []byte {
+	if r.err != nil || n < 0 || n > len(r.body) {
+		r.err = errShortFrame
+		return nil
+	}
+	b := r.body[:n]
+	r.body = r.body[n:]
+
+	return b
+}
+
+func (r *frameReader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+
+	return 0
+}
+
+func (r *frameReader) short() int {
+	if b := r.next(2); b != nil {
+		return int(binary.BigEndian.Uint16(b))
+	}
+
+	return 0
+}
+
+func (r *frameReader) int() int {
+	if b := r.next(4); b != nil {
+		return int(int32(binary.BigEndian.Uint32(b)))
+	}
+
+	return 0
+}
+
+// queryValues reads the query parameters of a QUERY or EXECUTE request,
+// returning their bound values.
+func (r *frameReader) queryValues() [][]byte {
+	r.short()
+	flags := r.byte()
+	if flags&0x01 == 0 {
+		return nil
+	}
+
+	var values [][]byte
+	for n := r.short(); n > 0; n-- {
+		values = append(values, r.bytes())
+	}
+
+	return values
+}
+
+func (r *frameReader) longString() string {
+	return string(r.next(r.int()))
+}
+
+func (r *frameReader) shortBytes() []byte {
+	return r.next(r.short())
+}
+
+func (r *frameReader) bytes() []byte {
+	n := r.int()
+	if n < 0 {
+		return nil
+	}
+
+	return r.next(n)
+}
@@ -0,0 +1,161 @@
+package gocqlxmock
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// FakeCoordinator is the coordinator reported by synthetic traces.
+const FakeCoordinator = "127.0.0.1"
+
+// TraceSession is a synthetic record of system_traces.sessions for a traced
+// query, along with its records of system_traces.events.
+type TraceSession struct {
+	ID          []byte
+	Coordinator string
+	Duration    time.Duration
+	Events      []TraceEvent
+}
+
+// TraceEvent is a synthetic record of system_traces.events.
+type TraceEvent struct {
+	Timestamp time.Time
+	Activity  string
+	Source    string
+	Elapsed   int
+}
+
+// TraceWriter is a gocql.Tracer that writes the synthetic traces of queries
+// in the format of the tracer returned by gocql.NewTraceWriter.
+type TraceWriter struct {
+	mu       sync.Mutex
+	w        io.Writer
+	sessions map[string]TraceSession
+}
+
+// NewTraceWriter returns a TraceWriter writing to w.
+func NewTraceWriter(w io.Writer) *TraceWriter {
+	return &TraceWriter{w: w}
+}
+
+// Trace writes the synthetic trace of traceID, which the queries tracing to
+// the writer hand it, like gocql reads it from system_traces.
+func (tw *TraceWriter) Trace(traceID []byte) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	session, ok := tw.sessions[string(traceID)]
+	if !ok {
+		fmt.Fprintln(tw.w, "Error:", gocql.ErrNotFound)
+		return
+	}
+	delete(tw.sessions, string(traceID))
+
+	writeTrace(tw.w, session)
+}
+
+// store keeps session until its ID is traced.
+func (tw *TraceWriter) store(session TraceSession) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.sessions == nil {
+		tw.sessions = map[string]TraceSession{}
+	}
+	tw.sessions[string(session.ID)] = session
+}
+
+// Traces returns the synthetic traces of the query, one per attempt of its
+// terminal calls, in attempt order.
+func (mock *QueryxMock) Traces() []TraceSession {
+	mock.state.mu.Lock()
+	defer mock.state.mu.Unlock()
+
+	return append([]TraceSession(nil), mock.state.traces...)
+}
+
+// trace feeds the tracer of the query with a synthetic trace of an attempt
+// that ran from start to end, as gocql traces every attempt of a query.
+func (mock *QueryxMock) trace(start, end time.Time) {
+	mock.state.mu.Lock()
+	tracer := mock.state.tracer
+	mock.state.mu.Unlock()
+
+	if tracer == nil {
+		return
+	}
+
+	root := mock.root()
+	root.state.mu.Lock()
+	root.state.traced++
+	n := root.state.traced
+	root.state.mu.Unlock()
+
+	stmt := mock.statement()
+	session := syntheticTrace(traceID(stmt, n), stmt, start, end)
+
+	mock.state.mu.Lock()
+	mock.state.traces = append(mock.state.traces, session)
+	mock.state.mu.Unlock()
+
+	if tw, ok := tracer.(*TraceWriter); ok {
+		tw.store(session)
+	} else if traces := tracedSystem(tracer); traces != nil {
+		traces.store(session)
+	}
+	tracer.Trace(session.ID)
+}
+
+// traceID returns a deterministic, name based, UUID for the n-th trace of
+// stmt.
+func traceID(stmt string, n int) []byte {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s#%d", stmt, n)))
+
+	id := sum[:16]
+	id[6] = (id[6] & 0x0f) | 0x50
+	id[8] = (id[8] & 0x3f) | 0x80
+
+	return id
+}
+
+func syntheticTrace(id []byte, stmt string, start, end time.Time) TraceSession {
+	duration := end.Sub(start)
+	activities := []string{
+		"Parsing " + stmt,
+		"Preparing statement",
+		"Executing query",
+		"Request complete",
+	}
+
+	session := TraceSession{
+		ID:          id,
+		Coordinator: FakeCoordinator,
+		Duration:    duration,
+	}
+	for i, activity := range activities {
+		elapsed := duration * time.Duration(i) / time.Duration(len(activities)-1)
+		session.Events = append(session.Events, TraceEvent{
+			Timestamp: start.Add(elapsed),
+			Activity:  activity,
+			Source:    FakeCoordinator,
+			Elapsed:   int(elapsed / time.Microsecond),
+		})
+	}
+
+	return session
+}
+
+func writeTrace(w io.Writer, session TraceSession) {
+	fmt.Fprintf(w, "Tracing session %016x (coordinator: %s, duration: %v):\n",
+		session.ID, session.Coordinator, session.Duration.Truncate(time.Microsecond))
+
+	for _, event := range session.Events {
+		fmt.Fprintf(w, "%s: %s (source: %s, elapsed: %d)\n",
+			event.Timestamp.Format("2006/01/02 15:04:05.999999"), event.Activity, event.Source, event.Elapsed)
+	}
+}
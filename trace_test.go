@@ -0,0 +1,142 @@
+package gocqlxmock
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type tracerSpy struct {
+	ids [][]byte
+}
+
+func (spy *tracerSpy) Trace(traceID []byte) {
+	spy.ids = append(spy.ids, traceID)
+}
+
+type traceSut struct {
+	stmt      string
+	querymock *QueryxMock
+}
+
+func makeTraceSut() traceSut {
+	stmt := "SELECT name FROM potato WHERE id = ?"
+	querymock := &QueryxMock{Stmt: stmt}
+	querymock.On("Trace", mock.Anything).Return(querymock)
+	querymock.On("Exec").Return(nil)
+
+	return traceSut{
+		stmt,
+		querymock,
+	}
+}
+
+func Test_Queryx_TraceSimulation(t *testing.T) {
+	t.Run("Should call the tracer with a deterministic trace ID on terminal calls", func(t *testing.T) {
+		// arrange
+		first := makeTraceSut()
+		second := makeTraceSut()
+		firstSpy := &tracerSpy{}
+		secondSpy := &tracerSpy{}
+
+		// act
+		_ = first.querymock.Trace(firstSpy).Exec()
+		_ = first.querymock.Exec()
+		_ = second.querymock.Trace(secondSpy).Exec()
+
+		// assert
+		assert.Len(t, firstSpy.ids, 2)
+		assert.Len(t, firstSpy.ids[0], 16)
+		assert.NotEqual(t, firstSpy.ids[0], firstSpy.ids[1])
+		assert.Equal(t, firstSpy.ids[0], secondSpy.ids[0])
+		assert.Equal(t, firstSpy.ids, [][]byte{first.querymock.Traces()[0].ID, first.querymock.Traces()[1].ID})
+	})
+
+	t.Run("Should write synthetic sessions and events to a TraceWriter", func(t *testing.T) {
+		// arrange
+		sut := makeTraceSut()
+		var buf bytes.Buffer
+
+		// act
+		_ = sut.querymock.Trace(NewTraceWriter(&buf)).Exec()
+
+		// assert
+		trace := sut.querymock.Traces()[0]
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		assert.Len(t, lines, 5)
+		assert.Equal(t, fmt.Sprintf("Tracing session %016x (coordinator: 127.0.0.1, duration: %v):", trace.ID, trace.Duration.Truncate(1000)), lines[0])
+		assert.Contains(t, lines[1], "Parsing "+sut.stmt+" (source: 127.0.0.1, elapsed: 0)")
+		assert.Contains(t, lines[4], "Request complete")
+		assert.Equal(t, FakeCoordinator, trace.Coordinator)
+		assert.Len(t, trace.Events, 4)
+	})
+
+	t.Run("Should forget the traces a TraceWriter wrote", func(t *testing.T) {
+		// arrange
+		sut := makeTraceSut()
+		var buf bytes.Buffer
+		tw := NewTraceWriter(&buf)
+
+		// act
+		_ = sut.querymock.Trace(tw).Exec()
+		buf.Reset()
+		tw.Trace(sut.querymock.Traces()[0].ID)
+
+		// assert
+		assert.Equal(t, "Error: not found\n", buf.String())
+		assert.Empty(t, tw.sessions)
+	})
+
+	t.Run("Should write synthetic sessions and events to gocql trace writers on a SystemTraces session", func(t *testing.T) {
+		// arrange
+		sut := makeTraceSut()
+		traces, err := NewSystemTraces()
+		assert.NoError(t, err)
+		defer traces.Close()
+		var want, got bytes.Buffer
+
+		// act
+		_ = sut.querymock.Trace(gocql.NewTraceWriter(traces.Session(), &got)).Exec()
+
+		// assert
+		writeTrace(&want, sut.querymock.Traces()[0])
+		assert.Equal(t, want.String(), got.String())
+		assert.Len(t, strings.Split(strings.TrimSpace(got.String()), "\n"), 5)
+	})
+
+	t.Run("Should trace every attempt of a terminal call", func(t *testing.T) {
+		// arrange
+		stmt := "SELECT name FROM potato WHERE id = ?"
+		querymock := &QueryxMock{Stmt: stmt}
+		querymock.On("Trace", mock.Anything).Return(querymock)
+		querymock.On("RetryPolicy", mock.Anything).Return(querymock)
+		querymock.On("Exec").Return(gocql.ErrTimeoutNoResponse).Once()
+		querymock.On("Exec").Return(nil).Once()
+		spy := &tracerSpy{}
+
+		// act
+		err := querymock.Trace(spy).RetryPolicy(&gocql.SimpleRetryPolicy{NumRetries: 1}).Exec()
+
+		// assert
+		assert.NoError(t, err)
+		assert.Len(t, spy.ids, 2)
+		assert.Len(t, querymock.Traces(), 2)
+		assert.NotEqual(t, spy.ids[0], spy.ids[1])
+	})
+
+	t.Run("Should report unknown trace IDs on a TraceWriter", func(t *testing.T) {
+		// arrange
+		var buf bytes.Buffer
+
+		// act
+		NewTraceWriter(&buf).Trace([]byte("unknown"))
+
+		// assert
+		assert.Equal(t, "Error: not found\n", buf.String())
+	})
+}
@@ -0,0 +1,264 @@
+package gocqlxmock
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Guilospanck/igocqlx"
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/mock"
+)
+
+// Transcript returns the calls made on the session, in order, in a stable
+// text format meant for AssertGolden. The calls made on each query or batch
+// it handed out are written under the Query, ContextQuery or NewBatch call,
+// and those made on the iterators of a query under its Iter call:
+//
+//	Query("SELECT name FROM potato WHERE id = ?", []string{"id"})
+//	  Consistency(ONE)
+//	  Bind(1)
+//	  Get(*string) -> nil
+//
+// Bound values are written in Go syntax, destinations by their type and
+// errors by their message. Calls made concurrently on the session are
+// written in the order they were made in, which may change between runs.
+func (mock *SessionxMock) Transcript() string {
+	calls := mock.log.between(0, -1)
+
+	w := &transcriptWriter{seen: map[*callLog]bool{}}
+	for i, call := range calls {
+		w.call(0, call)
+		log := logOf(call.handed)
+		if log == nil {
+			continue
+		}
+
+		to := -1
+		for _, next := range calls[i+1:] {
+			if next.handed == call.handed {
+				to = next.from
+				break
+			}
+		}
+		w.seen[log] = true
+		if query, ok := call.handed.(*QueryxMock); ok {
+			w.seen[&query.root().log] = true
+		}
+		w.calls(1, log.between(call.from, to))
+	}
+
+	return w.b.String()
+}
+
+// AssertTranscript asserts that the transcript of the session matches the
+// golden file at path, or writes it there when UpdateGoldenEnv is set.
+func (mock *SessionxMock) AssertTranscript(t mock.TestingT, path string) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	return AssertGolden(t, path, mock.Transcript())
+}
+
+// loggedCall is a call made on a mock and the values it returned. Calls
+// handing out a query or a batch hold it, and the index of the first call
+// made on it since.
+type loggedCall struct {
+	method    string
+	arguments []interface{}
+	returns   []interface{}
+	handed    interface{}
+	from      int
+}
+
+// callLog records the calls made on a mock, in order, for its transcript.
+type callLog struct {
+	mu    sync.Mutex
+	calls []loggedCall
+}
+
+func (log *callLog) record(method string, arguments, returns []interface{}) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	log.calls = append(log.calls, loggedCall{method: method, arguments: arguments, returns: returns})
+}
+
+// recordHandout records a call handing out handed, a query or a batch.
+func (log *callLog) recordHandout(method string, arguments, returns []interface{}, handed interface{}) {
+	call := loggedCall{method: method, arguments: arguments, returns: returns}
+	if handedLog := logOf(handed); handedLog != nil {
+		call.handed, call.from = handed, handedLog.len()
+	}
+
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	log.calls = append(log.calls, call)
+}
+
+// logOf returns the call log of v, or nil when v is not one of the mocks.
+func logOf(v interface{}) *callLog {
+	switch v := v.(type) {
+	case *QueryxMock:
+		return &v.log
+	case *IterxMock:
+		return &v.log
+	case *BatchxMock:
+		return &v.log
+	default:
+		return nil
+	}
+}
+
+func (log *callLog) len() int {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	return len(log.calls)
+}
+
+// between returns the calls from index from up to index to, or up to the
+// last one when to is negative.
+func (log *callLog) between(from, to int) []loggedCall {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	if to < 0 || to > len(log.calls) {
+		to = len(log.calls)
+	}
+	if from > to {
+		from = to
+	}
+
+	return append([]loggedCall(nil), log.calls[from:to]...)
+}
+
+// transcriptWriter writes calls, followed by the calls made on the queries,
+// iterators and batches they return, once each.
+type transcriptWriter struct {
+	b    strings.Builder
+	seen map[*callLog]bool
+}
+
+func (w *transcriptWriter) calls(depth int, calls []loggedCall) {
+	for _, call := range calls {
+		w.call(depth, call)
+	}
+}
+
+func (w *transcriptWriter) call(depth int, call loggedCall) {
+	var returns []string
+	for _, ret := range call.returns {
+		switch ret := ret.(type) {
+		case errIterx:
+			returns = append(returns, transcriptValue(ret.err, false))
+		case igocqlx.IQueryx, igocqlx.IIterx, IBatchx:
+		default:
+			returns = append(returns, transcriptValue(ret, false))
+		}
+	}
+
+	fmt.Fprintf(&w.b, "%s%s(%s)", strings.Repeat("  ", depth), call.method, strings.Join(transcriptArguments(call), ", "))
+	if len(returns) > 0 {
+		fmt.Fprintf(&w.b, " -> %s", strings.Join(returns, ", "))
+	}
+	w.b.WriteByte('\n')
+
+	if call.handed != nil {
+		return
+	}
+	for _, ret := range call.returns {
+		if log := logOf(ret); log != nil && !w.seen[log] {
+			w.seen[log] = true
+			w.calls(depth+1, log.between(0, -1))
+		}
+	}
+}
+
+// transcriptArguments writes the arguments of call: the values bound to a
+// query and the types of the destinations rows are scanned into.
+func transcriptArguments(call loggedCall) []string {
+	var args []string
+
+	switch call.method {
+	case "Get", "GetRelease", "GetCAS", "GetCASRelease", "Select", "SelectRelease", "Scan", "StructScan", "MapScan", "ExecuteBatchCAS":
+		for _, arg := range call.arguments {
+			if dest, ok := arg.([]interface{}); ok {
+				for _, d := range dest {
+					args = append(args, fmt.Sprintf("%T", d))
+				}
+				continue
+			}
+			if batch, ok := arg.(*BatchxMock); ok {
+				args = append(args, transcriptValue(batch, false))
+				continue
+			}
+			args = append(args, fmt.Sprintf("%T", arg))
+		}
+	case "Bind", "Query":
+		for _, arg := range call.arguments {
+			values, ok := arg.([]interface{})
+			if !ok {
+				args = append(args, transcriptValue(arg, true))
+				continue
+			}
+			for _, value := range values {
+				args = append(args, transcriptValue(value, true))
+			}
+		}
+	case "BindStruct", "BindStructMap", "BindMap":
+		for _, arg := range call.arguments {
+			args = append(args, transcriptValue(arg, true))
+		}
+	default:
+		for _, arg := range call.arguments {
+			args = append(args, transcriptValue(arg, false))
+		}
+	}
+
+	return args
+}
+
+// transcriptValue writes v in Go syntax, unless it has a stable textual
+// form. Pointers are followed when deref is set, and written by their type
+// otherwise, like functions and channels.
+func transcriptValue(v interface{}, deref bool) string {
+	switch v := v.(type) {
+	case nil:
+		return "nil"
+	case context.Context:
+		return "ctx"
+	case error:
+		return fmt.Sprintf("error(%q)", v.Error())
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case []byte:
+		return fmt.Sprintf("0x%x", v)
+	case *QueryxMock:
+		return fmt.Sprintf("Query(%q)", v.statement())
+	case *BatchxMock:
+		return fmt.Sprintf("Batch(%s)", batchTypeName(v.BatchType()))
+	case gocql.BatchType:
+		return batchTypeName(v)
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if deref && !rv.IsNil() {
+			return "&" + transcriptValue(rv.Elem().Interface(), deref)
+		}
+		return fmt.Sprintf("%T", v)
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return fmt.Sprintf("%T", v)
+	default:
+		return fmt.Sprintf("%#v", v)
+	}
+}
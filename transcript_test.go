@@ -0,0 +1,139 @@
+package gocqlxmock
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_Sessionx_Transcript(t *testing.T) {
+	t.Run("Should write every interaction with the session, its queries and iterators", func(t *testing.T) {
+		// arrange
+		sut := makeSessionxSut()
+		stmt := "SELECT name FROM potato WHERE id = ?"
+		names := []string{"id"}
+		querymock := &QueryxMock{}
+		itermock := &IterxMock{}
+		sut.sessionxmock.On("ExecStmt", "TRUNCATE potato").Return(nil)
+		sut.sessionxmock.On("ContextQuery", sut.ctx, stmt, names).Return(querymock)
+		querymock.On("Consistency", gocql.One).Return(querymock)
+		querymock.On("PageSize", 10).Return(querymock)
+		querymock.On("BindStruct", mock.Anything).Return(querymock)
+		querymock.On("Iter").Return(itermock)
+		itermock.On("Scan", mock.Anything).Return(true).Once()
+		itermock.On("Scan", mock.Anything).Return(false).Once()
+		itermock.On("Close").Return(errors.New("potato is gone"))
+		sut.sessionxmock.On("Close").Return()
+
+		// act
+		_ = sut.sessionxmock.ExecStmt("TRUNCATE potato")
+		iter := sut.sessionxmock.ContextQuery(sut.ctx, stmt, names).Consistency(gocql.One).PageSize(10).BindStruct(makeArg("potato")).Iter()
+		var name string
+		for iter.Scan(&name) {
+		}
+		_ = iter.Close()
+		sut.sessionxmock.Close()
+
+		// assert
+		sut.sessionxmock.AssertTranscript(t, "testdata/Test_Sessionx_Transcript.golden")
+	})
+
+	t.Run("Should write the calls of a shared query under the Query call they follow", func(t *testing.T) {
+		// arrange
+		sut := makeSessionxSut()
+		stmt := "UPDATE potato SET name = ? WHERE id = ?"
+		names := []string{"name", "id"}
+		querymock := &QueryxMock{}
+		sut.sessionxmock.On("Query", stmt, names).Return(querymock)
+		querymock.On("Bind", mock.Anything).Return(querymock)
+		querymock.On("Exec").Return(nil)
+		querymock.On("ExecCAS").Return(false, nil)
+
+		// act
+		_ = sut.sessionxmock.Query(stmt, names).Bind("potato", 1).Exec()
+		_, _ = sut.sessionxmock.Query(stmt, names).Bind("tomato", 2).ExecCAS()
+
+		// assert
+		assert.Equal(t, `Query("UPDATE potato SET name = ? WHERE id = ?", []string{"name", "id"})
+  Bind("potato", 1)
+  Exec() -> nil
+Query("UPDATE potato SET name = ? WHERE id = ?", []string{"name", "id"})
+  Bind("tomato", 2)
+  ExecCAS() -> false, nil
+`, sut.sessionxmock.Transcript())
+	})
+
+	t.Run("Should write the calls of each isolated query apart", func(t *testing.T) {
+		// arrange
+		sut := makeSessionxSut()
+		querymock := &QueryxMock{}
+		sut.sessionxmock.IsolateQueries()
+		sut.sessionxmock.On("Query", sut.stmt, sut.names).Return(querymock)
+		querymock.On("BindMap", mock.Anything).Return(querymock)
+		querymock.On("Get", mock.Anything).Return(gocql.ErrNotFound)
+
+		// act
+		first := sut.sessionxmock.Query(sut.stmt, sut.names)
+		second := sut.sessionxmock.Query(sut.stmt, sut.names)
+		var potato Potato
+		_ = second.BindMap(map[string]interface{}{"name1": 2, "name2": []byte("b")}).Get(&potato)
+		_ = first.BindMap(map[string]interface{}{"name1": 1}).Get(&potato)
+
+		// assert
+		assert.Equal(t, `Query("statement", []string{"name1", "name2"})
+  BindMap(map[string]interface {}{"name1":1})
+  Get(*gocqlxmock.Potato) -> error("not found")
+Query("statement", []string{"name1", "name2"})
+  BindMap(map[string]interface {}{"name1":2, "name2":[]uint8{0x62}})
+  Get(*gocqlxmock.Potato) -> error("not found")
+`, sut.sessionxmock.Transcript())
+	})
+}
+
+func Test_Sessionx_Transcript_Batch(t *testing.T) {
+	t.Run("Should write the calls of a batch under the NewBatch call", func(t *testing.T) {
+		// arrange
+		sut := makeBatchSut(gocql.LoggedBatch)
+		sut.batchmock.On("Query", "DELETE FROM potato WHERE id = ?", []interface{}{3}).Return()
+		query := sut.sessionmock.Query(sut.stmt, sut.names)
+		batch := sut.sessionmock.NewBatch(gocql.LoggedBatch)
+
+		// act
+		_ = batch.BindStruct(query, potato{1, 1, "first"})
+		_ = batch.BindStruct(query, struct{ ID int }{2})
+		batch.Query("DELETE FROM potato WHERE id = ?", 3)
+		_ = sut.sessionmock.ExecuteBatch(batch)
+
+		// assert
+		assert.Equal(t, `Query("INSERT INTO potato (id, day, name) VALUES (?, ?, ?)", []string{"id", "day", "name"})
+NewBatch(LOGGED)
+  BindStruct(Query("INSERT INTO potato (id, day, name) VALUES (?, ?, ?)"), gocqlxmock.potato{ID:1, Day:1, Name:"first"}) -> nil
+  BindStruct(Query("INSERT INTO potato (id, day, name) VALUES (?, ?, ?)"), struct { ID int }{ID:2}) -> error("bind error: could not find name \"day\" in struct { ID int }{ID:2} and map[string]interface {}(nil)")
+  Query("DELETE FROM potato WHERE id = ?", 3)
+ExecuteBatch(Batch(LOGGED)) -> nil
+`, sut.sessionmock.Transcript())
+	})
+}
+
+func Test_Sessionx_Transcript_TerminalCall(t *testing.T) {
+	t.Run("Should write the error of a terminal call whose scan failed", func(t *testing.T) {
+		// arrange
+		sut := makeSessionxSut()
+		sut.sessionxmock.On("Query", sut.stmt, sut.names).Return(sut.querymock)
+		sut.querymock.On("Get", mock.Anything).Return(nil)
+		sut.querymock.WithRows(NewRows("name text"))
+
+		// act
+		var name string
+		err := sut.sessionxmock.Query(sut.stmt, sut.names).Get(&name)
+
+		// assert
+		assert.ErrorIs(t, err, gocql.ErrNotFound)
+		assert.Equal(t, `Query("statement", []string{"name1", "name2"})
+  Get(*string) -> error("not found")
+`, sut.sessionxmock.Transcript())
+	})
+}
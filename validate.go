@@ -0,0 +1,139 @@
+package gocqlxmock
+
+// Validate checks the DML statement stmt against the schema, unqualified
+// names referring to keyspace, failing like Scylla on unknown keyspaces,
+// tables and columns.
+func (schema *Schema) Validate(keyspace, stmt string) error {
+	parsed, err := parseDML(stmt)
+	if err != nil {
+		return err
+	}
+
+	ks, name := statementName(parsed.stmt)
+	schema.mu.RLock()
+	metadata, err := schema.lookupKeyspace(ks, keyspace)
+	schema.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	table, err := schema.Table(metadata.Name, name)
+	if err != nil {
+		return err
+	}
+	for _, column := range referencedColumns(parsed.stmt) {
+		if _, err := tableColumn(table, column); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// referencedColumns returns the names of the columns a DML statement refers
+// to.
+func referencedColumns(stmt interface{}) []string {
+	var columns []string
+	relations := func(rels []relation) {
+		for _, rel := range rels {
+			columns = append(columns, rel.column)
+		}
+	}
+
+	switch stmt := stmt.(type) {
+	case *selectStmt:
+		for _, sel := range stmt.selectors {
+			if sel.column != "" {
+				columns = append(columns, sel.column)
+			}
+		}
+		relations(stmt.where)
+		columns = append(columns, stmt.orderBy...)
+	case *insertStmt:
+		columns = append(columns, stmt.columns...)
+	case *updateStmt:
+		for _, a := range stmt.assignments {
+			columns = append(columns, a.column)
+		}
+		relations(stmt.where)
+		relations(stmt.conditions)
+	case *deleteStmt:
+		for _, del := range stmt.columns {
+			columns = append(columns, del.column)
+		}
+		relations(stmt.where)
+		relations(stmt.conditions)
+	}
+
+	return columns
+}
+
+// WithSchema makes the session schema-aware. ExecStmt checks statements
+// against schema, returning Scylla's error without calling the mock when they
+// do not fit it, and applies DDL statements to schema once the mock returned
+// no error. The terminal calls of the queries handed out by the session check
+// and apply their statements the same way. Queries are handed out as views,
+// as with IsolateQueries, so that each keeps the outcome of its own
+// statement. Unqualified names refer to the keyspace of the session.
+func (mock *SessionxMock) WithSchema(schema *Schema) *SessionxMock {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	mock.schema = schema
+
+	return mock
+}
+
+// Schema returns the schema of the session, nil unless it is schema-aware.
+func (mock *SessionxMock) Schema() *Schema {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	return mock.schema
+}
+
+// validate checks stmt against the schema of the session, leaving it
+// unchanged.
+func (mock *SessionxMock) validate(stmt string) error {
+	mock.mu.Lock()
+	schema, keyspace := mock.schema, mock.keyspaceName
+	mock.mu.Unlock()
+
+	if schema == nil {
+		return nil
+	}
+
+	switch kind, _ := classify(stmt); kind {
+	case StatementSchema:
+		return schema.dryRun(keyspace, stmt)
+	case StatementSelect, StatementInsert, StatementUpdate, StatementDelete:
+		return schema.Validate(keyspace, stmt)
+	default:
+		return nil
+	}
+}
+
+// applySchema applies stmt to the schema of the session if it is a DDL
+// statement, once it was executed.
+func (mock *SessionxMock) applySchema(stmt string) error {
+	mock.mu.Lock()
+	schema, keyspace := mock.schema, mock.keyspaceName
+	mock.mu.Unlock()
+
+	if kind, _ := classify(stmt); schema == nil || kind != StatementSchema {
+		return nil
+	}
+
+	return schema.Exec(keyspace, stmt)
+}
+
+// dryRun runs the DDL statement stmt against a copy of the schema, failing
+// like Exec but leaving the schema unchanged.
+func (schema *Schema) dryRun(keyspace, stmt string) error {
+	schema.mu.RLock()
+	defer schema.mu.RUnlock()
+
+	_, err := schema.stage(keyspace, stmt)
+
+	return err
+}
@@ -0,0 +1,151 @@
+package gocqlxmock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func makeValidateSut(t *testing.T) sessionXSut {
+	sut := makeSessionxSut()
+	sut.sessionxmock.WithKeyspace("ks").WithSchema(makeSchemaSut(t))
+	if err := sut.sessionxmock.Schema().Exec("ks", "CREATE TABLE potato (id int PRIMARY KEY, name text)"); err != nil {
+		t.Fatal(err)
+	}
+
+	return sut
+}
+
+func Test_Schema_Validate(t *testing.T) {
+	schema := makeSchemaSut(t)
+	if err := schema.Exec("ks", "CREATE TABLE potato (id int, day int, name text, PRIMARY KEY (id, day))"); err != nil {
+		t.Fatal(err)
+	}
+
+	for stmt, expected := range map[string]string{
+		"SELECT id, count(*) FROM potato WHERE id = ? ORDER BY day": "",
+		"SELECT * FROM larry.potato":                                "Keyspace larry doesn't exist",
+		"SELECT * FROM tomato":                                      "unconfigured table tomato",
+		"SELECT color FROM potato":                                  "Undefined column name color",
+		"SELECT * FROM potato WHERE color = ?":                      "Undefined column name color",
+		"SELECT * FROM potato WHERE id = ? ORDER BY hour":           "Undefined column name hour",
+		"INSERT INTO potato (id, day, color) VALUES (?, ?, ?)":      "Undefined column name color",
+		"UPDATE potato SET color = ? WHERE id = ? AND day = ?":      "Undefined column name color",
+		"UPDATE potato SET name = ? WHERE id = ? IF color = ?":      "Undefined column name color",
+		"DELETE color FROM potato WHERE id = ?":                     "Undefined column name color",
+	} {
+		t.Run("Should validate "+stmt, func(t *testing.T) {
+			// act
+			err := schema.Validate("ks", stmt)
+
+			// assert
+			if expected == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, expected)
+			}
+		})
+	}
+}
+
+func Test_Sessionx_WithSchema(t *testing.T) {
+	t.Run("Should apply DDL statements given to ExecStmt", func(t *testing.T) {
+		// arrange
+		sut := makeValidateSut(t)
+		sut.sessionxmock.On("ExecStmt", mock.Anything).Return(nil)
+
+		// act
+		err := sut.sessionxmock.ExecStmt("ALTER TABLE potato ADD color text")
+
+		// assert
+		assert.NoError(t, err)
+		sut.sessionxmock.AssertNumberOfCalls(t, "ExecStmt", 1)
+		table, _ := sut.sessionxmock.Schema().Table("ks", "potato")
+		assert.Contains(t, table.Columns, "color")
+	})
+
+	t.Run("Should fail invalid statements given to ExecStmt without calling the mock", func(t *testing.T) {
+		// arrange
+		sut := makeValidateSut(t)
+
+		// act
+		errDDL := sut.sessionxmock.ExecStmt("CREATE TABLE potato (id int PRIMARY KEY)")
+		errDML := sut.sessionxmock.ExecStmt("INSERT INTO tomato (id) VALUES (1)")
+
+		// assert
+		assert.EqualError(t, errDDL, "Cannot add already existing table \"potato\" to keyspace \"ks\"")
+		assert.EqualError(t, errDML, "unconfigured table tomato")
+		sut.sessionxmock.AssertNotCalled(t, "ExecStmt", mock.Anything)
+	})
+
+	t.Run("Should fail the terminal calls of invalid queries", func(t *testing.T) {
+		// arrange
+		sut := makeValidateSut(t)
+		sut.sessionxmock.On("Query", mock.Anything, sut.names).Return(sut.querymock)
+		sut.sessionxmock.On("ContextQuery", sut.ctx, mock.Anything, sut.names).Return(sut.querymock)
+		sut.querymock.On("Exec").Return(nil)
+		sut.querymock.On("Iter").Return(&IterxMock{})
+
+		// act
+		errValid := sut.sessionxmock.Query("INSERT INTO potato (id, name) VALUES (?, ?)", sut.names).Exec()
+		errColumn := sut.sessionxmock.Query("INSERT INTO potato (id, color) VALUES (?, ?)", sut.names).Exec()
+		iter := sut.sessionxmock.ContextQuery(sut.ctx, "SELECT * FROM tomato", sut.names).Iter()
+
+		// assert
+		assert.NoError(t, errValid)
+		assert.EqualError(t, errColumn, "Undefined column name color")
+		assert.EqualError(t, iter.Close(), "unconfigured table tomato")
+		sut.querymock.AssertNumberOfCalls(t, "Exec", 1)
+		sut.querymock.AssertNotCalled(t, "Iter")
+	})
+	t.Run("Should not apply DDL statements the mock fails", func(t *testing.T) {
+		// arrange
+		sut := makeValidateSut(t)
+		sut.sessionxmock.On("ExecStmt", mock.Anything).Return(sut.err)
+
+		// act
+		err := sut.sessionxmock.ExecStmt("ALTER TABLE potato ADD color text")
+
+		// assert
+		assert.Equal(t, sut.err, err)
+		table, _ := sut.sessionxmock.Schema().Table("ks", "potato")
+		assert.NotContains(t, table.Columns, "color")
+	})
+
+	t.Run("Should apply the DDL statements of queries once executed", func(t *testing.T) {
+		// arrange
+		sut := makeValidateSut(t)
+		sut.sessionxmock.On("Query", mock.Anything, sut.names).Return(sut.querymock)
+		sut.querymock.On("Exec").Return(nil)
+
+		// act
+		query := sut.sessionxmock.Query("ALTER TABLE potato ADD color text", sut.names)
+		before, _ := sut.sessionxmock.Schema().Table("ks", "potato")
+		err := query.Exec()
+		after, _ := sut.sessionxmock.Schema().Table("ks", "potato")
+
+		// assert
+		assert.NoError(t, err)
+		assert.NotContains(t, before.Columns, "color")
+		assert.Contains(t, after.Columns, "color")
+	})
+
+	t.Run("Should keep the outcome of each query apart", func(t *testing.T) {
+		// arrange
+		sut := makeValidateSut(t)
+		sut.sessionxmock.On("Query", mock.Anything, sut.names).Return(sut.querymock)
+		sut.querymock.On("Exec").Return(nil)
+
+		// act
+		valid := sut.sessionxmock.Query("INSERT INTO potato (id, name) VALUES (?, ?)", sut.names)
+		invalid := sut.sessionxmock.Query("INSERT INTO potato (id, color) VALUES (?, ?)", sut.names)
+		errValid := valid.Exec()
+		errInvalid := invalid.Exec()
+
+		// assert
+		assert.NoError(t, errValid)
+		assert.EqualError(t, errInvalid, "Undefined column name color")
+		sut.querymock.AssertNumberOfCalls(t, "Exec", 1)
+	})
+}
@@ -0,0 +1,439 @@
+package gocqlxmock
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/scylladb/gocqlx/v2"
+	"gopkg.in/inf.v0"
+)
+
+// evaluator evaluates the terms of a statement against its bind values.
+type evaluator struct {
+	values []interface{}
+	// now is the time of the server, used by functions such as now().
+	now time.Time
+}
+
+// errUnset is returned for terms bound to gocql.UnsetValue.
+var errUnset = fmt.Errorf("unset value")
+
+// bytes returns the serialized value of t as typ, nil for null.
+func (ev evaluator) bytes(t term, typ gocql.TypeInfo) ([]byte, error) {
+	value, err := ev.value(t, typ)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	data, err := gocql.Marshal(typ, value)
+	if err != nil {
+		return nil, invalidf("%s", err)
+	}
+
+	return canonical(typ, data), nil
+}
+
+// value returns the Go value of t, ready to be marshalled as typ.
+func (ev evaluator) value(t term, typ gocql.TypeInfo) (interface{}, error) {
+	switch t.kind {
+	case termMarker:
+		if t.marker >= len(ev.values) {
+			return nil, invalidf("Invalid amount of bind variables: expected %d, got %d", t.marker+1, len(ev.values))
+		}
+
+		value := ev.values[t.marker]
+		if value == gocql.UnsetValue {
+			return nil, errUnset
+		}
+		if _, ok := value.(gocqlx.UDT); ok {
+			return makeUDT(reflect.ValueOf(value), false), nil
+		}
+		return value, nil
+	case termLiteral:
+		return literalValue(t.literal, typ)
+	case termFunction:
+		return ev.function(t, typ)
+	case termList, termSet:
+		collection, ok := typ.(gocql.CollectionType)
+		if !ok || collection.Type() == gocql.TypeMap && len(t.elems) > 0 {
+			return nil, invalidf("Invalid collection literal for type %s", typ)
+		}
+		if collection.Type() == gocql.TypeMap {
+			return map[interface{}]interface{}{}, nil
+		}
+
+		elems := make([]interface{}, 0, len(t.elems))
+		for _, elem := range t.elems {
+			value, err := ev.value(elem, collection.Elem)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, value)
+		}
+		return elems, nil
+	case termMap:
+		collection, ok := typ.(gocql.CollectionType)
+		if !ok || collection.Type() != gocql.TypeMap {
+			return nil, invalidf("Invalid map literal for type %s", typ)
+		}
+
+		m := make(map[interface{}]interface{}, len(t.elems)/2)
+		for i := 0; i < len(t.elems); i += 2 {
+			key, err := ev.value(t.elems[i], collection.Key)
+			if err != nil {
+				return nil, err
+			}
+			value, err := ev.value(t.elems[i+1], collection.Elem)
+			if err != nil {
+				return nil, err
+			}
+			m[hashable(key)] = value
+		}
+		return m, nil
+	case termTuple:
+		tuple, ok := typ.(gocql.TupleTypeInfo)
+		if !ok || len(tuple.Elems) < len(t.elems) {
+			return nil, invalidf("Invalid tuple literal for type %s", typ)
+		}
+
+		elems := make([]interface{}, len(tuple.Elems))
+		for i, elem := range t.elems {
+			value, err := ev.value(elem, tuple.Elems[i])
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = value
+		}
+		return elems, nil
+	case termUDT:
+		udt, ok := typ.(gocql.UDTTypeInfo)
+		if !ok {
+			return nil, invalidf("Invalid user type literal for type %s", typ)
+		}
+
+		fields := map[string]interface{}{}
+		for i, name := range t.fields {
+			field, ok := udtField(udt, name)
+			if !ok {
+				return nil, invalidf("Unknown field '%s' in value of user defined type %s", name, udt.Name)
+			}
+			value, err := ev.value(t.elems[i], field.Type)
+			if err != nil {
+				return nil, err
+			}
+			fields[name] = value
+		}
+		for _, field := range udt.Elements {
+			if _, ok := fields[field.Name]; !ok {
+				fields[field.Name] = nil
+			}
+		}
+		return fields, nil
+	default:
+		return nil, invalidf("unsupported value")
+	}
+}
+
+func (ev evaluator) function(t term, typ gocql.TypeInfo) (interface{}, error) {
+	switch t.name {
+	case "now", "currenttimeuuid":
+		return gocql.UUIDFromTime(ev.now), nil
+	case "uuid":
+		return gocql.RandomUUID()
+	case "currenttimestamp":
+		return ev.now, nil
+	case "currentdate":
+		return ev.now.Truncate(24 * time.Hour), nil
+	case "totimestamp", "todate":
+		if len(t.elems) != 1 {
+			return nil, invalidf("Invalid number of arguments in call to function %s: 1 required but %d provided", t.name, len(t.elems))
+		}
+
+		value, err := ev.value(t.elems[0], nativeType(gocql.TypeTimeUUID))
+		if err != nil {
+			return nil, err
+		}
+		id, ok := value.(gocql.UUID)
+		if !ok {
+			return nil, invalidf("Type error: %s cannot be passed as argument 0 of function %s", t.elems[0].literal.text, t.name)
+		}
+		if t.name == "todate" {
+			return id.Time().UTC().Truncate(24 * time.Hour), nil
+		}
+		return id.Time(), nil
+	default:
+		return nil, invalidf("Unknown function '%s'", t.name)
+	}
+}
+
+func nativeType(typ gocql.Type) gocql.TypeInfo {
+	return gocql.NewNativeType(protoVersion, typ, "")
+}
+
+// literalValue returns the Go value of a literal of type typ.
+func literalValue(tok token, typ gocql.TypeInfo) (interface{}, error) {
+	invalid := func() error {
+		kind := "STRING"
+		switch tok.kind {
+		case tokenNumber:
+			kind = "INTEGER"
+			if strings.ContainsAny(tok.text, ".eE") {
+				kind = "FLOAT"
+			}
+		case tokenBlob:
+			kind = "HEX"
+		case tokenUUID:
+			kind = "UUID"
+		case tokenIdent:
+			kind = "BOOLEAN"
+		}
+		return invalidf("Invalid %s constant (%s) for type %s", kind, tok.text, typ)
+	}
+
+	if tok.is("null") {
+		return nil, nil
+	}
+
+	switch typ.Type() {
+	case gocql.TypeAscii, gocql.TypeText, gocql.TypeVarchar:
+		if tok.kind == tokenString {
+			return tok.text, nil
+		}
+	case gocql.TypeBigInt, gocql.TypeCounter, gocql.TypeInt, gocql.TypeSmallInt, gocql.TypeTinyInt:
+		if tok.kind == tokenNumber {
+			n, err := strconv.ParseInt(tok.text, 10, 64)
+			if err != nil {
+				return nil, invalid()
+			}
+			return n, nil
+		}
+	case gocql.TypeVarint:
+		if tok.kind == tokenNumber {
+			n, ok := new(big.Int).SetString(tok.text, 10)
+			if !ok {
+				return nil, invalid()
+			}
+			return n, nil
+		}
+	case gocql.TypeFloat, gocql.TypeDouble, gocql.TypeDecimal:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		switch {
+		case tok.is("NaN"):
+			f, err = math.NaN(), nil
+		case tok.is("Infinity"):
+			f, err = math.Inf(1), nil
+		case tok.kind != tokenNumber:
+			err = invalid()
+		}
+		if err != nil {
+			return nil, invalid()
+		}
+		if typ.Type() == gocql.TypeFloat {
+			return float32(f), nil
+		}
+		if typ.Type() == gocql.TypeDecimal {
+			d, ok := new(inf.Dec).SetString(tok.text)
+			if !ok {
+				return nil, invalid()
+			}
+			return d, nil
+		}
+		return f, nil
+	case gocql.TypeBoolean:
+		if tok.is("true") || tok.is("false") {
+			return tok.is("true"), nil
+		}
+	case gocql.TypeBlob:
+		if tok.kind == tokenBlob {
+			data, err := hex.DecodeString(tok.text[2:])
+			if err != nil {
+				return nil, invalid()
+			}
+			return data, nil
+		}
+	case gocql.TypeUUID, gocql.TypeTimeUUID:
+		if tok.kind == tokenUUID {
+			return gocql.ParseUUID(tok.text)
+		}
+	case gocql.TypeTimestamp:
+		switch tok.kind {
+		case tokenNumber:
+			return strconv.ParseInt(tok.text, 10, 64)
+		case tokenString:
+			if t, ok := parseTimestamp(tok.text); ok {
+				return t, nil
+			}
+		}
+	case gocql.TypeDate:
+		if tok.kind == tokenString {
+			if t, err := time.Parse("2006-01-02", tok.text); err == nil {
+				return t, nil
+			}
+		}
+	case gocql.TypeTime:
+		if tok.kind == tokenString {
+			if t, err := time.Parse("15:04:05.999999999", tok.text); err == nil {
+				return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+					time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond()), nil
+			}
+		}
+	case gocql.TypeInet:
+		if tok.kind == tokenString {
+			if ip := net.ParseIP(tok.text); ip != nil {
+				return ip, nil
+			}
+		}
+	}
+
+	return nil, invalid()
+}
+
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999Z0700",
+	"2006-01-02 15:04:05.999Z0700",
+	"2006-01-02 15:04:05.999Z07:00",
+	"2006-01-02T15:04:05.999",
+	"2006-01-02 15:04:05.999",
+	"2006-01-02 15:04Z0700",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func parseTimestamp(s string) (time.Time, bool) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func udtField(udt gocql.UDTTypeInfo, name string) (gocql.UDTField, bool) {
+	for _, field := range udt.Elements {
+		if field.Name == name {
+			return field, true
+		}
+	}
+
+	return gocql.UDTField{}, false
+}
+
+// hashable returns a value usable as a map key in place of value.
+func hashable(value interface{}) interface{} {
+	if b, ok := value.([]byte); ok {
+		return string(b)
+	}
+
+	return value
+}
+
+// decode returns the Go value of data as typ, nil for null.
+func decode(typ gocql.TypeInfo, data []byte) (interface{}, error) {
+	if data == nil {
+		return nil, nil
+	}
+
+	value := typ.New()
+	if err := gocql.Unmarshal(typ, data, value); err != nil {
+		return nil, err
+	}
+
+	return reflect.ValueOf(value).Elem().Interface(), nil
+}
+
+// compareValues orders two serialized values of type typ the way the
+// database does, null first.
+func compareValues(typ gocql.TypeInfo, a, b []byte) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	x, errA := decode(typ, a)
+	y, errB := decode(typ, b)
+	if errA != nil || errB != nil {
+		return bytes.Compare(a, b)
+	}
+
+	switch x := x.(type) {
+	case gocql.UUID:
+		y := y.(gocql.UUID)
+		if typ.Type() == gocql.TypeTimeUUID || (x.Version() == 1 && y.Version() == 1) {
+			if c := compareTimes(x.Time(), y.Time()); c != 0 {
+				return c
+			}
+		}
+		return bytes.Compare(x[:], y[:])
+	case time.Time:
+		return compareTimes(x, y.(time.Time))
+	case *big.Int:
+		return x.Cmp(y.(*big.Int))
+	case []byte:
+		return bytes.Compare(x, y.([]byte))
+	case string:
+		return strings.Compare(x, y.(string))
+	case bool:
+		switch {
+		case x == y.(bool):
+			return 0
+		case x:
+			return 1
+		default:
+			return -1
+		}
+	}
+
+	vx, vy := reflect.ValueOf(x), reflect.ValueOf(y)
+	switch vx.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareOrdered(vx.Int() < vy.Int(), vx.Int() > vy.Int())
+	case reflect.Float32, reflect.Float64:
+		return compareOrdered(vx.Float() < vy.Float(), vx.Float() > vy.Float())
+	}
+
+	if cmp := vx.MethodByName("Cmp"); cmp.IsValid() {
+		return int(cmp.Call([]reflect.Value{vy})[0].Int())
+	}
+
+	return bytes.Compare(a, b)
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareTimes(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	default:
+		return 0
+	}
+}